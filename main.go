@@ -46,6 +46,69 @@ func init() {
 	viper.SetDefault("InfluxDatabaseHost", "http://localhost:8086")
 	viper.SetDefault("InfluxDatabaseName", "cloudDB")
 
+	viper.SetDefault("AlarmDeadbandPercent", 1.0)
+	viper.SetDefault("AlarmOnDelay", 0)
+	viper.SetDefault("AlarmOffDelay", 0)
+	viper.SetDefault("AlarmReraiseWindow", 600)
+	viper.SetDefault("AlarmStaleInterval", 60)
+	viper.SetDefault("AlarmSettingsTTL", 60)
+	viper.SetDefault("AlarmFloodCount", 10)
+	viper.SetDefault("AlarmFloodMinutes", 10)
+	viper.SetDefault("AlarmChatterCount", 3)
+	viper.SetDefault("AlarmChatterSeconds", 60)
+	viper.SetDefault("AlarmStandingHours", 24)
+	viper.SetDefault("AlarmDedupWindow", 600)
+	viper.SetDefault("AlarmDedupMatch", "episode")
+	viper.SetDefault("AlarmDedupValueTolerance", 0)
+
+	viper.SetDefault("NotifyWorkers", 4)
+	viper.SetDefault("NotifyMaxAttempts", 5)
+	viper.SetDefault("NotifyBackoff", 5)
+	viper.SetDefault("NotifyMaxBackoff", 600)
+	viper.SetDefault("NotifyHTTPTimeout", 10)
+
+	viper.SetDefault("EscalationInterval", 30)
+	viper.SetDefault("MaintenanceInterval", 30)
+
+	viper.SetDefault("ConnectivityGracePeriod", 300)
+	viper.SetDefault("ConnectivityHeartbeat", 30)
+	viper.SetDefault("ReconnectBackoff", 3)
+	viper.SetDefault("ReconnectMaxBackoff", 300)
+	viper.SetDefault("ReconnectJitter", 0.2)
+	viper.SetDefault("ReconnectStableTime", 60)
+
+	viper.SetDefault("SecretRotationGrace", 3600)
+	viper.SetDefault("MessageMaxSkew", 300)
+
+	viper.SetDefault("SyncMaxPayloadSize", 512<<20)
+	viper.SetDefault("SyncChunkSize", 1<<20)
+	viper.SetDefault("SyncMaxDecodedSize", 4<<30)
+	viper.SetDefault("SyncBatchSize", 5000)
+	viper.SetDefault("SyncTempDir", "")
+	viper.SetDefault("SyncWorkers", 4)
+	viper.SetDefault("SyncQueueSize", 16)
+
+	viper.SetDefault("InfluxSpoolDir", "influx_spool")
+	viper.SetDefault("InfluxSpoolSegmentSize", 64<<20)
+	viper.SetDefault("InfluxSpoolInterval", 10)
+	viper.SetDefault("InfluxSpoolBackoff", 5)
+	viper.SetDefault("InfluxSpoolMaxBackoff", 300)
+
+	viper.SetDefault("BackfillInterval", 30)
+	viper.SetDefault("BackfillTimeout", 3600)
+	viper.SetDefault("BackfillGapInterval", 3600)
+	viper.SetDefault("BackfillGapLookback", 86400)
+	viper.SetDefault("BackfillGapBucket", 600)
+	viper.SetDefault("BackfillGapMinimum", 1800)
+	viper.SetDefault("BackfillGapAutoRequest", false)
+
+	viper.SetDefault("ConfigChangeInterval", 30)
+	viper.SetDefault("ConfigChangeResend", 300)
+
+	viper.SetDefault("CommandInterval", 5)
+	viper.SetDefault("CommandTimeout", 30)
+	viper.SetDefault("CommandApprovalTimeout", 900)
+
 	viper.SetConfigName("config")
 	viper.AddConfigPath(".")
 	viper.SetConfigType("json")
@@ -89,9 +152,17 @@ func main() {
 	influxDB, err := influx.Open(influxHost, influxDBName)
 	if err != nil {
 		fmt.Println("ERROR INFLUX: ", err)
-		log.Println("Can't open database INFLUX: %s", err.Error())
+		log.Printf("Can't open database INFLUX: %s", err.Error())
 		return
 	}
+	if spoolDir := viper.GetString("InfluxSpoolDir"); spoolDir != "" {
+		spool, err := influx.OpenSpool(spoolDir, viper.GetInt64("InfluxSpoolSegmentSize"))
+		if err != nil {
+			log.Errorf("Can't open influx spool: %s", err.Error())
+			return
+		}
+		influxDB.SetSpool(spool)
+	}
 
 	client := server.NewServer(host, port, db, influxDB)
 	client.Run()
@@ -0,0 +1,5 @@
+-- Alarm rows now record state machine transitions (raise / re-raise / return to normal).
+ALTER TABLE alarms
+    ADD COLUMN transition VARCHAR(32) NOT NULL DEFAULT 'ALARM_TRANSITION_RAISE' AFTER value;
+
+CREATE INDEX alarms_sensor_type_time ON alarms (sensor_id, alarm_type, time);
@@ -0,0 +1,44 @@
+-- One record per alarm episode instead of one copy per company user.
+-- updated_ts is the sample time of the latest transition, ack/shelve keep their own timestamps.
+ALTER TABLE alarms
+    ADD COLUMN is_active TINYINT(1) NOT NULL DEFAULT 0 AFTER transition,
+    ADD COLUMN is_acked TINYINT(1) NOT NULL DEFAULT 0 AFTER is_active,
+    ADD COLUMN acked_by BIGINT NOT NULL DEFAULT 0 AFTER is_acked,
+    ADD COLUMN acked_ts BIGINT NOT NULL DEFAULT 0 AFTER acked_by,
+    ADD COLUMN ack_comment VARCHAR(1024) NOT NULL DEFAULT '' AFTER acked_ts,
+    ADD COLUMN shelved_by BIGINT NOT NULL DEFAULT 0 AFTER ack_comment,
+    ADD COLUMN shelved_until BIGINT NOT NULL DEFAULT 0 AFTER shelved_by,
+    ADD COLUMN shelve_comment VARCHAR(1024) NOT NULL DEFAULT '' AFTER shelved_until,
+    ADD COLUMN cleared_ts BIGINT NOT NULL DEFAULT 0 AFTER time,
+    ADD COLUMN updated_ts BIGINT NOT NULL DEFAULT 0 AFTER cleared_ts;
+
+-- Collapse the per-user copies into a single record.
+DELETE a FROM alarms a
+    JOIN alarms b
+    ON a.sensor_id = b.sensor_id
+    AND a.alarm_type = b.alarm_type
+    AND a.transition = b.transition
+    AND a.time = b.time
+    AND a.alarm_id > b.alarm_id;
+
+-- Legacy records carry no return-to-normal information, close them.
+UPDATE alarms SET is_active = 0, is_acked = 1, acked_ts = time, cleared_ts = time, updated_ts = time;
+
+ALTER TABLE alarms
+    DROP COLUMN user_id,
+    DROP COLUMN viewed;
+
+CREATE INDEX alarms_sensor_type_updated ON alarms (sensor_id, alarm_type, updated_ts);
+
+CREATE TABLE alarm_history (
+    history_id BIGINT NOT NULL AUTO_INCREMENT,
+    alarm_id BIGINT NOT NULL,
+    action VARCHAR(32) NOT NULL,
+    state VARCHAR(32) NOT NULL,
+    user_id BIGINT NOT NULL DEFAULT 0,
+    comment VARCHAR(1024) NOT NULL DEFAULT '',
+    value FLOAT NOT NULL DEFAULT 0,
+    time BIGINT NOT NULL,
+    PRIMARY KEY (history_id),
+    KEY alarm_history_alarm (alarm_id, time)
+);
@@ -0,0 +1,5 @@
+-- Indexes backing the /alarms/list filters and keyset pagination.
+CREATE INDEX alarms_oil_field_time ON alarms (oil_field_id, time, alarm_id);
+CREATE INDEX alarms_controller_time ON alarms (controller_id, time, alarm_id);
+CREATE INDEX alarms_time ON alarms (time, alarm_id);
+CREATE INDEX alarms_state ON alarms (is_active, is_acked, shelved_until);
@@ -0,0 +1,52 @@
+-- Company notification channels, per-user subscriptions and the delivery log.
+CREATE TABLE notification_channels (
+    channel_id BIGINT NOT NULL AUTO_INCREMENT,
+    company_id BIGINT NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    type VARCHAR(32) NOT NULL,
+    config TEXT NOT NULL,
+    is_enabled TINYINT(1) NOT NULL DEFAULT 1,
+    created_ts BIGINT NOT NULL,
+    updated_ts BIGINT NOT NULL,
+    PRIMARY KEY (channel_id),
+    KEY notification_channels_company (company_id)
+);
+
+-- oil_field_ids and severities are JSON arrays, empty array matches everything.
+-- quiet_from and quiet_to are minutes after midnight in time_zone.
+CREATE TABLE notification_subscriptions (
+    subscription_id BIGINT NOT NULL AUTO_INCREMENT,
+    user_id BIGINT NOT NULL,
+    channel_id BIGINT NOT NULL,
+    address VARCHAR(255) NOT NULL DEFAULT '',
+    oil_field_ids TEXT NOT NULL,
+    severities TEXT NOT NULL,
+    quiet_from INT NOT NULL DEFAULT 0,
+    quiet_to INT NOT NULL DEFAULT 0,
+    time_zone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+    is_enabled TINYINT(1) NOT NULL DEFAULT 1,
+    created_ts BIGINT NOT NULL,
+    updated_ts BIGINT NOT NULL,
+    PRIMARY KEY (subscription_id),
+    KEY notification_subscriptions_user (user_id),
+    KEY notification_subscriptions_channel (channel_id)
+);
+
+CREATE TABLE notification_deliveries (
+    delivery_id BIGINT NOT NULL AUTO_INCREMENT,
+    alarm_id BIGINT NOT NULL,
+    subscription_id BIGINT NOT NULL,
+    channel_id BIGINT NOT NULL,
+    user_id BIGINT NOT NULL,
+    channel_type VARCHAR(32) NOT NULL,
+    address VARCHAR(255) NOT NULL DEFAULT '',
+    status VARCHAR(16) NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    last_error VARCHAR(1024) NOT NULL DEFAULT '',
+    created_ts BIGINT NOT NULL,
+    updated_ts BIGINT NOT NULL,
+    sent_ts BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (delivery_id),
+    KEY notification_deliveries_alarm (alarm_id),
+    KEY notification_deliveries_channel (channel_id, delivery_id)
+);
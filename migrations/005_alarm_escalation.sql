@@ -0,0 +1,45 @@
+-- Escalation policies, on-call rotations and the escalation log.
+ALTER TABLE alarms
+    ADD COLUMN escalation_tier INT NOT NULL DEFAULT 0 AFTER shelve_comment,
+    ADD COLUMN escalated_ts BIGINT NOT NULL DEFAULT 0 AFTER escalation_tier;
+
+CREATE INDEX alarms_unacked ON alarms (is_active, is_acked, escalation_tier);
+
+-- user_ids is a JSON array, users take shifts of shift_hours in that order starting at rotation_start.
+CREATE TABLE on_call_schedules (
+    schedule_id BIGINT NOT NULL AUTO_INCREMENT,
+    company_id BIGINT NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    user_ids TEXT NOT NULL,
+    rotation_start BIGINT NOT NULL,
+    shift_hours INT NOT NULL,
+    created_ts BIGINT NOT NULL,
+    updated_ts BIGINT NOT NULL,
+    PRIMARY KEY (schedule_id),
+    KEY on_call_schedules_company (company_id)
+);
+
+-- oil_field_id 0 is the company wide policy, steps is a JSON array of tiers.
+CREATE TABLE escalation_policies (
+    policy_id BIGINT NOT NULL AUTO_INCREMENT,
+    company_id BIGINT NOT NULL,
+    oil_field_id BIGINT NOT NULL DEFAULT 0,
+    name VARCHAR(255) NOT NULL,
+    steps TEXT NOT NULL,
+    is_enabled TINYINT(1) NOT NULL DEFAULT 1,
+    created_ts BIGINT NOT NULL,
+    updated_ts BIGINT NOT NULL,
+    PRIMARY KEY (policy_id),
+    KEY escalation_policies_company (company_id, oil_field_id)
+);
+
+CREATE TABLE alarm_escalations (
+    escalation_id BIGINT NOT NULL AUTO_INCREMENT,
+    alarm_id BIGINT NOT NULL,
+    policy_id BIGINT NOT NULL,
+    tier INT NOT NULL,
+    user_id BIGINT NOT NULL,
+    time BIGINT NOT NULL,
+    PRIMARY KEY (escalation_id),
+    KEY alarm_escalations_alarm (alarm_id, time)
+);
@@ -0,0 +1,24 @@
+-- Maintenance windows suppressing alarms of an oil field, a controller or a sensor.
+-- Empty controller_id and sensor_id cover the whole oil field.
+CREATE TABLE maintenance_windows (
+    window_id BIGINT NOT NULL AUTO_INCREMENT,
+    oil_field_id BIGINT NOT NULL,
+    controller_id VARCHAR(255) NOT NULL DEFAULT '',
+    sensor_id VARCHAR(255) NOT NULL DEFAULT '',
+    owner_id BIGINT NOT NULL,
+    reason VARCHAR(1024) NOT NULL,
+    start_ts BIGINT NOT NULL,
+    end_ts BIGINT NOT NULL,
+    is_closed TINYINT(1) NOT NULL DEFAULT 0,
+    created_ts BIGINT NOT NULL,
+    updated_ts BIGINT NOT NULL,
+    PRIMARY KEY (window_id),
+    KEY maintenance_windows_oil_field (oil_field_id, is_closed, start_ts, end_ts),
+    KEY maintenance_windows_open (is_closed, end_ts)
+);
+
+ALTER TABLE alarms
+    ADD COLUMN suppression_id BIGINT NOT NULL DEFAULT 0 AFTER escalated_ts,
+    ADD COLUMN released_ts BIGINT NOT NULL DEFAULT 0 AFTER suppression_id;
+
+CREATE INDEX alarms_suppression ON alarms (suppression_id);
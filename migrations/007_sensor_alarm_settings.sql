@@ -0,0 +1,15 @@
+-- Cloud side alarm kinds per sensor, zero values switch a kind off.
+CREATE TABLE sensor_alarm_settings (
+    sensor_id VARCHAR(255) NOT NULL,
+    controller_id VARCHAR(255) NOT NULL,
+    oil_field_id BIGINT NOT NULL,
+    rate_of_change FLOAT NOT NULL DEFAULT 0,
+    stale_minutes INT NOT NULL DEFAULT 0,
+    frozen_minutes INT NOT NULL DEFAULT 0,
+    deviation_sensor_id VARCHAR(255) NOT NULL DEFAULT '',
+    deviation_setpoint FLOAT NOT NULL DEFAULT 0,
+    deviation_limit FLOAT NOT NULL DEFAULT 0,
+    bad_quality TINYINT(1) NOT NULL DEFAULT 0,
+    updated_ts BIGINT NOT NULL,
+    PRIMARY KEY (sensor_id)
+);
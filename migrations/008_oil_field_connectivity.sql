@@ -0,0 +1,10 @@
+-- Connect and disconnect history of the oil field sync connections.
+CREATE TABLE oil_field_connectivity (
+    event_id BIGINT NOT NULL AUTO_INCREMENT,
+    oil_field_id BIGINT NOT NULL,
+    event VARCHAR(16) NOT NULL,
+    address VARCHAR(255) NOT NULL DEFAULT '',
+    time BIGINT NOT NULL,
+    PRIMARY KEY (event_id),
+    KEY oil_field_connectivity_time (oil_field_id, time)
+);
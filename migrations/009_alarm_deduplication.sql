@@ -0,0 +1,90 @@
+-- Raises repeating a recent alarm of the same sensor limit bump its occurrences instead of adding a record.
+ALTER TABLE alarms
+    ADD COLUMN occurrences INT NOT NULL DEFAULT 1 AFTER transition;
+
+-- sensor_id '' is the company wide rule.
+CREATE TABLE alarm_dedup_rules (
+    rule_id BIGINT NOT NULL AUTO_INCREMENT,
+    company_id BIGINT NOT NULL,
+    sensor_id VARCHAR(255) NOT NULL DEFAULT '',
+    window_seconds BIGINT NOT NULL,
+    match_mode VARCHAR(16) NOT NULL,
+    value_tolerance FLOAT NOT NULL DEFAULT 0,
+    created_ts BIGINT NOT NULL,
+    updated_ts BIGINT NOT NULL,
+    PRIMARY KEY (rule_id),
+    UNIQUE KEY alarm_dedup_rules_sensor (company_id, sensor_id)
+);
+
+-- Collapse historical duplicates with the default rule: an alarm raised within 600 seconds after the last
+-- update of an earlier alarm of the same sensor limit belongs to it. Alarms no earlier one reaches start a
+-- group, every other alarm is merged into the latest group start before it.
+CREATE TABLE alarm_dedup_starts AS
+    SELECT a.alarm_id, a.sensor_id, a.alarm_type, a.time
+    FROM alarms a
+    WHERE NOT EXISTS (
+        SELECT 1 FROM alarms p
+        WHERE p.sensor_id = a.sensor_id
+        AND p.alarm_type = a.alarm_type
+        AND (p.time < a.time OR (p.time = a.time AND p.alarm_id < a.alarm_id))
+        AND p.updated_ts + 600 >= a.time
+    );
+
+CREATE INDEX alarm_dedup_starts_sensor ON alarm_dedup_starts (sensor_id, alarm_type, time, alarm_id);
+
+CREATE TABLE alarm_dedup_duplicates AS
+    SELECT a.alarm_id, (
+        SELECT s.alarm_id FROM alarm_dedup_starts s
+        WHERE s.sensor_id = a.sensor_id
+        AND s.alarm_type = a.alarm_type
+        AND (s.time < a.time OR (s.time = a.time AND s.alarm_id <= a.alarm_id))
+        ORDER BY s.time DESC, s.alarm_id DESC
+        LIMIT 1
+    ) AS keep_id
+    FROM alarms a;
+
+DELETE FROM alarm_dedup_duplicates WHERE keep_id IS NULL OR alarm_id = keep_id;
+
+-- The kept alarm takes the state of the latest alarm of its group.
+UPDATE alarms k
+    JOIN (
+        SELECT d.keep_id, COUNT(*) AS duplicates, MAX(d.alarm_id) AS last_id
+        FROM alarm_dedup_duplicates d
+        GROUP BY d.keep_id
+    ) g
+    ON k.alarm_id = g.keep_id
+    JOIN alarms l
+    ON l.alarm_id = g.last_id
+    SET k.occurrences = k.occurrences + g.duplicates,
+        k.alarm_value = l.alarm_value,
+        k.value = l.value,
+        k.transition = l.transition,
+        k.is_active = l.is_active,
+        k.is_acked = l.is_acked,
+        k.acked_by = l.acked_by,
+        k.acked_ts = l.acked_ts,
+        k.ack_comment = l.ack_comment,
+        k.cleared_ts = l.cleared_ts,
+        k.updated_ts = l.updated_ts;
+
+UPDATE alarm_history h
+    JOIN alarm_dedup_duplicates d
+    ON h.alarm_id = d.alarm_id
+    SET h.alarm_id = d.keep_id;
+
+UPDATE alarm_escalations e
+    JOIN alarm_dedup_duplicates d
+    ON e.alarm_id = d.alarm_id
+    SET e.alarm_id = d.keep_id;
+
+UPDATE notification_deliveries n
+    JOIN alarm_dedup_duplicates d
+    ON n.alarm_id = d.alarm_id
+    SET n.alarm_id = d.keep_id;
+
+DELETE a FROM alarms a
+    JOIN alarm_dedup_duplicates d
+    ON a.alarm_id = d.alarm_id;
+
+DROP TABLE alarm_dedup_duplicates;
+DROP TABLE alarm_dedup_starts;
@@ -0,0 +1,4 @@
+-- Field gateways behind NAT dial into the cloud instead of being dialed, gateway_token is the MD5 of the credential.
+ALTER TABLE oil_field
+    ADD COLUMN connection_mode VARCHAR(16) NOT NULL DEFAULT 'dial' AFTER lon,
+    ADD COLUMN gateway_token VARCHAR(64) NOT NULL DEFAULT '' AFTER connection_mode;
@@ -0,0 +1,7 @@
+-- Shared secrets signing the field link, the previous secret stays valid for a grace period after a rotation.
+ALTER TABLE oil_field
+    ADD COLUMN shared_secret VARCHAR(128) NOT NULL DEFAULT '' AFTER gateway_token,
+    ADD COLUMN previous_secret VARCHAR(128) NOT NULL DEFAULT '' AFTER shared_secret,
+    ADD COLUMN secret_rotated_ts BIGINT NOT NULL DEFAULT 0 AFTER previous_secret,
+    ADD COLUMN client_cert_cn VARCHAR(255) NOT NULL DEFAULT '' AFTER secret_rotated_ts,
+    ADD COLUMN use_tls TINYINT(1) NOT NULL DEFAULT 0 AFTER client_cert_cn;
@@ -0,0 +1,17 @@
+-- Ledger of the sync files of the oil fields, a file already ingested is acked without storing it again.
+CREATE TABLE sync_files (
+    file_id BIGINT NOT NULL AUTO_INCREMENT,
+    oil_field_id BIGINT NOT NULL,
+    file_name VARCHAR(255) NOT NULL,
+    checksum CHAR(64) NOT NULL DEFAULT '',
+    points INT NOT NULL DEFAULT 0,
+    status VARCHAR(16) NOT NULL,
+    error_code VARCHAR(32) NOT NULL DEFAULT '',
+    error VARCHAR(1024) NOT NULL DEFAULT '',
+    attempts INT NOT NULL DEFAULT 0,
+    created_ts BIGINT NOT NULL,
+    updated_ts BIGINT NOT NULL,
+    PRIMARY KEY (file_id),
+    UNIQUE KEY sync_files_file (oil_field_id, file_name, checksum),
+    KEY sync_files_updated (updated_ts)
+);
@@ -0,0 +1,23 @@
+-- Requests to the oil fields to resend the samples of a time range, proposed by gap detection or made by an admin.
+CREATE TABLE backfills (
+    backfill_id BIGINT NOT NULL AUTO_INCREMENT,
+    oil_field_id BIGINT NOT NULL,
+    controller_id VARCHAR(255) NOT NULL DEFAULT '',
+    sensor_ids TEXT NOT NULL,
+    from_ts BIGINT NOT NULL,
+    to_ts BIGINT NOT NULL,
+    status VARCHAR(16) NOT NULL,
+    source VARCHAR(16) NOT NULL,
+    requested_by BIGINT NOT NULL DEFAULT 0,
+    files INT NOT NULL DEFAULT 0,
+    expected_files INT NOT NULL DEFAULT 0,
+    points BIGINT NOT NULL DEFAULT 0,
+    error TEXT NOT NULL,
+    requested_ts BIGINT NOT NULL DEFAULT 0,
+    completed_ts BIGINT NOT NULL DEFAULT 0,
+    created_ts BIGINT NOT NULL,
+    updated_ts BIGINT NOT NULL,
+    PRIMARY KEY (backfill_id),
+    KEY backfills_oil_field (oil_field_id, from_ts),
+    KEY backfills_status (status, updated_ts)
+);
@@ -0,0 +1,20 @@
+-- Controller and sensor settings edited in the cloud on their way to the oil field, acked by the field.
+CREATE TABLE config_changes (
+    change_id BIGINT NOT NULL AUTO_INCREMENT,
+    oil_field_id BIGINT NOT NULL,
+    target_type VARCHAR(16) NOT NULL,
+    target_id VARCHAR(255) NOT NULL,
+    config TEXT NOT NULL,
+    status VARCHAR(16) NOT NULL,
+    error TEXT NOT NULL,
+    requested_by BIGINT NOT NULL DEFAULT 0,
+    updated_ts BIGINT NOT NULL,
+    field_ts BIGINT NOT NULL DEFAULT 0,
+    sent_ts BIGINT NOT NULL DEFAULT 0,
+    acked_ts BIGINT NOT NULL DEFAULT 0,
+    created_ts BIGINT NOT NULL,
+    PRIMARY KEY (change_id),
+    KEY config_changes_target (target_type, target_id, status),
+    KEY config_changes_status (status, sent_ts),
+    KEY config_changes_oil_field (oil_field_id)
+);
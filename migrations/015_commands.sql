@@ -0,0 +1,29 @@
+-- Remote write commands to field controllers with their approval and result, kept as the audit trail.
+CREATE TABLE commands (
+    command_id BIGINT NOT NULL AUTO_INCREMENT,
+    oil_field_id BIGINT NOT NULL,
+    controller_id VARCHAR(255) NOT NULL,
+    sensor_id VARCHAR(255) NOT NULL,
+    action VARCHAR(16) NOT NULL,
+    value FLOAT NOT NULL DEFAULT 0,
+    expected_value FLOAT NOT NULL DEFAULT 0,
+    tolerance FLOAT NOT NULL DEFAULT 0,
+    timeout BIGINT NOT NULL,
+    comment VARCHAR(1024) NOT NULL DEFAULT '',
+    status VARCHAR(32) NOT NULL,
+    readback FLOAT NOT NULL DEFAULT 0,
+    error TEXT NOT NULL,
+    issued_by BIGINT NOT NULL,
+    approved_by BIGINT NOT NULL DEFAULT 0,
+    created_ts BIGINT NOT NULL,
+    approved_ts BIGINT NOT NULL DEFAULT 0,
+    sent_ts BIGINT NOT NULL DEFAULT 0,
+    completed_ts BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (command_id),
+    KEY commands_oil_field (oil_field_id, command_id),
+    KEY commands_status (status)
+);
+
+-- Commands to critical sensors need the approval of a second user.
+ALTER TABLE sensors
+    ADD COLUMN is_critical TINYINT(1) NOT NULL DEFAULT 0;
@@ -0,0 +1,8 @@
+-- Controllers and sensors missing from the full config of their oil field are marked deleted, their history kept.
+ALTER TABLE controllers
+    ADD COLUMN is_deleted TINYINT(1) NOT NULL DEFAULT 0,
+    ADD COLUMN deleted_ts BIGINT NOT NULL DEFAULT 0;
+
+ALTER TABLE sensors
+    ADD COLUMN is_deleted TINYINT(1) NOT NULL DEFAULT 0,
+    ADD COLUMN deleted_ts BIGINT NOT NULL DEFAULT 0;
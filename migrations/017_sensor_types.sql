@@ -0,0 +1,6 @@
+-- Sensors hold a bool, int, enum or string value besides float, alarm_states raise a state alarm.
+-- enum_labels is a JSON object of code to label, alarm_states a JSON array.
+ALTER TABLE sensors
+    ADD COLUMN value_type VARCHAR(16) NOT NULL DEFAULT 'float',
+    ADD COLUMN enum_labels TEXT NOT NULL,
+    ADD COLUMN alarm_states TEXT NOT NULL;
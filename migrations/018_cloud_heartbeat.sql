@@ -0,0 +1,6 @@
+-- Last time the cloud was known to run, the connectivity of the oil fields is unknown from then until the restart.
+CREATE TABLE cloud_heartbeat (
+    heartbeat_id INT NOT NULL,
+    time BIGINT NOT NULL,
+    PRIMARY KEY (heartbeat_id)
+);
@@ -0,0 +1,6 @@
+-- Messages of an oil field without a secret are only accepted when it is allowed explicitly.
+ALTER TABLE oil_field
+    ADD COLUMN allow_unsigned TINYINT(1) NOT NULL DEFAULT 0 AFTER use_tls;
+
+-- Fields without a secret synced unsigned until now, they keep syncing until a secret is rotated in.
+UPDATE oil_field SET allow_unsigned=1 WHERE shared_secret IS NULL OR shared_secret='';
@@ -0,0 +1,2 @@
+-- Pending deliveries are queued again when the server starts, their retry timers do not survive a restart.
+CREATE INDEX notification_deliveries_status ON notification_deliveries (status, delivery_id);
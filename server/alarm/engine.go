@@ -0,0 +1,488 @@
+package alarm
+
+import (
+	"context"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+	"gitlab.citicom.kz/CloudServer/server/icontext"
+	"gitlab.citicom.kz/CloudServer/server/models"
+)
+
+// Store - persisted alarm history the engine restores its state from and the cloud side sensor settings.
+type Store interface {
+	GetLatestAlarms(ctx context.Context, sensorID string) ([]*models.AlarmResult, error)
+	GetSensorAlarmSettings(ctx context.Context) ([]*models.SensorAlarmSettings, error)
+}
+
+type Config struct {
+	DeadbandPercent float32
+	OnDelay         int64
+	OffDelay        int64
+	ReraiseWindow   int64
+}
+
+func configFromViper() Config {
+	return Config{
+		DeadbandPercent: float32(viper.GetFloat64("AlarmDeadbandPercent")),
+		OnDelay:         viper.GetInt64("AlarmOnDelay"),
+		OffDelay:        viper.GetInt64("AlarmOffDelay"),
+		ReraiseWindow:   viper.GetInt64("AlarmReraiseWindow"),
+	}
+}
+
+type limitState struct {
+	active       bool
+	pendingSince int64
+	lastTime     int64
+	lastReturn   int64
+}
+
+// sensorState - latest sample of a sensor, used by the kinds comparing a sample with the previous ones.
+type sensorState struct {
+	seen       bool
+	lastTime   int64
+	lastValue  float32
+	lastChange int64
+}
+
+// condition - evaluation of one alarm kind for a sample.
+type condition struct {
+	alarmType  string
+	alarmValue float32
+	breached   bool
+	cleared    bool
+}
+
+// Engine - per sensor and per limit alarm state machine.
+type Engine struct {
+	mu        sync.Mutex
+	store     Store
+	states    map[string]*limitState
+	restored  map[string]bool
+	sensors   map[string]*sensorState
+	startedTs int64
+
+	settingsMu       sync.Mutex
+	cachedSettings   map[string]*models.SensorAlarmSettings
+	settingsLoadedTs int64
+}
+
+func NewEngine(store Store) *Engine {
+	return &Engine{
+		store:     store,
+		states:    make(map[string]*limitState),
+		restored:  make(map[string]bool),
+		sensors:   make(map[string]*sensorState),
+		startedTs: time.Now().Unix(),
+	}
+}
+
+// Evaluate - feeds samples through the state machine and returns the transitions they caused.
+func (engine *Engine) Evaluate(ctx context.Context, samples []*models.SensorSample) []*models.Alarm {
+	config := configFromViper()
+	settings := engine.settings(ctx)
+
+	// time order first so deviation alarms compare with the reference value of the same moment
+	sorted := make([]*models.SensorSample, len(samples))
+	copy(sorted, samples)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Time != sorted[j].Time {
+			return sorted[i].Time < sorted[j].Time
+		}
+		return sorted[i].SensorID < sorted[j].SensorID
+	})
+
+	sensorIDs := make([]string, 0, len(sorted))
+	for _, sample := range sorted {
+		if sample.Sensor != nil && sample.Sensor.IsEnabled {
+			sensorIDs = append(sensorIDs, sample.SensorID)
+		}
+	}
+	engine.restore(ctx, sensorIDs)
+
+	engine.mu.Lock()
+	defer engine.mu.Unlock()
+
+	now := time.Now().Unix()
+	alarms := make([]*models.Alarm, 0, 10)
+	for _, sample := range sorted {
+		// a sensor whose state could not be restored is evaluated with its next samples
+		if sample.Sensor == nil || !sample.Sensor.IsEnabled || !engine.restored[sample.SensorID] {
+			continue
+		}
+
+		deadband := (sample.Sensor.RangeH - sample.Sensor.RangeL) * config.DeadbandPercent / 100
+		if deadband < 0 {
+			deadband = 0
+		}
+
+		sensor := engine.sensor(sample.SensorID)
+		sensorSettings := settings[sample.SensorID]
+
+		for _, cond := range engine.conditions(sample, sensor, sensorSettings, deadband) {
+			state := engine.state(sample.SensorID, cond.alarmType)
+			if sample.Time <= state.lastTime {
+				continue
+			}
+			state.lastTime = sample.Time
+
+			transition := state.next(cond.breached, cond.cleared, sample.Time, config)
+			if transition == "" {
+				continue
+			}
+
+			alarms = append(alarms, newAlarm(sample.OilFieldID, sample.ControllerID, sample.SensorID, cond.alarmType, cond.alarmValue, sample.Value, transition, sample.Time))
+		}
+
+		if sensorSettings != nil && sensorSettings.StaleMinutes > 0 && (!sensor.seen || sample.Time > sensor.lastTime) {
+			// fresh data returns a stale alarm, stale transitions are stamped with server time
+			state := engine.state(sample.SensorID, models.ALARM_TYPE_STALE)
+			if state.active {
+				state.active = false
+				state.pendingSince = 0
+				state.lastReturn = now
+				state.lastTime = now
+				alarms = append(alarms, newAlarm(sample.OilFieldID, sample.ControllerID, sample.SensorID, models.ALARM_TYPE_STALE, float32(sensorSettings.StaleMinutes), sample.Value, models.ALARM_TRANSITION_RETURN, now))
+			}
+		}
+
+		engine.track(sensor, sample)
+	}
+
+	return alarms
+}
+
+// CheckStale - raises stale alarms for sensors without a new sample for their StaleMinutes.
+// Sensors not seen since start are measured from the engine start.
+func (engine *Engine) CheckStale(ctx context.Context, now int64) []*models.Alarm {
+	config := configFromViper()
+	settings := engine.settings(ctx)
+
+	sensorIDs := make([]string, 0, len(settings))
+	for sensorID, sensorSettings := range settings {
+		if sensorSettings.StaleMinutes > 0 {
+			sensorIDs = append(sensorIDs, sensorID)
+		}
+	}
+	engine.restore(ctx, sensorIDs)
+
+	engine.mu.Lock()
+	defer engine.mu.Unlock()
+
+	alarms := make([]*models.Alarm, 0, 10)
+	for sensorID, sensorSettings := range settings {
+		if sensorSettings.StaleMinutes <= 0 || !engine.restored[sensorID] {
+			continue
+		}
+
+		sensor := engine.sensor(sensorID)
+		lastTime := engine.startedTs
+		if sensor.seen {
+			lastTime = sensor.lastTime
+		}
+		if now-lastTime < int64(sensorSettings.StaleMinutes)*60 {
+			continue
+		}
+
+		state := engine.state(sensorID, models.ALARM_TYPE_STALE)
+		if state.active {
+			continue
+		}
+		state.active = true
+		state.pendingSince = 0
+		state.lastTime = now
+
+		transition := models.ALARM_TRANSITION_RAISE
+		if state.lastReturn > 0 && now-state.lastReturn <= config.ReraiseWindow {
+			transition = models.ALARM_TRANSITION_RERAISE
+		}
+
+		alarms = append(alarms, newAlarm(sensorSettings.OilFieldID, sensorSettings.ControllerID, sensorID, models.ALARM_TYPE_STALE, float32(sensorSettings.StaleMinutes), sensor.lastValue, transition, now))
+	}
+
+	return alarms
+}
+
+// conditions - evaluates every alarm kind configured for the sensor against the sample.
+func (engine *Engine) conditions(sample *models.SensorSample, sensor *sensorState, settings *models.SensorAlarmSettings, deadband float32) []condition {
+	value := sample.Value
+	conditions := make([]condition, 0, 8)
+
+	if len(sample.Sensor.AlarmStates) > 0 && models.IsDiscreteSensorType(sample.Sensor.ValueType) {
+		alarmState := sample.Sensor.IsAlarmState(sample.State, value)
+		conditions = append(conditions, condition{
+			alarmType:  models.ALARM_TYPE_STATE,
+			alarmValue: value,
+			breached:   alarmState,
+			cleared:    !alarmState,
+		})
+	}
+
+	// bool, enum and string states are not compared with limits or other samples
+	if !models.IsNumericSensorType(sample.Sensor.ValueType) {
+		if settings != nil && settings.BadQuality {
+			badSample := sample.Quality == models.SAMPLE_QUALITY_BAD
+			conditions = append(conditions, condition{
+				alarmType: models.ALARM_TYPE_BAD_QUALITY,
+				breached:  badSample,
+				cleared:   !badSample,
+			})
+		}
+		return conditions
+	}
+
+	for _, limit := range sample.Sensor.AlarmLimits() {
+		conditions = append(conditions, condition{
+			alarmType:  limit.AlarmType,
+			alarmValue: limit.Value,
+			breached:   limit.Breached(value),
+			cleared:    limit.Cleared(value, deadband),
+		})
+	}
+
+	if settings == nil {
+		return conditions
+	}
+
+	// out of the sensor range, or read with bad quality by the field
+	badSample := sample.Quality == models.SAMPLE_QUALITY_BAD
+	hasRange := sample.Sensor.RangeH > sample.Sensor.RangeL
+	if settings.BadQuality {
+		var bound float32
+		if hasRange {
+			bound = sample.Sensor.RangeH
+			if value < sample.Sensor.RangeL {
+				bound = sample.Sensor.RangeL
+			}
+		}
+		conditions = append(conditions, condition{
+			alarmType:  models.ALARM_TYPE_BAD_QUALITY,
+			alarmValue: bound,
+			breached:   badSample || (hasRange && (value < sample.Sensor.RangeL || value > sample.Sensor.RangeH)),
+			cleared:    !badSample && (!hasRange || (value >= sample.Sensor.RangeL+deadband && value <= sample.Sensor.RangeH-deadband)),
+		})
+	}
+
+	if settings.RateOfChange > 0 && sensor.seen && sample.Time > sensor.lastTime {
+		rate := float32(math.Abs(float64(value-sensor.lastValue))) / (float32(sample.Time-sensor.lastTime) / 60)
+		conditions = append(conditions, condition{
+			alarmType:  models.ALARM_TYPE_RATE_OF_CHANGE,
+			alarmValue: settings.RateOfChange,
+			breached:   rate > settings.RateOfChange,
+			cleared:    rate <= settings.RateOfChange,
+		})
+	}
+
+	if settings.FrozenMinutes > 0 && sensor.seen && sample.Time > sensor.lastTime {
+		changed := value != sensor.lastValue
+		conditions = append(conditions, condition{
+			alarmType:  models.ALARM_TYPE_FROZEN,
+			alarmValue: float32(settings.FrozenMinutes),
+			breached:   !changed && sample.Time-sensor.lastChange >= int64(settings.FrozenMinutes)*60,
+			cleared:    changed,
+		})
+	}
+
+	if settings.DeviationLimit > 0 {
+		reference, ok := settings.DeviationSetpoint, true
+		if settings.DeviationSensorID != "" {
+			referenceSensor, exists := engine.sensors[settings.DeviationSensorID]
+			ok = exists && referenceSensor.seen
+			if ok {
+				reference = referenceSensor.lastValue
+			}
+		}
+		if ok {
+			deviation := float32(math.Abs(float64(value - reference)))
+			clearLimit := settings.DeviationLimit - deadband
+			if clearLimit < 0 {
+				clearLimit = 0
+			}
+			conditions = append(conditions, condition{
+				alarmType:  models.ALARM_TYPE_DEVIATION,
+				alarmValue: settings.DeviationLimit,
+				breached:   deviation > settings.DeviationLimit,
+				cleared:    deviation <= clearLimit,
+			})
+		}
+	}
+
+	return conditions
+}
+
+// track - remembers the sample as the latest one of the sensor.
+func (engine *Engine) track(sensor *sensorState, sample *models.SensorSample) {
+	if sensor.seen && sample.Time <= sensor.lastTime {
+		return
+	}
+	if !sensor.seen || sample.Value != sensor.lastValue {
+		sensor.lastChange = sample.Time
+	}
+	sensor.seen = true
+	sensor.lastTime = sample.Time
+	sensor.lastValue = sample.Value
+}
+
+func (state *limitState) next(breached bool, cleared bool, sampleTime int64, config Config) string {
+	if !state.active {
+		if !breached {
+			state.pendingSince = 0
+			return ""
+		}
+		if state.pendingSince == 0 {
+			state.pendingSince = sampleTime
+		}
+		if sampleTime-state.pendingSince < config.OnDelay {
+			return ""
+		}
+
+		state.active = true
+		state.pendingSince = 0
+		if state.lastReturn > 0 && sampleTime-state.lastReturn <= config.ReraiseWindow {
+			return models.ALARM_TRANSITION_RERAISE
+		}
+		return models.ALARM_TRANSITION_RAISE
+	}
+
+	if !cleared {
+		state.pendingSince = 0
+		return ""
+	}
+	if state.pendingSince == 0 {
+		state.pendingSince = sampleTime
+	}
+	if sampleTime-state.pendingSince < config.OffDelay {
+		return ""
+	}
+
+	state.active = false
+	state.pendingSince = 0
+	state.lastReturn = sampleTime
+	return models.ALARM_TRANSITION_RETURN
+}
+
+func newAlarm(oilFieldID int64, controllerID string, sensorID string, alarmType string, alarmValue float32, value float32, transition string, alarmTime int64) *models.Alarm {
+	return &models.Alarm{
+		OilFieldID:   oilFieldID,
+		ControllerID: controllerID,
+		SensorID:     sensorID,
+		AlarmType:    alarmType,
+		AlarmValue:   alarmValue,
+		Value:        value,
+		Transition:   transition,
+		Time:         alarmTime,
+	}
+}
+
+// ReloadSettings - the next evaluation reads the sensor settings from the store again, called when they are saved
+// or sensors are deleted or restored.
+func (engine *Engine) ReloadSettings() {
+	engine.settingsMu.Lock()
+	defer engine.settingsMu.Unlock()
+
+	engine.settingsLoadedTs = 0
+}
+
+// settings - the cloud side sensor settings keyed by sensor id, read from the store at most every
+// AlarmSettingsTTL seconds. The map is shared, callers must not change it. When the store fails the previous
+// settings are kept and read again on the next call.
+func (engine *Engine) settings(ctx context.Context) map[string]*models.SensorAlarmSettings {
+	engine.settingsMu.Lock()
+	defer engine.settingsMu.Unlock()
+
+	now := time.Now().Unix()
+	if engine.settingsLoadedTs > 0 && now-engine.settingsLoadedTs < viper.GetInt64("AlarmSettingsTTL") {
+		return engine.cachedSettings
+	}
+
+	list, err := engine.store.GetSensorAlarmSettings(ctx)
+	if err != nil {
+		if l, ok := icontext.GetLogger(ctx); ok {
+			l.Errorf("Can't receive sensor alarm settings: %s", err.Error())
+		}
+		if engine.cachedSettings == nil {
+			return make(map[string]*models.SensorAlarmSettings)
+		}
+		return engine.cachedSettings
+	}
+
+	settings := make(map[string]*models.SensorAlarmSettings, len(list))
+	for _, item := range list {
+		settings[item.SensorID] = item
+	}
+	engine.cachedSettings = settings
+	engine.settingsLoadedTs = now
+
+	return settings
+}
+
+func (engine *Engine) sensor(sensorID string) *sensorState {
+	sensor, exists := engine.sensors[sensorID]
+	if !exists {
+		sensor = &sensorState{}
+		engine.sensors[sensorID] = sensor
+	}
+
+	return sensor
+}
+
+// restore - restores the states of sensors seen for the first time from the latest stored alarm of each limit.
+// The store is queried without the engine lock, a sensor failing to load is not marked and is retried later.
+func (engine *Engine) restore(ctx context.Context, sensorIDs []string) {
+	engine.mu.Lock()
+	missing := make([]string, 0, len(sensorIDs))
+	for _, sensorID := range sensorIDs {
+		if !engine.restored[sensorID] {
+			missing = append(missing, sensorID)
+		}
+	}
+	engine.mu.Unlock()
+
+	loaded := make(map[string]bool, len(missing))
+	for _, sensorID := range missing {
+		if loaded[sensorID] {
+			continue
+		}
+		loaded[sensorID] = true
+
+		latest, err := engine.store.GetLatestAlarms(ctx, sensorID)
+		if err != nil {
+			if l, ok := icontext.GetLogger(ctx); ok {
+				l.Errorf("Can't restore alarm state of sensor %s: %s", sensorID, err.Error())
+			}
+			continue
+		}
+
+		engine.mu.Lock()
+		if !engine.restored[sensorID] {
+			for _, alarm := range latest {
+				state := &limitState{
+					lastTime: alarm.UpdatedTs,
+					active:   alarm.IsActive,
+				}
+				if !state.active {
+					state.lastReturn = alarm.ClearedTs
+				}
+				engine.states[sensorID+"|"+alarm.AlarmType] = state
+			}
+			engine.restored[sensorID] = true
+		}
+		engine.mu.Unlock()
+	}
+}
+
+// state - returns the state of a restored sensor limit, a limit without stored alarms starts inactive.
+func (engine *Engine) state(sensorID string, alarmType string) *limitState {
+	key := sensorID + "|" + alarmType
+	if state, exists := engine.states[key]; exists {
+		return state
+	}
+
+	state := &limitState{}
+	engine.states[key] = state
+	return state
+}
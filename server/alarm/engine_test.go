@@ -0,0 +1,123 @@
+package alarm
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"gitlab.citicom.kz/CloudServer/server/models"
+)
+
+// stubStore - alarm store whose first restores fail.
+type stubStore struct {
+	failures int
+	calls    int
+	latest   []*models.AlarmResult
+}
+
+func (store *stubStore) GetLatestAlarms(ctx context.Context, sensorID string) ([]*models.AlarmResult, error) {
+	store.calls++
+	if store.calls <= store.failures {
+		return nil, errors.New("connection refused")
+	}
+	return store.latest, nil
+}
+
+func (store *stubStore) GetSensorAlarmSettings(ctx context.Context) ([]*models.SensorAlarmSettings, error) {
+	return nil, nil
+}
+
+func testSample(value float32, sampleTime int64) *models.SensorSample {
+	return &models.SensorSample{
+		OilFieldID: 1,
+		SensorID:   "sensor",
+		Sensor: &models.SensorResultCloud{
+			IsEnabled: true,
+			ValueType: models.SENSOR_TYPE_FLOAT,
+			AlarmH:    100,
+			AlarmHH:   200,
+		},
+		Value: value,
+		Time:  sampleTime,
+	}
+}
+
+func TestEngineRetriesFailedRestore(t *testing.T) {
+	store := &stubStore{
+		failures: 1,
+		latest: []*models.AlarmResult{
+			{SensorID: "sensor", AlarmType: models.ALARM_TYPE_HIGHT, IsActive: true, UpdatedTs: 10},
+		},
+	}
+	engine := NewEngine(store)
+
+	if alarms := engine.Evaluate(context.Background(), []*models.SensorSample{testSample(150, 20)}); len(alarms) != 0 {
+		t.Fatalf("sensor without a restored state raised %d alarms", len(alarms))
+	}
+
+	// the stored alarm is still active, the breach continues it instead of raising a new one
+	if alarms := engine.Evaluate(context.Background(), []*models.SensorSample{testSample(150, 30)}); len(alarms) != 0 {
+		t.Fatalf("active stored alarm raised again: %+v", alarms[0])
+	}
+	if store.calls != 2 {
+		t.Errorf("store queried %d times, want 2", store.calls)
+	}
+
+	alarms := engine.Evaluate(context.Background(), []*models.SensorSample{testSample(50, 40)})
+	if len(alarms) != 1 || alarms[0].Transition != models.ALARM_TRANSITION_RETURN {
+		t.Fatalf("expected the restored alarm to return, got %+v", alarms)
+	}
+	if store.calls != 2 {
+		t.Errorf("store queried %d times, want 2", store.calls)
+	}
+}
+
+// TestEngineRetriedSyncFile - batches of a nacked sync file are evaluated again when the field sends it again,
+// the retry raises what a single pass raises.
+func TestEngineRetriedSyncFile(t *testing.T) {
+	file := make([]*models.SensorSample, 0, 20)
+	for i := int64(1); i <= 20; i++ {
+		value := float32(50)
+		if i > 5 && i <= 15 {
+			value = 150
+		}
+		file = append(file, testSample(value, i))
+	}
+	batches := [][]*models.SensorSample{file[:8], file[8:]}
+
+	single := NewEngine(&stubStore{})
+	want := 0
+	for _, batch := range batches {
+		want += len(single.Evaluate(context.Background(), batch))
+	}
+	if want != 2 {
+		t.Fatalf("single pass raised %d transitions, want 2", want)
+	}
+
+	retried := NewEngine(&stubStore{})
+	got := len(retried.Evaluate(context.Background(), batches[0]))
+	// the file is nacked after its first batch and sent again from the start
+	for _, batch := range batches {
+		got += len(retried.Evaluate(context.Background(), batch))
+	}
+	if got != want {
+		t.Errorf("retried file raised %d transitions, want %d", got, want)
+	}
+
+	// sent again after a restart, the raise stored by the first attempt is not repeated
+	restarted := NewEngine(&stubStore{latest: []*models.AlarmResult{
+		{SensorID: "sensor", AlarmType: models.ALARM_TYPE_HIGHT, IsActive: true, UpdatedTs: 6},
+	}})
+	got = 0
+	for _, batch := range batches {
+		for _, alarm := range restarted.Evaluate(context.Background(), batch) {
+			if alarm.Transition != models.ALARM_TRANSITION_RETURN {
+				t.Errorf("restarted engine raised %s at %d", alarm.Transition, alarm.Time)
+			}
+			got++
+		}
+	}
+	if got != 1 {
+		t.Errorf("restarted engine made %d transitions, want the return", got)
+	}
+}
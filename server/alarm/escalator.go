@@ -0,0 +1,144 @@
+package alarm
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"gitlab.citicom.kz/CloudServer/server/icontext"
+	"gitlab.citicom.kz/CloudServer/server/models"
+)
+
+// EscalationStore - unacknowledged alarms, policies, schedules and the escalation log.
+type EscalationStore interface {
+	GetUnackedAlarms(ctx context.Context) ([]*models.AlarmResult, error)
+	GetEscalationPolicy(ctx context.Context, companyID int64, oilFieldID int64) (*models.EscalationPolicy, error)
+	GetOnCallSchedule(ctx context.Context, scheduleID int64) (*models.OnCallSchedule, error)
+	GetUsers(ctx context.Context, companyID int64, all bool) ([]*models.User, error)
+	EscalateAlarm(ctx context.Context, alarmID int64, policyID int64, tier int, userIDs []int64, now int64) (bool, error)
+	GetAlarm(ctx context.Context, alarmID int64) (*models.AlarmResult, error)
+}
+
+// EscalateFunc - delivers an escalated alarm to the users of the reached tier.
+type EscalateFunc func(ctx context.Context, alarm *models.AlarmResult, userIDs []int64)
+
+// Escalator - periodically moves unacknowledged alarms through the tiers of their escalation policy.
+type Escalator struct {
+	store    EscalationStore
+	escalate EscalateFunc
+	logger   *log.Entry
+}
+
+func NewEscalator(store EscalationStore, escalate EscalateFunc) *Escalator {
+	return &Escalator{
+		store:    store,
+		escalate: escalate,
+		logger: log.WithFields(log.Fields{
+			"ServerThread": "Escalator",
+		}),
+	}
+}
+
+// Run - checks the alarms every EscalationInterval seconds.
+func (escalator *Escalator) Run() {
+	ctx := context.WithValue(context.Background(), icontext.LoggerContextKey, escalator.logger)
+	for {
+		interval := viper.GetInt64("EscalationInterval")
+		if interval < 1 {
+			interval = 1
+		}
+		<-time.After(time.Duration(interval) * time.Second)
+
+		escalator.Check(ctx, time.Now().Unix())
+	}
+}
+
+// Check - escalates every alarm whose next tier delay has passed by now.
+func (escalator *Escalator) Check(ctx context.Context, now int64) {
+	alarms, err := escalator.store.GetUnackedAlarms(ctx)
+	if err != nil {
+		escalator.logger.Errorf("Can't receive unacknowledged alarms: %s", err.Error())
+		return
+	}
+
+	for _, alarm := range alarms {
+		policy, err := escalator.store.GetEscalationPolicy(ctx, alarm.CompanyID, alarm.OilFieldId)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			escalator.logger.Errorf("Can't receive escalation policy: %s", err.Error())
+			continue
+		}
+
+		tier := alarm.EscalationTier + 1
+		if tier > len(policy.Steps) {
+			continue
+		}
+		step := policy.Steps[tier-1]
+		// alarms released from a maintenance window are escalated as if raised at release
+		raisedTs := alarm.Time
+		if alarm.ReleasedTs > raisedTs {
+			raisedTs = alarm.ReleasedTs
+		}
+		if now-raisedTs < int64(step.DelayMinutes)*60 {
+			continue
+		}
+
+		userIDs := escalator.recipients(ctx, alarm.CompanyID, step, now)
+		escalated, err := escalator.store.EscalateAlarm(ctx, alarm.AlarmID, policy.PolicyID, tier, userIDs, now)
+		if err != nil {
+			escalator.logger.Errorf("Can't escalate alarm %d: %s", alarm.AlarmID, err.Error())
+			continue
+		}
+		if !escalated {
+			continue
+		}
+
+		escalator.logger.Infof("Alarm %d escalated to tier %d, users %v", alarm.AlarmID, tier, userIDs)
+		if len(userIDs) == 0 {
+			continue
+		}
+
+		alarm, err = escalator.store.GetAlarm(ctx, alarm.AlarmID)
+		if err != nil {
+			continue
+		}
+		escalator.escalate(ctx, alarm, userIDs)
+	}
+}
+
+// recipients - resolves the users of an escalation step among the active company users.
+func (escalator *Escalator) recipients(ctx context.Context, companyID int64, step models.EscalationStep, now int64) []int64 {
+	users, err := escalator.store.GetUsers(ctx, companyID, false)
+	if err != nil {
+		escalator.logger.Errorf("Can't receive company users: %s", err.Error())
+		return nil
+	}
+
+	if step.ScheduleID > 0 {
+		schedule, err := escalator.store.GetOnCallSchedule(ctx, step.ScheduleID)
+		if err != nil {
+			escalator.logger.Errorf("Can't receive on-call schedule %d: %s", step.ScheduleID, err.Error())
+			return nil
+		}
+		onCall := schedule.OnCall(now)
+		for _, user := range users {
+			if user.UserID == onCall && !user.IsDeleted && schedule.CompanyID == companyID {
+				return []int64{user.UserID}
+			}
+		}
+		return nil
+	}
+
+	userIDs := make([]int64, 0, len(users))
+	for _, user := range users {
+		if user.Role == step.Role && !user.IsDeleted {
+			userIDs = append(userIDs, user.UserID)
+		}
+	}
+
+	return userIDs
+}
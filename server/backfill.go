@@ -0,0 +1,198 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+	"gitlab.citicom.kz/CloudServer/server/icontext"
+	"gitlab.citicom.kz/CloudServer/server/models"
+)
+
+// runBackfillDaemon - sends pending backfills to their oil fields once online, fails backfills the field stopped
+// answering and, every BackfillGapInterval, proposes backfills for gaps in the stored samples.
+func (server *Server) runBackfillDaemon() {
+	ctx := context.WithValue(context.Background(), icontext.LoggerContextKey, server.logger)
+	lastGapCheck := time.Now().Unix()
+	for {
+		interval := viper.GetInt64("BackfillInterval")
+		if interval < 1 {
+			interval = 1
+		}
+		<-time.After(time.Duration(interval) * time.Second)
+
+		server.sendPendingBackfills(ctx)
+		server.failStaleBackfills(ctx)
+
+		gapInterval := viper.GetInt64("BackfillGapInterval")
+		if now := time.Now().Unix(); gapInterval > 0 && now-lastGapCheck >= gapInterval {
+			lastGapCheck = now
+			server.detectGaps(ctx, now)
+		}
+	}
+}
+
+func (server *Server) sendPendingBackfills(ctx context.Context) {
+	backfills, err := server.db.GetPendingBackfills(ctx)
+	if err != nil {
+		server.logger.Errorf("Can't receive pending backfills: %s", err.Error())
+		return
+	}
+
+	for _, backfill := range backfills {
+		if !server.isOilFieldOnline(backfill.OilFieldID) {
+			continue
+		}
+
+		if err := server.sendBackfill(ctx, backfill); err != nil {
+			server.logger.Errorf("Backfill %d of oil field %d failed: %s", backfill.BackfillID, backfill.OilFieldID, err.Error())
+			server.db.SetBackfillStatus(ctx, backfill.BackfillID, models.BACKFILL_STATUS_FAILED, err.Error(), models.BACKFILL_STATUS_PENDING)
+		}
+	}
+}
+
+// sendBackfill - asks the oil field for the samples of the backfill. The backfill is moved to requested first so
+// files answering it are counted, it goes back to pending if the message can't be queued.
+func (server *Server) sendBackfill(ctx context.Context, backfill *models.Backfill) error {
+	request, err := server.backfillRequest(ctx, backfill)
+	if err != nil {
+		return err
+	}
+
+	moved, err := server.db.SetBackfillStatus(ctx, backfill.BackfillID, models.BACKFILL_STATUS_REQUESTED, "", models.BACKFILL_STATUS_PENDING)
+	if err != nil || !moved {
+		return err
+	}
+
+	if !server.SendMessageOilField(models.MessageTypeCloudBackfill, request, backfill.OilFieldID) {
+		_, err := server.db.SetBackfillStatus(ctx, backfill.BackfillID, models.BACKFILL_STATUS_PENDING, "", models.BACKFILL_STATUS_REQUESTED)
+		return err
+	}
+
+	server.logger.Infof("Backfill %d of oil field %d requested", backfill.BackfillID, backfill.OilFieldID)
+	return nil
+}
+
+// backfillRequest - translates the cloud ids of the backfill to the ids of the field.
+func (server *Server) backfillRequest(ctx context.Context, backfill *models.Backfill) (*models.BackfillRequest, error) {
+	request := &models.BackfillRequest{
+		BackfillID: backfill.BackfillID,
+		TagNames:   make([]string, 0, len(backfill.SensorIDs)),
+		From:       backfill.From,
+		To:         backfill.To,
+	}
+
+	if backfill.ControllerID != "" {
+		controllerID, err := strconv.ParseInt(strings.TrimPrefix(backfill.ControllerID, fmt.Sprintf("%d_", backfill.OilFieldID)), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid controller id %s", backfill.ControllerID)
+		}
+		request.ControllerID = controllerID
+	}
+
+	tagNames, err := server.db.GetSensorTagNames(ctx, backfill.SensorIDs)
+	if err != nil {
+		return nil, err
+	}
+	for _, sensorID := range backfill.SensorIDs {
+		tagName, exists := tagNames[sensorID]
+		if !exists {
+			return nil, fmt.Errorf("Sensor %s not found", sensorID)
+		}
+		request.TagNames = append(request.TagNames, tagName)
+	}
+
+	return request, nil
+}
+
+func (server *Server) failStaleBackfills(ctx context.Context) {
+	timeout := viper.GetInt64("BackfillTimeout")
+	if timeout < 1 {
+		return
+	}
+
+	backfills, err := server.db.GetStaleBackfills(ctx, time.Now().Unix()-timeout)
+	if err != nil {
+		server.logger.Errorf("Can't receive stale backfills: %s", err.Error())
+		return
+	}
+
+	for _, backfill := range backfills {
+		server.logger.Errorf("Backfill %d of oil field %d timed out", backfill.BackfillID, backfill.OilFieldID)
+		server.db.SetBackfillStatus(ctx, backfill.BackfillID, models.BACKFILL_STATUS_FAILED, "Timed out",
+			models.BACKFILL_STATUS_REQUESTED,
+			models.BACKFILL_STATUS_RECEIVING,
+		)
+	}
+}
+
+// detectGaps - looks for runs of empty BackfillGapBucket buckets of at least BackfillGapMinimum seconds in the last
+// BackfillGapLookback seconds of each oil field. A backfill of the gap is proposed for approval, or requested
+// right away with BackfillGapAutoRequest, unless one already covers it.
+func (server *Server) detectGaps(ctx context.Context, now int64) {
+	bucket := viper.GetInt64("BackfillGapBucket")
+	if bucket < 1 {
+		bucket = 1
+	}
+	minGap := viper.GetInt64("BackfillGapMinimum")
+	to := now - now%bucket
+	from := to - viper.GetInt64("BackfillGapLookback")
+
+	status := models.BACKFILL_STATUS_PROPOSED
+	if viper.GetBool("BackfillGapAutoRequest") {
+		status = models.BACKFILL_STATUS_PENDING
+	}
+
+	oilFields, err := server.db.GetOilFields(ctx, 0, true)
+	if err != nil {
+		server.logger.Errorf("Can't receive oil fields: %s", err.Error())
+		return
+	}
+
+	for _, oilField := range oilFields {
+		if oilField.IsDeleted {
+			continue
+		}
+
+		buckets, err := server.influxDB.GetSampleBuckets(fmt.Sprintf("%d_", oilField.OilFieldId), from, to, bucket)
+		if err != nil {
+			server.logger.Errorf("Can't receive samples of oil field %d: %s", oilField.OilFieldId, err.Error())
+			continue
+		}
+
+		for _, gap := range models.DetectGaps(buckets, minGap) {
+			exists, err := server.db.HasBackfillOverlap(ctx, oilField.OilFieldId, gap.From, gap.To)
+			if err != nil || exists {
+				continue
+			}
+
+			backfill, err := server.db.CreateBackfill(ctx, models.Backfill{
+				OilFieldID: oilField.OilFieldId,
+				From:       gap.From,
+				To:         gap.To,
+				Status:     status,
+				Source:     models.BACKFILL_SOURCE_GAP,
+			})
+			if err != nil {
+				server.logger.Errorf("Can't create backfill of oil field %d: %s", oilField.OilFieldId, err.Error())
+				continue
+			}
+			server.logger.Infof("Gap of oil field %d from %d to %d, backfill %d %s", oilField.OilFieldId, gap.From, gap.To, backfill.BackfillID, backfill.Status)
+		}
+	}
+}
+
+// addBackfillFile - counts a sync file sent for a backfill, files of the normal sync carry no backfill id.
+func (server *Server) addBackfillFile(ctx context.Context, oilFieldId int64, backfillID int64, points int64) {
+	if backfillID == 0 {
+		return
+	}
+
+	l, _ := icontext.GetLogger(ctx)
+	if err := server.db.AddBackfillFile(ctx, oilFieldId, backfillID, points); err != nil {
+		l.Errorf("%v", err)
+	}
+}
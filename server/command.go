@@ -0,0 +1,152 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+	"gitlab.citicom.kz/CloudServer/server/icontext"
+	"gitlab.citicom.kz/CloudServer/server/models"
+)
+
+// runCommandDaemon - times out the commands without a result within their timeout and the ones not approved
+// within CommandApprovalTimeout seconds.
+func (server *Server) runCommandDaemon() {
+	ctx := context.WithValue(context.Background(), icontext.LoggerContextKey, server.logger)
+	for {
+		interval := viper.GetInt64("CommandInterval")
+		if interval < 1 {
+			interval = 1
+		}
+		<-time.After(time.Duration(interval) * time.Second)
+
+		now := time.Now().Unix()
+		commands, err := server.db.GetExpiredCommands(ctx, now, now-viper.GetInt64("CommandApprovalTimeout"))
+		if err != nil {
+			server.logger.Errorf("Can't receive expired commands: %s", err.Error())
+			continue
+		}
+
+		for _, command := range commands {
+			reason := "No result within the timeout"
+			if command.Status == models.COMMAND_STATUS_AWAITING_APPROVAL {
+				reason = "Not approved in time"
+			}
+
+			server.completeCommand(ctx, command.CommandID, command.OilFieldID, models.CommandResult{
+				CommandID: command.CommandID,
+				Status:    models.COMMAND_STATUS_TIMED_OUT,
+				Error:     reason,
+			})
+		}
+	}
+}
+
+// sendCommand - sends the command to its oil field, it fails right away when the field is offline. Commands are
+// never queued for a field that comes back later, the situation may have changed by then.
+func (server *Server) sendCommand(ctx context.Context, command *models.Command) {
+	l, _ := icontext.GetLogger(ctx)
+
+	request, err := server.commandRequest(ctx, command)
+	if err == nil && !server.SendMessageOilField(models.MessageTypeCloudCommand, request, command.OilFieldID) {
+		err = fmt.Errorf("Oil field %d is offline", command.OilFieldID)
+	}
+	if err != nil {
+		server.completeCommand(ctx, command.CommandID, command.OilFieldID, models.CommandResult{
+			CommandID: command.CommandID,
+			Status:    models.COMMAND_STATUS_FAILED,
+			Error:     err.Error(),
+		})
+		return
+	}
+
+	l.Infof("Command %d to %s of oil field %d sent: %s %v", command.CommandID, command.SensorID, command.OilFieldID, command.Action, command.Value)
+}
+
+// commandRequest - translates the cloud ids of the command to the ids of the field, a controller id is
+// <oil field>_<controller>.
+func (server *Server) commandRequest(ctx context.Context, command *models.Command) (*models.CommandRequest, error) {
+	tagName, _, _, _, _, err := server.db.GetCommandTarget(ctx, command.SensorID)
+	if err != nil {
+		return nil, fmt.Errorf("Sensor %s not found", command.SensorID)
+	}
+
+	ids := strings.SplitN(command.ControllerID, "_", 2)
+	if len(ids) != 2 {
+		return nil, fmt.Errorf("Invalid controller id %s", command.ControllerID)
+	}
+	controllerID, err := strconv.ParseInt(ids[1], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid controller id %s", command.ControllerID)
+	}
+
+	return &models.CommandRequest{
+		CommandID:     command.CommandID,
+		ControllerID:  controllerID,
+		TagName:       tagName,
+		Action:        command.Action,
+		Value:         command.Value,
+		ExpectedValue: command.ExpectedValue,
+		Tolerance:     command.Tolerance,
+		Timeout:       command.Timeout,
+		ExpiresTs:     command.SentTs + command.Timeout,
+	}, nil
+}
+
+// commandResult - records the result the oil field sent for its command. A write the field reports as done is
+// failed when the value read back is not the expected one.
+func (server *Server) commandResult(ctx context.Context, oilFieldId int64, result models.CommandResult) {
+	l, _ := icontext.GetLogger(ctx)
+
+	command, err := server.db.GetCommand(ctx, result.CommandID)
+	if err != nil || command.OilFieldID != oilFieldId {
+		l.Errorf("Result of unknown command %d of oil field %d", result.CommandID, oilFieldId)
+		return
+	}
+
+	if result.Status != models.COMMAND_STATUS_SUCCEEDED {
+		result.Status = models.COMMAND_STATUS_FAILED
+	} else if !command.ReadbackMatches(result.Readback) {
+		result.Status = models.COMMAND_STATUS_FAILED
+		result.Error = fmt.Sprintf("Readback %v, expected %v", result.Readback, command.ExpectedValue)
+	}
+
+	server.completeCommand(ctx, command.CommandID, oilFieldId, result)
+}
+
+// completeCommand - stores the final status of the command and sends it to the users who issued and approved it.
+func (server *Server) completeCommand(ctx context.Context, commandID int64, oilFieldID int64, result models.CommandResult) {
+	l, _ := icontext.GetLogger(ctx)
+
+	completed, err := server.db.CompleteCommand(ctx, commandID, oilFieldID, result)
+	if err != nil {
+		l.Errorf("%v", err)
+		return
+	}
+	if !completed {
+		l.Infof("Result %s of command %d ignored, the command is already completed", result.Status, commandID)
+		return
+	}
+
+	command, err := server.db.GetCommand(ctx, commandID)
+	if err != nil {
+		l.Errorf("%v", err)
+		return
+	}
+	if command.Status != models.COMMAND_STATUS_SUCCEEDED {
+		l.Errorf("Command %d of oil field %d %s: %s", command.CommandID, command.OilFieldID, command.Status, command.Error)
+	}
+
+	server.notifyCommand(ctx, command)
+}
+
+// notifyCommand - sends the command to the users who issued and approved it.
+func (server *Server) notifyCommand(ctx context.Context, command *models.Command) {
+	server.SendMessageTo(ctx, models.MessageTypeCommand, command, command.IssuedBy)
+	if command.ApprovedBy > 0 && command.ApprovedBy != command.IssuedBy {
+		server.SendMessageTo(ctx, models.MessageTypeCommand, command, command.ApprovedBy)
+	}
+}
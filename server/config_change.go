@@ -0,0 +1,121 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+	"gitlab.citicom.kz/CloudServer/server/icontext"
+	"gitlab.citicom.kz/CloudServer/server/models"
+)
+
+// runConfigDaemon - sends the config changes waiting for their oil field to come online and resends the ones
+// not acknowledged within ConfigChangeResend seconds.
+func (server *Server) runConfigDaemon() {
+	ctx := context.WithValue(context.Background(), icontext.LoggerContextKey, server.logger)
+	for {
+		interval := viper.GetInt64("ConfigChangeInterval")
+		if interval < 1 {
+			interval = 1
+		}
+		<-time.After(time.Duration(interval) * time.Second)
+
+		changes, err := server.db.GetUnsentConfigChanges(ctx, time.Now().Unix()-viper.GetInt64("ConfigChangeResend"))
+		if err != nil {
+			server.logger.Errorf("Can't receive config changes: %s", err.Error())
+			continue
+		}
+
+		for _, change := range changes {
+			server.sendConfigChange(ctx, change)
+		}
+	}
+}
+
+// sendConfigChange - queues the change to its oil field if online, it stays pending otherwise.
+func (server *Server) sendConfigChange(ctx context.Context, change *models.ConfigChange) {
+	l, _ := icontext.GetLogger(ctx)
+	if !server.isOilFieldOnline(change.OilFieldID) {
+		return
+	}
+
+	request, err := configChangeRequest(change)
+	if err != nil {
+		l.Errorf("Config change %d: %s", change.ChangeID, err.Error())
+		return
+	}
+
+	if !server.SendMessageOilField(models.MessageTypeCloudConfigChange, request, change.OilFieldID) {
+		return
+	}
+
+	if err := server.db.SetConfigChangeSent(ctx, change.ChangeID); err != nil {
+		l.Errorf("%v", err)
+	}
+}
+
+// configChangeRequest - translates the cloud id of the changed controller or sensor to the ids of the field,
+// a controller id is <oil field>_<controller> and a sensor id <oil field>_<controller>_<tag name>.
+func configChangeRequest(change *models.ConfigChange) (*models.ConfigChangeRequest, error) {
+	parts := 2
+	if change.TargetType == models.CONFIG_TARGET_SENSOR {
+		parts = 3
+	}
+
+	ids := strings.SplitN(change.TargetID, "_", parts)
+	if len(ids) != parts {
+		return nil, fmt.Errorf("Invalid %s id %s", change.TargetType, change.TargetID)
+	}
+
+	controllerID, err := strconv.ParseInt(ids[1], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid %s id %s", change.TargetType, change.TargetID)
+	}
+
+	request := &models.ConfigChangeRequest{
+		ChangeID:     change.ChangeID,
+		ControllerID: controllerID,
+		UpdatedTs:    change.UpdatedTs,
+		Config:       change.Config,
+	}
+	if change.TargetType == models.CONFIG_TARGET_SENSOR {
+		request.TagName = ids[2]
+	}
+
+	return request, nil
+}
+
+// ackConfigChange - records the answer of the oil field to a config change and pushes the result to the company.
+func (server *Server) ackConfigChange(ctx context.Context, oilFieldId int64, ack models.ConfigChangeAck) {
+	l, _ := icontext.GetLogger(ctx)
+
+	switch ack.Status {
+	case models.CONFIG_CHANGE_STATUS_APPLIED, models.CONFIG_CHANGE_STATUS_CONFLICT:
+	default:
+		ack.Status = models.CONFIG_CHANGE_STATUS_REJECTED
+	}
+
+	acked, err := server.db.AckConfigChange(ctx, oilFieldId, ack)
+	if err != nil {
+		l.Errorf("%v", err)
+		return
+	}
+	if !acked {
+		l.Infof("Ack of config change %d of oil field %d ignored, the change is not open", ack.ChangeID, oilFieldId)
+		return
+	}
+
+	change, err := server.db.GetConfigChange(ctx, ack.ChangeID)
+	if err != nil {
+		l.Errorf("%v", err)
+		return
+	}
+	if change.Status != models.CONFIG_CHANGE_STATUS_APPLIED {
+		l.Errorf("Config change %d of oil field %d %s: %s", change.ChangeID, oilFieldId, change.Status, change.Error)
+	}
+
+	server.SendMessageToCompany(ctx, models.MessageTypeConfigChange, change, change.CompanyID)
+}
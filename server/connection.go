@@ -2,6 +2,7 @@ package server
 
 import (
 	"context"
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -12,7 +13,7 @@ import (
 )
 
 const (
-	outputChannelBufferSize = 10
+	outputChannelBufferSize = 64
 	pongWait                = 6 * time.Second
 	pingPeriod              = (pongWait * 9) / 10
 )
@@ -24,6 +25,7 @@ type SocketConnection struct {
 	server          *Server
 	outgoingMessage chan *models.OutputMessage
 	closeCh         chan bool
+	closeOnce       sync.Once
 	logger          *log.Entry
 }
 
@@ -47,19 +49,22 @@ func NewSocketConnection(server *Server, conn *websocket.Conn, user *models.User
 	})
 
 	return &SocketConnection{
-		id,
-		user,
-		conn,
-		server,
-		ch,
-		closeCh,
-		connectionLogger,
+		ID:              id,
+		User:            user,
+		conn:            conn,
+		server:          server,
+		outgoingMessage: ch,
+		closeCh:         closeCh,
+		logger:          connectionLogger,
 	}
 }
 
+// Close - stops the connection, safe to call more than once.
 func (cc *SocketConnection) Close() {
-	cc.logger.Info("Signal to close ")
-	close(cc.closeCh)
+	cc.closeOnce.Do(func() {
+		cc.logger.Info("Signal to close ")
+		close(cc.closeCh)
+	})
 }
 
 func (cc *SocketConnection) Run() {
@@ -96,6 +101,8 @@ func (cc *SocketConnection) listenWrite() {
 func (cc *SocketConnection) listenRead() {
 	defer func() {
 		_ = cc.conn.Close()
+		ctx := context.WithValue(context.Background(), icontext.LoggerContextKey, cc.logger)
+		cc.server.socketDisconnect(ctx, cc.User.UserID, cc.ID)
 	}()
 
 	_ = cc.conn.SetReadDeadline(time.Now().Add(pongWait))
@@ -126,7 +133,6 @@ func (cc *SocketConnection) listenRead() {
 				} else {
 					cc.logger.Errorf("Error while reading JSON from websocket %s", err.Error())
 				}
-				cc.server.socketDisconnect(ctx, cc.User.UserID, cc.ID)
 				return
 			} else {
 				//cc.server.NewIncomingMessage(ctx, &messageObject, cc.User)
@@ -135,7 +141,12 @@ func (cc *SocketConnection) listenRead() {
 	}
 }
 
-// SendMessage - add message to output queue
-func (cc *SocketConnection) SendMessage(mes *models.OutputMessage) {
-	cc.outgoingMessage <- mes
+// SendMessage - add message to output queue, returns false without blocking when the queue is full
+func (cc *SocketConnection) SendMessage(mes *models.OutputMessage) bool {
+	select {
+	case cc.outgoingMessage <- mes:
+		return true
+	default:
+		return false
+	}
 }
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/spf13/viper"
+	"gitlab.citicom.kz/CloudServer/server/models"
+)
+
+// fieldConnectivity - offline tracking of an oil field, owned by the master daemon.
+type fieldConnectivity struct {
+	offlineSince int64
+	alarmActive  bool
+}
+
+func (server *Server) recordConnectivity(ctx context.Context, oilFieldID int64, event string, address string) {
+	if err := server.db.AddConnectivityEvent(ctx, oilFieldID, event, address, time.Now().Unix()); err != nil {
+		server.logger.Errorf("Can't record %s of oil field %d: %s", event, oilFieldID, err.Error())
+	}
+}
+
+// runHeartbeatDaemon - records every ConnectivityHeartbeat seconds that the cloud runs, the next start marks the
+// connectivity of the oil fields unknown from the last heartbeat on.
+func (server *Server) runHeartbeatDaemon() {
+	ctx := context.Background()
+	for {
+		if err := server.db.SaveHeartbeat(ctx, time.Now().Unix()); err != nil {
+			server.logger.Errorf("Can't save heartbeat: %s", err.Error())
+		}
+
+		interval := viper.GetInt64("ConnectivityHeartbeat")
+		if interval < 1 {
+			interval = 1
+		}
+		<-time.After(time.Duration(interval) * time.Second)
+	}
+}
+
+// checkConnectivity - raises an offline alarm for oil fields offline longer than ConnectivityGracePeriod
+// seconds and returns it once the field is back.
+func (server *Server) checkConnectivity(ctx context.Context, oilFields []*models.OilField) {
+	now := time.Now().Unix()
+	grace := viper.GetInt64("ConnectivityGracePeriod")
+
+	alarms := make([]*models.Alarm, 0)
+	for _, oilField := range oilFields {
+		if oilField.IsDeleted {
+			continue
+		}
+
+		sensorID := models.OilFieldSensorID(oilField.OilFieldId)
+		state, exists := server.connectivity[oilField.OilFieldId]
+		if !exists {
+			state = &fieldConnectivity{
+				alarmActive: server.db.OpenAlarmExists(ctx, sensorID, models.ALARM_TYPE_OFFLINE),
+			}
+			server.connectivity[oilField.OilFieldId] = state
+		}
+
+		if server.isOilFieldOnline(oilField.OilFieldId) {
+			state.offlineSince = 0
+			if state.alarmActive {
+				state.alarmActive = false
+				alarms = append(alarms, &models.Alarm{
+					OilFieldID: oilField.OilFieldId,
+					SensorID:   sensorID,
+					AlarmType:  models.ALARM_TYPE_OFFLINE,
+					AlarmValue: float32(grace),
+					Transition: models.ALARM_TRANSITION_RETURN,
+					Time:       now,
+				})
+			}
+			continue
+		}
+
+		if state.offlineSince == 0 {
+			// a field never seen online is measured from now
+			state.offlineSince = now
+			last, err := server.db.GetLastConnectivityEvent(ctx, oilField.OilFieldId, now+1)
+			if err == nil && last.Event == models.ConnectivityEventDisconnect {
+				state.offlineSince = last.Time
+			}
+		}
+
+		if !state.alarmActive && now-state.offlineSince >= grace {
+			state.alarmActive = true
+			alarms = append(alarms, &models.Alarm{
+				OilFieldID: oilField.OilFieldId,
+				SensorID:   sensorID,
+				AlarmType:  models.ALARM_TYPE_OFFLINE,
+				AlarmValue: float32(grace),
+				Value:      float32(now - state.offlineSince),
+				Transition: models.ALARM_TRANSITION_RAISE,
+				Time:       now,
+			})
+		}
+	}
+
+	server.handleAlarms(ctx, alarms)
+}
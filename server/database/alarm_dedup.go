@@ -0,0 +1,120 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gitlab.citicom.kz/CloudServer/server/icontext"
+	"gitlab.citicom.kz/CloudServer/server/models"
+)
+
+const alarmDedupRuleSelectSQL = `SELECT
+	r.rule_id,
+	r.company_id,
+	r.sensor_id,
+	r.window_seconds,
+	r.match_mode,
+	r.value_tolerance,
+	r.created_ts,
+	r.updated_ts
+	FROM alarm_dedup_rules AS r`
+
+func scanAlarmDedupRule(row rowScanner) (*models.AlarmDedupRule, error) {
+	rule := &models.AlarmDedupRule{}
+	if err := row.Scan(
+		&rule.RuleID,
+		&rule.CompanyID,
+		&rule.SensorID,
+		&rule.WindowSeconds,
+		&rule.Match,
+		&rule.ValueTolerance,
+		&rule.CreatedTs,
+		&rule.UpdatedTs,
+	); err != nil {
+		return nil, err
+	}
+
+	return rule, nil
+}
+
+func (db *DB) GetAlarmDedupRules(ctx context.Context, companyID int64, all bool) ([]*models.AlarmDedupRule, error) {
+	l, _ := icontext.GetLogger(ctx)
+
+	var rows *sql.Rows
+	var err error
+
+	if !all {
+		rows, err = db.sql.Query(fmt.Sprintf(`%s WHERE r.company_id=? ORDER BY r.sensor_id`, alarmDedupRuleSelectSQL), companyID)
+	} else {
+		rows, err = db.sql.Query(fmt.Sprintf(`%s ORDER BY r.company_id, r.sensor_id`, alarmDedupRuleSelectSQL))
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	rules := make([]*models.AlarmDedupRule, 0, 10)
+	for rows.Next() {
+		rule, err := scanAlarmDedupRule(rows)
+		if err != nil {
+			l.WithFields(log.Fields{
+				"Error": err,
+			}).Error("Scan alarm dedup rule error")
+			continue
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+func (db *DB) GetAlarmDedupRule(ctx context.Context, ruleID int64) (*models.AlarmDedupRule, error) {
+	return scanAlarmDedupRule(db.sql.QueryRow(fmt.Sprintf(`%s WHERE r.rule_id=?`, alarmDedupRuleSelectSQL), ruleID))
+}
+
+// GetAlarmDedupRuleFor - returns the rule of the sensor, falling back to the company wide rule of its oil field.
+func (db *DB) GetAlarmDedupRuleFor(ctx context.Context, oilFieldID int64, sensorID string) (*models.AlarmDedupRule, error) {
+	return scanAlarmDedupRule(db.sql.QueryRow(fmt.Sprintf(`%s
+		JOIN oil_field oi
+		ON r.company_id = oi.company_id
+		WHERE oi.oil_field_id=? AND (r.sensor_id=? OR r.sensor_id='')
+		ORDER BY r.sensor_id DESC
+		LIMIT 1`, alarmDedupRuleSelectSQL), oilFieldID, sensorID))
+}
+
+// SaveAlarmDedupRule - creates or replaces the rule of the company and sensor.
+func (db *DB) SaveAlarmDedupRule(ctx context.Context, model models.AlarmDedupRule) (*models.AlarmDedupRule, error) {
+	if _, err := db.sql.Exec(`INSERT INTO alarm_dedup_rules(
+			company_id,
+			sensor_id,
+			window_seconds,
+			match_mode,
+			value_tolerance,
+			created_ts,
+			updated_ts) VALUES(?, ?, ?, ?, ?, ?, ?)
+			ON DUPLICATE KEY UPDATE
+			window_seconds=VALUES(window_seconds),
+			match_mode=VALUES(match_mode),
+			value_tolerance=VALUES(value_tolerance),
+			updated_ts=VALUES(updated_ts)`,
+		model.CompanyID,
+		model.SensorID,
+		model.WindowSeconds,
+		model.Match,
+		model.ValueTolerance,
+		time.Now().Unix(),
+		time.Now().Unix(),
+	); err != nil {
+		return nil, err
+	}
+
+	return scanAlarmDedupRule(db.sql.QueryRow(fmt.Sprintf(`%s WHERE r.company_id=? AND r.sensor_id=?`, alarmDedupRuleSelectSQL), model.CompanyID, model.SensorID))
+}
+
+func (db *DB) DeleteAlarmDedupRule(ctx context.Context, ruleID int64) error {
+	_, err := db.sql.Exec(`DELETE FROM alarm_dedup_rules WHERE rule_id=?`, ruleID)
+	return err
+}
@@ -0,0 +1,130 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	"gitlab.citicom.kz/CloudServer/server/icontext"
+	"gitlab.citicom.kz/CloudServer/server/models"
+)
+
+// alarmKPIFilterSQL - scope of the KPI queries, a zero companyID with all set covers every company.
+func alarmKPIFilterSQL(request *models.AlarmKPIRequest, all bool) (string, []interface{}) {
+	where := ""
+	args := make([]interface{}, 0, 4)
+	if !all || request.CompanyID > 0 {
+		where += " AND oi.company_id=?"
+		args = append(args, request.CompanyID)
+	}
+	if request.OilFieldID > 0 {
+		where += " AND a.oil_field_id=?"
+		args = append(args, request.OilFieldID)
+	}
+
+	return where, args
+}
+
+// GetAlarmAnnunciations - returns the raises and re-raises of [from, to) in time order.
+func (db *DB) GetAlarmAnnunciations(ctx context.Context, request *models.AlarmKPIRequest, all bool) ([]*models.AlarmAnnunciation, error) {
+	l, _ := icontext.GetLogger(ctx)
+	where, args := alarmKPIFilterSQL(request, all)
+	args = append([]interface{}{models.ALARM_TRANSITION_RAISE, models.ALARM_TRANSITION_RERAISE, request.From, request.To}, args...)
+	rows, err := db.sql.Query(fmt.Sprintf(`SELECT
+		a.alarm_id,
+		a.oil_field_id,
+		a.controller_id,
+		a.sensor_id,
+		a.alarm_type,
+		h.time
+		FROM alarm_history AS h
+		JOIN alarms a
+		ON h.alarm_id = a.alarm_id
+		JOIN oil_field oi
+		ON a.oil_field_id = oi.oil_field_id
+		WHERE h.action IN (?, ?) AND h.time>=? AND h.time<?%s
+		ORDER BY h.time, h.history_id`, where), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	annunciations := make([]*models.AlarmAnnunciation, 0, 10)
+	for rows.Next() {
+		annunciation := &models.AlarmAnnunciation{}
+		err := rows.Scan(
+			&annunciation.AlarmID,
+			&annunciation.OilFieldID,
+			&annunciation.ControllerID,
+			&annunciation.SensorID,
+			&annunciation.AlarmType,
+			&annunciation.Time,
+		)
+		if err != nil {
+			l.WithFields(log.Fields{
+				"Error": err,
+			}).Error("Scan alarm annunciation error")
+			continue
+		}
+		annunciations = append(annunciations, annunciation)
+	}
+
+	return annunciations, nil
+}
+
+// GetAlarmAckStats - returns per oil field the alarms raised in [from, to) acknowledged by a user and their
+// total time to acknowledge.
+func (db *DB) GetAlarmAckStats(ctx context.Context, request *models.AlarmKPIRequest, all bool) ([]*models.AlarmAckStats, error) {
+	where, args := alarmKPIFilterSQL(request, all)
+	args = append([]interface{}{request.From, request.To}, args...)
+	rows, err := db.sql.Query(fmt.Sprintf(`SELECT
+		a.oil_field_id,
+		COUNT(*),
+		IFNULL(SUM(a.acked_ts - a.time), 0)
+		FROM alarms a
+		JOIN oil_field oi
+		ON a.oil_field_id = oi.oil_field_id
+		WHERE a.is_acked=1 AND a.acked_by>0 AND a.time>=? AND a.time<?%s
+		GROUP BY a.oil_field_id`, where), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := make([]*models.AlarmAckStats, 0, 10)
+	for rows.Next() {
+		stats := &models.AlarmAckStats{}
+		if err := rows.Scan(&stats.OilFieldID, &stats.Count, &stats.TotalSeconds); err != nil {
+			return nil, err
+		}
+		list = append(list, stats)
+	}
+
+	return list, nil
+}
+
+// GetStandingAlarms - returns the alarms that were active at the end of the range for longer than standingHours.
+func (db *DB) GetStandingAlarms(ctx context.Context, request *models.AlarmKPIRequest, all bool, standingHours int64) ([]*models.AlarmResult, error) {
+	l, _ := icontext.GetLogger(ctx)
+	where, args := alarmKPIFilterSQL(request, all)
+	args = append([]interface{}{request.To - standingHours*3600, request.To}, args...)
+	rows, err := db.sql.Query(fmt.Sprintf(`%s
+		WHERE a.time<=? AND (a.is_active=1 OR a.cleared_ts>?)%s
+		ORDER BY a.time, a.alarm_id
+		LIMIT %d`, alarmSelectSQL, where, models.AlarmListMaxLimit), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	alarms := make([]*models.AlarmResult, 0, 10)
+	for rows.Next() {
+		alarm, err := scanAlarm(rows)
+		if err != nil {
+			l.WithFields(log.Fields{
+				"Error": err,
+			}).Error("Scan alarm error")
+			continue
+		}
+		alarms = append(alarms, alarm)
+	}
+
+	return alarms, nil
+}
@@ -3,98 +3,257 @@ package database
 import (
 	"context"
 	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 	"gitlab.citicom.kz/CloudServer/server/icontext"
 	"gitlab.citicom.kz/CloudServer/server/models"
 )
 
-func (db *DB) GetAlarm(ctx context.Context, alarmID int64) (*models.AlarmResult, error) {
+var AlarmAlreadyAcked = errors.New("Alarm already acknowledged")
+var AlarmNotShelved = errors.New("Alarm is not shelved")
+var InvalidCursor = errors.New("Invalid cursor")
+
+// alarmStateSQL - derives the lifecycle state of an alarm row aliased as "a".
+var alarmStateSQL = fmt.Sprintf(`CASE
+	WHEN a.suppression_id > 0 AND (a.is_active OR NOT a.is_acked) THEN '%s'
+	WHEN a.shelved_until > UNIX_TIMESTAMP() THEN '%s'
+	WHEN a.is_active AND a.is_acked THEN '%s'
+	WHEN a.is_active THEN '%s'
+	WHEN a.is_acked THEN '%s'
+	ELSE '%s' END`,
+	models.ALARM_STATE_SUPPRESSED,
+	models.ALARM_STATE_SHELVED,
+	models.ALARM_STATE_ACTIVE_ACKED,
+	models.ALARM_STATE_ACTIVE_UNACKED,
+	models.ALARM_STATE_CLEARED,
+	models.ALARM_STATE_CLEARED_UNACKED,
+)
+
+var alarmSelectSQL = fmt.Sprintf(`SELECT
+	a.alarm_id,
+	oi.company_id,
+	a.oil_field_id,
+	oi.name,
+	a.controller_id,
+	IFNULL(c.name, ''),
+	a.sensor_id,
+	a.alarm_type,
+	a.alarm_value,
+	a.value,
+	a.transition,
+	a.occurrences,
+	%s,
+	a.is_active,
+	a.is_acked,
+	a.acked_by,
+	a.acked_ts,
+	a.ack_comment,
+	a.shelved_by,
+	a.shelved_until,
+	a.shelve_comment,
+	a.escalation_tier,
+	a.escalated_ts,
+	a.suppression_id,
+	a.released_ts,
+	a.time,
+	a.cleared_ts,
+	a.updated_ts
+	FROM alarms a
+	JOIN oil_field oi
+	ON a.oil_field_id = oi.oil_field_id
+	LEFT JOIN controllers c
+	ON a.controller_id = c.controller_id`, alarmStateSQL)
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanAlarm(row rowScanner) (*models.AlarmResult, error) {
 	alarm := &models.AlarmResult{}
-	if err := db.sql.QueryRow(`SELECT 
- 								a.alarm_id,
- 								a.user_id,
- 								a.oil_field_id,
- 								a.controller_id,
- 								a.sensor_id,
- 								a.alarm_type,
- 								a.alarm_value,
- 								a.value,
- 								a.viewed,
- 								a.time
- 								FROM alarms AS a WHERE a.alarm_id=?`,
-		alarmID,
-	).Scan(
+	err := row.Scan(
 		&alarm.AlarmID,
-		&alarm.UserID,
+		&alarm.CompanyID,
 		&alarm.OilFieldId,
+		&alarm.OilFieldName,
 		&alarm.ControllerID,
+		&alarm.ControllerName,
 		&alarm.SensorID,
 		&alarm.AlarmType,
 		&alarm.AlarmValue,
 		&alarm.Value,
-		&alarm.IsViewed,
+		&alarm.Transition,
+		&alarm.Occurrences,
+		&alarm.State,
+		&alarm.IsActive,
+		&alarm.IsAcked,
+		&alarm.AckedBy,
+		&alarm.AckedTs,
+		&alarm.AckComment,
+		&alarm.ShelvedBy,
+		&alarm.ShelvedUntil,
+		&alarm.ShelveComment,
+		&alarm.EscalationTier,
+		&alarm.EscalatedTs,
+		&alarm.SuppressionID,
+		&alarm.ReleasedTs,
 		&alarm.Time,
-	); err != nil {
+		&alarm.ClearedTs,
+		&alarm.UpdatedTs,
+	)
+	if err != nil {
 		return nil, err
 	}
 
 	return alarm, nil
 }
 
-func (db *DB) GetAlarms(ctx context.Context, companyID int64, all bool) ([]*models.AlarmResult, error) {
-	l, _ := icontext.GetLogger(ctx)
-	query := `SELECT 
-	a.alarm_id,
-	a.user_id,
-	a.oil_field_id,
-	oi.name,
-	a.controller_id,
-	c.name,
-	a.sensor_id,
-	a.alarm_type,
-	a.alarm_value,
-	a.value,
-	a.viewed,
-	a.time
-	FROM alarms a 
-	JOIN oil_field oi
-	ON a.oil_field_id = oi.oil_field_id
-	JOIN controllers c
-	ON a.controller_id = c.controller_id`
+func (db *DB) GetAlarm(ctx context.Context, alarmID int64) (*models.AlarmResult, error) {
+	return scanAlarm(db.sql.QueryRow(fmt.Sprintf(`%s WHERE a.alarm_id=?`, alarmSelectSQL), alarmID))
+}
+
+// GetLatestAlarms - returns the most recently updated alarm of each limit of the sensor.
+func (db *DB) GetLatestAlarms(ctx context.Context, sensorID string) ([]*models.AlarmResult, error) {
+	rows, err := db.sql.Query(fmt.Sprintf(`%s WHERE a.sensor_id=? AND NOT EXISTS (
+		SELECT 1 FROM alarms newer
+		WHERE newer.sensor_id = a.sensor_id
+		AND newer.alarm_type = a.alarm_type
+		AND (newer.updated_ts > a.updated_ts OR (newer.updated_ts = a.updated_ts AND newer.alarm_id > a.alarm_id)))`, alarmSelectSQL),
+		sensorID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
-	var rows *sql.Rows
-	var err error
+	alarms := make([]*models.AlarmResult, 0, 10)
+	for rows.Next() {
+		alarm, err := scanAlarm(rows)
+		if err != nil {
+			return nil, err
+		}
+		alarms = append(alarms, alarm)
+	}
+
+	return alarms, rows.Err()
+}
+
+var alarmSortColumns = map[string]string{
+	"time":      "a.time",
+	"updatedTs": "a.updated_ts",
+	"clearedTs": "a.cleared_ts",
+	"alarmType": "a.alarm_type",
+	"sensorId":  "a.sensor_id",
+}
+
+// alarmFilterSQL - builds the WHERE clause of an alarm list query, the state filter is optional
+// so the same conditions can be reused for the per-state counters.
+func alarmFilterSQL(companyID int64, all bool, filter *models.AlarmFilter, withState bool) (string, []interface{}) {
+	conditions := make([]string, 0, 10)
+	args := make([]interface{}, 0, 10)
 
 	if !all {
-		query = fmt.Sprintf(`%s WHERE oi.company_id=?`, query)
-		rows, err = db.sql.Query(query, companyID)
-	} else {
-		rows, err = db.sql.Query(query)
+		conditions = append(conditions, "oi.company_id=?")
+		args = append(args, companyID)
+	}
+	if filter.OilFieldID > 0 {
+		conditions = append(conditions, "a.oil_field_id=?")
+		args = append(args, filter.OilFieldID)
+	}
+	if filter.ControllerID != "" {
+		conditions = append(conditions, "a.controller_id=?")
+		args = append(args, filter.ControllerID)
+	}
+	if filter.SensorID != "" {
+		conditions = append(conditions, "a.sensor_id=?")
+		args = append(args, filter.SensorID)
+	}
+	if filter.AlarmType != "" {
+		conditions = append(conditions, "a.alarm_type=?")
+		args = append(args, filter.AlarmType)
+	}
+	if filter.IsActive != nil {
+		conditions = append(conditions, "a.is_active=?")
+		args = append(args, *filter.IsActive)
+	}
+	if filter.IsAcked != nil {
+		conditions = append(conditions, "a.is_acked=?")
+		args = append(args, *filter.IsAcked)
+	}
+	if filter.From > 0 {
+		conditions = append(conditions, "a.time>=?")
+		args = append(args, filter.From)
+	}
+	if filter.To > 0 {
+		conditions = append(conditions, "a.time<=?")
+		args = append(args, filter.To)
+	}
+	if withState && filter.State != "" {
+		conditions = append(conditions, fmt.Sprintf("(%s)=?", alarmStateSQL))
+		args = append(args, filter.State)
+	}
+
+	if len(conditions) == 0 {
+		return "", args
 	}
 
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// GetAlarms - returns one page of alarms matching the filter and the cursor of the next page.
+func (db *DB) GetAlarms(ctx context.Context, companyID int64, all bool, filter *models.AlarmFilter) ([]*models.AlarmResult, string, error) {
+	l, _ := icontext.GetLogger(ctx)
+
+	sort := filter.Sort
+	sortColumn, ok := alarmSortColumns[sort]
+	if !ok {
+		sort = "time"
+		sortColumn = alarmSortColumns[sort]
+	}
+	order, direction, comparison := "desc", "DESC", "<"
+	if filter.Order == "asc" {
+		order, direction, comparison = "asc", "ASC", ">"
+	}
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = models.AlarmListDefaultLimit
+	}
+
+	where, args := alarmFilterSQL(companyID, all, filter, true)
+	if filter.Cursor != "" {
+		cursor, err := decodeAlarmCursor(filter.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		// the value of a cursor is only comparable in the sort it was made for
+		if cursor.Sort != sort || cursor.Order != order {
+			return nil, "", InvalidCursor
+		}
+
+		condition := fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND a.alarm_id %[2]s ?))", sortColumn, comparison)
+		if where == "" {
+			where = " WHERE " + condition
+		} else {
+			where = where + " AND " + condition
+		}
+		args = append(args, cursor.Value, cursor.Value, cursor.AlarmID)
+	}
+
+	query := fmt.Sprintf(`%s%s ORDER BY %s %s, a.alarm_id %s LIMIT %d`, alarmSelectSQL, where, sortColumn, direction, direction, limit+1)
+	rows, err := db.sql.Query(query, args...)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 	defer rows.Close()
 	alarms := make([]*models.AlarmResult, 0, 10)
 	for rows.Next() {
-		alarm := &models.AlarmResult{}
-		err := rows.Scan(
-			&alarm.AlarmID,
-			&alarm.UserID,
-			&alarm.OilFieldId,
-			&alarm.OilFieldName,
-			&alarm.ControllerID,
-			&alarm.ControllerName,
-			&alarm.SensorID,
-			&alarm.AlarmType,
-			&alarm.AlarmValue,
-			&alarm.Value,
-			&alarm.IsViewed,
-			&alarm.Time,
-		)
+		alarm, err := scanAlarm(rows)
 		if err != nil {
 			l.WithFields(log.Fields{
 				"Error": err,
@@ -104,89 +263,451 @@ func (db *DB) GetAlarms(ctx context.Context, companyID int64, all bool) ([]*mode
 		alarms = append(alarms, alarm)
 	}
 
-	return alarms, nil
+	nextCursor := ""
+	if len(alarms) > limit {
+		alarms = alarms[:limit]
+		nextCursor = encodeAlarmCursor(alarms[limit-1], sort, order)
+	}
+
+	return alarms, nextCursor, nil
 }
 
-func (db *DB) MarkAlarmAsViewed(ctx context.Context, alarmID int64) (*models.AlarmResult, error) {
-	_, err := db.sql.Exec(`UPDATE alarms SET viewed=? WHERE alarm_id=?`, true, alarmID)
+// CountAlarmsByState - returns the number of alarms in every state, ignoring the state filter.
+func (db *DB) CountAlarmsByState(ctx context.Context, companyID int64, all bool, filter *models.AlarmFilter) (map[string]int64, error) {
+	where, args := alarmFilterSQL(companyID, all, filter, false)
+	rows, err := db.sql.Query(fmt.Sprintf(`SELECT
+		%s AS state,
+		COUNT(*)
+		FROM alarms a
+		JOIN oil_field oi
+		ON a.oil_field_id = oi.oil_field_id%s
+		GROUP BY state`, alarmStateSQL, where), args...)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	return db.GetAlarm(ctx, alarmID)
+	counts := map[string]int64{
+		models.ALARM_STATE_ACTIVE_UNACKED:  0,
+		models.ALARM_STATE_ACTIVE_ACKED:    0,
+		models.ALARM_STATE_CLEARED_UNACKED: 0,
+		models.ALARM_STATE_CLEARED:         0,
+		models.ALARM_STATE_SHELVED:         0,
+		models.ALARM_STATE_SUPPRESSED:      0,
+	}
+	for rows.Next() {
+		var state string
+		var count int64
+		if err := rows.Scan(&state, &count); err != nil {
+			return nil, err
+		}
+		counts[state] = count
+	}
+
+	return counts, nil
 }
 
-func (db *DB) SaveAlarms(ctx context.Context, alarms models.Alarms) []*models.AlarmResult {
-	alarmResults := make([]*models.AlarmResult, 0, 10)
-	for _, alarm := range alarms.Alarms {
-		oilField, err := db.GetOilField(ctx, alarm.OilFieldID)
+func encodeAlarmCursor(alarm *models.AlarmResult, sort string, order string) string {
+	cursor := models.AlarmCursor{Sort: sort, Order: order, AlarmID: alarm.AlarmID}
+	switch sort {
+	case "updatedTs":
+		cursor.Value = strconv.FormatInt(alarm.UpdatedTs, 10)
+	case "clearedTs":
+		cursor.Value = strconv.FormatInt(alarm.ClearedTs, 10)
+	case "alarmType":
+		cursor.Value = alarm.AlarmType
+	case "sensorId":
+		cursor.Value = alarm.SensorID
+	default:
+		cursor.Value = strconv.FormatInt(alarm.Time, 10)
+	}
+
+	cursorBytes, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(cursorBytes)
+}
+
+func decodeAlarmCursor(value string) (*models.AlarmCursor, error) {
+	cursorBytes, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, InvalidCursor
+	}
+
+	cursor := &models.AlarmCursor{}
+	if err := json.Unmarshal(cursorBytes, cursor); err != nil {
+		return nil, InvalidCursor
+	}
+
+	return cursor, nil
+}
+
+func (db *DB) GetAlarmHistory(ctx context.Context, alarmID int64) ([]*models.AlarmHistoryResult, error) {
+	l, _ := icontext.GetLogger(ctx)
+	rows, err := db.sql.Query(`SELECT
+		h.history_id,
+		h.alarm_id,
+		h.action,
+		h.state,
+		h.user_id,
+		IFNULL(u.first_name, ''),
+		IFNULL(u.last_name, ''),
+		h.comment,
+		h.value,
+		h.time
+		FROM alarm_history AS h
+		LEFT JOIN users u
+		ON h.user_id = u.user_id
+		WHERE h.alarm_id=?
+		ORDER BY h.time, h.history_id`, alarmID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	history := make([]*models.AlarmHistoryResult, 0, 10)
+	for rows.Next() {
+		item := &models.AlarmHistoryResult{}
+		err := rows.Scan(
+			&item.HistoryID,
+			&item.AlarmID,
+			&item.Action,
+			&item.State,
+			&item.UserID,
+			&item.FirstName,
+			&item.LastName,
+			&item.Comment,
+			&item.Value,
+			&item.Time,
+		)
 		if err != nil {
+			l.WithFields(log.Fields{
+				"Error": err,
+			}).Error("Scan alarm history error")
 			continue
 		}
+		history = append(history, item)
+	}
+
+	return history, nil
+}
 
-		companyID := oilField.CompanyID
-		if db.AlarmExists(ctx, alarm.SensorID, alarm.AlarmType, alarm.AlarmValue, alarm.Time) {
+// SaveAlarms - applies engine transitions to the alarm records and returns the changed alarms.
+// defaultRule deduplicates raises of companies and sensors without a rule of their own.
+func (db *DB) SaveAlarms(ctx context.Context, alarms []*models.Alarm, defaultRule models.AlarmDedupRule) []*models.AlarmResult {
+	l, _ := icontext.GetLogger(ctx)
+	alarmResults := make([]*models.AlarmResult, 0, 10)
+	for _, alarm := range alarms {
+		if !db.oilFieldExists(ctx, alarm.OilFieldID) {
 			continue
 		}
 
-		users, err := db.GetUsers(ctx, companyID, false)
+		rule, err := db.GetAlarmDedupRuleFor(ctx, alarm.OilFieldID, alarm.SensorID)
 		if err != nil {
+			if err != sql.ErrNoRows {
+				l.WithFields(log.Fields{
+					"Error":    err,
+					"SensorID": alarm.SensorID,
+				}).Error("Get alarm dedup rule error")
+			}
+			rule = &defaultRule
+		}
+
+		alarmID, err := db.saveAlarmTransition(alarm, rule, db.activeMaintenanceWindowID(ctx, alarm.OilFieldID, alarm.ControllerID, alarm.SensorID, alarm.Time, 0))
+		if err != nil {
+			l.WithFields(log.Fields{
+				"Error":    err,
+				"SensorID": alarm.SensorID,
+			}).Error("Save alarm transition error")
+			continue
+		}
+		if alarmID == 0 {
 			continue
 		}
 
-		for _, user := range users {
-			result, err := db.sql.Exec(`INSERT INTO alarms(
-								user_id, 
-								oil_field_id, 
-								controller_id, 
-								sensor_id, 
-								alarm_type, 
-								alarm_value, 
-								value, 
-								viewed, 
-								time) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-				user.UserID,
-				oilField.OilFieldId,
+		alarmResult, err := db.GetAlarm(ctx, alarmID)
+		if err != nil {
+			continue
+		}
+
+		alarmResults = append(alarmResults, alarmResult)
+	}
+
+	return alarmResults
+}
+
+// saveAlarmTransition - stores the transition, raises inside a maintenance window are marked with its suppressionID.
+// A raise reopens the alarm of its sensor limit that is not closed yet, or the closed one matched by the rule,
+// and bumps its occurrences. Raises of a standing alarm and raises older than the last update are duplicates.
+func (db *DB) saveAlarmTransition(alarm *models.Alarm, rule *models.AlarmDedupRule, suppressionID int64) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	var alarmID int64
+	var isActive bool
+	err = tx.sql.QueryRow(`SELECT a.alarm_id, a.is_active FROM alarms AS a
+			WHERE a.sensor_id=? AND a.alarm_type=? AND NOT (a.is_active=0 AND a.is_acked=1)
+			ORDER BY a.alarm_id DESC LIMIT 1 FOR UPDATE`,
+		alarm.SensorID,
+		alarm.AlarmType,
+	).Scan(&alarmID, &isActive)
+	if err != nil && err != sql.ErrNoRows {
+		_ = tx.sql.Rollback()
+		return 0, err
+	}
+
+	if alarm.IsActive() {
+		if alarmID > 0 && isActive {
+			_ = tx.sql.Rollback()
+			return 0, nil
+		}
+
+		reopen := false
+		if alarmID == 0 {
+			previous := &models.AlarmResult{}
+			err = tx.sql.QueryRow(`SELECT a.alarm_id, a.alarm_value, a.updated_ts FROM alarms AS a
+					WHERE a.sensor_id=? AND a.alarm_type=?
+					ORDER BY a.updated_ts DESC, a.alarm_id DESC LIMIT 1 FOR UPDATE`,
+				alarm.SensorID,
+				alarm.AlarmType,
+			).Scan(&previous.AlarmID, &previous.AlarmValue, &previous.UpdatedTs)
+			if err != nil && err != sql.ErrNoRows {
+				_ = tx.sql.Rollback()
+				return 0, err
+			}
+			if err == nil {
+				if alarm.Time <= previous.UpdatedTs {
+					_ = tx.sql.Rollback()
+					return 0, nil
+				}
+				if rule.Matches(previous, alarm) {
+					alarmID = previous.AlarmID
+					reopen = true
+				}
+			}
+		}
+
+		if alarmID == 0 {
+			result, err := tx.sql.Exec(`INSERT INTO alarms(
+								oil_field_id,
+								controller_id,
+								sensor_id,
+								alarm_type,
+								alarm_value,
+								value,
+								transition,
+								is_active,
+								suppression_id,
+								time,
+								updated_ts) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				alarm.OilFieldID,
 				alarm.ControllerID,
 				alarm.SensorID,
 				alarm.AlarmType,
 				alarm.AlarmValue,
 				alarm.Value,
-				false,
+				alarm.Transition,
+				true,
+				suppressionID,
+				alarm.Time,
 				alarm.Time,
 			)
 			if err != nil {
-				continue
+				_ = tx.sql.Rollback()
+				return 0, err
 			}
-			alarmId, err := result.LastInsertId()
+			alarmID, err = result.LastInsertId()
 			if err != nil {
-				continue
+				_ = tx.sql.Rollback()
+				return 0, err
 			}
+		} else if _, err := tx.sql.Exec(`UPDATE alarms SET
+								alarm_value=?,
+								value=?,
+								transition=?,
+								occurrences=occurrences+1,
+								is_active=?,
+								is_acked=IF(?, 0, is_acked),
+								acked_by=IF(?, 0, acked_by),
+								acked_ts=IF(?, 0, acked_ts),
+								ack_comment=IF(?, '', ack_comment),
+								suppression_id=IF(? > 0, ?, suppression_id),
+								updated_ts=?
+								WHERE alarm_id=?`,
+			alarm.AlarmValue,
+			alarm.Value,
+			alarm.Transition,
+			true,
+			reopen,
+			reopen,
+			reopen,
+			reopen,
+			suppressionID,
+			suppressionID,
+			alarm.Time,
+			alarmID,
+		); err != nil {
+			_ = tx.sql.Rollback()
+			return 0, err
+		}
+	} else {
+		if alarmID == 0 || !isActive {
+			_ = tx.sql.Rollback()
+			return 0, nil
+		}
+		if _, err := tx.sql.Exec(`UPDATE alarms SET
+								value=?,
+								transition=?,
+								is_active=?,
+								cleared_ts=?,
+								updated_ts=?
+								WHERE alarm_id=?`,
+			alarm.Value,
+			alarm.Transition,
+			false,
+			alarm.Time,
+			alarm.Time,
+			alarmID,
+		); err != nil {
+			_ = tx.sql.Rollback()
+			return 0, err
+		}
+	}
 
-			alarmResult, err := db.GetAlarm(ctx, alarmId)
-			if err != nil {
-				continue
-			}
+	if err := tx.addAlarmHistory(alarmID, alarm.Transition, 0, "", alarm.Value, alarm.Time); err != nil {
+		_ = tx.sql.Rollback()
+		return 0, err
+	}
 
-			alarmResults = append(alarmResults, alarmResult)
-		}
+	return alarmID, tx.sql.Commit()
+}
+
+// AcknowledgeAlarm - acknowledges an active or cleared alarm on behalf of the user.
+func (db *DB) AcknowledgeAlarm(ctx context.Context, alarmID int64, userID int64, comment string) (*models.AlarmResult, error) {
+	now := time.Now().Unix()
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := tx.sql.Exec(`UPDATE alarms SET
+			is_acked=?,
+			acked_by=?,
+			acked_ts=?,
+			ack_comment=?
+			WHERE alarm_id=? AND is_acked=0`,
+		true,
+		userID,
+		now,
+		comment,
+		alarmID,
+	)
+	if err != nil {
+		_ = tx.sql.Rollback()
+		return nil, err
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		_ = tx.sql.Rollback()
+		return nil, AlarmAlreadyAcked
+	}
 
+	if err := tx.addAlarmHistory(alarmID, models.ALARM_ACTION_ACK, userID, comment, 0, now); err != nil {
+		_ = tx.sql.Rollback()
+		return nil, err
+	}
+	if err := tx.sql.Commit(); err != nil {
+		return nil, err
 	}
 
-	return alarmResults
+	return db.GetAlarm(ctx, alarmID)
 }
 
-func (db *DB) AlarmExists(ctx context.Context, sensorID string, alarmType string, alarmValue float32, time int64) bool {
-	timeBefore := time - 600
-	timeAfter := time + 600
+// ShelveAlarm - hides the alarm from the active list until the given unix time.
+func (db *DB) ShelveAlarm(ctx context.Context, alarmID int64, userID int64, until int64, comment string) (*models.AlarmResult, error) {
+	now := time.Now().Unix()
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
 
-	return db.RowExists(
-		ctx,
-		`SELECT alarm_id FROM alarms WHERE sensor_id=? AND alarm_type=? AND alarm_value=? AND time BETWEEN ? AND ?`,
-		sensorID,
-		alarmType,
-		alarmValue,
-		timeBefore,
-		timeAfter,
+	if _, err := tx.sql.Exec(`UPDATE alarms SET
+			shelved_by=?,
+			shelved_until=?,
+			shelve_comment=?
+			WHERE alarm_id=?`,
+		userID,
+		until,
+		comment,
+		alarmID,
+	); err != nil {
+		_ = tx.sql.Rollback()
+		return nil, err
+	}
+
+	if err := tx.addAlarmHistory(alarmID, models.ALARM_ACTION_SHELVE, userID, comment, 0, now); err != nil {
+		_ = tx.sql.Rollback()
+		return nil, err
+	}
+	if err := tx.sql.Commit(); err != nil {
+		return nil, err
+	}
+
+	return db.GetAlarm(ctx, alarmID)
+}
+
+// UnshelveAlarm - returns a shelved alarm to the list before its shelve time runs out.
+func (db *DB) UnshelveAlarm(ctx context.Context, alarmID int64, userID int64) (*models.AlarmResult, error) {
+	now := time.Now().Unix()
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := tx.sql.Exec(`UPDATE alarms SET
+			shelved_until=?
+			WHERE alarm_id=? AND shelved_until>?`,
+		0,
+		alarmID,
+		now,
+	)
+	if err != nil {
+		_ = tx.sql.Rollback()
+		return nil, err
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		_ = tx.sql.Rollback()
+		return nil, AlarmNotShelved
+	}
+
+	if err := tx.addAlarmHistory(alarmID, models.ALARM_ACTION_UNSHELVE, userID, "", 0, now); err != nil {
+		_ = tx.sql.Rollback()
+		return nil, err
+	}
+	if err := tx.sql.Commit(); err != nil {
+		return nil, err
+	}
+
+	return db.GetAlarm(ctx, alarmID)
+}
+
+// addAlarmHistory - records an action together with the state it left the alarm in.
+func (tx *Tx) addAlarmHistory(alarmID int64, action string, userID int64, comment string, value float32, actionTime int64) error {
+	_, err := tx.sql.Exec(fmt.Sprintf(`INSERT INTO alarm_history(
+			alarm_id,
+			action,
+			state,
+			user_id,
+			comment,
+			value,
+			time)
+			SELECT a.alarm_id, ?, %s, ?, ?, IF(? = 0, a.value, ?), ? FROM alarms AS a WHERE a.alarm_id=?`, alarmStateSQL),
+		action,
+		userID,
+		comment,
+		value,
+		value,
+		actionTime,
+		alarmID,
 	)
+
+	return err
 }
@@ -0,0 +1,320 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gitlab.citicom.kz/CloudServer/server/icontext"
+	"gitlab.citicom.kz/CloudServer/server/models"
+)
+
+const backfillSelectSQL = `SELECT
+	b.backfill_id,
+	oi.company_id,
+	b.oil_field_id,
+	b.controller_id,
+	b.sensor_ids,
+	b.from_ts,
+	b.to_ts,
+	b.status,
+	b.source,
+	b.requested_by,
+	b.files,
+	b.expected_files,
+	b.points,
+	b.error,
+	b.requested_ts,
+	b.completed_ts,
+	b.created_ts,
+	b.updated_ts
+	FROM backfills AS b
+	JOIN oil_field oi
+	ON b.oil_field_id = oi.oil_field_id`
+
+func scanBackfill(row rowScanner) (*models.Backfill, error) {
+	backfill := &models.Backfill{}
+	var sensorIDs string
+	if err := row.Scan(
+		&backfill.BackfillID,
+		&backfill.CompanyID,
+		&backfill.OilFieldID,
+		&backfill.ControllerID,
+		&sensorIDs,
+		&backfill.From,
+		&backfill.To,
+		&backfill.Status,
+		&backfill.Source,
+		&backfill.RequestedBy,
+		&backfill.Files,
+		&backfill.ExpectedFiles,
+		&backfill.Points,
+		&backfill.Error,
+		&backfill.RequestedTs,
+		&backfill.CompletedTs,
+		&backfill.CreatedTs,
+		&backfill.UpdatedTs,
+	); err != nil {
+		return nil, err
+	}
+
+	backfill.SensorIDs = make([]string, 0)
+	if sensorIDs != "" {
+		if err := json.Unmarshal([]byte(sensorIDs), &backfill.SensorIDs); err != nil {
+			return nil, err
+		}
+	}
+
+	return backfill, nil
+}
+
+func (db *DB) queryBackfills(ctx context.Context, where string, args ...interface{}) ([]*models.Backfill, error) {
+	l, _ := icontext.GetLogger(ctx)
+	rows, err := db.sql.Query(fmt.Sprintf(`%s%s ORDER BY b.backfill_id DESC LIMIT %d`, backfillSelectSQL, where, models.AlarmListMaxLimit), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	backfills := make([]*models.Backfill, 0, 10)
+	for rows.Next() {
+		backfill, err := scanBackfill(rows)
+		if err != nil {
+			l.WithFields(log.Fields{
+				"Error": err,
+			}).Error("Scan backfill error")
+			continue
+		}
+		backfills = append(backfills, backfill)
+	}
+
+	return backfills, nil
+}
+
+// GetBackfills - returns the latest backfills of the company, optionally of one oil field and status.
+func (db *DB) GetBackfills(ctx context.Context, companyID int64, all bool, oilFieldID int64, status string) ([]*models.Backfill, error) {
+	conditions := make([]string, 0, 3)
+	args := make([]interface{}, 0, 3)
+	if !all {
+		conditions = append(conditions, "oi.company_id=?")
+		args = append(args, companyID)
+	}
+	if oilFieldID > 0 {
+		conditions = append(conditions, "b.oil_field_id=?")
+		args = append(args, oilFieldID)
+	}
+	if status != "" {
+		conditions = append(conditions, "b.status=?")
+		args = append(args, status)
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	return db.queryBackfills(ctx, where, args...)
+}
+
+func (db *DB) GetBackfill(ctx context.Context, backfillID int64) (*models.Backfill, error) {
+	return scanBackfill(db.sql.QueryRow(fmt.Sprintf(`%s WHERE b.backfill_id=?`, backfillSelectSQL), backfillID))
+}
+
+// GetPendingBackfills - returns the approved backfills not sent to their oil field yet, oldest first.
+func (db *DB) GetPendingBackfills(ctx context.Context) ([]*models.Backfill, error) {
+	backfills, err := db.queryBackfills(ctx, " WHERE b.status=?", models.BACKFILL_STATUS_PENDING)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, j := 0, len(backfills)-1; i < j; i, j = i+1, j-1 {
+		backfills[i], backfills[j] = backfills[j], backfills[i]
+	}
+	return backfills, nil
+}
+
+// GetStaleBackfills - returns the backfills sent to their oil field without progress since before the given time.
+func (db *DB) GetStaleBackfills(ctx context.Context, before int64) ([]*models.Backfill, error) {
+	return db.queryBackfills(ctx, " WHERE b.status IN (?, ?) AND b.updated_ts<?",
+		models.BACKFILL_STATUS_REQUESTED,
+		models.BACKFILL_STATUS_RECEIVING,
+		before,
+	)
+}
+
+// HasBackfillOverlap - reports whether a backfill of the whole oil field overlaps [from, to). Failed backfills
+// are ignored so the range can be requested again, cancelled ones are kept so a dismissed proposal stays dismissed.
+func (db *DB) HasBackfillOverlap(ctx context.Context, oilFieldID int64, from int64, to int64) (bool, error) {
+	var count int64
+	err := db.sql.QueryRow(`SELECT COUNT(*) FROM backfills
+			WHERE oil_field_id=? AND controller_id='' AND from_ts<? AND to_ts>? AND status<>?`,
+		oilFieldID,
+		to,
+		from,
+		models.BACKFILL_STATUS_FAILED,
+	).Scan(&count)
+
+	return count > 0, err
+}
+
+func (db *DB) CreateBackfill(ctx context.Context, model models.Backfill) (*models.Backfill, error) {
+	sensorIDs := ""
+	if len(model.SensorIDs) > 0 {
+		sensorBytes, err := json.Marshal(model.SensorIDs)
+		if err != nil {
+			return nil, err
+		}
+		sensorIDs = string(sensorBytes)
+	}
+
+	result, err := db.sql.Exec(`INSERT INTO backfills(
+			oil_field_id,
+			controller_id,
+			sensor_ids,
+			from_ts,
+			to_ts,
+			status,
+			source,
+			requested_by,
+			error,
+			created_ts,
+			updated_ts) VALUES(?, ?, ?, ?, ?, ?, ?, ?, '', ?, ?)`,
+		model.OilFieldID,
+		model.ControllerID,
+		sensorIDs,
+		model.From,
+		model.To,
+		model.Status,
+		model.Source,
+		model.RequestedBy,
+		time.Now().Unix(),
+		time.Now().Unix(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	lastID, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	return db.GetBackfill(ctx, lastID)
+}
+
+// SetBackfillStatus - moves the backfill from one of the given statuses to status, reports whether it moved.
+func (db *DB) SetBackfillStatus(ctx context.Context, backfillID int64, status string, errText string, from ...string) (bool, error) {
+	now := time.Now().Unix()
+	args := []interface{}{status, errText, status, now, models.BACKFILL_STATUS_REQUESTED, now, now, backfillID}
+	placeholders := make([]string, 0, len(from))
+	for _, fromStatus := range from {
+		placeholders = append(placeholders, "?")
+		args = append(args, fromStatus)
+	}
+
+	result, err := db.sql.Exec(fmt.Sprintf(`UPDATE backfills SET
+			status=?,
+			error=?,
+			completed_ts=IF(? IN ('completed', 'failed', 'cancelled'), ?, completed_ts),
+			requested_ts=IF(status=?, ?, requested_ts),
+			updated_ts=?
+			WHERE backfill_id=? AND status IN (%s)`, strings.Join(placeholders, ", ")), args...)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// AddBackfillFile - counts an ingested sync file of the oil field's backfill, it completes once the field
+// reported done and all of its files arrived.
+func (db *DB) AddBackfillFile(ctx context.Context, oilFieldID int64, backfillID int64, points int64) error {
+	now := time.Now().Unix()
+	_, err := db.sql.Exec(`UPDATE backfills SET
+			files=files+1,
+			points=points+?,
+			status=IF(expected_files>0 AND files>=expected_files, ?, ?),
+			completed_ts=IF(status=?, ?, completed_ts),
+			updated_ts=?
+			WHERE backfill_id=? AND oil_field_id=? AND status IN (?, ?)`,
+		points,
+		models.BACKFILL_STATUS_COMPLETED,
+		models.BACKFILL_STATUS_RECEIVING,
+		models.BACKFILL_STATUS_COMPLETED,
+		now,
+		now,
+		backfillID,
+		oilFieldID,
+		models.BACKFILL_STATUS_REQUESTED,
+		models.BACKFILL_STATUS_RECEIVING,
+	)
+	return err
+}
+
+// SetBackfillDone - the field sent all files of the backfill or failed. The backfill completes once all the
+// files reported were ingested.
+func (db *DB) SetBackfillDone(ctx context.Context, oilFieldID int64, done models.BackfillDone) error {
+	now := time.Now().Unix()
+	status := models.BACKFILL_STATUS_RECEIVING
+	if done.Error != "" {
+		status = models.BACKFILL_STATUS_FAILED
+	}
+
+	_, err := db.sql.Exec(`UPDATE backfills SET
+			expected_files=?,
+			error=?,
+			status=IF(?=? OR files<?, ?, ?),
+			completed_ts=IF(status IN (?, ?), ?, completed_ts),
+			updated_ts=?
+			WHERE backfill_id=? AND oil_field_id=? AND status IN (?, ?)`,
+		done.Files,
+		done.Error,
+		status,
+		models.BACKFILL_STATUS_FAILED,
+		done.Files,
+		status,
+		models.BACKFILL_STATUS_COMPLETED,
+		models.BACKFILL_STATUS_COMPLETED,
+		models.BACKFILL_STATUS_FAILED,
+		now,
+		now,
+		done.BackfillID,
+		oilFieldID,
+		models.BACKFILL_STATUS_REQUESTED,
+		models.BACKFILL_STATUS_RECEIVING,
+	)
+	return err
+}
+
+// GetSensorTagNames - returns the tag names of the sensors on their field by cloud sensor id.
+func (db *DB) GetSensorTagNames(ctx context.Context, sensorIDs []string) (map[string]string, error) {
+	tagNames := make(map[string]string)
+	if len(sensorIDs) == 0 {
+		return tagNames, nil
+	}
+
+	placeholders := make([]string, 0, len(sensorIDs))
+	args := make([]interface{}, 0, len(sensorIDs))
+	for _, sensorID := range sensorIDs {
+		placeholders = append(placeholders, "?")
+		args = append(args, sensorID)
+	}
+
+	rows, err := db.sql.Query(fmt.Sprintf(`SELECT sensor_id, tag_name FROM sensors WHERE sensor_id IN (%s)`, strings.Join(placeholders, ", ")), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var sensorID, tagName string
+		if err := rows.Scan(&sensorID, &tagName); err != nil {
+			return nil, err
+		}
+		tagNames[sensorID] = tagName
+	}
+
+	return tagNames, nil
+}
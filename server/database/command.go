@@ -0,0 +1,270 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gitlab.citicom.kz/CloudServer/server/icontext"
+	"gitlab.citicom.kz/CloudServer/server/models"
+)
+
+const commandSelectSQL = `SELECT
+	cm.command_id,
+	oi.company_id,
+	cm.oil_field_id,
+	cm.controller_id,
+	cm.sensor_id,
+	cm.action,
+	cm.value,
+	cm.expected_value,
+	cm.tolerance,
+	cm.timeout,
+	cm.comment,
+	cm.status,
+	cm.readback,
+	cm.error,
+	cm.issued_by,
+	cm.approved_by,
+	cm.created_ts,
+	cm.approved_ts,
+	cm.sent_ts,
+	cm.completed_ts
+	FROM commands AS cm
+	JOIN oil_field oi
+	ON cm.oil_field_id = oi.oil_field_id`
+
+func scanCommand(row rowScanner) (*models.Command, error) {
+	command := &models.Command{}
+	if err := row.Scan(
+		&command.CommandID,
+		&command.CompanyID,
+		&command.OilFieldID,
+		&command.ControllerID,
+		&command.SensorID,
+		&command.Action,
+		&command.Value,
+		&command.ExpectedValue,
+		&command.Tolerance,
+		&command.Timeout,
+		&command.Comment,
+		&command.Status,
+		&command.Readback,
+		&command.Error,
+		&command.IssuedBy,
+		&command.ApprovedBy,
+		&command.CreatedTs,
+		&command.ApprovedTs,
+		&command.SentTs,
+		&command.CompletedTs,
+	); err != nil {
+		return nil, err
+	}
+
+	return command, nil
+}
+
+func (db *DB) queryCommands(ctx context.Context, where string, args ...interface{}) ([]*models.Command, error) {
+	l, _ := icontext.GetLogger(ctx)
+	rows, err := db.sql.Query(fmt.Sprintf(`%s%s ORDER BY cm.command_id DESC LIMIT %d`, commandSelectSQL, where, models.AlarmListMaxLimit), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	commands := make([]*models.Command, 0, 10)
+	for rows.Next() {
+		command, err := scanCommand(rows)
+		if err != nil {
+			l.WithFields(log.Fields{
+				"Error": err,
+			}).Error("Scan command error")
+			continue
+		}
+		commands = append(commands, command)
+	}
+
+	return commands, nil
+}
+
+// GetCommands - returns the latest commands of the company, optionally of one oil field and status.
+func (db *DB) GetCommands(ctx context.Context, companyID int64, all bool, oilFieldID int64, status string) ([]*models.Command, error) {
+	conditions := make([]string, 0, 3)
+	args := make([]interface{}, 0, 3)
+	if !all {
+		conditions = append(conditions, "oi.company_id=?")
+		args = append(args, companyID)
+	}
+	if oilFieldID > 0 {
+		conditions = append(conditions, "cm.oil_field_id=?")
+		args = append(args, oilFieldID)
+	}
+	if status != "" {
+		conditions = append(conditions, "cm.status=?")
+		args = append(args, status)
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	return db.queryCommands(ctx, where, args...)
+}
+
+func (db *DB) GetCommand(ctx context.Context, commandID int64) (*models.Command, error) {
+	return scanCommand(db.sql.QueryRow(fmt.Sprintf(`%s WHERE cm.command_id=?`, commandSelectSQL), commandID))
+}
+
+// GetExpiredCommands - returns the commands sent without a result within their timeout and the ones waiting
+// for approval since before approvalBefore.
+func (db *DB) GetExpiredCommands(ctx context.Context, now int64, approvalBefore int64) ([]*models.Command, error) {
+	return db.queryCommands(ctx, " WHERE (cm.status=? AND cm.sent_ts+cm.timeout<?) OR (cm.status=? AND cm.created_ts<?)",
+		models.COMMAND_STATUS_SENT,
+		now,
+		models.COMMAND_STATUS_AWAITING_APPROVAL,
+		approvalBefore,
+	)
+}
+
+// GetCommandTarget - returns the tag name, controller, oil field, company and critical flag of a sensor.
+func (db *DB) GetCommandTarget(ctx context.Context, sensorID string) (string, string, int64, int64, bool, error) {
+	var tagName, controllerID string
+	var oilFieldID, companyID int64
+	var isCritical bool
+	err := db.sql.QueryRow(`SELECT s.tag_name, s.controller_id, c.oil_field_id, oi.company_id, s.is_critical
+		FROM sensors AS s
+		JOIN controllers c
+		ON s.controller_id = c.controller_id
+		JOIN oil_field oi
+		ON c.oil_field_id = oi.oil_field_id
+		WHERE s.sensor_id=?`, sensorID).Scan(&tagName, &controllerID, &oilFieldID, &companyID, &isCritical)
+
+	return tagName, controllerID, oilFieldID, companyID, isCritical, err
+}
+
+// SetSensorCritical - marks the sensor as critical, its commands need the approval of a second user.
+func (db *DB) SetSensorCritical(ctx context.Context, sensorID string, isCritical bool) error {
+	_, err := db.sql.Exec(`UPDATE sensors SET is_critical=? WHERE sensor_id=?`, isCritical, sensorID)
+	return err
+}
+
+func (db *DB) CreateCommand(ctx context.Context, model models.Command) (*models.Command, error) {
+	result, err := db.sql.Exec(`INSERT INTO commands(
+			oil_field_id,
+			controller_id,
+			sensor_id,
+			action,
+			value,
+			expected_value,
+			tolerance,
+			timeout,
+			comment,
+			status,
+			error,
+			issued_by,
+			sent_ts,
+			created_ts) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, '', ?, ?, ?)`,
+		model.OilFieldID,
+		model.ControllerID,
+		model.SensorID,
+		model.Action,
+		model.Value,
+		model.ExpectedValue,
+		model.Tolerance,
+		model.Timeout,
+		model.Comment,
+		model.Status,
+		model.IssuedBy,
+		model.SentTs,
+		time.Now().Unix(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	lastID, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	return db.GetCommand(ctx, lastID)
+}
+
+// ApproveCommand - the approver accepted the command waiting for approval, it is sent to the field right away.
+// Reports whether the command was waiting.
+func (db *DB) ApproveCommand(ctx context.Context, commandID int64, approvedBy int64) (bool, error) {
+	now := time.Now().Unix()
+	result, err := db.sql.Exec(`UPDATE commands SET
+			status=?,
+			approved_by=?,
+			approved_ts=?,
+			sent_ts=?
+			WHERE command_id=? AND status=?`,
+		models.COMMAND_STATUS_SENT,
+		approvedBy,
+		now,
+		now,
+		commandID,
+		models.COMMAND_STATUS_AWAITING_APPROVAL,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// RejectCommand - the approver refused the command waiting for approval, reports whether it was waiting.
+func (db *DB) RejectCommand(ctx context.Context, commandID int64, userID int64, reason string) (bool, error) {
+	now := time.Now().Unix()
+	result, err := db.sql.Exec(`UPDATE commands SET
+			status=?,
+			error=?,
+			approved_by=?,
+			approved_ts=?,
+			completed_ts=?
+			WHERE command_id=? AND status=?`,
+		models.COMMAND_STATUS_REJECTED,
+		reason,
+		userID,
+		now,
+		now,
+		commandID,
+		models.COMMAND_STATUS_AWAITING_APPROVAL,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// CompleteCommand - records the result of a command sent or waiting for approval, reports whether the command
+// was still open. A result of another oil field, or one arriving after the timeout, is not recorded.
+func (db *DB) CompleteCommand(ctx context.Context, commandID int64, oilFieldID int64, result models.CommandResult) (bool, error) {
+	res, err := db.sql.Exec(`UPDATE commands SET
+			status=?,
+			readback=?,
+			error=?,
+			completed_ts=?
+			WHERE command_id=? AND oil_field_id=? AND status IN (?, ?)`,
+		result.Status,
+		result.Readback,
+		result.Error,
+		time.Now().Unix(),
+		commandID,
+		oilFieldID,
+		models.COMMAND_STATUS_SENT,
+		models.COMMAND_STATUS_AWAITING_APPROVAL,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := res.RowsAffected()
+	return affected > 0, err
+}
@@ -100,7 +100,7 @@ func (db *DB) GetCompany(ctx context.Context, companyID int64) (*models.Company,
 		&company.CreatedTs,
 		&company.UpdatedTs,
 	); err != nil {
-		l.Errorf("SELECT Company ERROR: %f", err.Error())
+		l.Errorf("SELECT Company ERROR: %s", err.Error())
 		return nil, err
 	}
 
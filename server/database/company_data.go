@@ -17,7 +17,7 @@ func (db *DB) GetCompanyData(ctx context.Context, companyID int64, dataType stri
 		WHERE cd.company_id=? AND type=?`, companyID, dataType).Scan(
 		&desktopValue,
 	); err != nil {
-		l.Errorf("SELECT CompanyData ERROR: %f", err.Error())
+		l.Errorf("SELECT CompanyData ERROR: %s", err.Error())
 		return nil, err
 	}
 
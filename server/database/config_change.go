@@ -0,0 +1,360 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gitlab.citicom.kz/CloudServer/server/icontext"
+	"gitlab.citicom.kz/CloudServer/server/models"
+)
+
+var ConfigOutdated = errors.New("Changed since it was read")
+
+const configChangeSelectSQL = `SELECT
+	cc.change_id,
+	oi.company_id,
+	cc.oil_field_id,
+	cc.target_type,
+	cc.target_id,
+	cc.config,
+	cc.status,
+	cc.error,
+	cc.requested_by,
+	cc.updated_ts,
+	cc.field_ts,
+	cc.sent_ts,
+	cc.acked_ts,
+	cc.created_ts
+	FROM config_changes AS cc
+	JOIN oil_field oi
+	ON cc.oil_field_id = oi.oil_field_id`
+
+func scanConfigChange(row rowScanner) (*models.ConfigChange, error) {
+	change := &models.ConfigChange{}
+	var config string
+	if err := row.Scan(
+		&change.ChangeID,
+		&change.CompanyID,
+		&change.OilFieldID,
+		&change.TargetType,
+		&change.TargetID,
+		&config,
+		&change.Status,
+		&change.Error,
+		&change.RequestedBy,
+		&change.UpdatedTs,
+		&change.FieldTs,
+		&change.SentTs,
+		&change.AckedTs,
+		&change.CreatedTs,
+	); err != nil {
+		return nil, err
+	}
+	change.Config = json.RawMessage(config)
+
+	return change, nil
+}
+
+func (db *DB) queryConfigChanges(ctx context.Context, where string, args ...interface{}) ([]*models.ConfigChange, error) {
+	l, _ := icontext.GetLogger(ctx)
+	rows, err := db.sql.Query(fmt.Sprintf(`%s%s ORDER BY cc.change_id DESC LIMIT %d`, configChangeSelectSQL, where, models.AlarmListMaxLimit), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	changes := make([]*models.ConfigChange, 0, 10)
+	for rows.Next() {
+		change, err := scanConfigChange(rows)
+		if err != nil {
+			l.WithFields(log.Fields{
+				"Error": err,
+			}).Error("Scan config change error")
+			continue
+		}
+		changes = append(changes, change)
+	}
+
+	return changes, nil
+}
+
+// GetConfigChanges - returns the latest config changes of the company, optionally of one oil field and status.
+func (db *DB) GetConfigChanges(ctx context.Context, companyID int64, all bool, oilFieldID int64, status string) ([]*models.ConfigChange, error) {
+	conditions := make([]string, 0, 3)
+	args := make([]interface{}, 0, 3)
+	if !all {
+		conditions = append(conditions, "oi.company_id=?")
+		args = append(args, companyID)
+	}
+	if oilFieldID > 0 {
+		conditions = append(conditions, "cc.oil_field_id=?")
+		args = append(args, oilFieldID)
+	}
+	if status != "" {
+		conditions = append(conditions, "cc.status=?")
+		args = append(args, status)
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	return db.queryConfigChanges(ctx, where, args...)
+}
+
+func (db *DB) GetConfigChange(ctx context.Context, changeID int64) (*models.ConfigChange, error) {
+	return scanConfigChange(db.sql.QueryRow(fmt.Sprintf(`%s WHERE cc.change_id=?`, configChangeSelectSQL), changeID))
+}
+
+// GetUnsentConfigChanges - returns the changes not sent yet and the ones sent before the given time without
+// an ack, oldest first so the field applies them in order.
+func (db *DB) GetUnsentConfigChanges(ctx context.Context, before int64) ([]*models.ConfigChange, error) {
+	changes, err := db.queryConfigChanges(ctx, " WHERE cc.status=? OR (cc.status=? AND cc.sent_ts<?)",
+		models.CONFIG_CHANGE_STATUS_PENDING,
+		models.CONFIG_CHANGE_STATUS_SENT,
+		before,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, j := 0, len(changes)-1; i < j; i, j = i+1, j-1 {
+		changes[i], changes[j] = changes[j], changes[i]
+	}
+	return changes, nil
+}
+
+// SaveSensorConfig - applies the cloud edit to the sensor and queues it for the field. The sensor gets a version
+// newer than both the clock and the version the edit is based on, so the next sync file doesn't revert it.
+func (db *DB) SaveSensorConfig(ctx context.Context, config models.SensorConfig, oilFieldID int64, requestedBy int64) (*models.ConfigChange, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	var updatedTs int64
+	if err := tx.sql.QueryRow(`SELECT updated_ts FROM sensors WHERE sensor_id=? FOR UPDATE`, config.SensorID).Scan(&updatedTs); err != nil {
+		_ = tx.sql.Rollback()
+		if err == sql.ErrNoRows {
+			return nil, NotFound
+		}
+		return nil, err
+	}
+	if updatedTs != config.UpdatedTs {
+		_ = tx.sql.Rollback()
+		return nil, ConfigOutdated
+	}
+
+	config.UpdatedTs = nextConfigVersion(updatedTs)
+	if _, err := tx.sql.Exec(`UPDATE sensors SET
+			range_l=?,
+			range_h=?,
+			alarm_l=?,
+			alarm_ll=?,
+			alarm_h=?,
+			alarm_hh=?,
+			unit=?,
+			is_enabled=?,
+			alarm_states=?,
+			updated_ts=?
+			WHERE sensor_id=?`,
+		config.RangeL,
+		config.RangeH,
+		config.AlarmL,
+		config.AlarmLL,
+		config.AlarmH,
+		config.AlarmHH,
+		config.Unit,
+		config.IsEnabled,
+		marshalText(config.AlarmStates),
+		config.UpdatedTs,
+		config.SensorID,
+	); err != nil {
+		_ = tx.sql.Rollback()
+		return nil, err
+	}
+
+	changeID, err := tx.addConfigChange(oilFieldID, models.CONFIG_TARGET_SENSOR, config.SensorID, config, config.UpdatedTs, requestedBy)
+	if err != nil {
+		_ = tx.sql.Rollback()
+		return nil, err
+	}
+
+	if err := tx.sql.Commit(); err != nil {
+		return nil, err
+	}
+
+	return db.GetConfigChange(ctx, changeID)
+}
+
+// SaveControllerConfig - applies the cloud edit to the controller and queues it for the field, like SaveSensorConfig.
+func (db *DB) SaveControllerConfig(ctx context.Context, config models.ControllerConfig, oilFieldID int64, requestedBy int64) (*models.ConfigChange, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	var updatedTs int64
+	if err := tx.sql.QueryRow(`SELECT updated_ts FROM controllers WHERE controller_id=? FOR UPDATE`, config.ControllerID).Scan(&updatedTs); err != nil {
+		_ = tx.sql.Rollback()
+		if err == sql.ErrNoRows {
+			return nil, NotFound
+		}
+		return nil, err
+	}
+	if updatedTs != config.UpdatedTs {
+		_ = tx.sql.Rollback()
+		return nil, ConfigOutdated
+	}
+
+	config.UpdatedTs = nextConfigVersion(updatedTs)
+	if _, err := tx.sql.Exec(`UPDATE controllers SET
+			name=?,
+			is_enabled=?,
+			updated_ts=?
+			WHERE controller_id=?`,
+		config.Name,
+		config.IsEnabled,
+		config.UpdatedTs,
+		config.ControllerID,
+	); err != nil {
+		_ = tx.sql.Rollback()
+		return nil, err
+	}
+
+	changeID, err := tx.addConfigChange(oilFieldID, models.CONFIG_TARGET_CONTROLLER, config.ControllerID, config, config.UpdatedTs, requestedBy)
+	if err != nil {
+		_ = tx.sql.Rollback()
+		return nil, err
+	}
+
+	if err := tx.sql.Commit(); err != nil {
+		return nil, err
+	}
+
+	return db.GetConfigChange(ctx, changeID)
+}
+
+func nextConfigVersion(updatedTs int64) int64 {
+	if now := time.Now().Unix(); now > updatedTs {
+		return now
+	}
+	return updatedTs + 1
+}
+
+// addConfigChange - queues the change, the open changes of the same target are superseded by it.
+func (tx *Tx) addConfigChange(oilFieldID int64, targetType string, targetID string, config interface{}, updatedTs int64, requestedBy int64) (int64, error) {
+	configBytes, err := json.Marshal(config)
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.sql.Exec(`UPDATE config_changes SET status=?
+			WHERE target_type=? AND target_id=? AND status IN (?, ?)`,
+		models.CONFIG_CHANGE_STATUS_SUPERSEDED,
+		targetType,
+		targetID,
+		models.CONFIG_CHANGE_STATUS_PENDING,
+		models.CONFIG_CHANGE_STATUS_SENT,
+	); err != nil {
+		return 0, err
+	}
+
+	result, err := tx.sql.Exec(`INSERT INTO config_changes(
+			oil_field_id,
+			target_type,
+			target_id,
+			config,
+			status,
+			error,
+			requested_by,
+			updated_ts,
+			created_ts) VALUES(?, ?, ?, ?, ?, '', ?, ?, ?)`,
+		oilFieldID,
+		targetType,
+		targetID,
+		string(configBytes),
+		models.CONFIG_CHANGE_STATUS_PENDING,
+		requestedBy,
+		updatedTs,
+		time.Now().Unix(),
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.LastInsertId()
+}
+
+// SetConfigChangeSent - records the change was queued to the field, a superseded change stays superseded.
+func (db *DB) SetConfigChangeSent(ctx context.Context, changeID int64) error {
+	_, err := db.sql.Exec(`UPDATE config_changes SET status=?, sent_ts=?
+			WHERE change_id=? AND status IN (?, ?)`,
+		models.CONFIG_CHANGE_STATUS_SENT,
+		time.Now().Unix(),
+		changeID,
+		models.CONFIG_CHANGE_STATUS_PENDING,
+		models.CONFIG_CHANGE_STATUS_SENT,
+	)
+	return err
+}
+
+// AckConfigChange - records the answer of the oil field to its change, reports whether the change was open.
+// When the field didn't apply the change the target takes the field version, so the next sync file restores
+// the field settings unless the target was edited again meanwhile.
+func (db *DB) AckConfigChange(ctx context.Context, oilFieldID int64, ack models.ConfigChangeAck) (bool, error) {
+	change, err := db.GetConfigChange(ctx, ack.ChangeID)
+	if err == sql.ErrNoRows || (err == nil && change.OilFieldID != oilFieldID) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+
+	result, err := tx.sql.Exec(`UPDATE config_changes SET
+			status=?,
+			error=?,
+			field_ts=?,
+			acked_ts=?
+			WHERE change_id=? AND status IN (?, ?)`,
+		ack.Status,
+		ack.Error,
+		ack.UpdatedTs,
+		time.Now().Unix(),
+		change.ChangeID,
+		models.CONFIG_CHANGE_STATUS_PENDING,
+		models.CONFIG_CHANGE_STATUS_SENT,
+	)
+	if err != nil {
+		_ = tx.sql.Rollback()
+		return false, err
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		_ = tx.sql.Rollback()
+		return false, err
+	}
+
+	if ack.Status != models.CONFIG_CHANGE_STATUS_APPLIED {
+		query := `UPDATE sensors SET updated_ts=? WHERE sensor_id=? AND updated_ts=?`
+		if change.TargetType == models.CONFIG_TARGET_CONTROLLER {
+			query = `UPDATE controllers SET updated_ts=? WHERE controller_id=? AND updated_ts=?`
+		}
+		if _, err := tx.sql.Exec(query, ack.UpdatedTs, change.TargetID, change.UpdatedTs); err != nil {
+			_ = tx.sql.Rollback()
+			return false, err
+		}
+	}
+
+	return true, tx.sql.Commit()
+}
@@ -0,0 +1,126 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+
+	log "github.com/sirupsen/logrus"
+	"gitlab.citicom.kz/CloudServer/server/icontext"
+	"gitlab.citicom.kz/CloudServer/server/models"
+)
+
+func (db *DB) AddConnectivityEvent(ctx context.Context, oilFieldID int64, event string, address string, eventTime int64) error {
+	_, err := db.sql.Exec(`INSERT INTO oil_field_connectivity(oil_field_id, event, address, time) VALUES(?, ?, ?, ?)`,
+		oilFieldID,
+		event,
+		address,
+		eventTime,
+	)
+
+	return err
+}
+
+// GetConnectivityEvents - returns the events of the oil field in [from, to) in time order.
+func (db *DB) GetConnectivityEvents(ctx context.Context, oilFieldID int64, from int64, to int64) ([]*models.ConnectivityEvent, error) {
+	l, _ := icontext.GetLogger(ctx)
+	rows, err := db.sql.Query(`SELECT
+		ofc.event_id,
+		ofc.oil_field_id,
+		ofc.event,
+		ofc.address,
+		ofc.time
+		FROM oil_field_connectivity AS ofc
+		WHERE ofc.oil_field_id=? AND ofc.time>=? AND ofc.time<?
+		ORDER BY ofc.time, ofc.event_id`, oilFieldID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	events := make([]*models.ConnectivityEvent, 0, 10)
+	for rows.Next() {
+		event := &models.ConnectivityEvent{}
+		err := rows.Scan(
+			&event.EventID,
+			&event.OilFieldID,
+			&event.Event,
+			&event.Address,
+			&event.Time,
+		)
+		if err != nil {
+			l.WithFields(log.Fields{
+				"Error": err,
+			}).Error("Scan connectivity event error")
+			continue
+		}
+		events = append(events, event)
+	}
+
+	return events, nil
+}
+
+// GetLastConnectivityEvent - returns the latest event of the oil field before the given time.
+func (db *DB) GetLastConnectivityEvent(ctx context.Context, oilFieldID int64, before int64) (*models.ConnectivityEvent, error) {
+	event := &models.ConnectivityEvent{}
+	err := db.sql.QueryRow(`SELECT
+		ofc.event_id,
+		ofc.oil_field_id,
+		ofc.event,
+		ofc.address,
+		ofc.time
+		FROM oil_field_connectivity AS ofc
+		WHERE ofc.oil_field_id=? AND ofc.time<?
+		ORDER BY ofc.time DESC, ofc.event_id DESC
+		LIMIT 1`, oilFieldID, before).Scan(
+		&event.EventID,
+		&event.OilFieldID,
+		&event.Event,
+		&event.Address,
+		&event.Time,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return event, nil
+}
+
+// SaveHeartbeat - records that the cloud runs at now.
+func (db *DB) SaveHeartbeat(ctx context.Context, now int64) error {
+	_, err := db.sql.Exec(`INSERT INTO cloud_heartbeat(heartbeat_id, time) VALUES(1, ?)
+		ON DUPLICATE KEY UPDATE time=VALUES(time)`, now)
+
+	return err
+}
+
+// CloseConnectivity - used on start, records an unknown event for every oil field at the last heartbeat of the
+// previous run. Whether a field was up while the cloud was down is not known, so the time until its next
+// connect is left out of its uptime. Without a heartbeat the unknown period starts at now.
+func (db *DB) CloseConnectivity(ctx context.Context, now int64) error {
+	heartbeat := now
+	err := db.sql.QueryRow(`SELECT time FROM cloud_heartbeat WHERE heartbeat_id=1`).Scan(&heartbeat)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	_, err = db.sql.Exec(`INSERT INTO oil_field_connectivity(oil_field_id, event, address, time)
+		SELECT ofc.oil_field_id, ?, ofc.address, GREATEST(ofc.time, ?) FROM oil_field_connectivity AS ofc
+		JOIN (SELECT oil_field_id, MAX(event_id) AS event_id FROM oil_field_connectivity GROUP BY oil_field_id) AS last
+		ON ofc.event_id = last.event_id
+		WHERE ofc.event<>?`,
+		models.ConnectivityEventUnknown,
+		heartbeat,
+		models.ConnectivityEventUnknown,
+	)
+
+	return err
+}
+
+// OpenAlarmExists - reports whether the sensor limit has a standing alarm.
+func (db *DB) OpenAlarmExists(ctx context.Context, sensorID string, alarmType string) bool {
+	return db.RowExists(
+		ctx,
+		`SELECT alarm_id FROM alarms WHERE sensor_id=? AND alarm_type=? AND is_active=1`,
+		sensorID,
+		alarmType,
+	)
+}
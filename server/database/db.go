@@ -48,7 +48,7 @@ func (db *DB) RowExists(ctx context.Context, query string, args ...interface{})
 	if err != nil && err != sql.ErrNoRows {
 		l.WithFields(log.Fields{
 			"Error": err,
-		}).Error("error checking if row exists '%s' %v", args, err)
+		}).Errorf("error checking if row exists '%s' %v", args, err)
 	}
 
 	return exists
@@ -0,0 +1,373 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gitlab.citicom.kz/CloudServer/server/icontext"
+	"gitlab.citicom.kz/CloudServer/server/models"
+)
+
+const scheduleSelectSQL = `SELECT
+	s.schedule_id,
+	s.company_id,
+	s.name,
+	s.user_ids,
+	s.rotation_start,
+	s.shift_hours,
+	s.created_ts,
+	s.updated_ts
+	FROM on_call_schedules AS s`
+
+func scanSchedule(row rowScanner) (*models.OnCallSchedule, error) {
+	schedule := &models.OnCallSchedule{}
+	var userIDs string
+	if err := row.Scan(
+		&schedule.ScheduleID,
+		&schedule.CompanyID,
+		&schedule.Name,
+		&userIDs,
+		&schedule.RotationStart,
+		&schedule.ShiftHours,
+		&schedule.CreatedTs,
+		&schedule.UpdatedTs,
+	); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(userIDs), &schedule.UserIDs); err != nil {
+		return nil, err
+	}
+	schedule.OnCallUserID = schedule.OnCall(time.Now().Unix())
+
+	return schedule, nil
+}
+
+func (db *DB) GetOnCallSchedules(ctx context.Context, companyID int64, all bool) ([]*models.OnCallSchedule, error) {
+	l, _ := icontext.GetLogger(ctx)
+
+	var rows *sql.Rows
+	var err error
+
+	if !all {
+		rows, err = db.sql.Query(fmt.Sprintf(`%s WHERE s.company_id=?`, scheduleSelectSQL), companyID)
+	} else {
+		rows, err = db.sql.Query(scheduleSelectSQL)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	schedules := make([]*models.OnCallSchedule, 0, 10)
+	for rows.Next() {
+		schedule, err := scanSchedule(rows)
+		if err != nil {
+			l.WithFields(log.Fields{
+				"Error": err,
+			}).Error("Scan on-call schedule error")
+			continue
+		}
+		schedules = append(schedules, schedule)
+	}
+
+	return schedules, nil
+}
+
+func (db *DB) GetOnCallSchedule(ctx context.Context, scheduleID int64) (*models.OnCallSchedule, error) {
+	return scanSchedule(db.sql.QueryRow(fmt.Sprintf(`%s WHERE s.schedule_id=?`, scheduleSelectSQL), scheduleID))
+}
+
+func (db *DB) SaveOnCallSchedule(ctx context.Context, model models.OnCallSchedule) (*models.OnCallSchedule, error) {
+	userIDs, _ := json.Marshal(model.UserIDs)
+
+	if model.ScheduleID > 0 {
+		if _, err := db.sql.Exec(
+			`UPDATE on_call_schedules SET company_id=?, name=?, user_ids=?, rotation_start=?, shift_hours=?, updated_ts=?
+					WHERE schedule_id=?`,
+			model.CompanyID,
+			model.Name,
+			string(userIDs),
+			model.RotationStart,
+			model.ShiftHours,
+			time.Now().Unix(),
+			model.ScheduleID,
+		); err != nil {
+			return nil, err
+		}
+
+		return db.GetOnCallSchedule(ctx, model.ScheduleID)
+	}
+
+	result, err := db.sql.Exec(
+		`INSERT INTO on_call_schedules(company_id, name, user_ids, rotation_start, shift_hours, created_ts, updated_ts)
+					VALUES(?, ?, ?, ?, ?, ?, ?)`,
+		model.CompanyID,
+		model.Name,
+		string(userIDs),
+		model.RotationStart,
+		model.ShiftHours,
+		time.Now().Unix(),
+		time.Now().Unix(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	lastID, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	return db.GetOnCallSchedule(ctx, lastID)
+}
+
+func (db *DB) DeleteOnCallSchedule(ctx context.Context, scheduleID int64) error {
+	_, err := db.sql.Exec(`DELETE FROM on_call_schedules WHERE schedule_id=?`, scheduleID)
+	return err
+}
+
+const policySelectSQL = `SELECT
+	p.policy_id,
+	p.company_id,
+	p.oil_field_id,
+	p.name,
+	p.steps,
+	p.is_enabled,
+	p.created_ts,
+	p.updated_ts
+	FROM escalation_policies AS p`
+
+func scanPolicy(row rowScanner) (*models.EscalationPolicy, error) {
+	policy := &models.EscalationPolicy{}
+	var steps string
+	if err := row.Scan(
+		&policy.PolicyID,
+		&policy.CompanyID,
+		&policy.OilFieldID,
+		&policy.Name,
+		&steps,
+		&policy.IsEnabled,
+		&policy.CreatedTs,
+		&policy.UpdatedTs,
+	); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(steps), &policy.Steps); err != nil {
+		return nil, err
+	}
+
+	return policy, nil
+}
+
+func (db *DB) GetEscalationPolicies(ctx context.Context, companyID int64, all bool) ([]*models.EscalationPolicy, error) {
+	l, _ := icontext.GetLogger(ctx)
+
+	var rows *sql.Rows
+	var err error
+
+	if !all {
+		rows, err = db.sql.Query(fmt.Sprintf(`%s WHERE p.company_id=?`, policySelectSQL), companyID)
+	} else {
+		rows, err = db.sql.Query(policySelectSQL)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	policies := make([]*models.EscalationPolicy, 0, 10)
+	for rows.Next() {
+		policy, err := scanPolicy(rows)
+		if err != nil {
+			l.WithFields(log.Fields{
+				"Error": err,
+			}).Error("Scan escalation policy error")
+			continue
+		}
+		policies = append(policies, policy)
+	}
+
+	return policies, nil
+}
+
+func (db *DB) GetEscalationPolicyByID(ctx context.Context, policyID int64) (*models.EscalationPolicy, error) {
+	return scanPolicy(db.sql.QueryRow(fmt.Sprintf(`%s WHERE p.policy_id=?`, policySelectSQL), policyID))
+}
+
+// GetEscalationPolicy - returns the enabled policy of the oil field, falling back to the company wide one.
+func (db *DB) GetEscalationPolicy(ctx context.Context, companyID int64, oilFieldID int64) (*models.EscalationPolicy, error) {
+	return scanPolicy(db.sql.QueryRow(fmt.Sprintf(`%s
+		WHERE p.company_id=? AND p.is_enabled=1 AND (p.oil_field_id=? OR p.oil_field_id=0)
+		ORDER BY p.oil_field_id DESC, p.policy_id
+		LIMIT 1`, policySelectSQL), companyID, oilFieldID))
+}
+
+func (db *DB) SaveEscalationPolicy(ctx context.Context, model models.EscalationPolicy) (*models.EscalationPolicy, error) {
+	steps, _ := json.Marshal(model.Steps)
+
+	if model.PolicyID > 0 {
+		if _, err := db.sql.Exec(
+			`UPDATE escalation_policies SET company_id=?, oil_field_id=?, name=?, steps=?, is_enabled=?, updated_ts=?
+					WHERE policy_id=?`,
+			model.CompanyID,
+			model.OilFieldID,
+			model.Name,
+			string(steps),
+			model.IsEnabled,
+			time.Now().Unix(),
+			model.PolicyID,
+		); err != nil {
+			return nil, err
+		}
+
+		return db.GetEscalationPolicyByID(ctx, model.PolicyID)
+	}
+
+	result, err := db.sql.Exec(
+		`INSERT INTO escalation_policies(company_id, oil_field_id, name, steps, is_enabled, created_ts, updated_ts)
+					VALUES(?, ?, ?, ?, ?, ?, ?)`,
+		model.CompanyID,
+		model.OilFieldID,
+		model.Name,
+		string(steps),
+		model.IsEnabled,
+		time.Now().Unix(),
+		time.Now().Unix(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	lastID, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	return db.GetEscalationPolicyByID(ctx, lastID)
+}
+
+func (db *DB) DeleteEscalationPolicy(ctx context.Context, policyID int64) error {
+	_, err := db.sql.Exec(`DELETE FROM escalation_policies WHERE policy_id=?`, policyID)
+	return err
+}
+
+// GetUnackedAlarms - returns active, unacknowledged, not shelved and not suppressed alarms, the escalation candidates.
+func (db *DB) GetUnackedAlarms(ctx context.Context) ([]*models.AlarmResult, error) {
+	l, _ := icontext.GetLogger(ctx)
+	rows, err := db.sql.Query(fmt.Sprintf(`%s
+		WHERE a.is_active=1 AND a.is_acked=0 AND a.suppression_id=0 AND a.shelved_until<=UNIX_TIMESTAMP()`, alarmSelectSQL))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	alarms := make([]*models.AlarmResult, 0, 10)
+	for rows.Next() {
+		alarm, err := scanAlarm(rows)
+		if err != nil {
+			l.WithFields(log.Fields{
+				"Error": err,
+			}).Error("Scan alarm error")
+			continue
+		}
+		alarms = append(alarms, alarm)
+	}
+
+	return alarms, nil
+}
+
+// EscalateAlarm - moves an unacknowledged alarm to the next tier and logs the notified users.
+// Returns false when the alarm was acknowledged or escalated by someone else meanwhile.
+func (db *DB) EscalateAlarm(ctx context.Context, alarmID int64, policyID int64, tier int, userIDs []int64, now int64) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+
+	result, err := tx.sql.Exec(`UPDATE alarms SET
+			escalation_tier=?,
+			escalated_ts=?
+			WHERE alarm_id=? AND escalation_tier=? AND is_acked=0`,
+		tier,
+		now,
+		alarmID,
+		tier-1,
+	)
+	if err != nil {
+		_ = tx.sql.Rollback()
+		return false, err
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		_ = tx.sql.Rollback()
+		return false, err
+	}
+
+	for _, userID := range userIDs {
+		if _, err := tx.sql.Exec(`INSERT INTO alarm_escalations(alarm_id, policy_id, tier, user_id, time)
+						VALUES(?, ?, ?, ?, ?)`,
+			alarmID,
+			policyID,
+			tier,
+			userID,
+			now,
+		); err != nil {
+			_ = tx.sql.Rollback()
+			return false, err
+		}
+	}
+
+	if err := tx.addAlarmHistory(alarmID, models.ALARM_ACTION_ESCALATE, 0, fmt.Sprintf("tier %d", tier), 0, now); err != nil {
+		_ = tx.sql.Rollback()
+		return false, err
+	}
+
+	return true, tx.sql.Commit()
+}
+
+func (db *DB) GetAlarmEscalations(ctx context.Context, alarmID int64) ([]*models.AlarmEscalationResult, error) {
+	l, _ := icontext.GetLogger(ctx)
+	rows, err := db.sql.Query(`SELECT
+		e.escalation_id,
+		e.alarm_id,
+		e.policy_id,
+		e.tier,
+		e.user_id,
+		IFNULL(u.first_name, ''),
+		IFNULL(u.last_name, ''),
+		e.time
+		FROM alarm_escalations AS e
+		LEFT JOIN users u
+		ON e.user_id = u.user_id
+		WHERE e.alarm_id=?
+		ORDER BY e.time, e.escalation_id`, alarmID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	escalations := make([]*models.AlarmEscalationResult, 0, 10)
+	for rows.Next() {
+		item := &models.AlarmEscalationResult{}
+		err := rows.Scan(
+			&item.EscalationID,
+			&item.AlarmID,
+			&item.PolicyID,
+			&item.Tier,
+			&item.UserID,
+			&item.FirstName,
+			&item.LastName,
+			&item.Time,
+		)
+		if err != nil {
+			l.WithFields(log.Fields{
+				"Error": err,
+			}).Error("Scan alarm escalation error")
+			continue
+		}
+		escalations = append(escalations, item)
+	}
+
+	return escalations, nil
+}
@@ -0,0 +1,274 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gitlab.citicom.kz/CloudServer/server/icontext"
+	"gitlab.citicom.kz/CloudServer/server/models"
+)
+
+const maintenanceSelectSQL = `SELECT
+	mw.window_id,
+	oi.company_id,
+	mw.oil_field_id,
+	mw.controller_id,
+	mw.sensor_id,
+	mw.owner_id,
+	IFNULL(u.first_name, ''),
+	IFNULL(u.last_name, ''),
+	mw.reason,
+	mw.start_ts,
+	mw.end_ts,
+	mw.is_closed,
+	mw.created_ts,
+	mw.updated_ts
+	FROM maintenance_windows AS mw
+	JOIN oil_field oi
+	ON mw.oil_field_id = oi.oil_field_id
+	LEFT JOIN users u
+	ON mw.owner_id = u.user_id`
+
+func scanMaintenanceWindow(row rowScanner) (*models.MaintenanceWindow, error) {
+	window := &models.MaintenanceWindow{}
+	if err := row.Scan(
+		&window.WindowID,
+		&window.CompanyID,
+		&window.OilFieldID,
+		&window.ControllerID,
+		&window.SensorID,
+		&window.OwnerID,
+		&window.OwnerFirstName,
+		&window.OwnerLastName,
+		&window.Reason,
+		&window.StartTs,
+		&window.EndTs,
+		&window.IsClosed,
+		&window.CreatedTs,
+		&window.UpdatedTs,
+	); err != nil {
+		return nil, err
+	}
+
+	return window, nil
+}
+
+func (db *DB) queryMaintenanceWindows(ctx context.Context, where string, args ...interface{}) ([]*models.MaintenanceWindow, error) {
+	l, _ := icontext.GetLogger(ctx)
+	rows, err := db.sql.Query(fmt.Sprintf(`%s%s ORDER BY mw.start_ts DESC, mw.window_id DESC`, maintenanceSelectSQL, where), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	windows := make([]*models.MaintenanceWindow, 0, 10)
+	for rows.Next() {
+		window, err := scanMaintenanceWindow(rows)
+		if err != nil {
+			l.WithFields(log.Fields{
+				"Error": err,
+			}).Error("Scan maintenance window error")
+			continue
+		}
+		windows = append(windows, window)
+	}
+
+	return windows, nil
+}
+
+// GetMaintenanceWindows - returns the windows of the company, optionally of one oil field or only the open ones.
+func (db *DB) GetMaintenanceWindows(ctx context.Context, companyID int64, all bool, oilFieldID int64, openOnly bool) ([]*models.MaintenanceWindow, error) {
+	conditions := make([]string, 0, 3)
+	args := make([]interface{}, 0, 3)
+	if !all {
+		conditions = append(conditions, "oi.company_id=?")
+		args = append(args, companyID)
+	}
+	if oilFieldID > 0 {
+		conditions = append(conditions, "mw.oil_field_id=?")
+		args = append(args, oilFieldID)
+	}
+	if openOnly {
+		conditions = append(conditions, "mw.is_closed=0")
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	return db.queryMaintenanceWindows(ctx, where, args...)
+}
+
+func (db *DB) GetMaintenanceWindow(ctx context.Context, windowID int64) (*models.MaintenanceWindow, error) {
+	return scanMaintenanceWindow(db.sql.QueryRow(fmt.Sprintf(`%s WHERE mw.window_id=?`, maintenanceSelectSQL), windowID))
+}
+
+// GetExpiredMaintenanceWindows - returns the open windows whose end has passed.
+func (db *DB) GetExpiredMaintenanceWindows(ctx context.Context, now int64) ([]*models.MaintenanceWindow, error) {
+	return db.queryMaintenanceWindows(ctx, " WHERE mw.is_closed=0 AND mw.end_ts<=?", now)
+}
+
+func (db *DB) SaveMaintenanceWindow(ctx context.Context, model models.MaintenanceWindow) (*models.MaintenanceWindow, error) {
+	if model.WindowID > 0 {
+		if _, err := db.sql.Exec(
+			`UPDATE maintenance_windows SET oil_field_id=?, controller_id=?, sensor_id=?, reason=?, start_ts=?, end_ts=?, updated_ts=?
+					WHERE window_id=?`,
+			model.OilFieldID,
+			model.ControllerID,
+			model.SensorID,
+			model.Reason,
+			model.StartTs,
+			model.EndTs,
+			time.Now().Unix(),
+			model.WindowID,
+		); err != nil {
+			return nil, err
+		}
+
+		return db.GetMaintenanceWindow(ctx, model.WindowID)
+	}
+
+	result, err := db.sql.Exec(
+		`INSERT INTO maintenance_windows(oil_field_id, controller_id, sensor_id, owner_id, reason, start_ts, end_ts, created_ts, updated_ts)
+					VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		model.OilFieldID,
+		model.ControllerID,
+		model.SensorID,
+		model.OwnerID,
+		model.Reason,
+		model.StartTs,
+		model.EndTs,
+		time.Now().Unix(),
+		time.Now().Unix(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	lastID, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	return db.GetMaintenanceWindow(ctx, lastID)
+}
+
+// activeMaintenanceWindowID - returns the open window covering the sensor at the given time or 0,
+// the window excludeID is skipped.
+func (db *DB) activeMaintenanceWindowID(ctx context.Context, oilFieldID int64, controllerID string, sensorID string, at int64, excludeID int64) int64 {
+	var windowID int64
+	err := db.sql.QueryRow(`SELECT mw.window_id FROM maintenance_windows AS mw
+			WHERE mw.oil_field_id=?
+			AND (mw.controller_id='' OR mw.controller_id=?)
+			AND (mw.sensor_id='' OR mw.sensor_id=?)
+			AND mw.is_closed=0 AND mw.start_ts<=? AND mw.end_ts>? AND mw.window_id<>?
+			ORDER BY mw.end_ts DESC LIMIT 1`,
+		oilFieldID,
+		controllerID,
+		sensorID,
+		at,
+		at,
+		excludeID,
+	).Scan(&windowID)
+	if err != nil {
+		return 0
+	}
+
+	return windowID
+}
+
+// CloseMaintenanceWindow - ends the window at now and releases its suppressed alarms. Alarms covered by
+// another open window move to it, cleared ones are closed and the ones still standing are returned so they
+// can be announced. Returns nil when the window was already closed.
+func (db *DB) CloseMaintenanceWindow(ctx context.Context, windowID int64, now int64) ([]*models.AlarmResult, error) {
+	result, err := db.sql.Exec(`UPDATE maintenance_windows SET
+			is_closed=1,
+			end_ts=LEAST(end_ts, ?),
+			updated_ts=?
+			WHERE window_id=? AND is_closed=0`,
+		now,
+		now,
+		windowID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		return nil, err
+	}
+
+	rows, err := db.sql.Query(fmt.Sprintf(`%s WHERE a.suppression_id=?`, alarmSelectSQL), windowID)
+	if err != nil {
+		return nil, err
+	}
+	suppressed := make([]*models.AlarmResult, 0, 10)
+	for rows.Next() {
+		alarm, err := scanAlarm(rows)
+		if err != nil {
+			continue
+		}
+		suppressed = append(suppressed, alarm)
+	}
+	rows.Close()
+
+	released := make([]*models.AlarmResult, 0, len(suppressed))
+	for _, alarm := range suppressed {
+		nextWindowID := db.activeMaintenanceWindowID(ctx, alarm.OilFieldId, alarm.ControllerID, alarm.SensorID, now, windowID)
+		isReleased, err := db.releaseAlarm(alarm, nextWindowID, now)
+		if err != nil {
+			return released, err
+		}
+		if !isReleased {
+			continue
+		}
+
+		alarmResult, err := db.GetAlarm(ctx, alarm.AlarmID)
+		if err != nil {
+			continue
+		}
+		released = append(released, alarmResult)
+	}
+
+	return released, nil
+}
+
+// releaseAlarm - moves a suppressed alarm to the next window or lifts the suppression,
+// returns true when the alarm is still standing and was not acknowledged.
+func (db *DB) releaseAlarm(alarm *models.AlarmResult, nextWindowID int64, now int64) (bool, error) {
+	if nextWindowID > 0 {
+		_, err := db.sql.Exec(`UPDATE alarms SET suppression_id=? WHERE alarm_id=?`, nextWindowID, alarm.AlarmID)
+		return false, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+
+	comment := "maintenance window closed"
+	if alarm.IsActive {
+		_, err = tx.sql.Exec(`UPDATE alarms SET suppression_id=0, released_ts=? WHERE alarm_id=?`, now, alarm.AlarmID)
+	} else {
+		comment = "maintenance window closed, cleared during maintenance"
+		_, err = tx.sql.Exec(`UPDATE alarms SET
+				suppression_id=0,
+				released_ts=?,
+				is_acked=1,
+				acked_ts=IF(acked_ts > 0, acked_ts, ?)
+				WHERE alarm_id=?`, now, now, alarm.AlarmID)
+	}
+	if err != nil {
+		_ = tx.sql.Rollback()
+		return false, err
+	}
+
+	if err := tx.addAlarmHistory(alarm.AlarmID, models.ALARM_ACTION_RELEASE, 0, comment, 0, now); err != nil {
+		_ = tx.sql.Rollback()
+		return false, err
+	}
+
+	return alarm.IsActive && !alarm.IsAcked, tx.sql.Commit()
+}
@@ -137,7 +137,7 @@ func (db *DB) GetLatestSensorValues(ctx context.Context, influxDB *influx.Influx
 						s.range_h,
 						s.range_l
 						FROM sensors AS s 
-						WHERE s.sensor_id=? LIMIT 0, 1`, sensorID).Scan(
+						WHERE s.sensor_id=? AND s.is_deleted=0 LIMIT 0, 1`, sensorID).Scan(
 			&model.SensorID,
 			&model.Unit,
 			&model.RangeH,
@@ -146,8 +146,10 @@ func (db *DB) GetLatestSensorValues(ctx context.Context, influxDB *influx.Influx
 			continue
 		}
 
-		date, value := influxDB.GetLatestSensorValue(sensorID)
+		date, value, quality, state := influxDB.GetLatestSensorValue(sensorID)
 		model.FormattedValue = value
+		model.Quality = quality
+		model.State = state
 		model.CreatedTs = date
 
 		result = append(result, model)
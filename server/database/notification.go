@@ -0,0 +1,455 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gitlab.citicom.kz/CloudServer/server/icontext"
+	"gitlab.citicom.kz/CloudServer/server/models"
+)
+
+func (db *DB) GetNotificationChannels(ctx context.Context, companyID int64, all bool) ([]*models.NotificationChannel, error) {
+	l, _ := icontext.GetLogger(ctx)
+	query := `SELECT
+		nc.channel_id,
+		nc.company_id,
+		nc.name,
+		nc.type,
+		nc.config,
+		nc.is_enabled,
+		nc.created_ts,
+		nc.updated_ts
+		FROM notification_channels AS nc`
+
+	var rows *sql.Rows
+	var err error
+
+	if !all {
+		query = fmt.Sprintf(`%s WHERE nc.company_id=?`, query)
+		rows, err = db.sql.Query(query, companyID)
+	} else {
+		rows, err = db.sql.Query(query)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	channels := make([]*models.NotificationChannel, 0, 10)
+	for rows.Next() {
+		channel := &models.NotificationChannel{}
+		var config string
+		err := rows.Scan(
+			&channel.ChannelID,
+			&channel.CompanyID,
+			&channel.Name,
+			&channel.Type,
+			&config,
+			&channel.IsEnabled,
+			&channel.CreatedTs,
+			&channel.UpdatedTs,
+		)
+		if err != nil {
+			l.WithFields(log.Fields{
+				"Error": err,
+			}).Error("Scan notification channel error")
+			continue
+		}
+		channel.Config = json.RawMessage(config)
+		channels = append(channels, channel)
+	}
+
+	return channels, nil
+}
+
+func (db *DB) GetNotificationChannel(ctx context.Context, channelID int64) (*models.NotificationChannel, error) {
+	channel := &models.NotificationChannel{}
+	var config string
+	if err := db.sql.QueryRow(`SELECT
+		nc.channel_id,
+		nc.company_id,
+		nc.name,
+		nc.type,
+		nc.config,
+		nc.is_enabled,
+		nc.created_ts,
+		nc.updated_ts
+		FROM notification_channels AS nc
+		WHERE nc.channel_id=?`, channelID).Scan(
+		&channel.ChannelID,
+		&channel.CompanyID,
+		&channel.Name,
+		&channel.Type,
+		&config,
+		&channel.IsEnabled,
+		&channel.CreatedTs,
+		&channel.UpdatedTs,
+	); err != nil {
+		return nil, err
+	}
+	channel.Config = json.RawMessage(config)
+
+	return channel, nil
+}
+
+func (db *DB) SaveNotificationChannel(ctx context.Context, model models.NotificationChannel) (*models.NotificationChannel, error) {
+	if model.ChannelID > 0 {
+		if _, err := db.sql.Exec(
+			`UPDATE notification_channels SET company_id=?, name=?, type=?, config=?, is_enabled=?, updated_ts=?
+					WHERE channel_id=?`,
+			model.CompanyID,
+			model.Name,
+			model.Type,
+			string(model.Config),
+			model.IsEnabled,
+			time.Now().Unix(),
+			model.ChannelID,
+		); err != nil {
+			return nil, err
+		}
+
+		return db.GetNotificationChannel(ctx, model.ChannelID)
+	}
+
+	result, err := db.sql.Exec(
+		`INSERT INTO notification_channels(company_id, name, type, config, is_enabled, created_ts, updated_ts)
+										VALUES(?, ?, ?, ?, ?, ?, ?)`,
+		model.CompanyID,
+		model.Name,
+		model.Type,
+		string(model.Config),
+		model.IsEnabled,
+		time.Now().Unix(),
+		time.Now().Unix(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	lastID, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	return db.GetNotificationChannel(ctx, lastID)
+}
+
+const subscriptionSelectSQL = `SELECT
+	ns.subscription_id,
+	ns.user_id,
+	ns.channel_id,
+	ns.address,
+	ns.oil_field_ids,
+	ns.severities,
+	ns.quiet_from,
+	ns.quiet_to,
+	ns.time_zone,
+	ns.is_enabled,
+	ns.created_ts,
+	ns.updated_ts
+	FROM notification_subscriptions AS ns`
+
+func scanSubscription(row rowScanner) (*models.NotificationSubscription, error) {
+	subscription := &models.NotificationSubscription{}
+	var oilFieldIDs, severities string
+	if err := row.Scan(
+		&subscription.SubscriptionID,
+		&subscription.UserID,
+		&subscription.ChannelID,
+		&subscription.Address,
+		&oilFieldIDs,
+		&severities,
+		&subscription.QuietFrom,
+		&subscription.QuietTo,
+		&subscription.TimeZone,
+		&subscription.IsEnabled,
+		&subscription.CreatedTs,
+		&subscription.UpdatedTs,
+	); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(oilFieldIDs), &subscription.OilFieldIDs); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(severities), &subscription.Severities); err != nil {
+		return nil, err
+	}
+
+	return subscription, nil
+}
+
+func (db *DB) GetUserSubscriptions(ctx context.Context, userID int64) ([]*models.NotificationSubscription, error) {
+	l, _ := icontext.GetLogger(ctx)
+	rows, err := db.sql.Query(fmt.Sprintf(`%s WHERE ns.user_id=?`, subscriptionSelectSQL), userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	subscriptions := make([]*models.NotificationSubscription, 0, 10)
+	for rows.Next() {
+		subscription, err := scanSubscription(rows)
+		if err != nil {
+			l.WithFields(log.Fields{
+				"Error": err,
+			}).Error("Scan notification subscription error")
+			continue
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+
+	return subscriptions, nil
+}
+
+// GetCompanySubscriptions - returns subscriptions of the active company users with their channels.
+func (db *DB) GetCompanySubscriptions(ctx context.Context, companyID int64) ([]*models.NotificationSubscription, error) {
+	l, _ := icontext.GetLogger(ctx)
+	rows, err := db.sql.Query(fmt.Sprintf(`%s
+		JOIN users u
+		ON ns.user_id = u.user_id
+		WHERE u.company_id=? AND u.is_deleted=0`, subscriptionSelectSQL), companyID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	subscriptions := make([]*models.NotificationSubscription, 0, 10)
+	for rows.Next() {
+		subscription, err := scanSubscription(rows)
+		if err != nil {
+			l.WithFields(log.Fields{
+				"Error": err,
+			}).Error("Scan notification subscription error")
+			continue
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+	rows.Close()
+
+	channels := make(map[int64]*models.NotificationChannel)
+	for _, subscription := range subscriptions {
+		channel, exists := channels[subscription.ChannelID]
+		if !exists {
+			channel, err = db.GetNotificationChannel(ctx, subscription.ChannelID)
+			if err != nil {
+				continue
+			}
+			channels[subscription.ChannelID] = channel
+		}
+		subscription.Channel = channel
+	}
+
+	return subscriptions, nil
+}
+
+func (db *DB) GetSubscription(ctx context.Context, subscriptionID int64) (*models.NotificationSubscription, error) {
+	return scanSubscription(db.sql.QueryRow(fmt.Sprintf(`%s WHERE ns.subscription_id=?`, subscriptionSelectSQL), subscriptionID))
+}
+
+func (db *DB) SaveSubscription(ctx context.Context, model models.NotificationSubscription) (*models.NotificationSubscription, error) {
+	if model.OilFieldIDs == nil {
+		model.OilFieldIDs = []int64{}
+	}
+	if model.Severities == nil {
+		model.Severities = []string{}
+	}
+	oilFieldIDs, _ := json.Marshal(model.OilFieldIDs)
+	severities, _ := json.Marshal(model.Severities)
+
+	if model.SubscriptionID > 0 {
+		if _, err := db.sql.Exec(
+			`UPDATE notification_subscriptions SET channel_id=?, address=?, oil_field_ids=?, severities=?,
+					quiet_from=?, quiet_to=?, time_zone=?, is_enabled=?, updated_ts=?
+					WHERE subscription_id=?`,
+			model.ChannelID,
+			model.Address,
+			string(oilFieldIDs),
+			string(severities),
+			model.QuietFrom,
+			model.QuietTo,
+			model.TimeZone,
+			model.IsEnabled,
+			time.Now().Unix(),
+			model.SubscriptionID,
+		); err != nil {
+			return nil, err
+		}
+
+		return db.GetSubscription(ctx, model.SubscriptionID)
+	}
+
+	result, err := db.sql.Exec(
+		`INSERT INTO notification_subscriptions(user_id, channel_id, address, oil_field_ids, severities,
+					quiet_from, quiet_to, time_zone, is_enabled, created_ts, updated_ts)
+					VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		model.UserID,
+		model.ChannelID,
+		model.Address,
+		string(oilFieldIDs),
+		string(severities),
+		model.QuietFrom,
+		model.QuietTo,
+		model.TimeZone,
+		model.IsEnabled,
+		time.Now().Unix(),
+		time.Now().Unix(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	lastID, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	return db.GetSubscription(ctx, lastID)
+}
+
+func (db *DB) DeleteSubscription(ctx context.Context, subscriptionID int64) error {
+	_, err := db.sql.Exec(`DELETE FROM notification_subscriptions WHERE subscription_id=?`, subscriptionID)
+	return err
+}
+
+// SaveNotificationDelivery - inserts a new delivery log row or updates the status of an existing one.
+func (db *DB) SaveNotificationDelivery(ctx context.Context, delivery *models.NotificationDelivery) (*models.NotificationDelivery, error) {
+	if delivery.DeliveryID > 0 {
+		_, err := db.sql.Exec(`UPDATE notification_deliveries SET
+				status=?,
+				attempts=?,
+				last_error=?,
+				updated_ts=?,
+				sent_ts=?
+				WHERE delivery_id=?`,
+			delivery.Status,
+			delivery.Attempts,
+			delivery.LastError,
+			delivery.UpdatedTs,
+			delivery.SentTs,
+			delivery.DeliveryID,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		return delivery, nil
+	}
+
+	result, err := db.sql.Exec(`INSERT INTO notification_deliveries(
+			alarm_id,
+			subscription_id,
+			channel_id,
+			user_id,
+			channel_type,
+			address,
+			status,
+			attempts,
+			last_error,
+			created_ts,
+			updated_ts,
+			sent_ts) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		delivery.AlarmID,
+		delivery.SubscriptionID,
+		delivery.ChannelID,
+		delivery.UserID,
+		delivery.ChannelType,
+		delivery.Address,
+		delivery.Status,
+		delivery.Attempts,
+		delivery.LastError,
+		delivery.CreatedTs,
+		delivery.UpdatedTs,
+		delivery.SentTs,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	delivery.DeliveryID, err = result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	return delivery, nil
+}
+
+const deliverySelectSQL = `SELECT
+	nd.delivery_id,
+	nd.alarm_id,
+	nd.subscription_id,
+	nd.channel_id,
+	nd.user_id,
+	nd.channel_type,
+	nd.address,
+	nd.status,
+	nd.attempts,
+	nd.last_error,
+	nd.created_ts,
+	nd.updated_ts,
+	nd.sent_ts
+	FROM notification_deliveries AS nd`
+
+func scanDelivery(row rowScanner) (*models.NotificationDelivery, error) {
+	delivery := &models.NotificationDelivery{}
+	err := row.Scan(
+		&delivery.DeliveryID,
+		&delivery.AlarmID,
+		&delivery.SubscriptionID,
+		&delivery.ChannelID,
+		&delivery.UserID,
+		&delivery.ChannelType,
+		&delivery.Address,
+		&delivery.Status,
+		&delivery.Attempts,
+		&delivery.LastError,
+		&delivery.CreatedTs,
+		&delivery.UpdatedTs,
+		&delivery.SentTs,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return delivery, nil
+}
+
+// GetNotificationDeliveries - returns the latest delivery log rows of the company, optionally of one alarm.
+func (db *DB) GetNotificationDeliveries(ctx context.Context, companyID int64, all bool, alarmID int64, limit int) ([]*models.NotificationDelivery, error) {
+	query := deliverySelectSQL + `
+		JOIN notification_channels nc
+		ON nd.channel_id = nc.channel_id
+		WHERE (? OR nc.company_id=?) AND (?=0 OR nd.alarm_id=?)
+		ORDER BY nd.delivery_id DESC
+		LIMIT ?`
+
+	return db.queryDeliveries(ctx, query, all, companyID, alarmID, alarmID, limit)
+}
+
+// GetPendingNotificationDeliveries - returns the deliveries not sent yet and not given up, oldest first.
+func (db *DB) GetPendingNotificationDeliveries(ctx context.Context) ([]*models.NotificationDelivery, error) {
+	return db.queryDeliveries(ctx, deliverySelectSQL+` WHERE nd.status=? ORDER BY nd.delivery_id`, models.NotificationStatusPending)
+}
+
+func (db *DB) queryDeliveries(ctx context.Context, query string, args ...interface{}) ([]*models.NotificationDelivery, error) {
+	l, _ := icontext.GetLogger(ctx)
+	rows, err := db.sql.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	deliveries := make([]*models.NotificationDelivery, 0, 10)
+	for rows.Next() {
+		delivery, err := scanDelivery(rows)
+		if err != nil {
+			l.WithFields(log.Fields{
+				"Error": err,
+			}).Error("Scan notification delivery error")
+			continue
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, nil
+}
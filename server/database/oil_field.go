@@ -10,6 +10,7 @@ import (
 	log "github.com/sirupsen/logrus"
 	"gitlab.citicom.kz/CloudServer/server/icontext"
 	"gitlab.citicom.kz/CloudServer/server/models"
+	"gitlab.citicom.kz/CloudServer/server/utils"
 )
 
 func (db *DB) GetOilFields(ctx context.Context, companyID int64, all bool) ([]*models.OilField, error) {
@@ -22,6 +23,7 @@ func (db *DB) GetOilFields(ctx context.Context, companyID int64, all bool) ([]*m
 		oilF.name,
 		oilF.lat,
 		oilF.lon,
+		oilF.connection_mode,
 		oilF.is_deleted,
 		oilF.created_ts,
 		oilF.updated_ts
@@ -57,6 +59,7 @@ func (db *DB) GetOilFields(ctx context.Context, companyID int64, all bool) ([]*m
 			&oilField.Name,
 			&oilField.Lat,
 			&oilField.Lon,
+			&oilField.ConnectionMode,
 			&oilField.IsDeleted,
 			&oilField.CreatedTs,
 			&oilField.UpdatedTs,
@@ -80,6 +83,7 @@ func (db *DB) GetOilField(ctx context.Context, oilFieldID int64) (*models.OilFie
 		oilF.name,
 		oilF.lat,
 		oilF.lon,
+		oilF.connection_mode,
 		oilF.is_deleted,
 		oilF.created_ts,
 		oilF.updated_ts
@@ -91,11 +95,12 @@ func (db *DB) GetOilField(ctx context.Context, oilFieldID int64) (*models.OilFie
 		&oilField.Name,
 		&oilField.Lat,
 		&oilField.Lon,
+		&oilField.ConnectionMode,
 		&oilField.IsDeleted,
 		&oilField.CreatedTs,
 		&oilField.UpdatedTs,
 	); err != nil {
-		l.Errorf("SELECT oilField ERROR: %f", err.Error())
+		l.Errorf("SELECT oilField ERROR: %s", err.Error())
 		return nil, err
 	}
 
@@ -111,6 +116,7 @@ func (db *DB) GetOilFieldCheckingUser(ctx context.Context, companyID int64, all
 	oilF.name,
 	oilF.lat,
 	oilF.lon,
+	oilF.connection_mode,
 	oilF.is_deleted,
 	oilF.created_ts,
 	oilF.updated_ts
@@ -144,6 +150,7 @@ func (db *DB) GetOilFieldCheckingUser(ctx context.Context, companyID int64, all
 			&oilField.Name,
 			&oilField.Lat,
 			&oilField.Lon,
+			&oilField.ConnectionMode,
 			&oilField.IsDeleted,
 			&oilField.CreatedTs,
 			&oilField.UpdatedTs,
@@ -176,15 +183,20 @@ func (db *DB) DeleteOilField(ctx context.Context, oilFieldID int64) (*models.Oil
 }
 
 func (db *DB) SaveOilField(ctx context.Context, model models.OilFieldResult) (*models.OilField, error) {
+	if model.ConnectionMode == "" {
+		model.ConnectionMode = models.ConnectionModeDial
+	}
+
 	if db.oilFieldExists(ctx, model.OilFieldId) {
 		if _, err := db.sql.Exec(
-			`UPDATE oil_field SET http_address=?, company_id=?, name=?, lat=?, lon=?, is_deleted=?, created_ts=?, updated_ts=?
+			`UPDATE oil_field SET http_address=?, company_id=?, name=?, lat=?, lon=?, connection_mode=?, is_deleted=?, created_ts=?, updated_ts=?
 					WHERE oil_field_id=?`,
 			model.HttpAddress,
 			model.CompanyID,
 			model.Name,
 			model.Lat,
 			model.Lon,
+			model.ConnectionMode,
 			model.IsDeleted,
 			time.Now().Unix(),
 			time.Now().Unix(),
@@ -196,13 +208,14 @@ func (db *DB) SaveOilField(ctx context.Context, model models.OilFieldResult) (*m
 		return db.GetOilField(ctx, model.OilFieldId)
 	} else {
 		result, err := db.sql.Exec(
-			`INSERT INTO oil_field(http_address, company_id, name, lat, lon, is_deleted, created_ts, updated_ts)
-											VALUES(?, ?, ?, ?, ?, ?, ?, ?)`,
+			`INSERT INTO oil_field(http_address, company_id, name, lat, lon, connection_mode, is_deleted, created_ts, updated_ts)
+											VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 			model.HttpAddress,
 			model.CompanyID,
 			model.Name,
 			model.Lat,
 			model.Lon,
+			model.ConnectionMode,
 			model.IsDeleted,
 			time.Now().Unix(),
 			time.Now().Unix(),
@@ -220,6 +233,93 @@ func (db *DB) SaveOilField(ctx context.Context, model models.OilFieldResult) (*m
 	}
 }
 
+// SetGatewayToken - stores the hash of the new credential of the field gateway, replacing the previous one.
+func (db *DB) SetGatewayToken(ctx context.Context, oilFieldID int64, token string) error {
+	_, err := db.sql.Exec(`UPDATE oil_field SET gateway_token=?, updated_ts=? WHERE oil_field_id=?`,
+		utils.GetMD5Hash(token),
+		time.Now().Unix(),
+		oilFieldID,
+	)
+
+	return err
+}
+
+// CheckGatewayToken - reports whether the token is the credential of the oil field gateway.
+func (db *DB) CheckGatewayToken(ctx context.Context, oilFieldID int64, token string) bool {
+	if token == "" {
+		return false
+	}
+
+	return db.RowExists(
+		ctx,
+		`SELECT oilF.oil_field_id FROM oil_field AS oilF WHERE oilF.oil_field_id=? AND oilF.gateway_token=?`,
+		oilFieldID,
+		utils.GetMD5Hash(token),
+	)
+}
+
+func (db *DB) GetOilFieldCredentials(ctx context.Context, oilFieldID int64) (*models.OilFieldCredentials, error) {
+	credentials := &models.OilFieldCredentials{}
+	if err := db.sql.QueryRow(`SELECT
+		oilF.oil_field_id,
+		oilF.shared_secret,
+		oilF.previous_secret,
+		oilF.secret_rotated_ts,
+		oilF.client_cert_cn,
+		oilF.use_tls,
+		oilF.allow_unsigned
+		FROM oil_field AS oilF
+		WHERE oilF.oil_field_id=?`, oilFieldID).Scan(
+		&credentials.OilFieldID,
+		&credentials.Secret,
+		&credentials.PreviousSecret,
+		&credentials.RotatedTs,
+		&credentials.ClientCertCN,
+		&credentials.UseTLS,
+		&credentials.AllowUnsigned,
+	); err != nil {
+		return nil, err
+	}
+	credentials.HasSecret = credentials.Secret != ""
+
+	return credentials, nil
+}
+
+// SaveOilFieldCredentials - stores the client certificate name, the TLS switch and whether unsigned messages are
+// accepted, secrets are only changed by rotation.
+func (db *DB) SaveOilFieldCredentials(ctx context.Context, model models.OilFieldCredentials) (*models.OilFieldCredentials, error) {
+	if _, err := db.sql.Exec(`UPDATE oil_field SET client_cert_cn=?, use_tls=?, allow_unsigned=?, updated_ts=? WHERE oil_field_id=?`,
+		model.ClientCertCN,
+		model.UseTLS,
+		model.AllowUnsigned,
+		time.Now().Unix(),
+		model.OilFieldID,
+	); err != nil {
+		return nil, err
+	}
+
+	return db.GetOilFieldCredentials(ctx, model.OilFieldID)
+}
+
+// RotateOilFieldSecret - makes secret the current one, keeping the replaced secret as the previous.
+func (db *DB) RotateOilFieldSecret(ctx context.Context, oilFieldID int64, secret string, now int64) (*models.OilFieldCredentials, error) {
+	if _, err := db.sql.Exec(`UPDATE oil_field SET
+			previous_secret=shared_secret,
+			shared_secret=?,
+			secret_rotated_ts=?,
+			updated_ts=?
+			WHERE oil_field_id=?`,
+		secret,
+		now,
+		now,
+		oilFieldID,
+	); err != nil {
+		return nil, err
+	}
+
+	return db.GetOilFieldCredentials(ctx, oilFieldID)
+}
+
 func (db *DB) GetController(ctx context.Context, controllerID string) (*models.ControllerResult, error) {
 	controller := &models.ControllerResult{}
 	if err := db.sql.QueryRow(`SELECT 
@@ -256,7 +356,7 @@ func (db *DB) GetControllers(ctx context.Context, oilFieldID int64) ([]*models.C
 			c.is_enabled,
 			c.created_ts,
 			c.updated_ts
-			FROM controllers AS c WHERE c.oil_field_id=?
+			FROM controllers AS c WHERE c.oil_field_id=? AND c.is_deleted=0
 	`, oilFieldID)
 	if err != nil {
 		l.WithFields(log.Fields{
@@ -307,7 +407,7 @@ func (db *DB) GetControllersArrayInputParam(ctx context.Context, oilFieldID []in
 			c.is_enabled,
 			c.created_ts,
 			c.updated_ts
-			FROM controllers AS c WHERE c.oil_field_id IN(?)`, Ids)
+			FROM controllers AS c WHERE c.oil_field_id IN(?) AND c.is_deleted=0`, Ids)
 	if err != nil {
 		l.WithFields(log.Fields{
 			"Error": err,
@@ -369,10 +469,13 @@ func (db *DB) GetSensors(ctx context.Context, controllerID string) ([]*models.Se
 		s.unit,
 		s.is_enabled,
 		s.created_ts,
-		s.updated_ts 
+		s.updated_ts,
+		s.value_type,
+		s.enum_labels,
+		s.alarm_states
 		FROM sensors AS s 
 		LEFT JOIN alarms a ON s.sensor_id=a.sensor_id
-		WHERE s.controller_id=?`, controllerID)
+		WHERE s.controller_id=? AND s.is_deleted=0`, controllerID)
 	if err != nil {
 		l.WithFields(log.Fields{
 			"Error": err,
@@ -383,6 +486,7 @@ func (db *DB) GetSensors(ctx context.Context, controllerID string) ([]*models.Se
 	sensors := make([]*models.SensorResult, 0, 10)
 	for rows.Next() {
 		sensor := &models.SensorResult{}
+		var enumLabels, alarmStates string
 		err := rows.Scan(
 			&sensor.SensorId,
 			&sensor.TagName,
@@ -400,11 +504,16 @@ func (db *DB) GetSensors(ctx context.Context, controllerID string) ([]*models.Se
 			&sensor.IsEnabled,
 			&sensor.CreatedTs,
 			&sensor.UpdatedTs,
+			&sensor.ValueType,
+			&enumLabels,
+			&alarmStates,
 		)
 		if err != nil {
 			fmt.Println("SENSOR", err)
 			continue
 		}
+		unmarshalText(enumLabels, &sensor.EnumLabels)
+		unmarshalText(alarmStates, &sensor.AlarmStates)
 		sensors = append(sensors, sensor)
 	}
 
@@ -428,10 +537,13 @@ func (db *DB) GetSensor(ctx context.Context, controllerID string, sensorID strin
 		s.unit,
 		s.is_enabled,
 		s.created_ts,
-		s.updated_ts 
+		s.updated_ts,
+		s.value_type,
+		s.enum_labels,
+		s.alarm_states
 		FROM sensors AS s 
 		LEFT JOIN alarms a ON s.sensor_id=a.sensor_id
-		WHERE s.controller_id=? AND s.sensor_id`, controllerID, sensorID)
+		WHERE s.controller_id=? AND s.sensor_id=? AND s.is_deleted=0`, controllerID, sensorID)
 	if err != nil {
 		l.WithFields(log.Fields{
 			"Error": err,
@@ -442,6 +554,7 @@ func (db *DB) GetSensor(ctx context.Context, controllerID string, sensorID strin
 	sensors := make([]*models.SensorResult, 0, 10)
 	for rows.Next() {
 		sensor := &models.SensorResult{}
+		var enumLabels, alarmStates string
 		err := rows.Scan(
 			&sensor.SensorId,
 			&sensor.TagName,
@@ -459,11 +572,16 @@ func (db *DB) GetSensor(ctx context.Context, controllerID string, sensorID strin
 			&sensor.IsEnabled,
 			&sensor.CreatedTs,
 			&sensor.UpdatedTs,
+			&sensor.ValueType,
+			&enumLabels,
+			&alarmStates,
 		)
 		if err != nil {
 			fmt.Println("SENSOR", err)
 			continue
 		}
+		unmarshalText(enumLabels, &sensor.EnumLabels)
+		unmarshalText(alarmStates, &sensor.AlarmStates)
 		sensors = append(sensors, sensor)
 	}
 
@@ -0,0 +1,129 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gitlab.citicom.kz/CloudServer/server/icontext"
+	"gitlab.citicom.kz/CloudServer/server/models"
+)
+
+const sensorAlarmSettingsSelectSQL = `SELECT
+	sas.sensor_id,
+	sas.controller_id,
+	sas.oil_field_id,
+	sas.rate_of_change,
+	sas.stale_minutes,
+	sas.frozen_minutes,
+	sas.deviation_sensor_id,
+	sas.deviation_setpoint,
+	sas.deviation_limit,
+	sas.bad_quality,
+	sas.updated_ts
+	FROM sensor_alarm_settings AS sas`
+
+func scanSensorAlarmSettings(row rowScanner) (*models.SensorAlarmSettings, error) {
+	settings := &models.SensorAlarmSettings{}
+	if err := row.Scan(
+		&settings.SensorID,
+		&settings.ControllerID,
+		&settings.OilFieldID,
+		&settings.RateOfChange,
+		&settings.StaleMinutes,
+		&settings.FrozenMinutes,
+		&settings.DeviationSensorID,
+		&settings.DeviationSetpoint,
+		&settings.DeviationLimit,
+		&settings.BadQuality,
+		&settings.UpdatedTs,
+	); err != nil {
+		return nil, err
+	}
+
+	return settings, nil
+}
+
+// GetSensorAlarmSettings - returns the cloud side alarm settings of every sensor not deleted.
+func (db *DB) GetSensorAlarmSettings(ctx context.Context) ([]*models.SensorAlarmSettings, error) {
+	l, _ := icontext.GetLogger(ctx)
+	rows, err := db.sql.Query(sensorAlarmSettingsSelectSQL + ` JOIN sensors s ON sas.sensor_id = s.sensor_id WHERE s.is_deleted=0`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := make([]*models.SensorAlarmSettings, 0, 10)
+	for rows.Next() {
+		settings, err := scanSensorAlarmSettings(rows)
+		if err != nil {
+			l.WithFields(log.Fields{
+				"Error": err,
+			}).Error("Scan sensor alarm settings error")
+			continue
+		}
+		list = append(list, settings)
+	}
+
+	return list, nil
+}
+
+func (db *DB) GetSensorAlarmSetting(ctx context.Context, sensorID string) (*models.SensorAlarmSettings, error) {
+	return scanSensorAlarmSettings(db.sql.QueryRow(sensorAlarmSettingsSelectSQL+` WHERE sas.sensor_id=?`, sensorID))
+}
+
+// GetSensorOwner - returns the controller, oil field and company of a synchronized sensor.
+func (db *DB) GetSensorOwner(ctx context.Context, sensorID string) (string, int64, int64, error) {
+	var controllerID string
+	var oilFieldID, companyID int64
+	err := db.sql.QueryRow(`SELECT s.controller_id, c.oil_field_id, oi.company_id
+		FROM sensors AS s
+		JOIN controllers c
+		ON s.controller_id = c.controller_id
+		JOIN oil_field oi
+		ON c.oil_field_id = oi.oil_field_id
+		WHERE s.sensor_id=?`, sensorID).Scan(&controllerID, &oilFieldID, &companyID)
+
+	return controllerID, oilFieldID, companyID, err
+}
+
+func (db *DB) SaveSensorAlarmSettings(ctx context.Context, model models.SensorAlarmSettings) (*models.SensorAlarmSettings, error) {
+	if _, err := db.sql.Exec(`INSERT INTO sensor_alarm_settings(
+			sensor_id,
+			controller_id,
+			oil_field_id,
+			rate_of_change,
+			stale_minutes,
+			frozen_minutes,
+			deviation_sensor_id,
+			deviation_setpoint,
+			deviation_limit,
+			bad_quality,
+			updated_ts) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			ON DUPLICATE KEY UPDATE
+			controller_id=VALUES(controller_id),
+			oil_field_id=VALUES(oil_field_id),
+			rate_of_change=VALUES(rate_of_change),
+			stale_minutes=VALUES(stale_minutes),
+			frozen_minutes=VALUES(frozen_minutes),
+			deviation_sensor_id=VALUES(deviation_sensor_id),
+			deviation_setpoint=VALUES(deviation_setpoint),
+			deviation_limit=VALUES(deviation_limit),
+			bad_quality=VALUES(bad_quality),
+			updated_ts=VALUES(updated_ts)`,
+		model.SensorID,
+		model.ControllerID,
+		model.OilFieldID,
+		model.RateOfChange,
+		model.StaleMinutes,
+		model.FrozenMinutes,
+		model.DeviationSensorID,
+		model.DeviationSetpoint,
+		model.DeviationLimit,
+		model.BadQuality,
+		time.Now().Unix(),
+	); err != nil {
+		return nil, err
+	}
+
+	return db.GetSensorAlarmSetting(ctx, model.SensorID)
+}
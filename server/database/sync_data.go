@@ -2,157 +2,18 @@ package database
 
 import (
 	"context"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	client "github.com/influxdata/influxdb1-client/v2"
+	"gitlab.citicom.kz/CloudServer/server/icontext"
 	"gitlab.citicom.kz/CloudServer/server/influx"
 	"gitlab.citicom.kz/CloudServer/server/models"
+	"strconv"
+	"strings"
 	"time"
 )
 
-func (db *DB) SynchronizeControllers(ctx context.Context, influxDB *influx.Influx, controllers []*models.CloudControllerResult, oilFieldID int64) {
-	for _, controller := range controllers {
-		primaryKey := getPrimaryKey(oilFieldID, controller.ControllerId)
-
-		if !db.controllerExists(ctx, primaryKey) {
-			_, err := db.sql.Exec(`INSERT INTO controllers(
-									controller_id, 
-									name,
-									oil_field_id,
-									slave_id,
-									address,
-									port,
-									model,
-									is_enabled,
-									created_ts,
-									updated_ts) 
-									VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-				primaryKey,
-				controller.Name,
-				oilFieldID,
-				controller.SlaveId,
-				controller.Address,
-				controller.Port,
-				controller.Model,
-				controller.IsEnabled,
-				controller.CreatedTs,
-				controller.UpdatedTs,
-			)
-			if err != nil {
-				fmt.Println("CONTROLLER INSERT ERROR: ", err)
-				continue
-			}
-		} else {
-			_, err := db.sql.Exec(`UPDATE controllers SET 
-									name=?, 
-									oil_field_id=?, 
-									slave_id=?,
-									address=?,
-									port=?,
-									model=?,
-									is_enabled=?,
-									created_ts=?,
-									updated_ts=?
-									WHERE controller_id=?`,
-				controller.Name,
-				oilFieldID,
-				controller.SlaveId,
-				controller.Address,
-				controller.Port,
-				controller.Model,
-				controller.IsEnabled,
-				controller.CreatedTs,
-				controller.UpdatedTs,
-				primaryKey,
-			)
-			if err != nil {
-				fmt.Println("CONTROLLER UPDATE ERROR: ", err)
-				continue
-			}
-		}
-
-		for _, sensor := range controller.Sensors {
-			sensorPrimaryKey := getPrimaryKey(primaryKey, sensor.TagName)
-
-			if !db.sensorExists(ctx, sensorPrimaryKey) {
-				_, err := db.sql.Exec(`INSERT INTO sensors(
-										sensor_id,
-										tag_name,
-										controller_id,
-										transform,
-										address,
-										range_l,
-										range_h,
-										alarm_l,
-										alarm_ll,
-										alarm_h,
-										alarm_hh,
-										unit,
-										is_enabled,
-										created_ts,
-										updated_ts) 
-										VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-					sensorPrimaryKey,
-					sensor.TagName,
-					primaryKey,
-					sensor.Transform,
-					sensor.Address,
-					sensor.RangeL,
-					sensor.RangeH,
-					sensor.AlarmL,
-					sensor.AlarmLL,
-					sensor.AlarmH,
-					sensor.AlarmHH,
-					sensor.Unit,
-					sensor.IsEnabled,
-					sensor.CreatedTs,
-					sensor.UpdatedTs,
-				)
-				if err != nil {
-					fmt.Println("SENSOR INSERT ERROR: ", err)
-					continue
-				}
-			} else {
-				_, err := db.sql.Exec(`UPDATE sensors SET 
-										tag_name=?, 
-										controller_id=?, 
-										transform=?,
-										address=?,
-										range_l=?,
-										range_h=?,
-										alarm_l=?,
-										alarm_ll=?,
-										alarm_h=?,
-										alarm_hh=?,
-										unit=?,
-										is_enabled=?,
-										created_ts=?,
-										updated_ts=?
-										WHERE sensor_id=?`,
-					sensor.TagName,
-					primaryKey,
-					sensor.Transform,
-					sensor.Address,
-					sensor.RangeL,
-					sensor.RangeH,
-					sensor.AlarmL,
-					sensor.AlarmLL,
-					sensor.AlarmH,
-					sensor.AlarmHH,
-					sensor.Unit,
-					sensor.IsEnabled,
-					sensor.CreatedTs,
-					sensor.UpdatedTs,
-					sensorPrimaryKey,
-				)
-				if err != nil {
-					fmt.Println("SENSOR UPDATE ERROR: ", err)
-					continue
-				}
-			}
-		}
-	}
-}
-
 func (db *DB) SynchronizeSensorData(ctx context.Context, influxDB *influx.Influx, sensorDatas []*models.SensorDataResult, oilFieldID int64) models.Alarms {
 	//synchronizedIds := make([]int64, 0, 10)
 	alarms := models.Alarms{
@@ -206,34 +67,104 @@ func (db *DB) SynchronizeSensorData(ctx context.Context, influxDB *influx.Influx
 	return alarms
 }
 
-func (db *DB) SynchronizeData(
+// configSyncChunk - rows per multi-row upsert of the controllers or sensors of a sync file.
+const configSyncChunk = 500
+
+var controllerSyncColumns = []string{
+	"controller_id",
+	"name",
+	"oil_field_id",
+	"slave_id",
+	"address",
+	"port",
+	"model",
+	"is_enabled",
+	"created_ts",
+	"updated_ts",
+	"is_deleted",
+	"deleted_ts",
+}
+
+var sensorSyncColumns = []string{
+	"sensor_id",
+	"tag_name",
+	"controller_id",
+	"transform",
+	"address",
+	"range_l",
+	"range_h",
+	"alarm_l",
+	"alarm_ll",
+	"alarm_h",
+	"alarm_hh",
+	"unit",
+	"is_enabled",
+	"created_ts",
+	"updated_ts",
+	"value_type",
+	"enum_labels",
+	"alarm_states",
+	"is_deleted",
+	"deleted_ts",
+}
+
+// syncRowState - the cloud copy of a controller or sensor of a sync file, sensor holds the settings of a sensor.
+type syncRowState struct {
+	updatedTs int64
+	deleted   bool
+	sensor    *models.SensorResultCloud
+}
+
+// SynchronizeCloudControllers - upserts the controllers and sensors of a sync file in one transaction and returns
+// its sensors, the deleted ones it restored and the counts of the rows. Rows whose updatedTs did not change are not
+// written, rows edited in the cloud later than the file are kept and their sensors take the cloud settings, so alarms
+// follow them until the field applies them. Storing a file again is safe, the rows are matched by their primary keys.
+func (db *DB) SynchronizeCloudControllers(
 	ctx context.Context,
-	influxDB *influx.Influx,
 	controllers []*models.CloudControllersResult,
-	data []*models.SensorData,
 	oilFieldID int64,
-) models.Alarms {
+) ([]*models.SensorResultCloud, []*models.SyncItemEvent, models.ConfigSyncCounts, error) {
 	sensors := make([]*models.SensorResultCloud, 0, 10)
-	alarms := models.Alarms{
-		Alarms: make([]*models.Alarm, 0, 10),
+	restored := make([]*models.SyncItemEvent, 0)
+	counts := models.ConfigSyncCounts{}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, nil, counts, err
+	}
+
+	cloudControllers, err := tx.controllerSyncStates(oilFieldID)
+	if err != nil {
+		_ = tx.sql.Rollback()
+		return nil, nil, counts, err
+	}
+	cloudSensors, err := tx.sensorSyncStates(oilFieldID)
+	if err != nil {
+		_ = tx.sql.Rollback()
+		return nil, nil, counts, err
 	}
 
+	controllerRows := make([][]interface{}, 0, len(controllers))
+	sensorRows := make([][]interface{}, 0, 10)
+	restoredControllers := make([]string, 0)
+	restoredSensors := make([]string, 0)
 	for _, controller := range controllers {
 		primaryKey := getPrimaryKey(oilFieldID, controller.ControllerId)
 
-		if !db.controllerExists(ctx, primaryKey) {
-			_, err := db.sql.Exec(`INSERT INTO controllers(
-									controller_id, 
-									name,
-									oil_field_id,
-									slave_id,
-									address,
-									port,
-									model,
-									is_enabled,
-									created_ts,
-									updated_ts) 
-									VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		cloud, exists := cloudControllers[primaryKey]
+		switch {
+		case !exists:
+			counts.Inserted++
+		case cloud.updatedTs < controller.UpdatedTs:
+			counts.Updated++
+		default:
+			counts.Unchanged++
+		}
+		if exists && cloud.deleted {
+			restored = append(restored, syncItemEvent(oilFieldID, models.SYNC_ITEM_CONTROLLER, primaryKey, primaryKey, controller.Name, models.SYNC_ITEM_EVENT_RESTORED))
+		}
+		if !exists || cloud.updatedTs < controller.UpdatedTs {
+			controllerRows = append(controllerRows, []interface{}{
 				primaryKey,
 				controller.Name,
 				oilFieldID,
@@ -244,62 +175,47 @@ func (db *DB) SynchronizeData(
 				controller.IsEnabled,
 				controller.CreatedTs,
 				controller.UpdatedTs,
-			)
-			if err != nil {
-				fmt.Println("CONTROLLER INSERT ERROR: ", err)
-				continue
-			}
-		} else {
-			_, err := db.sql.Exec(`UPDATE controllers SET 
-									name=?, 
-									oil_field_id=?, 
-									slave_id=?,
-									address=?,
-									port=?,
-									model=?,
-									is_enabled=?,
-									created_ts=?,
-									updated_ts=?
-									WHERE controller_id=?`,
-				controller.Name,
-				oilFieldID,
-				controller.SlaveId,
-				controller.Address,
-				controller.Port,
-				controller.Model,
-				controller.IsEnabled,
-				controller.CreatedTs,
-				controller.UpdatedTs,
-				primaryKey,
-			)
-			if err != nil {
-				fmt.Println("CONTROLLER UPDATE ERROR: ", err)
-				continue
-			}
+				false,
+				0,
+			})
+			// a controller listed again in the file is compared with the row written now
+			cloudControllers[primaryKey] = &syncRowState{updatedTs: controller.UpdatedTs}
+		} else if cloud.deleted {
+			restoredControllers = append(restoredControllers, primaryKey)
+			cloud.deleted = false
 		}
 
 		for _, sensor := range controller.Sensors {
 			sensors = append(sensors, sensor)
 			sensorPrimaryKey := getPrimaryKey(primaryKey, sensor.TagName)
 
-			if !db.sensorExists(ctx, sensorPrimaryKey) {
-				_, err := db.sql.Exec(`INSERT INTO sensors(
-										sensor_id,
-										tag_name,
-										controller_id,
-										transform,
-										address,
-										range_l,
-										range_h,
-										alarm_l,
-										alarm_ll,
-										alarm_h,
-										alarm_hh,
-										unit,
-										is_enabled,
-										created_ts,
-										updated_ts) 
-										VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			cloud, exists := cloudSensors[sensorPrimaryKey]
+			switch {
+			case !exists:
+				counts.Inserted++
+			case cloud.updatedTs < sensor.UpdatedTs:
+				counts.Updated++
+			default:
+				counts.Unchanged++
+			}
+			if exists && cloud.deleted {
+				restored = append(restored, syncItemEvent(oilFieldID, models.SYNC_ITEM_SENSOR, sensorPrimaryKey, primaryKey, sensor.TagName, models.SYNC_ITEM_EVENT_RESTORED))
+			}
+			if exists && cloud.updatedTs > sensor.UpdatedTs {
+				// edited in the cloud after the field, alarms follow the cloud settings until the field applies them
+				sensor.RangeL = cloud.sensor.RangeL
+				sensor.RangeH = cloud.sensor.RangeH
+				sensor.AlarmL = cloud.sensor.AlarmL
+				sensor.AlarmLL = cloud.sensor.AlarmLL
+				sensor.AlarmH = cloud.sensor.AlarmH
+				sensor.AlarmHH = cloud.sensor.AlarmHH
+				sensor.Unit = cloud.sensor.Unit
+				sensor.IsEnabled = cloud.sensor.IsEnabled
+				sensor.AlarmStates = cloud.sensor.AlarmStates
+				sensor.UpdatedTs = cloud.updatedTs
+			}
+			if !exists || cloud.updatedTs < sensor.UpdatedTs {
+				sensorRows = append(sensorRows, []interface{}{
 					sensorPrimaryKey,
 					sensor.TagName,
 					primaryKey,
@@ -315,56 +231,288 @@ func (db *DB) SynchronizeData(
 					sensor.IsEnabled,
 					sensor.CreatedTs,
 					sensor.UpdatedTs,
-				)
-				if err != nil {
-					fmt.Println("SENSOR INSERT ERROR: ", err)
-					continue
-				}
-			} else {
-				_, err := db.sql.Exec(`UPDATE sensors SET 
-										tag_name=?, 
-										controller_id=?, 
-										transform=?,
-										address=?,
-										range_l=?,
-										range_h=?,
-										alarm_l=?,
-										alarm_ll=?,
-										alarm_h=?,
-										alarm_hh=?,
-										unit=?,
-										is_enabled=?,
-										created_ts=?,
-										updated_ts=?
-										WHERE sensor_id=?`,
-					sensor.TagName,
-					primaryKey,
-					sensor.Transform,
-					sensor.Address,
-					sensor.RangeL,
-					sensor.RangeH,
-					sensor.AlarmL,
-					sensor.AlarmLL,
-					sensor.AlarmH,
-					sensor.AlarmHH,
-					sensor.Unit,
-					sensor.IsEnabled,
-					sensor.CreatedTs,
-					sensor.UpdatedTs,
-					sensorPrimaryKey,
-				)
-				if err != nil {
-					fmt.Println("SENSOR UPDATE ERROR: ", err)
-					continue
-				}
+					models.NormalizeSensorType(sensor.ValueType),
+					marshalText(sensor.EnumLabels),
+					marshalText(sensor.AlarmStates),
+					false,
+					0,
+				})
+			} else if cloud.deleted {
+				restoredSensors = append(restoredSensors, sensorPrimaryKey)
 			}
+			cloudSensors[sensorPrimaryKey] = &syncRowState{updatedTs: sensor.UpdatedTs, sensor: sensor}
+		}
+	}
+
+	if err := tx.upsertRows("controllers", controllerSyncColumns, controllerRows); err != nil {
+		_ = tx.sql.Rollback()
+		return nil, nil, counts, err
+	}
+	if err := tx.upsertRows("sensors", sensorSyncColumns, sensorRows); err != nil {
+		_ = tx.sql.Rollback()
+		return nil, nil, counts, err
+	}
+	if err := tx.restoreRows("controllers", "controller_id", restoredControllers); err != nil {
+		_ = tx.sql.Rollback()
+		return nil, nil, counts, err
+	}
+	if err := tx.restoreRows("sensors", "sensor_id", restoredSensors); err != nil {
+		_ = tx.sql.Rollback()
+		return nil, nil, counts, err
+	}
+
+	if err := tx.sql.Commit(); err != nil {
+		return nil, nil, counts, err
+	}
+
+	return sensors, restored, counts, nil
+}
+
+// controllerSyncStates - returns the controllers of the oil field by primary key, locked until the sync ends.
+func (tx *Tx) controllerSyncStates(oilFieldID int64) (map[string]*syncRowState, error) {
+	rows, err := tx.sql.Query(`SELECT c.controller_id, c.updated_ts, c.is_deleted
+			FROM controllers AS c
+			WHERE c.oil_field_id=? FOR UPDATE`, oilFieldID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	states := make(map[string]*syncRowState)
+	for rows.Next() {
+		var primaryKey string
+		state := &syncRowState{}
+		if err := rows.Scan(&primaryKey, &state.updatedTs, &state.deleted); err != nil {
+			return nil, err
 		}
+		states[primaryKey] = state
 	}
 
+	return states, rows.Err()
+}
+
+// sensorSyncStates - returns the sensors of the oil field with their settings by primary key, locked until
+// the sync ends.
+func (tx *Tx) sensorSyncStates(oilFieldID int64) (map[string]*syncRowState, error) {
+	rows, err := tx.sql.Query(`SELECT
+			s.sensor_id,
+			s.updated_ts,
+			s.is_deleted,
+			s.range_l,
+			s.range_h,
+			s.alarm_l,
+			s.alarm_ll,
+			s.alarm_h,
+			s.alarm_hh,
+			s.unit,
+			s.is_enabled,
+			s.alarm_states
+			FROM sensors AS s
+			JOIN controllers c
+			ON s.controller_id = c.controller_id
+			WHERE c.oil_field_id=? FOR UPDATE`, oilFieldID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	states := make(map[string]*syncRowState)
+	for rows.Next() {
+		var primaryKey, alarmStates string
+		state := &syncRowState{sensor: &models.SensorResultCloud{}}
+		if err := rows.Scan(
+			&primaryKey,
+			&state.updatedTs,
+			&state.deleted,
+			&state.sensor.RangeL,
+			&state.sensor.RangeH,
+			&state.sensor.AlarmL,
+			&state.sensor.AlarmLL,
+			&state.sensor.AlarmH,
+			&state.sensor.AlarmHH,
+			&state.sensor.Unit,
+			&state.sensor.IsEnabled,
+			&alarmStates,
+		); err != nil {
+			return nil, err
+		}
+		unmarshalText(alarmStates, &state.sensor.AlarmStates)
+		states[primaryKey] = state
+	}
+
+	return states, rows.Err()
+}
+
+// upsertRows - writes the rows with multi-row INSERT ... ON DUPLICATE KEY UPDATE, configSyncChunk rows at a time.
+// The first column is the primary key, the others are overwritten.
+func (tx *Tx) upsertRows(table string, columns []string, rows [][]interface{}) error {
+	updates := make([]string, 0, len(columns)-1)
+	for _, column := range columns[1:] {
+		updates = append(updates, fmt.Sprintf("%s=VALUES(%s)", column, column))
+	}
+	placeholder := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ") + ")"
+
+	for start := 0; start < len(rows); start += configSyncChunk {
+		end := start + configSyncChunk
+		if end > len(rows) {
+			end = len(rows)
+		}
+
+		values := make([]string, 0, end-start)
+		args := make([]interface{}, 0, (end-start)*len(columns))
+		for _, row := range rows[start:end] {
+			values = append(values, placeholder)
+			args = append(args, row...)
+		}
+
+		if _, err := tx.sql.Exec(fmt.Sprintf(`INSERT INTO %s(%s) VALUES %s ON DUPLICATE KEY UPDATE %s`,
+			table,
+			strings.Join(columns, ", "),
+			strings.Join(values, ", "),
+			strings.Join(updates, ", "),
+		), args...); err != nil {
+			return fmt.Errorf("Upsert %s: %v", table, err)
+		}
+	}
+
+	return nil
+}
+
+// restoreRows - clears the deleted mark of the rows not otherwise written by the sync.
+func (tx *Tx) restoreRows(table string, keyColumn string, keys []string) error {
+	for start := 0; start < len(keys); start += configSyncChunk {
+		end := start + configSyncChunk
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		args := make([]interface{}, 0, end-start)
+		for _, key := range keys[start:end] {
+			args = append(args, key)
+		}
+
+		if _, err := tx.sql.Exec(fmt.Sprintf(`UPDATE %s SET is_deleted=0, deleted_ts=0 WHERE %s IN (%s)`,
+			table,
+			keyColumn,
+			strings.TrimSuffix(strings.Repeat("?, ", len(args)), ", "),
+		), args...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DeleteMissingControllers - the controllers of a full config are every controller of the oil field with every
+// sensor. The ones missing are marked deleted, their rows and history are kept until they come back.
+func (db *DB) DeleteMissingControllers(
+	ctx context.Context,
+	controllers []*models.CloudControllersResult,
+	oilFieldID int64,
+) ([]*models.SyncItemEvent, error) {
+	present := make(map[string]bool)
+	for _, controller := range controllers {
+		primaryKey := getPrimaryKey(oilFieldID, controller.ControllerId)
+		present[primaryKey] = true
+		for _, sensor := range controller.Sensors {
+			present[getPrimaryKey(primaryKey, sensor.TagName)] = true
+		}
+	}
+
+	missing, err := db.missingSyncItems(`SELECT c.controller_id, c.controller_id, c.name
+			FROM controllers AS c
+			WHERE c.oil_field_id=? AND c.is_deleted=0`, oilFieldID, models.SYNC_ITEM_CONTROLLER, present)
+	if err != nil {
+		return nil, err
+	}
+	missingSensors, err := db.missingSyncItems(`SELECT s.sensor_id, s.controller_id, s.tag_name
+			FROM sensors AS s
+			JOIN controllers c
+			ON s.controller_id = c.controller_id
+			WHERE c.oil_field_id=? AND s.is_deleted=0`, oilFieldID, models.SYNC_ITEM_SENSOR, present)
+	if err != nil {
+		return nil, err
+	}
+	missing = append(missing, missingSensors...)
+	if len(missing) == 0 {
+		return missing, nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, event := range missing {
+		query := `UPDATE sensors SET is_deleted=1, deleted_ts=? WHERE sensor_id=?`
+		if event.ItemType == models.SYNC_ITEM_CONTROLLER {
+			query = `UPDATE controllers SET is_deleted=1, deleted_ts=? WHERE controller_id=?`
+		}
+		if _, err := tx.sql.Exec(query, event.Ts, event.ItemID); err != nil {
+			_ = tx.sql.Rollback()
+			return nil, err
+		}
+	}
+
+	if err := tx.sql.Commit(); err != nil {
+		return nil, err
+	}
+
+	return missing, nil
+}
+
+// missingSyncItems - returns a deleted event for every row of the query, selecting id, controller id and name,
+// whose id is not present.
+func (db *DB) missingSyncItems(query string, oilFieldID int64, itemType string, present map[string]bool) ([]*models.SyncItemEvent, error) {
+	rows, err := db.sql.Query(query, oilFieldID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	missing := make([]*models.SyncItemEvent, 0)
+	for rows.Next() {
+		var itemID, controllerID, name string
+		if err := rows.Scan(&itemID, &controllerID, &name); err != nil {
+			return nil, err
+		}
+		if !present[itemID] {
+			missing = append(missing, syncItemEvent(oilFieldID, itemType, itemID, controllerID, name, models.SYNC_ITEM_EVENT_DELETED))
+		}
+	}
+
+	return missing, rows.Err()
+}
+
+func syncItemEvent(oilFieldID int64, itemType string, itemID string, controllerID string, name string, event string) *models.SyncItemEvent {
+	return &models.SyncItemEvent{
+		OilFieldID:   oilFieldID,
+		ItemType:     itemType,
+		ItemID:       itemID,
+		ControllerID: controllerID,
+		Name:         name,
+		Event:        event,
+		Ts:           time.Now().Unix(),
+	}
+}
+
+// SynchronizeSamples - writes a batch of samples of a sync file to InfluxDB in one request and returns the samples
+// of known sensors. Points overwrite by tags and time, so a batch may be written again. A batch InfluxDB refuses
+// is spooled to disk and counts as stored, it is written later by the spool daemon.
+func (db *DB) SynchronizeSamples(
+	ctx context.Context,
+	influxDB *influx.Influx,
+	sensors []*models.SensorResultCloud,
+	data []*models.SensorData,
+	oilFieldID int64,
+) ([]*models.SensorSample, error) {
+	l, _ := icontext.GetLogger(ctx)
+	samples := make([]*models.SensorSample, 0, len(data))
+
 	points, err := influxDB.NewBatchPoints()
 	if err != nil {
 		fmt.Println("INFLUX POINTS ERROR: ", err)
-		return alarms
+		return nil, err
 	}
 
 	for _, sensorData := range data {
@@ -377,11 +525,21 @@ func (db *DB) SynchronizeData(
 		primaryKey := getPrimaryKey(oilFieldID, sensor.ControllerID)
 		sensorPrimaryKey := getPrimaryKey(primaryKey, sensor.TagName)
 
+		value, number, state, err := sensor.SampleValue(sensorData)
+		if err != nil {
+			l.Errorf("Sample of sensor %s skipped: %s", sensorPrimaryKey, err.Error())
+			continue
+		}
+
 		tags := map[string]string{
-			"tagName": sensorPrimaryKey,
+			"tagName":      sensorPrimaryKey,
+			"oilFieldId":   strconv.FormatInt(oilFieldID, 10),
+			"controllerId": primaryKey,
 		}
-		value := map[string]interface{} {
-			"value": sensorData.FormattedValue,
+		value["quality"] = sensorData.SampleQuality()
+		value["sampleId"] = sensorData.SensorDataId
+		if len(sensorData.RawValue) > 0 {
+			value["raw"] = hex.EncodeToString(sensorData.RawValue)
 		}
 		createdTime := time.Unix(sensorData.CreatedTs, 0)
 		point, err := client.NewPoint(
@@ -396,29 +554,28 @@ func (db *DB) SynchronizeData(
 		}
 		points.AddPoint(point)
 
-		hasAlarm, alarmType, alarmValue := sensorData.HasAlarm(sensor)
-		if hasAlarm {
-			alarm := &models.Alarm{
-				OilFieldID:   oilFieldID,
-				ControllerID: primaryKey,
-				SensorID:     sensorPrimaryKey,
-				AlarmType:    alarmType,
-				AlarmValue:   alarmValue,
-				Value:        sensorData.FormattedValue,
-				Time:         sensorData.CreatedTs,
-			}
-			alarms.Add(alarm)
-		}
+		samples = append(samples, &models.SensorSample{
+			OilFieldID:   oilFieldID,
+			ControllerID: primaryKey,
+			SensorID:     sensorPrimaryKey,
+			Sensor:       sensor,
+			Value:        number,
+			State:        state,
+			Quality:      sensorData.SampleQuality(),
+			Time:         sensorData.CreatedTs,
+		})
 	}
 
-	err = influxDB.Write(points)
+	spooled, err := influxDB.WriteDurable(points)
 	if err != nil {
 		fmt.Println("SAVE INFLUX ERROR: ", err)
-	} else {
-		fmt.Println("INFLUX SAVED")
+		return nil, err
+	}
+	if spooled {
+		l.Warnf("InfluxDB unavailable, %d points of oil field %d spooled", len(points.Points()), oilFieldID)
 	}
 
-	return alarms
+	return samples, nil
 }
 
 func findSensor(a []*models.SensorResultCloud, tagName string) int {
@@ -430,22 +587,23 @@ func findSensor(a []*models.SensorResultCloud, tagName string) int {
 	return -1
 }
 
-func (db *DB) controllerExists(ctx context.Context, pk string) bool {
-	return db.RowExists(
-		ctx,
-		`SELECT c.controller_id FROM controllers AS c WHERE c.controller_id=?`,
-		pk,
-	)
+func getPrimaryKey(first interface{}, second interface{}) string {
+	return fmt.Sprintf("%v_%v", first, second)
 }
 
-func (db *DB) sensorExists(ctx context.Context, pk string) bool {
-	return db.RowExists(
-		ctx,
-		`SELECT s.sensor_id FROM sensors AS s WHERE s.sensor_id=?`,
-		pk,
-	)
+// marshalText - the value as the JSON stored in a TEXT column, empty for nil.
+func marshalText(value interface{}) string {
+	bytes, err := json.Marshal(value)
+	if err != nil || string(bytes) == "null" {
+		return ""
+	}
+
+	return string(bytes)
 }
 
-func getPrimaryKey(first interface{}, second interface{}) string {
-	return fmt.Sprintf("%v_%v", first, second)
+// unmarshalText - decodes the JSON of a TEXT column, an empty or invalid one leaves value unchanged.
+func unmarshalText(text string, value interface{}) {
+	if text != "" {
+		_ = json.Unmarshal([]byte(text), value)
+	}
 }
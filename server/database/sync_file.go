@@ -0,0 +1,160 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gitlab.citicom.kz/CloudServer/server/icontext"
+	"gitlab.citicom.kz/CloudServer/server/models"
+)
+
+const syncFileSelectSQL = `SELECT
+	f.file_id,
+	f.oil_field_id,
+	f.file_name,
+	f.checksum,
+	f.points,
+	f.status,
+	f.error_code,
+	f.error,
+	f.attempts,
+	f.created_ts,
+	f.updated_ts
+	FROM sync_files AS f`
+
+func scanSyncFile(row rowScanner) (*models.SyncFile, error) {
+	file := &models.SyncFile{}
+	if err := row.Scan(
+		&file.FileID,
+		&file.OilFieldID,
+		&file.FileName,
+		&file.Checksum,
+		&file.Points,
+		&file.Status,
+		&file.ErrorCode,
+		&file.Error,
+		&file.Attempts,
+		&file.CreatedTs,
+		&file.UpdatedTs,
+	); err != nil {
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// GetSyncFiles - returns the latest ledger records, optionally of one oil field and status.
+func (db *DB) GetSyncFiles(ctx context.Context, companyID int64, all bool, filter *models.SyncFileFilter) ([]*models.SyncFile, error) {
+	l, _ := icontext.GetLogger(ctx)
+
+	where := ""
+	args := make([]interface{}, 0, 3)
+	if !all {
+		where += " AND oi.company_id=?"
+		args = append(args, companyID)
+	}
+	if filter.OilFieldID > 0 {
+		where += " AND f.oil_field_id=?"
+		args = append(args, filter.OilFieldID)
+	}
+	if filter.Status != "" {
+		where += " AND f.status=?"
+		args = append(args, filter.Status)
+	}
+
+	rows, err := db.sql.Query(fmt.Sprintf(`%s
+		JOIN oil_field oi
+		ON f.oil_field_id = oi.oil_field_id
+		WHERE 1=1%s
+		ORDER BY f.updated_ts DESC, f.file_id DESC
+		LIMIT %d`, syncFileSelectSQL, where, filter.Limit), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	files := make([]*models.SyncFile, 0, 10)
+	for rows.Next() {
+		file, err := scanSyncFile(rows)
+		if err != nil {
+			l.WithFields(log.Fields{
+				"Error": err,
+			}).Error("Scan sync file error")
+			continue
+		}
+		files = append(files, file)
+	}
+
+	return files, nil
+}
+
+func (db *DB) GetSyncFile(ctx context.Context, oilFieldID int64, fileName string, checksum string) (*models.SyncFile, error) {
+	return scanSyncFile(db.sql.QueryRow(fmt.Sprintf(`%s WHERE f.oil_field_id=? AND f.file_name=? AND f.checksum=?`, syncFileSelectSQL), oilFieldID, fileName, checksum))
+}
+
+// StartSyncFile - records another delivery of the file. An ingested file keeps its status so the caller can skip it.
+func (db *DB) StartSyncFile(ctx context.Context, oilFieldID int64, fileName string, checksum string) (*models.SyncFile, error) {
+	if _, err := db.sql.Exec(`INSERT INTO sync_files(
+			oil_field_id,
+			file_name,
+			checksum,
+			status,
+			attempts,
+			created_ts,
+			updated_ts) VALUES(?, ?, ?, ?, 1, ?, ?)
+			ON DUPLICATE KEY UPDATE
+			status=IF(status=?, status, VALUES(status)),
+			attempts=attempts+1,
+			updated_ts=VALUES(updated_ts)`,
+		oilFieldID,
+		fileName,
+		checksum,
+		models.SYNC_FILE_STATUS_RECEIVED,
+		time.Now().Unix(),
+		time.Now().Unix(),
+		models.SYNC_FILE_STATUS_INGESTED,
+	); err != nil {
+		return nil, err
+	}
+
+	return db.GetSyncFile(ctx, oilFieldID, fileName, checksum)
+}
+
+// SetSyncFileIngested - marks the file stored, called once the MySQL and Influx writes succeeded.
+func (db *DB) SetSyncFileIngested(ctx context.Context, fileID int64, points int) error {
+	_, err := db.sql.Exec(`UPDATE sync_files SET
+			status=?,
+			points=?,
+			error_code='',
+			error='',
+			updated_ts=?
+			WHERE file_id=?`,
+		models.SYNC_FILE_STATUS_INGESTED,
+		points,
+		time.Now().Unix(),
+		fileID,
+	)
+	return err
+}
+
+// SetSyncFileFailed - marks the file failed with the code sent in the nack.
+func (db *DB) SetSyncFileFailed(ctx context.Context, fileID int64, code string, errText string) error {
+	if len(errText) > models.SyncFileErrorMaxLength {
+		errText = errText[:models.SyncFileErrorMaxLength]
+	}
+
+	_, err := db.sql.Exec(`UPDATE sync_files SET
+			status=?,
+			error_code=?,
+			error=?,
+			updated_ts=?
+			WHERE file_id=?`,
+		models.SYNC_FILE_STATUS_FAILED,
+		code,
+		errText,
+		time.Now().Unix(),
+		fileID,
+	)
+	return err
+}
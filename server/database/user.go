@@ -96,7 +96,7 @@ func (db *DB) GetUser(ctx context.Context, userID int64) (*models.User, error) {
 		&user.CreatedTs,
 		&user.UpdatedTs,
 	); err != nil {
-		l.Errorf("SELECT Company ERROR: %f", err.Error())
+		l.Errorf("SELECT Company ERROR: %s", err.Error())
 		return nil, err
 	}
 
@@ -0,0 +1,156 @@
+package server
+
+import (
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	"gitlab.citicom.kz/CloudServer/server/models"
+)
+
+// fieldQueue - pending messages of one oil field. A queue is handed to at most one worker at a time,
+// which keeps the messages of the field in order.
+type fieldQueue struct {
+	oilFieldID int64
+	messages   chan *incomingMessageWithContext
+	scheduled  bool
+	processing bool
+}
+
+// dispatcher - processes the incoming sync messages on a fixed number of workers. Oil fields take turns,
+// one message each, a field with a full queue blocks its sender until a worker catches up.
+type dispatcher struct {
+	mutex     sync.Mutex
+	ready     *sync.Cond
+	queues    map[int64]*fieldQueue
+	pending   []*fieldQueue
+	queueSize int
+	workers   int
+	process   func(*incomingMessageWithContext)
+	logger    *log.Entry
+}
+
+func newDispatcher(queueSize int, process func(*incomingMessageWithContext), logger *log.Entry) *dispatcher {
+	if queueSize < 1 {
+		queueSize = 1
+	}
+
+	d := &dispatcher{
+		queues:    make(map[int64]*fieldQueue),
+		pending:   make([]*fieldQueue, 0, 10),
+		queueSize: queueSize,
+		process:   process,
+		logger:    logger,
+	}
+	d.ready = sync.NewCond(&d.mutex)
+
+	return d
+}
+
+// Run - starts the workers.
+func (d *dispatcher) Run(workers int) {
+	if workers < 1 {
+		workers = 1
+	}
+	d.workers = workers
+	for i := 0; i < workers; i++ {
+		go d.work()
+	}
+}
+
+// Dispatch - queues the message behind the earlier messages of its oil field. Blocks while the queue of the
+// field is full, returns false if cancel closed first.
+func (d *dispatcher) Dispatch(message *incomingMessageWithContext, cancel <-chan bool) bool {
+	queue := d.queue(message.OilFieldId)
+
+	select {
+	case queue.messages <- message:
+	case <-cancel:
+		return false
+	}
+
+	d.mutex.Lock()
+	if !queue.scheduled {
+		queue.scheduled = true
+		d.pending = append(d.pending, queue)
+		d.ready.Signal()
+	}
+	d.mutex.Unlock()
+
+	return true
+}
+
+func (d *dispatcher) queue(oilFieldID int64) *fieldQueue {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	queue, exists := d.queues[oilFieldID]
+	if !exists {
+		queue = &fieldQueue{
+			oilFieldID: oilFieldID,
+			messages:   make(chan *incomingMessageWithContext, d.queueSize),
+		}
+		d.queues[oilFieldID] = queue
+	}
+
+	return queue
+}
+
+func (d *dispatcher) work() {
+	for {
+		d.mutex.Lock()
+		for len(d.pending) == 0 {
+			d.ready.Wait()
+		}
+		queue := d.pending[0]
+		d.pending = d.pending[1:]
+		queue.processing = true
+		d.mutex.Unlock()
+
+		select {
+		case message := <-queue.messages:
+			d.processSafe(message)
+		default:
+		}
+
+		d.mutex.Lock()
+		queue.processing = false
+		if len(queue.messages) > 0 {
+			d.pending = append(d.pending, queue)
+			d.ready.Signal()
+		} else {
+			queue.scheduled = false
+		}
+		d.mutex.Unlock()
+	}
+}
+
+func (d *dispatcher) processSafe(message *incomingMessageWithContext) {
+	defer func() {
+		if err := recover(); err != nil {
+			d.logger.Errorf("Panic processing message %s of oil field %d: %v", message.Message.Type, message.OilFieldId, err)
+		}
+	}()
+
+	d.process(message)
+}
+
+// Depths - the queued messages of every oil field that has any or is being processed.
+func (d *dispatcher) Depths() []*models.SyncQueue {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	depths := make([]*models.SyncQueue, 0, len(d.queues))
+	for _, queue := range d.queues {
+		if len(queue.messages) == 0 && !queue.processing {
+			continue
+		}
+		depths = append(depths, &models.SyncQueue{
+			OilFieldID: queue.oilFieldID,
+			Depth:      len(queue.messages),
+			Capacity:   d.queueSize,
+			Processing: queue.processing,
+		})
+	}
+
+	return depths
+}
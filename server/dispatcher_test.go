@@ -0,0 +1,156 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gitlab.citicom.kz/CloudServer/server/models"
+)
+
+func testIncomingMessage(oilFieldID int64, sequence int64) *incomingMessageWithContext {
+	return &incomingMessageWithContext{
+		Message:    &models.InputMessage{Type: "test", Timestamp: sequence},
+		OilFieldId: oilFieldID,
+		Context:    context.Background(),
+	}
+}
+
+func TestDispatcherKeepsFieldOrder(t *testing.T) {
+	const fields = 8
+	const messages = 200
+
+	var mutex sync.Mutex
+	received := make(map[int64][]int64)
+	var busy [fields + 1]int32
+	var wg sync.WaitGroup
+	wg.Add(fields * messages)
+
+	d := newDispatcher(4, func(message *incomingMessageWithContext) {
+		defer wg.Done()
+		if atomic.AddInt32(&busy[message.OilFieldId], 1) != 1 {
+			t.Errorf("oil field %d processed by two workers at once", message.OilFieldId)
+		}
+
+		mutex.Lock()
+		received[message.OilFieldId] = append(received[message.OilFieldId], message.Message.Timestamp)
+		mutex.Unlock()
+
+		atomic.AddInt32(&busy[message.OilFieldId], -1)
+	}, testLogger())
+	d.Run(4)
+
+	var senders sync.WaitGroup
+	for oilFieldID := int64(1); oilFieldID <= fields; oilFieldID++ {
+		senders.Add(1)
+		go func(oilFieldID int64) {
+			defer senders.Done()
+			for sequence := int64(0); sequence < messages; sequence++ {
+				if !d.Dispatch(testIncomingMessage(oilFieldID, sequence), make(chan bool)) {
+					t.Errorf("message %d of oil field %d not dispatched", sequence, oilFieldID)
+				}
+				d.Depths()
+			}
+		}(oilFieldID)
+	}
+	senders.Wait()
+	wg.Wait()
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	for oilFieldID := int64(1); oilFieldID <= fields; oilFieldID++ {
+		sequences := received[oilFieldID]
+		if len(sequences) != messages {
+			t.Fatalf("oil field %d: %d messages processed, want %d", oilFieldID, len(sequences), messages)
+		}
+		for i, sequence := range sequences {
+			if sequence != int64(i) {
+				t.Fatalf("oil field %d: message %d processed at position %d", oilFieldID, sequence, i)
+			}
+		}
+	}
+}
+
+func TestDispatcherFieldsTakeTurns(t *testing.T) {
+	release := make(chan struct{})
+	processed := make(chan int64, 16)
+	d := newDispatcher(4, func(message *incomingMessageWithContext) {
+		<-release
+		processed <- message.OilFieldId
+	}, testLogger())
+
+	// a busy oil field queues its messages before a quiet one sends its only message
+	for sequence := int64(0); sequence < 3; sequence++ {
+		d.Dispatch(testIncomingMessage(1, sequence), make(chan bool))
+	}
+	d.Dispatch(testIncomingMessage(2, 0), make(chan bool))
+	d.Run(1)
+	close(release)
+
+	order := make([]int64, 0, 4)
+	for i := 0; i < 4; i++ {
+		select {
+		case oilFieldID := <-processed:
+			order = append(order, oilFieldID)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("only %d messages processed", len(order))
+		}
+	}
+	if order[1] != 2 {
+		t.Errorf("oil field 2 waited for the whole queue of oil field 1: %v", order)
+	}
+}
+
+func TestDispatcherCancelsFullQueue(t *testing.T) {
+	d := newDispatcher(1, func(message *incomingMessageWithContext) {}, testLogger())
+
+	if !d.Dispatch(testIncomingMessage(1, 0), make(chan bool)) {
+		t.Fatal("first message not dispatched")
+	}
+
+	cancel := make(chan bool)
+	done := make(chan bool)
+	go func() {
+		done <- d.Dispatch(testIncomingMessage(1, 1), cancel)
+	}()
+	close(cancel)
+
+	select {
+	case dispatched := <-done:
+		if dispatched {
+			t.Error("message dispatched to a full queue without workers")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("dispatch blocked after cancel")
+	}
+
+	depths := d.Depths()
+	if len(depths) != 1 || depths[0].OilFieldID != 1 || depths[0].Depth != 1 {
+		t.Errorf("unexpected depths %+v", depths)
+	}
+}
+
+func TestDispatcherRecoversPanic(t *testing.T) {
+	processed := make(chan int64, 2)
+	d := newDispatcher(4, func(message *incomingMessageWithContext) {
+		if message.Message.Timestamp == 0 {
+			panic("test")
+		}
+		processed <- message.Message.Timestamp
+	}, testLogger())
+	d.Run(1)
+
+	d.Dispatch(testIncomingMessage(1, 0), make(chan bool))
+	d.Dispatch(testIncomingMessage(1, 1), make(chan bool))
+
+	select {
+	case sequence := <-processed:
+		if sequence != 1 {
+			t.Errorf("message %d processed, want 1", sequence)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("worker stopped after a panic")
+	}
+}
@@ -0,0 +1,152 @@
+package server
+
+import (
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	"gitlab.citicom.kz/CloudServer/server/models"
+)
+
+// Hub - owns the websocket connections of the users and the sync connections of the oil fields. Every
+// registration, lookup and send goes through it, so connections may come and go from any goroutine.
+// A connection whose output queue is full is a slow consumer, it is closed instead of blocking the sender
+// and its reader unregisters it.
+type Hub struct {
+	mutex     sync.RWMutex
+	users     map[int64][]*SocketConnection
+	oilFields map[int64]*SyncClient
+	logger    *log.Entry
+}
+
+func NewHub(logger *log.Entry) *Hub {
+	return &Hub{
+		users:     make(map[int64][]*SocketConnection),
+		oilFields: make(map[int64]*SyncClient),
+		logger:    logger,
+	}
+}
+
+func (hub *Hub) AddUserConnection(connection *SocketConnection) {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	hub.users[connection.User.UserID] = append(hub.users[connection.User.UserID], connection)
+}
+
+// RemoveUserConnection - closes and unregisters the connection, reports whether it was the last one of the user.
+func (hub *Hub) RemoveUserConnection(userID int64, connectionID string) bool {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	connections, exists := hub.users[userID]
+	if !exists {
+		return false
+	}
+
+	left := make([]*SocketConnection, 0, len(connections))
+	for _, connection := range connections {
+		if connection.ID == connectionID {
+			connection.Close()
+			continue
+		}
+		left = append(left, connection)
+	}
+	if len(left) == len(connections) {
+		return false
+	}
+
+	if len(left) > 0 {
+		hub.users[userID] = left
+		return false
+	}
+	delete(hub.users, userID)
+
+	return true
+}
+
+func (hub *Hub) IsUserOnline(userID int64) bool {
+	hub.mutex.RLock()
+	defer hub.mutex.RUnlock()
+
+	_, exists := hub.users[userID]
+	return exists
+}
+
+// SendToUser - queues the message on every connection of the user.
+func (hub *Hub) SendToUser(userID int64, message *models.OutputMessage) {
+	hub.mutex.RLock()
+	connections := make([]*SocketConnection, len(hub.users[userID]))
+	copy(connections, hub.users[userID])
+	hub.mutex.RUnlock()
+
+	for _, connection := range connections {
+		if !connection.SendMessage(message) {
+			hub.logger.Errorf("Connection %s of user %d is too slow, closing it", connection.ID, userID)
+			connection.Close()
+		}
+	}
+}
+
+// SendToUsers - queues the message on every connection of the users.
+func (hub *Hub) SendToUsers(userIDs []int64, message *models.OutputMessage) {
+	for _, userID := range userIDs {
+		hub.SendToUser(userID, message)
+	}
+}
+
+// AddOilField - registers the sync connection of the oil field, a connection it replaces is closed.
+func (hub *Hub) AddOilField(client *SyncClient) {
+	hub.mutex.Lock()
+	previous, exists := hub.oilFields[client.OilFieldID]
+	hub.oilFields[client.OilFieldID] = client
+	hub.mutex.Unlock()
+
+	if exists && previous != client {
+		previous.Close()
+	}
+}
+
+// RemoveOilField - closes and unregisters the connection of the oil field. With a client given, only that
+// connection is removed, a newer one stays. Returns the removed connection.
+func (hub *Hub) RemoveOilField(oilFieldID int64, client *SyncClient) (*SyncClient, bool) {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	current, exists := hub.oilFields[oilFieldID]
+	if !exists || (client != nil && current != client) {
+		return nil, false
+	}
+	delete(hub.oilFields, oilFieldID)
+	current.Close()
+
+	return current, true
+}
+
+func (hub *Hub) OilField(oilFieldID int64) (*SyncClient, bool) {
+	hub.mutex.RLock()
+	defer hub.mutex.RUnlock()
+
+	client, exists := hub.oilFields[oilFieldID]
+	return client, exists
+}
+
+func (hub *Hub) IsOilFieldOnline(oilFieldID int64) bool {
+	_, exists := hub.OilField(oilFieldID)
+	return exists
+}
+
+// SendToOilField - queues the message on the connection of the oil field, reports whether it was queued.
+func (hub *Hub) SendToOilField(oilFieldID int64, message *models.OutputMessage) bool {
+	client, exists := hub.OilField(oilFieldID)
+	if !exists {
+		return false
+	}
+
+	if !client.SendMessage(message) {
+		hub.logger.Errorf("Connection of oil field %d is too slow, closing it", oilFieldID)
+		client.Close()
+		return false
+	}
+
+	return true
+}
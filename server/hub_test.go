@@ -0,0 +1,193 @@
+package server
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"gitlab.citicom.kz/CloudServer/server/models"
+)
+
+func testLogger() *log.Entry {
+	logger := log.New()
+	logger.SetOutput(ioutil.Discard)
+	return log.NewEntry(logger)
+}
+
+func testUserConnection(id string, userID int64) *SocketConnection {
+	return &SocketConnection{
+		ID:              id,
+		User:            &models.User{UserID: userID},
+		outgoingMessage: make(chan *models.OutputMessage, outputChannelBufferSize),
+		closeCh:         make(chan bool),
+		logger:          testLogger(),
+	}
+}
+
+func testSyncClient(oilFieldID int64) *SyncClient {
+	return NewSyncClient(oilFieldID, "", nil, nil, testLogger())
+}
+
+func isClosed(closeCh chan bool) bool {
+	select {
+	case <-closeCh:
+		return true
+	default:
+		return false
+	}
+}
+
+// drain - reads the queue of the connection until it is closed, like its writer does.
+func drain(outgoing chan *models.OutputMessage, closeCh chan bool) {
+	for {
+		select {
+		case <-outgoing:
+		case <-closeCh:
+			return
+		}
+	}
+}
+
+func TestHubUserConnections(t *testing.T) {
+	hub := NewHub(testLogger())
+
+	var wg sync.WaitGroup
+	for userID := int64(1); userID <= 8; userID++ {
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func(userID int64, i int) {
+				defer wg.Done()
+
+				connection := testUserConnection(fmt.Sprintf("%d-%d", userID, i), userID)
+				go drain(connection.outgoingMessage, connection.closeCh)
+				hub.AddUserConnection(connection)
+				for j := 0; j < 20; j++ {
+					hub.SendToUsers([]int64{userID, userID%8 + 1}, &models.OutputMessage{Type: "test"})
+					hub.IsUserOnline(userID)
+				}
+				hub.RemoveUserConnection(userID, connection.ID)
+				if !isClosed(connection.closeCh) {
+					t.Errorf("connection %s not closed on removal", connection.ID)
+				}
+			}(userID, i)
+		}
+	}
+	wg.Wait()
+
+	for userID := int64(1); userID <= 8; userID++ {
+		if hub.IsUserOnline(userID) {
+			t.Errorf("user %d online after all connections were removed", userID)
+		}
+	}
+}
+
+func TestHubRemoveLastUserConnection(t *testing.T) {
+	hub := NewHub(testLogger())
+	first := testUserConnection("first", 1)
+	second := testUserConnection("second", 1)
+	hub.AddUserConnection(first)
+	hub.AddUserConnection(second)
+
+	if hub.RemoveUserConnection(1, first.ID) {
+		t.Error("first connection reported as the last one")
+	}
+	if hub.RemoveUserConnection(1, first.ID) {
+		t.Error("connection removed twice")
+	}
+	if !hub.RemoveUserConnection(1, second.ID) {
+		t.Error("second connection not reported as the last one")
+	}
+}
+
+func TestHubClosesSlowUser(t *testing.T) {
+	hub := NewHub(testLogger())
+	slow := testUserConnection("slow", 1)
+	hub.AddUserConnection(slow)
+
+	for i := 0; i <= outputChannelBufferSize; i++ {
+		hub.SendToUser(1, &models.OutputMessage{Type: "test"})
+	}
+	if !isClosed(slow.closeCh) {
+		t.Error("slow connection not closed")
+	}
+}
+
+func TestHubOilFields(t *testing.T) {
+	hub := NewHub(testLogger())
+
+	var wg sync.WaitGroup
+	for oilFieldID := int64(1); oilFieldID <= 8; oilFieldID++ {
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func(oilFieldID int64) {
+				defer wg.Done()
+
+				client := testSyncClient(oilFieldID)
+				go drain(client.outgoingMessage, client.closeCh)
+				hub.AddOilField(client)
+				for j := 0; j < 20; j++ {
+					hub.SendToOilField(oilFieldID, &models.OutputMessage{Type: "test"})
+					hub.IsOilFieldOnline(oilFieldID)
+				}
+				hub.RemoveOilField(oilFieldID, client)
+				if !isClosed(client.closeCh) {
+					t.Errorf("client of oil field %d neither replaced nor removed", oilFieldID)
+				}
+			}(oilFieldID)
+		}
+	}
+	wg.Wait()
+
+	for oilFieldID := int64(1); oilFieldID <= 8; oilFieldID++ {
+		if hub.IsOilFieldOnline(oilFieldID) {
+			t.Errorf("oil field %d online after all clients were removed", oilFieldID)
+		}
+	}
+}
+
+func TestHubReplacesOilField(t *testing.T) {
+	hub := NewHub(testLogger())
+	previous := testSyncClient(1)
+	current := testSyncClient(1)
+
+	hub.AddOilField(previous)
+	hub.AddOilField(current)
+	if !isClosed(previous.closeCh) {
+		t.Error("replaced client not closed")
+	}
+
+	// the reader of the replaced client unregisters it late, the current one must stay
+	if _, removed := hub.RemoveOilField(1, previous); removed {
+		t.Error("replaced client removed the current one")
+	}
+	if client, exists := hub.OilField(1); !exists || client != current {
+		t.Error("current client not registered")
+	}
+
+	if _, removed := hub.RemoveOilField(1, current); !removed {
+		t.Error("current client not removed")
+	}
+	if hub.IsOilFieldOnline(1) {
+		t.Error("oil field online after removal")
+	}
+}
+
+func TestHubClosesSlowOilField(t *testing.T) {
+	hub := NewHub(testLogger())
+	slow := testSyncClient(1)
+	hub.AddOilField(slow)
+
+	for i := 0; i < outputChannelBufferSize; i++ {
+		if !hub.SendToOilField(1, &models.OutputMessage{Type: "test"}) {
+			t.Fatalf("message %d not queued", i)
+		}
+	}
+	if hub.SendToOilField(1, &models.OutputMessage{Type: "test"}) {
+		t.Error("message queued on a full client")
+	}
+	if !isClosed(slow.closeCh) {
+		t.Error("slow client not closed")
+	}
+}
@@ -8,6 +8,7 @@ import (
 type Influx struct {
 	database string
 	client   client.Client
+	spool    *Spool
 }
 
 func Open(address string, database string) (*Influx, error) {
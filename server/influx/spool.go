@@ -0,0 +1,319 @@
+package influx
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	influxModels "github.com/influxdata/influxdb1-client/models"
+	client "github.com/influxdata/influxdb1-client/v2"
+	"gitlab.citicom.kz/CloudServer/server/models"
+)
+
+const spoolSegmentExt = ".wal"
+
+// spoolHeaderSize - a record starts with the length and the CRC-32 of its payload.
+const spoolHeaderSize = 8
+
+// Spool - write-ahead log of the batches InfluxDB refused. Batches are appended to segment files under a directory
+// and synced to disk before Append returns, a segment is named by the time it was opened in nanoseconds. Replay
+// writes the closed segments oldest first and removes each one once all its batches are written.
+type Spool struct {
+	mutex       sync.Mutex
+	dir         string
+	segmentSize int64
+	active      *os.File
+	activeSize  int64
+	spooled     int64
+	replayed    int64
+	lastError   string
+}
+
+// OpenSpool - opens the spool in dir, the segments left by a previous run are replayed too. A segment is closed
+// once it reaches segmentSize bytes.
+func OpenSpool(dir string, segmentSize int64) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	return &Spool{
+		dir:         dir,
+		segmentSize: segmentSize,
+	}, nil
+}
+
+// Append - stores the batch durably, in line protocol with nanosecond timestamps. A failed write is cut off
+// the segment, so a segment never holds a broken record followed by good ones.
+func (spool *Spool) Append(bp client.BatchPoints) error {
+	points := bp.Points()
+	if len(points) == 0 {
+		return nil
+	}
+
+	lines := make([]string, 0, len(points))
+	for _, point := range points {
+		lines = append(lines, point.PrecisionString("n"))
+	}
+	payload := []byte(strings.Join(lines, "\n"))
+
+	record := make([]byte, spoolHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(record[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(record[4:8], crc32.ChecksumIEEE(payload))
+	copy(record[spoolHeaderSize:], payload)
+
+	spool.mutex.Lock()
+	defer spool.mutex.Unlock()
+
+	if spool.active != nil && spool.activeSize >= spool.segmentSize {
+		spool.closeActive()
+	}
+	if spool.active == nil {
+		name := filepath.Join(spool.dir, fmt.Sprintf("%020d%s", time.Now().UnixNano(), spoolSegmentExt))
+		file, err := os.OpenFile(name, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		spool.active = file
+		spool.activeSize = 0
+	}
+
+	if _, err := spool.active.Write(record); err != nil {
+		_ = spool.active.Truncate(spool.activeSize)
+		spool.closeActive()
+		return err
+	}
+	if err := spool.active.Sync(); err != nil {
+		_ = spool.active.Truncate(spool.activeSize)
+		spool.closeActive()
+		return err
+	}
+
+	spool.activeSize += int64(len(record))
+	spool.spooled++
+	return nil
+}
+
+func (spool *Spool) closeActive() {
+	_ = spool.active.Close()
+	spool.active = nil
+	spool.activeSize = 0
+}
+
+// seal - closes the segment being appended to and returns the paths of all segments, oldest first.
+func (spool *Spool) seal() ([]string, error) {
+	spool.mutex.Lock()
+	defer spool.mutex.Unlock()
+
+	if spool.active != nil {
+		spool.closeActive()
+	}
+
+	return spool.segments()
+}
+
+func (spool *Spool) segments() ([]string, error) {
+	files, err := ioutil.ReadDir(spool.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, 0, len(files))
+	for _, file := range files {
+		if !file.IsDir() && strings.HasSuffix(file.Name(), spoolSegmentExt) {
+			paths = append(paths, filepath.Join(spool.dir, file.Name()))
+		}
+	}
+	sort.Strings(paths)
+
+	return paths, nil
+}
+
+// Stats - size and age of the spool, Age is the seconds since the oldest segment was opened.
+func (spool *Spool) Stats() models.SpoolStats {
+	spool.mutex.Lock()
+	defer spool.mutex.Unlock()
+
+	stats := models.SpoolStats{
+		Dir:            spool.dir,
+		BatchesSpooled: spool.spooled,
+		PointsReplayed: spool.replayed,
+		LastError:      spool.lastError,
+	}
+
+	paths, err := spool.segments()
+	if err != nil {
+		stats.LastError = err.Error()
+		return stats
+	}
+	for i, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		stats.Segments++
+		stats.Bytes += info.Size()
+		if i == 0 {
+			if opened, err := strconv.ParseInt(strings.TrimSuffix(filepath.Base(path), spoolSegmentExt), 10, 64); err == nil {
+				stats.OldestTs = opened / int64(time.Second)
+				stats.Age = time.Now().Unix() - stats.OldestTs
+			}
+		}
+	}
+
+	return stats
+}
+
+func (spool *Spool) done(points int64, err error) {
+	spool.mutex.Lock()
+	defer spool.mutex.Unlock()
+
+	spool.replayed += points
+	spool.lastError = ""
+	if err != nil {
+		spool.lastError = err.Error()
+	}
+}
+
+// readSpoolSegment - hands every record of the segment to onRecord. A record cut short or failing its checksum
+// was being written when the process stopped, it was never acknowledged, so the segment ends there.
+func readSpoolSegment(path string, onRecord func(payload []byte) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	remaining := info.Size()
+	header := make([]byte, spoolHeaderSize)
+	for {
+		if _, err := io.ReadFull(file, header); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return nil
+			}
+			return err
+		}
+
+		length := int64(binary.BigEndian.Uint32(header[0:4]))
+		remaining -= spoolHeaderSize + length
+		if remaining < 0 {
+			return nil
+		}
+
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(file, payload); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return nil
+			}
+			return err
+		}
+		if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:8]) {
+			return nil
+		}
+
+		if err := onRecord(payload); err != nil {
+			return err
+		}
+	}
+}
+
+var SpoolDisabled = errors.New("Influx spool is not configured")
+
+// SetSpool - batches WriteDurable fails to write go to the spool.
+func (influx *Influx) SetSpool(spool *Spool) {
+	influx.spool = spool
+}
+
+// WriteDurable - writes the batch, or appends it to the spool when InfluxDB refuses it. Reports whether the batch
+// was spooled, the batch is durably accepted either way unless an error is returned.
+func (influx *Influx) WriteDurable(bp client.BatchPoints) (bool, error) {
+	err := influx.client.Write(bp)
+	if err == nil {
+		return false, nil
+	}
+	if influx.spool == nil {
+		return false, err
+	}
+
+	if spoolErr := influx.spool.Append(bp); spoolErr != nil {
+		return false, fmt.Errorf("%v, spool: %v", err, spoolErr)
+	}
+	return true, nil
+}
+
+// SpoolStats - size and age of the spool, nil without a spool.
+func (influx *Influx) SpoolStats() *models.SpoolStats {
+	if influx.spool == nil {
+		return nil
+	}
+
+	stats := influx.spool.Stats()
+	return &stats
+}
+
+// ReplaySpool - writes the spooled batches to InfluxDB oldest first and returns the number of points written.
+// It stops at the first failure, the segment being replayed is kept whole and written again next time, points
+// overwrite by tags and time so that is safe.
+func (influx *Influx) ReplaySpool() (int64, error) {
+	if influx.spool == nil {
+		return 0, SpoolDisabled
+	}
+
+	paths, err := influx.spool.seal()
+	if err != nil {
+		influx.spool.done(0, err)
+		return 0, err
+	}
+
+	var replayed int64
+	for _, path := range paths {
+		var points int64
+		err := readSpoolSegment(path, func(payload []byte) error {
+			parsed, err := influxModels.ParsePointsWithPrecision(payload, time.Now(), "n")
+			if err != nil {
+				// a record that can't be parsed will never be written, it is dropped with the segment
+				return nil
+			}
+
+			bp, err := influx.NewBatchPoints()
+			if err != nil {
+				return err
+			}
+			for _, point := range parsed {
+				bp.AddPoint(client.NewPointFrom(point))
+			}
+			if err := influx.client.Write(bp); err != nil {
+				return err
+			}
+
+			points += int64(len(parsed))
+			return nil
+		})
+		if err == nil {
+			err = os.Remove(path)
+		}
+		if err != nil {
+			influx.spool.done(replayed, err)
+			return replayed, err
+		}
+
+		replayed += points
+	}
+
+	influx.spool.done(replayed, nil)
+	return replayed, nil
+}
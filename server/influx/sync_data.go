@@ -6,6 +6,7 @@ import (
 	"math"
 	"reflect"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -29,8 +30,11 @@ type singleGraphData struct {
 	YColumn []float64 `json:"yColumn"`
 }
 
+// ResultGraphData - Columns holds the "x" column of times and a column per tag, Quality a column per tag with
+// the quality of each time when asked for, both starting with the name of the column.
 type ResultGraphData struct {
 	Columns [][]interface{}        `json:"columns"`
+	Quality [][]interface{}        `json:"quality,omitempty"`
 	Objects []*models.SensorResult `json:"objects"`
 }
 
@@ -101,16 +105,43 @@ func (influx *Influx) GetSensorMedianData(sensorTagName string, selectTime strin
 	return outputResult, nil
 }
 
-func (influx *Influx) GetMultipleTagsData(tagNames []string, selectTime string, diffTime string, groupTime string) ResultGraphData {
+// GetMultipleTagsData - a column per tag, the median of each group or, for the tags of a discrete type in
+// valueTypes, the step series of GetSensorStepData.
+func (influx *Influx) GetMultipleTagsData(tagNames []string, valueTypes map[string]string, selectTime string, diffTime string, groupTime string, withQuality bool) ResultGraphData {
 	xColumn := make([]interface{}, 0, 10)
 
 	columns := make([][]interface{}, 0, 10)
+	var qualityColumns [][]interface{}
 	for _, tagName := range tagNames {
-		res, err := influx.GetSensorMedianData(tagName, selectTime, diffTime, groupTime)
+		var res *stepGraphData
+		var err error
+		if models.IsDiscreteSensorType(valueTypes[tagName]) {
+			res, err = influx.GetSensorStepData(tagName, valueTypes[tagName], selectTime, diffTime, groupTime)
+		} else {
+			res, err = influx.getSensorMedianColumn(tagName, selectTime, diffTime, groupTime)
+		}
 		if err != nil {
 			continue
 		}
 
+		if withQuality {
+			qualities, err := influx.GetSensorQuality(tagName, selectTime, diffTime, groupTime)
+			if err != nil {
+				qualities = map[int64]string{}
+			}
+
+			qualityColumn := make([]interface{}, 0, len(res.XColumn)+1)
+			qualityColumn = append(qualityColumn, tagName)
+			for _, xCol := range res.XColumn {
+				quality, ok := qualities[xCol]
+				if !ok {
+					quality = models.SAMPLE_QUALITY_GOOD
+				}
+				qualityColumn = append(qualityColumn, quality)
+			}
+			qualityColumns = append(qualityColumns, qualityColumn)
+		}
+
 		if len(xColumn) == 0 && len(res.XColumn) > 0 {
 			xColumn = append(xColumn, "x")
 			for _, xCol := range res.XColumn {
@@ -118,11 +149,9 @@ func (influx *Influx) GetMultipleTagsData(tagNames []string, selectTime string,
 			}
 		}
 
-		yColumn := make([]interface{}, 0, 10)
+		yColumn := make([]interface{}, 0, len(res.YColumn)+1)
 		yColumn = append(yColumn, tagName)
-		for _, yCol := range res.YColumn {
-			yColumn = append(yColumn, yCol)
-		}
+		yColumn = append(yColumn, res.YColumn...)
 		columns = append(columns, yColumn)
 	}
 
@@ -134,19 +163,156 @@ func (influx *Influx) GetMultipleTagsData(tagNames []string, selectTime string,
 
 	return ResultGraphData{
 		Columns: resultColumns,
+		Quality: qualityColumns,
+	}
+}
+
+// stepGraphData - times and values of a column, numbers or the text of a string sensor.
+type stepGraphData struct {
+	XColumn []int64
+	YColumn []interface{}
+}
+
+func (influx *Influx) getSensorMedianColumn(sensorTagName string, selectTime string, diffTime string, groupTime string) (*stepGraphData, error) {
+	res, err := influx.GetSensorMedianData(sensorTagName, selectTime, diffTime, groupTime)
+	if err != nil {
+		return nil, err
+	}
+
+	column := &stepGraphData{XColumn: res.XColumn, YColumn: make([]interface{}, 0, len(res.YColumn))}
+	for _, yCol := range res.YColumn {
+		column.YColumn = append(column.YColumn, yCol)
+	}
+	return column, nil
+}
+
+// GetSensorStepData - the state of a discrete sensor in each group of GetSensorMedianData: the last sample of the
+// group, held over the groups without samples. A string sensor gives its text, the other types their number.
+func (influx *Influx) GetSensorStepData(sensorTagName string, valueType string, selectTime string, diffTime string, groupTime string) (*stepGraphData, error) {
+	field := "value"
+	if models.NormalizeSensorType(valueType) == models.SENSOR_TYPE_STRING {
+		field = "valueString"
+	}
+
+	res, err := influx.Query(fmt.Sprintf(
+		`SELECT LAST(%s) FROM cloudData WHERE tagName='%v' AND %s GROUP BY time(%v) fill(previous)`,
+		field,
+		sensorTagName,
+		sampleTimeCondition(selectTime, diffTime),
+		groupTime,
+	))
+	if err != nil {
+		return nil, err
 	}
+	if res.Error() != nil {
+		return nil, res.Error()
+	}
+
+	column := &stepGraphData{XColumn: make([]int64, 0, 10), YColumn: make([]interface{}, 0, 10)}
+	for _, result := range res.Results {
+		for _, series := range result.Series {
+			for _, val := range series.Values {
+				if len(val) < 2 {
+					continue
+				}
+				parsedTime, err := time.Parse(time.RFC3339, fmt.Sprintf("%v", val[0]))
+				if err != nil {
+					continue
+				}
+
+				var value interface{}
+				if val[1] != nil {
+					if number, err := getFloat(val[1]); err == nil && field == "value" {
+						value = number
+					} else {
+						value = fmt.Sprintf("%v", val[1])
+					}
+				}
+
+				column.XColumn = append(column.XColumn, parsedTime.Unix())
+				column.YColumn = append(column.YColumn, value)
+			}
+		}
+	}
+
+	return column, nil
 }
 
-func (influx *Influx) GetLatestSensorValue(sensorId string) (int64, float64) {
+// sampleTimeCondition - the time range of selectTime and diffTime as in GetSensorMedianData.
+func sampleTimeCondition(selectTime string, diffTime string) string {
+	if len(diffTime) > 0 {
+		return fmt.Sprintf(`time >= now() - %v AND time <= now() - %v + %v`, selectTime, selectTime, diffTime)
+	}
+	return fmt.Sprintf(`time >= now() - %v`, selectTime)
+}
+
+// GetSensorQuality - the worst quality of the samples in each group of GetSensorMedianData, by the unix time of
+// the group. Groups of good samples only are left out, samples stored without a quality are good.
+func (influx *Influx) GetSensorQuality(sensorTagName string, selectTime string, diffTime string, groupTime string) (map[int64]string, error) {
+	timeCondition := sampleTimeCondition(selectTime, diffTime)
+
+	// worst first, a bad group is not downgraded to uncertain
+	qualities := []string{models.SAMPLE_QUALITY_BAD, models.SAMPLE_QUALITY_UNCERTAIN}
+	statements := make([]string, 0, len(qualities))
+	for _, quality := range qualities {
+		statements = append(statements, fmt.Sprintf(
+			`SELECT COUNT(quality) FROM cloudData WHERE tagName='%v' AND quality='%s' AND %s GROUP BY time(%v)`,
+			sensorTagName,
+			quality,
+			timeCondition,
+			groupTime,
+		))
+	}
+
+	res, err := influx.Query(strings.Join(statements, "; "))
+	if err != nil {
+		return nil, err
+	}
+	if res.Error() != nil {
+		return nil, res.Error()
+	}
+
+	groups := make(map[int64]string)
+	for i, result := range res.Results {
+		if i >= len(qualities) {
+			break
+		}
+		for _, series := range result.Series {
+			for _, val := range series.Values {
+				if len(val) < 2 {
+					continue
+				}
+				count, err := getInt(val[1])
+				if err != nil || count == 0 {
+					continue
+				}
+				parsedTime, err := time.Parse(time.RFC3339, fmt.Sprintf("%v", val[0]))
+				if err != nil {
+					continue
+				}
+				if _, ok := groups[parsedTime.Unix()]; !ok {
+					groups[parsedTime.Unix()] = qualities[i]
+				}
+			}
+		}
+	}
+
+	return groups, nil
+}
+
+// GetLatestSensorValue - time, value, quality and the text of an enum or string sensor of the latest sample.
+func (influx *Influx) GetLatestSensorValue(sensorId string) (int64, float64, string, string) {
 	res, err := influx.Query(
 		fmt.Sprintf(
-			`SELECT last(value) FROM cloudData WHERE "tagName"='%s'`,
+			`SELECT value, quality, valueString FROM cloudData WHERE "tagName"='%s' ORDER BY time DESC LIMIT 1`,
 			sensorId,
 		),
 	)
 
 	value := 0.0
 	date := int64(0)
+	quality := models.SAMPLE_QUALITY_GOOD
+	state := ""
 	if err == nil {
 		for _, result := range res.Results {
 			for _, series := range result.Series {
@@ -155,6 +321,12 @@ func (influx *Influx) GetLatestSensorValue(sensorId string) (int64, float64) {
 					if err == nil {
 						value = formattedValue
 					}
+					if len(series.Values[0]) > 2 && series.Values[0][2] != nil {
+						quality = models.NormalizeQuality(fmt.Sprintf("%v", series.Values[0][2]))
+					}
+					if len(series.Values[0]) > 3 && series.Values[0][3] != nil {
+						state = fmt.Sprintf("%v", series.Values[0][3])
+					}
 
 					layout := "2006-01-02T15:04:05Z"
 					t, err := time.Parse(layout, fmt.Sprintf("%v", series.Values[0][0]))
@@ -166,7 +338,54 @@ func (influx *Influx) GetLatestSensorValue(sensorId string) (int64, float64) {
 		}
 	}
 
-	return date, value
+	return date, value, quality, state
+}
+
+// GetSampleBuckets - number of samples of the sensors with ids starting with tagPrefix in each bucket of
+// [from, to), empty buckets included.
+func (influx *Influx) GetSampleBuckets(tagPrefix string, from int64, to int64, bucket int64) ([]models.SampleBucket, error) {
+	res, err := influx.Query(
+		fmt.Sprintf(
+			`SELECT COUNT(value) FROM cloudData WHERE "tagName" =~ /^%s/ AND time >= %ds AND time < %ds GROUP BY time(%ds) fill(0)`,
+			tagPrefix,
+			from,
+			to,
+			bucket,
+		),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if res.Error() != nil {
+		return nil, res.Error()
+	}
+
+	buckets := make([]models.SampleBucket, 0, 10)
+	for _, result := range res.Results {
+		for _, series := range result.Series {
+			for _, val := range series.Values {
+				if len(val) < 2 {
+					continue
+				}
+
+				parsedTime, err := time.Parse(time.RFC3339, fmt.Sprintf("%v", val[0]))
+				if err != nil {
+					continue
+				}
+				count, err := getInt(val[1])
+				if err != nil {
+					count = 0
+				}
+
+				buckets = append(buckets, models.SampleBucket{
+					Time:  parsedTime.Unix(),
+					Count: count,
+				})
+			}
+		}
+	}
+
+	return buckets, nil
 }
 
 var floatType = reflect.TypeOf(float64(0))
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// runSpoolDaemon - replays the batches spooled while InfluxDB was unavailable every InfluxSpoolInterval seconds,
+// after a failure it waits from InfluxSpoolBackoff doubling up to InfluxSpoolMaxBackoff seconds.
+func (server *Server) runSpoolDaemon() {
+	if server.influxDB.SpoolStats() == nil {
+		return
+	}
+
+	failures := 0
+	for {
+		interval := viper.GetInt64("InfluxSpoolInterval")
+		if interval < 1 {
+			interval = 1
+		}
+		delay := time.Duration(interval) * time.Second
+		if failures > 0 {
+			delay = spoolBackoff(failures)
+		}
+		<-time.After(delay)
+
+		points, err := server.influxDB.ReplaySpool()
+		if err != nil {
+			failures++
+			server.logger.Errorf("Can't replay influx spool, retry in %s: %s", spoolBackoff(failures), err.Error())
+			continue
+		}
+
+		failures = 0
+		if points > 0 {
+			stats := server.influxDB.SpoolStats()
+			server.logger.Infof("Influx spool: %d points replayed, %d segments left", points, stats.Segments)
+		}
+	}
+}
+
+// spoolBackoff - exponential delay before the next replay, capped by InfluxSpoolMaxBackoff seconds.
+func spoolBackoff(failures int) time.Duration {
+	delay := time.Duration(viper.GetInt64("InfluxSpoolBackoff")) * time.Second
+	if delay < time.Second {
+		delay = time.Second
+	}
+	maxDelay := time.Duration(viper.GetInt64("InfluxSpoolMaxBackoff")) * time.Second
+	if maxDelay < delay {
+		maxDelay = delay
+	}
+	for i := 1; i < failures && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+
+	return delay
+}
@@ -1,26 +1,226 @@
 package models
 
+import (
+	"fmt"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+	validation2 "gitlab.citicom.kz/CloudServer/server/utils/validation"
+)
+
 const (
 	ALARM_TYPE_LOW_LOW = "ALARM_TYPE_LOW_LOW"
 	ALARM_TYPE_LOW     = "ALARM_TYPE_LOW"
 
 	ALARM_TYPE_HIGHT       = "ALARM_TYPE_HIGHT"
 	ALARM_TYPE_HIGHT_HIGHT = "ALARM_TYPE_HIGHT_HIGHT"
+
+	ALARM_TYPE_RATE_OF_CHANGE = "ALARM_TYPE_RATE_OF_CHANGE"
+	ALARM_TYPE_STALE          = "ALARM_TYPE_STALE"
+	ALARM_TYPE_FROZEN         = "ALARM_TYPE_FROZEN"
+	ALARM_TYPE_DEVIATION      = "ALARM_TYPE_DEVIATION"
+	ALARM_TYPE_BAD_QUALITY    = "ALARM_TYPE_BAD_QUALITY"
+	ALARM_TYPE_STATE          = "ALARM_TYPE_STATE"
+
+	ALARM_TYPE_OFFLINE = "ALARM_TYPE_OFFLINE"
+)
+
+const (
+	ALARM_SEVERITY_CRITICAL = "critical"
+	ALARM_SEVERITY_WARNING  = "warning"
+)
+
+// AlarmSeverity - maps an alarm type to the severity used by notification rules.
+func AlarmSeverity(alarmType string) string {
+	switch alarmType {
+	case ALARM_TYPE_LOW_LOW, ALARM_TYPE_HIGHT_HIGHT, ALARM_TYPE_OFFLINE:
+		return ALARM_SEVERITY_CRITICAL
+	default:
+		return ALARM_SEVERITY_WARNING
+	}
+}
+
+const (
+	ALARM_TRANSITION_RAISE   = "ALARM_TRANSITION_RAISE"
+	ALARM_TRANSITION_RERAISE = "ALARM_TRANSITION_RERAISE"
+	ALARM_TRANSITION_RETURN  = "ALARM_TRANSITION_RETURN"
+)
+
+const (
+	ALARM_STATE_ACTIVE_UNACKED  = "ALARM_STATE_ACTIVE_UNACKED"
+	ALARM_STATE_ACTIVE_ACKED    = "ALARM_STATE_ACTIVE_ACKED"
+	ALARM_STATE_CLEARED_UNACKED = "ALARM_STATE_CLEARED_UNACKED"
+	ALARM_STATE_CLEARED         = "ALARM_STATE_CLEARED"
+	ALARM_STATE_SHELVED         = "ALARM_STATE_SHELVED"
+	ALARM_STATE_SUPPRESSED      = "ALARM_STATE_SUPPRESSED"
+)
+
+const (
+	ALARM_ACTION_ACK      = "ALARM_ACTION_ACK"
+	ALARM_ACTION_SHELVE   = "ALARM_ACTION_SHELVE"
+	ALARM_ACTION_UNSHELVE = "ALARM_ACTION_UNSHELVE"
+	ALARM_ACTION_ESCALATE = "ALARM_ACTION_ESCALATE"
+	ALARM_ACTION_RELEASE  = "ALARM_ACTION_RELEASE"
 )
 
 type AlarmResult struct {
-	AlarmID      int64   `json:"alarmId"`
-	UserID       int64   `json:"userId"`
-	OilFieldId   int64   `json:"oilFieldId"`
-	ControllerID string  `json:"controllerId"`
-	OilFieldName string  `json:"oilFieldName"`
+	AlarmID        int64   `json:"alarmId"`
+	CompanyID      int64   `json:"companyId"`
+	OilFieldId     int64   `json:"oilFieldId"`
+	ControllerID   string  `json:"controllerId"`
+	OilFieldName   string  `json:"oilFieldName"`
 	ControllerName string  `json:"controllerName"`
-	SensorID     string  `json:"sensorId"`
-	AlarmType    string  `json:"alarmType"`
-	AlarmValue   float32 `json:"alarmValue"`
-	Value        float32 `json:"value"`
-	Time         int64   `json:"time"`
-	IsViewed     bool    `json:"isViewed"`
+	SensorID       string  `json:"sensorId"`
+	AlarmType      string  `json:"alarmType"`
+	AlarmValue     float32 `json:"alarmValue"`
+	Value          float32 `json:"value"`
+	Transition     string  `json:"transition"`
+	Occurrences    int     `json:"occurrences"`
+	State          string  `json:"state"`
+	IsActive       bool    `json:"isActive"`
+	IsAcked        bool    `json:"isAcked"`
+	AckedBy        int64   `json:"ackedBy"`
+	AckedTs        int64   `json:"ackedTs"`
+	AckComment     string  `json:"ackComment"`
+	ShelvedBy      int64   `json:"shelvedBy"`
+	ShelvedUntil   int64   `json:"shelvedUntil"`
+	ShelveComment  string  `json:"shelveComment"`
+	EscalationTier int     `json:"escalationTier"`
+	EscalatedTs    int64   `json:"escalatedTs"`
+	SuppressionID  int64   `json:"suppressionId"`
+	ReleasedTs     int64   `json:"releasedTs"`
+	Time           int64   `json:"time"`
+	ClearedTs      int64   `json:"clearedTs"`
+	UpdatedTs      int64   `json:"updatedTs"`
+}
+
+type AlarmHistoryResult struct {
+	HistoryID int64   `json:"historyId"`
+	AlarmID   int64   `json:"alarmId"`
+	Action    string  `json:"action"`
+	State     string  `json:"state"`
+	UserID    int64   `json:"userId"`
+	FirstName string  `json:"firstName"`
+	LastName  string  `json:"lastName"`
+	Comment   string  `json:"comment"`
+	Value     float32 `json:"value"`
+	Time      int64   `json:"time"`
+}
+
+type AlarmAck struct {
+	AlarmID int64  `json:"alarmId"`
+	Comment string `json:"comment"`
+}
+
+type AlarmShelve struct {
+	AlarmID int64  `json:"alarmId"`
+	Until   int64  `json:"until"`
+	Comment string `json:"comment"`
+}
+
+const (
+	AlarmListDefaultLimit = 100
+	AlarmListMaxLimit     = 1000
+)
+
+// AlarmFilter - query parameters of /alarms/list.
+type AlarmFilter struct {
+	OilFieldID   int64
+	ControllerID string
+	SensorID     string
+	AlarmType    string
+	State        string
+	IsActive     *bool
+	IsAcked      *bool
+	From         int64
+	To           int64
+	Sort         string
+	Order        string
+	Limit        int
+	Cursor       string
+}
+
+// AlarmCursor - position after the last alarm of a page, Value is the sort key of the alarm in Sort and Order.
+type AlarmCursor struct {
+	Sort    string `json:"s"`
+	Order   string `json:"o"`
+	Value   string `json:"v"`
+	AlarmID int64  `json:"id"`
+}
+
+type AlarmListResult struct {
+	Alarms     []*AlarmResult   `json:"alarms"`
+	Total      int64            `json:"total"`
+	Counts     map[string]int64 `json:"counts"`
+	NextCursor string           `json:"nextCursor"`
+}
+
+func (filter *AlarmFilter) Validate() error {
+	if filter.To > 0 && filter.To < filter.From {
+		return fmt.Errorf("to must not be before from")
+	}
+
+	return validation.ValidateStruct(
+		filter,
+		validation.Field(
+			&filter.State,
+			validation.In(
+				ALARM_STATE_ACTIVE_UNACKED,
+				ALARM_STATE_ACTIVE_ACKED,
+				ALARM_STATE_CLEARED_UNACKED,
+				ALARM_STATE_CLEARED,
+				ALARM_STATE_SHELVED,
+				ALARM_STATE_SUPPRESSED,
+			),
+		),
+		validation.Field(
+			&filter.Sort,
+			validation.In("time", "updatedTs", "clearedTs", "alarmType", "sensorId"),
+		),
+		validation.Field(
+			&filter.Order,
+			validation.In("asc", "desc"),
+		),
+		validation.Field(
+			&filter.Limit,
+			validation2.GreaterThanOrEqualCreate("limit greater than or equal 1", 1),
+			validation2.LessOrEqualCreate(fmt.Sprintf("limit less than or equal %d", AlarmListMaxLimit), AlarmListMaxLimit),
+		),
+	)
+}
+
+func (ack *AlarmAck) Validate() error {
+	return validation.ValidateStruct(
+		ack,
+		validation.Field(
+			&ack.AlarmID,
+			validation.Required,
+		),
+		validation.Field(
+			&ack.Comment,
+			validation.Length(0, 1024),
+		),
+	)
+}
+
+func (shelve *AlarmShelve) Validate() error {
+	return validation.ValidateStruct(
+		shelve,
+		validation.Field(
+			&shelve.AlarmID,
+			validation.Required,
+		),
+		validation.Field(
+			&shelve.Until,
+			validation.Required,
+			validation2.GreaterThanOrEqualCreate("until must be in the future", time.Now().Unix()),
+		),
+		validation.Field(
+			&shelve.Comment,
+			validation.Required,
+			validation.Length(0, 1024),
+		),
+	)
 }
 
 type Alarm struct {
@@ -30,9 +230,50 @@ type Alarm struct {
 	AlarmType    string  `json:"alarm_type"`
 	AlarmValue   float32 `json:"alarm_value"`
 	Value        float32 `json:"value"`
+	Transition   string  `json:"transition"`
 	Time         int64   `json:"time"`
 }
 
+// IsActive - reports whether the transition leaves the alarm standing.
+func (alarm *Alarm) IsActive() bool {
+	return alarm.Transition != ALARM_TRANSITION_RETURN
+}
+
+// AlarmLimit - one of the four static limits configured on a sensor.
+type AlarmLimit struct {
+	AlarmType string
+	Value     float32
+	Low       bool
+}
+
+// Breached - reports whether value is on the alarm side of the limit.
+func (limit AlarmLimit) Breached(value float32) bool {
+	if limit.Low {
+		return value <= limit.Value
+	}
+	return value >= limit.Value
+}
+
+// Cleared - reports whether value came back past the limit by more than deadband.
+func (limit AlarmLimit) Cleared(value float32, deadband float32) bool {
+	if limit.Low {
+		return value > limit.Value+deadband
+	}
+	return value < limit.Value-deadband
+}
+
+// SensorSample - a synchronized value together with the sensor configuration it was read with.
+type SensorSample struct {
+	OilFieldID   int64
+	ControllerID string
+	SensorID     string
+	Sensor       *SensorResultCloud
+	Value        float32
+	State        string
+	Quality      string
+	Time         int64
+}
+
 type Alarms struct {
 	Alarms []*Alarm
 }
@@ -0,0 +1,64 @@
+package models
+
+import (
+	"math"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+	validation2 "gitlab.citicom.kz/CloudServer/server/utils/validation"
+)
+
+const (
+	ALARM_DEDUP_MATCH_EPISODE = "episode"
+	ALARM_DEDUP_MATCH_VALUE   = "value"
+)
+
+// AlarmDedupRule - a raise arriving within WindowSeconds after the last update of the previous alarm of the
+// same sensor limit is counted as another occurrence of that alarm instead of a new record. The episode match
+// ignores the limit value, the value match requires it within ValueTolerance. A rule with an empty SensorID
+// covers the whole company, a zero window switches deduplication off.
+type AlarmDedupRule struct {
+	RuleID         int64   `json:"ruleId"`
+	CompanyID      int64   `json:"companyId"`
+	SensorID       string  `json:"sensorId"`
+	WindowSeconds  int64   `json:"windowSeconds"`
+	Match          string  `json:"match"`
+	ValueTolerance float32 `json:"valueTolerance"`
+	CreatedTs      int64   `json:"createdTs"`
+	UpdatedTs      int64   `json:"updatedTs"`
+}
+
+// Matches - reports whether the raise continues the previous alarm of its sensor limit.
+func (rule *AlarmDedupRule) Matches(previous *AlarmResult, alarm *Alarm) bool {
+	if rule.WindowSeconds <= 0 || alarm.Time-previous.UpdatedTs > rule.WindowSeconds {
+		return false
+	}
+	if rule.Match == ALARM_DEDUP_MATCH_VALUE {
+		return math.Abs(float64(alarm.AlarmValue-previous.AlarmValue)) <= float64(rule.ValueTolerance)
+	}
+
+	return true
+}
+
+func (rule *AlarmDedupRule) Validate() error {
+	return validation.ValidateStruct(
+		rule,
+		validation.Field(
+			&rule.CompanyID,
+			validation.Required,
+		),
+		validation.Field(
+			&rule.WindowSeconds,
+			validation2.GreaterThanOrEqualCreate("windowSeconds must be between 0 and 604800", 0),
+			validation2.LessOrEqualCreate("windowSeconds must be between 0 and 604800", 7*24*3600),
+		),
+		validation.Field(
+			&rule.Match,
+			validation.Required,
+			validation.In(ALARM_DEDUP_MATCH_EPISODE, ALARM_DEDUP_MATCH_VALUE),
+		),
+		validation.Field(
+			&rule.ValueTolerance,
+			validation2.GreaterThanOrEqualCreate("valueTolerance must not be negative", 0),
+		),
+	)
+}
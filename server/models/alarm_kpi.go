@@ -0,0 +1,289 @@
+package models
+
+import (
+	"errors"
+	"sort"
+)
+
+const (
+	AlarmKPIDefaultTop = 10
+	AlarmKPIMaxTop     = 100
+)
+
+// AlarmAnnunciation - a raise or re-raise of an alarm, the unit every rate is counted in.
+type AlarmAnnunciation struct {
+	AlarmID      int64
+	OilFieldID   int64
+	ControllerID string
+	SensorID     string
+	AlarmType    string
+	Time         int64
+}
+
+// AlarmAckStats - acknowledged alarms of an oil field raised inside the report range.
+type AlarmAckStats struct {
+	OilFieldID   int64
+	Count        int64
+	TotalSeconds int64
+}
+
+// AlarmKPISettings - thresholds of the report, floods and chattering follow ISA-18.2.
+type AlarmKPISettings struct {
+	FloodCount     int
+	FloodSeconds   int64
+	ChatterCount   int
+	ChatterSeconds int64
+	StandingHours  int64
+}
+
+type AlarmKPIRequest struct {
+	CompanyID  int64
+	OilFieldID int64
+	From       int64
+	To         int64
+	Top        int
+	Operators  int
+}
+
+func (request *AlarmKPIRequest) Validate() error {
+	if request.From <= 0 || request.To <= request.From {
+		return errors.New("from and to required, to must be after from")
+	}
+	if request.Top < 0 || request.Top > AlarmKPIMaxTop {
+		return errors.New("top must be between 0 and 100")
+	}
+	if request.Operators < 0 {
+		return errors.New("operators must not be negative")
+	}
+
+	return nil
+}
+
+type AlarmFlood struct {
+	Start         int64 `json:"start"`
+	End           int64 `json:"end"`
+	Annunciations int   `json:"annunciations"`
+}
+
+type AlarmBadActor struct {
+	SensorID      string  `json:"sensorId"`
+	ControllerID  string  `json:"controllerId"`
+	OilFieldID    int64   `json:"oilFieldId"`
+	Annunciations int     `json:"annunciations"`
+	Percent       float64 `json:"percent"`
+}
+
+type AlarmChattering struct {
+	SensorID      string `json:"sensorId"`
+	AlarmType     string `json:"alarmType"`
+	OilFieldID    int64  `json:"oilFieldId"`
+	Annunciations int    `json:"annunciations"`
+	Bursts        int    `json:"bursts"`
+}
+
+type AlarmOilFieldKPI struct {
+	OilFieldID        int64   `json:"oilFieldId"`
+	Annunciations     int     `json:"annunciations"`
+	AckedAlarms       int64   `json:"ackedAlarms"`
+	AverageAckSeconds float64 `json:"averageAckSeconds"`
+}
+
+type AlarmKPIReport struct {
+	CompanyID                int64               `json:"companyId"`
+	OilFieldID               int64               `json:"oilFieldId"`
+	From                     int64               `json:"from"`
+	To                       int64               `json:"to"`
+	Operators                int                 `json:"operators"`
+	Annunciations            int                 `json:"annunciations"`
+	AlarmsPerHour            float64             `json:"alarmsPerHour"`
+	AlarmsPerOperatorPerHour float64             `json:"alarmsPerOperatorPerHour"`
+	PeakAlarmsPerHour        int                 `json:"peakAlarmsPerHour"`
+	Floods                   []*AlarmFlood       `json:"floods"`
+	TimeInFloodPercent       float64             `json:"timeInFloodPercent"`
+	BadActors                []*AlarmBadActor    `json:"badActors"`
+	Chattering               []*AlarmChattering  `json:"chattering"`
+	StandingAlarms           []*AlarmResult      `json:"standingAlarms"`
+	AckedAlarms              int64               `json:"ackedAlarms"`
+	AverageAckSeconds        float64             `json:"averageAckSeconds"`
+	OilFields                []*AlarmOilFieldKPI `json:"oilFields"`
+}
+
+// NewAlarmKPIReport - builds the report of [from, to) out of the time ordered annunciations of the range.
+func NewAlarmKPIReport(request *AlarmKPIRequest, settings AlarmKPISettings, annunciations []*AlarmAnnunciation, acks []*AlarmAckStats, standing []*AlarmResult) *AlarmKPIReport {
+	report := &AlarmKPIReport{
+		CompanyID:      request.CompanyID,
+		OilFieldID:     request.OilFieldID,
+		From:           request.From,
+		To:             request.To,
+		Operators:      request.Operators,
+		Annunciations:  len(annunciations),
+		StandingAlarms: standing,
+		OilFields:      make([]*AlarmOilFieldKPI, 0, 10),
+	}
+
+	hours := float64(request.To-request.From) / 3600
+	report.AlarmsPerHour = float64(len(annunciations)) / hours
+	if request.Operators > 0 {
+		report.AlarmsPerOperatorPerHour = report.AlarmsPerHour / float64(request.Operators)
+	}
+
+	hourly := make(map[int64]int)
+	for _, annunciation := range annunciations {
+		hour := (annunciation.Time - request.From) / 3600
+		hourly[hour]++
+		if hourly[hour] > report.PeakAlarmsPerHour {
+			report.PeakAlarmsPerHour = hourly[hour]
+		}
+	}
+
+	report.Floods = alarmFloods(annunciations, settings)
+	flooded := int64(0)
+	for _, flood := range report.Floods {
+		flooded += flood.End - flood.Start
+	}
+	report.TimeInFloodPercent = float64(flooded) * 100 / float64(request.To-request.From)
+
+	report.BadActors = alarmBadActors(annunciations, request.Top)
+	report.Chattering = alarmChattering(annunciations, settings)
+
+	oilFields := make(map[int64]*AlarmOilFieldKPI)
+	oilField := func(oilFieldID int64) *AlarmOilFieldKPI {
+		item, exists := oilFields[oilFieldID]
+		if !exists {
+			item = &AlarmOilFieldKPI{OilFieldID: oilFieldID}
+			oilFields[oilFieldID] = item
+			report.OilFields = append(report.OilFields, item)
+		}
+		return item
+	}
+	for _, annunciation := range annunciations {
+		oilField(annunciation.OilFieldID).Annunciations++
+	}
+
+	ackSeconds := int64(0)
+	for _, ack := range acks {
+		item := oilField(ack.OilFieldID)
+		item.AckedAlarms = ack.Count
+		if ack.Count > 0 {
+			item.AverageAckSeconds = float64(ack.TotalSeconds) / float64(ack.Count)
+		}
+		report.AckedAlarms += ack.Count
+		ackSeconds += ack.TotalSeconds
+	}
+	if report.AckedAlarms > 0 {
+		report.AverageAckSeconds = float64(ackSeconds) / float64(report.AckedAlarms)
+	}
+	sort.Slice(report.OilFields, func(i, j int) bool {
+		return report.OilFields[i].OilFieldID < report.OilFields[j].OilFieldID
+	})
+
+	return report
+}
+
+// alarmFloods - periods where more than FloodCount annunciations fall inside FloodSeconds.
+func alarmFloods(annunciations []*AlarmAnnunciation, settings AlarmKPISettings) []*AlarmFlood {
+	floods := make([]*AlarmFlood, 0, 10)
+	var flood *AlarmFlood
+	first := 0
+	for i, annunciation := range annunciations {
+		for annunciation.Time-annunciations[first].Time >= settings.FloodSeconds {
+			first++
+		}
+
+		if i-first+1 > settings.FloodCount {
+			if flood == nil {
+				flood = &AlarmFlood{Start: annunciations[first].Time, Annunciations: i - first}
+			}
+			flood.End = annunciation.Time
+			flood.Annunciations++
+		} else if flood != nil {
+			floods = append(floods, flood)
+			flood = nil
+		}
+	}
+	if flood != nil {
+		floods = append(floods, flood)
+	}
+
+	return floods
+}
+
+// alarmBadActors - the top sensors by annunciations.
+func alarmBadActors(annunciations []*AlarmAnnunciation, top int) []*AlarmBadActor {
+	actors := make([]*AlarmBadActor, 0, 10)
+	sensors := make(map[string]*AlarmBadActor)
+	for _, annunciation := range annunciations {
+		actor, exists := sensors[annunciation.SensorID]
+		if !exists {
+			actor = &AlarmBadActor{
+				SensorID:     annunciation.SensorID,
+				ControllerID: annunciation.ControllerID,
+				OilFieldID:   annunciation.OilFieldID,
+			}
+			sensors[annunciation.SensorID] = actor
+			actors = append(actors, actor)
+		}
+		actor.Annunciations++
+	}
+
+	for _, actor := range actors {
+		actor.Percent = float64(actor.Annunciations) * 100 / float64(len(annunciations))
+	}
+	sort.SliceStable(actors, func(i, j int) bool {
+		return actors[i].Annunciations > actors[j].Annunciations
+	})
+	if len(actors) > top {
+		actors = actors[:top]
+	}
+
+	return actors
+}
+
+// alarmChattering - sensor limits with ChatterCount or more annunciations inside ChatterSeconds.
+func alarmChattering(annunciations []*AlarmAnnunciation, settings AlarmKPISettings) []*AlarmChattering {
+	type limitKey struct {
+		sensorID  string
+		alarmType string
+	}
+	limits := make(map[limitKey][]*AlarmAnnunciation)
+	keys := make([]limitKey, 0, 10)
+	for _, annunciation := range annunciations {
+		key := limitKey{annunciation.SensorID, annunciation.AlarmType}
+		if _, exists := limits[key]; !exists {
+			keys = append(keys, key)
+		}
+		limits[key] = append(limits[key], annunciation)
+	}
+
+	chattering := make([]*AlarmChattering, 0, 10)
+	for _, key := range keys {
+		list := limits[key]
+		bursts := 0
+		first := 0
+		for i, annunciation := range list {
+			for annunciation.Time-list[first].Time >= settings.ChatterSeconds {
+				first++
+			}
+			if i-first+1 >= settings.ChatterCount {
+				bursts++
+				first = i + 1
+			}
+		}
+		if bursts == 0 {
+			continue
+		}
+
+		chattering = append(chattering, &AlarmChattering{
+			SensorID:      key.sensorID,
+			AlarmType:     key.alarmType,
+			OilFieldID:    list[0].OilFieldID,
+			Annunciations: len(list),
+			Bursts:        bursts,
+		})
+	}
+	sort.SliceStable(chattering, func(i, j int) bool {
+		return chattering[i].Annunciations > chattering[j].Annunciations
+	})
+
+	return chattering
+}
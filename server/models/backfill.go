@@ -0,0 +1,151 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+)
+
+const (
+	BACKFILL_STATUS_PROPOSED  = "proposed"
+	BACKFILL_STATUS_PENDING   = "pending"
+	BACKFILL_STATUS_REQUESTED = "requested"
+	BACKFILL_STATUS_RECEIVING = "receiving"
+	BACKFILL_STATUS_COMPLETED = "completed"
+	BACKFILL_STATUS_FAILED    = "failed"
+	BACKFILL_STATUS_CANCELLED = "cancelled"
+
+	BACKFILL_SOURCE_MANUAL = "manual"
+	BACKFILL_SOURCE_GAP    = "gap"
+)
+
+// BackfillMaxRange - longest time range of one backfill in seconds.
+const BackfillMaxRange = 31 * 24 * 3600
+
+// Backfill - request to an oil field to resend its samples of [From, To). Empty ControllerID covers the whole
+// oil field, empty SensorIDs the whole controller. Proposed backfills come from gap detection and are sent once
+// approved, pending ones are sent as soon as the field is online.
+type Backfill struct {
+	BackfillID    int64    `json:"backfillId"`
+	CompanyID     int64    `json:"companyId"`
+	OilFieldID    int64    `json:"oilFieldId"`
+	ControllerID  string   `json:"controllerId"`
+	SensorIDs     []string `json:"sensorIds"`
+	From          int64    `json:"from"`
+	To            int64    `json:"to"`
+	Status        string   `json:"status"`
+	Source        string   `json:"source"`
+	RequestedBy   int64    `json:"requestedBy"`
+	Files         int      `json:"files"`
+	ExpectedFiles int      `json:"expectedFiles"`
+	Points        int64    `json:"points"`
+	Error         string   `json:"error"`
+	RequestedTs   int64    `json:"requestedTs"`
+	CompletedTs   int64    `json:"completedTs"`
+	CreatedTs     int64    `json:"createdTs"`
+	UpdatedTs     int64    `json:"updatedTs"`
+}
+
+// IsOpen - not yet completed, failed or cancelled.
+func (backfill *Backfill) IsOpen() bool {
+	switch backfill.Status {
+	case BACKFILL_STATUS_COMPLETED, BACKFILL_STATUS_FAILED, BACKFILL_STATUS_CANCELLED:
+		return false
+	}
+
+	return true
+}
+
+func (backfill *Backfill) Validate() error {
+	if backfill.To <= backfill.From {
+		return errors.New("to must be after from")
+	}
+	if backfill.To-backfill.From > BackfillMaxRange {
+		return fmt.Errorf("the range must not exceed %d seconds", BackfillMaxRange)
+	}
+
+	// cloud ids of controllers and sensors are prefixed with the id of their oil field and controller
+	prefix := fmt.Sprintf("%d_", backfill.OilFieldID)
+	if backfill.ControllerID != "" {
+		if !strings.HasPrefix(backfill.ControllerID, prefix) {
+			return errors.New("controllerId is not a controller of the oil field")
+		}
+		prefix = backfill.ControllerID + "_"
+	}
+	for _, sensorID := range backfill.SensorIDs {
+		if !strings.HasPrefix(sensorID, prefix) {
+			return fmt.Errorf("sensor %s is not a sensor of the controller", sensorID)
+		}
+	}
+	if len(backfill.SensorIDs) > 0 && backfill.ControllerID == "" {
+		return errors.New("controllerId required with sensorIds")
+	}
+
+	return validation.ValidateStruct(
+		backfill,
+		validation.Field(
+			&backfill.OilFieldID,
+			validation.Required,
+		),
+		validation.Field(
+			&backfill.From,
+			validation.Required,
+		),
+	)
+}
+
+// BackfillRequest - body of MessageTypeCloudBackfill, ids are the ones of the field. A zero ControllerID asks
+// for every controller, empty TagNames for every sensor of the controller.
+type BackfillRequest struct {
+	BackfillID   int64    `json:"backfill_id"`
+	ControllerID int64    `json:"controller_id"`
+	TagNames     []string `json:"tag_names"`
+	From         int64    `json:"from"`
+	To           int64    `json:"to"`
+}
+
+// BackfillDone - body of MessageTypeCloudBackfillDone, the field sent Files sync files for the backfill
+// or failed with Error.
+type BackfillDone struct {
+	BackfillID int64  `json:"backfill_id"`
+	Files      int    `json:"files"`
+	Error      string `json:"error"`
+}
+
+// SampleBucket - number of samples stored for an oil field in the bucket starting at Time.
+type SampleBucket struct {
+	Time  int64
+	Count int64
+}
+
+// TimeRange - [From, To).
+type TimeRange struct {
+	From int64
+	To   int64
+}
+
+// DetectGaps - runs of empty buckets of at least minGap seconds between buckets with samples. Empty buckets
+// before the first and after the last sample are not gaps, the field may be new or not synced yet.
+func DetectGaps(buckets []SampleBucket, minGap int64) []TimeRange {
+	gaps := make([]TimeRange, 0, 10)
+	gapStart := int64(-1)
+	seenData := false
+	for _, bucket := range buckets {
+		if bucket.Count > 0 {
+			if gapStart >= 0 && bucket.Time-gapStart >= minGap {
+				gaps = append(gaps, TimeRange{From: gapStart, To: bucket.Time})
+			}
+			gapStart = -1
+			seenData = true
+			continue
+		}
+
+		if seenData && gapStart < 0 {
+			gapStart = bucket.Time
+		}
+	}
+
+	return gaps
+}
@@ -0,0 +1,121 @@
+package models
+
+import (
+	"errors"
+	"math"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+	validation2 "gitlab.citicom.kz/CloudServer/server/utils/validation"
+)
+
+const (
+	COMMAND_ACTION_SETPOINT = "setpoint"
+	COMMAND_ACTION_ON       = "on"
+	COMMAND_ACTION_OFF      = "off"
+
+	COMMAND_STATUS_AWAITING_APPROVAL = "awaiting_approval"
+	COMMAND_STATUS_REJECTED          = "rejected"
+	COMMAND_STATUS_SENT              = "sent"
+	COMMAND_STATUS_SUCCEEDED         = "succeeded"
+	COMMAND_STATUS_FAILED            = "failed"
+	COMMAND_STATUS_TIMED_OUT         = "timed_out"
+)
+
+// CommandMaxTimeout - longest time in seconds a command may wait for the result of the field.
+const CommandMaxTimeout = 600
+
+// Command - write of a setpoint or on/off to a sensor of a field controller. Commands to critical sensors wait
+// for the approval of a second user. Every command is kept with its result as the audit trail.
+type Command struct {
+	CommandID     int64   `json:"commandId"`
+	CompanyID     int64   `json:"companyId"`
+	OilFieldID    int64   `json:"oilFieldId"`
+	ControllerID  string  `json:"controllerId"`
+	SensorID      string  `json:"sensorId"`
+	Action        string  `json:"action"`
+	Value         float32 `json:"value"`
+	ExpectedValue float32 `json:"expectedValue"`
+	Tolerance     float32 `json:"tolerance"`
+	Timeout       int64   `json:"timeout"`
+	Comment       string  `json:"comment"`
+	Status        string  `json:"status"`
+	Readback      float32 `json:"readback"`
+	Error         string  `json:"error"`
+	IssuedBy      int64   `json:"issuedBy"`
+	ApprovedBy    int64   `json:"approvedBy"`
+	CreatedTs     int64   `json:"createdTs"`
+	ApprovedTs    int64   `json:"approvedTs"`
+	SentTs        int64   `json:"sentTs"`
+	CompletedTs   int64   `json:"completedTs"`
+}
+
+// Normalize - on and off write 1 and 0, the readback is expected to equal the written value unless given.
+func (command *Command) Normalize(expected *float32) {
+	switch command.Action {
+	case COMMAND_ACTION_ON:
+		command.Value = 1
+	case COMMAND_ACTION_OFF:
+		command.Value = 0
+	}
+
+	command.ExpectedValue = command.Value
+	if expected != nil {
+		command.ExpectedValue = *expected
+	}
+}
+
+// ReadbackMatches - whether the value read back after the write is the expected one within the tolerance.
+func (command *Command) ReadbackMatches(readback float32) bool {
+	return math.Abs(float64(readback-command.ExpectedValue)) <= float64(command.Tolerance)
+}
+
+func (command *Command) Validate() error {
+	if command.Action != COMMAND_ACTION_SETPOINT && command.Action != COMMAND_ACTION_ON && command.Action != COMMAND_ACTION_OFF {
+		return errors.New("action must be setpoint, on or off")
+	}
+
+	return validation.ValidateStruct(
+		command,
+		validation.Field(
+			&command.SensorID,
+			validation.Required,
+		),
+		validation.Field(
+			&command.Tolerance,
+			validation2.GreaterThanOrEqualCreate("tolerance must not be negative", float32(0)),
+		),
+		validation.Field(
+			&command.Timeout,
+			validation2.GreaterThanOrEqualCreate("timeout must not be negative", 0),
+			validation2.LessOrEqualCreate("timeout must not exceed 600 seconds", CommandMaxTimeout),
+		),
+	)
+}
+
+// CommandRequest - body of MessageTypeCloudCommand, ids are the ones of the field. The field writes Value and
+// reads the tag back, it must not execute the command after ExpiresTs.
+type CommandRequest struct {
+	CommandID     int64   `json:"command_id"`
+	ControllerID  int64   `json:"controller_id"`
+	TagName       string  `json:"tag_name"`
+	Action        string  `json:"action"`
+	Value         float32 `json:"value"`
+	ExpectedValue float32 `json:"expected_value"`
+	Tolerance     float32 `json:"tolerance"`
+	Timeout       int64   `json:"timeout"`
+	ExpiresTs     int64   `json:"expires_ts"`
+}
+
+// CommandResult - body of MessageTypeCloudCommandResult, Status is succeeded or failed with Error.
+type CommandResult struct {
+	CommandID int64   `json:"command_id"`
+	Status    string  `json:"status"`
+	Readback  float32 `json:"readback"`
+	Error     string  `json:"error"`
+}
+
+// CriticalTag - marks a sensor whose commands need a second user to approve them.
+type CriticalTag struct {
+	SensorID   string `json:"sensorId"`
+	IsCritical bool   `json:"isCritical"`
+}
@@ -0,0 +1,129 @@
+package models
+
+import (
+	validation "github.com/go-ozzo/ozzo-validation"
+	validation2 "gitlab.citicom.kz/CloudServer/server/utils/validation"
+)
+
+const (
+	CONFIG_CHANGE_STATUS_PENDING    = "pending"
+	CONFIG_CHANGE_STATUS_SENT       = "sent"
+	CONFIG_CHANGE_STATUS_APPLIED    = "applied"
+	CONFIG_CHANGE_STATUS_REJECTED   = "rejected"
+	CONFIG_CHANGE_STATUS_CONFLICT   = "conflict"
+	CONFIG_CHANGE_STATUS_SUPERSEDED = "superseded"
+
+	CONFIG_TARGET_CONTROLLER = "controller"
+	CONFIG_TARGET_SENSOR     = "sensor"
+)
+
+// SensorConfig - settings of a sensor editable in the cloud. UpdatedTs is the version the edit is based on,
+// the edit is refused when the sensor changed since. AlarmStates are the states raising ALARM_TYPE_STATE.
+type SensorConfig struct {
+	SensorID    string   `json:"sensorId"`
+	RangeL      float32  `json:"rangeL"`
+	RangeH      float32  `json:"rangeH"`
+	AlarmL      float32  `json:"alarmL"`
+	AlarmLL     float32  `json:"alarmLL"`
+	AlarmH      float32  `json:"alarmH"`
+	AlarmHH     float32  `json:"alarmHH"`
+	Unit        string   `json:"unit"`
+	IsEnabled   bool     `json:"isEnabled"`
+	AlarmStates []string `json:"alarmStates"`
+	UpdatedTs   int64    `json:"updatedTs"`
+}
+
+func (config *SensorConfig) Validate() error {
+	return validation.ValidateStruct(
+		config,
+		validation.Field(
+			&config.SensorID,
+			validation.Required,
+		),
+		validation.Field(
+			&config.RangeH,
+			validation2.GreaterThanOrEqualCreate("rangeH must not be below rangeL", config.RangeL),
+		),
+		validation.Field(
+			&config.AlarmL,
+			validation2.GreaterThanOrEqualCreate("alarmL must not be below alarmLL", config.AlarmLL),
+		),
+		validation.Field(
+			&config.AlarmHH,
+			validation2.GreaterThanOrEqualCreate("alarmHH must not be below alarmH", config.AlarmH),
+		),
+		validation.Field(
+			&config.UpdatedTs,
+			validation.Required,
+		),
+	)
+}
+
+// ControllerConfig - settings of a controller editable in the cloud, UpdatedTs as in SensorConfig.
+type ControllerConfig struct {
+	ControllerID string `json:"controllerId"`
+	Name         string `json:"name"`
+	IsEnabled    bool   `json:"isEnabled"`
+	UpdatedTs    int64  `json:"updatedTs"`
+}
+
+func (config *ControllerConfig) Validate() error {
+	return validation.ValidateStruct(
+		config,
+		validation.Field(
+			&config.ControllerID,
+			validation.Required,
+		),
+		validation.Field(
+			&config.Name,
+			validation.Required,
+		),
+		validation.Field(
+			&config.UpdatedTs,
+			validation.Required,
+		),
+	)
+}
+
+// ConfigChange - an edit made in the cloud on its way to the field. UpdatedTs is the new version of the target,
+// the field applies the change only if its own copy is not newer.
+type ConfigChange struct {
+	ChangeID    int64       `json:"changeId"`
+	CompanyID   int64       `json:"companyId"`
+	OilFieldID  int64       `json:"oilFieldId"`
+	TargetType  string      `json:"targetType"`
+	TargetID    string      `json:"targetId"`
+	Config      interface{} `json:"config"`
+	Status      string      `json:"status"`
+	Error       string      `json:"error"`
+	RequestedBy int64       `json:"requestedBy"`
+	UpdatedTs   int64       `json:"updatedTs"`
+	FieldTs     int64       `json:"fieldTs"`
+	SentTs      int64       `json:"sentTs"`
+	AckedTs     int64       `json:"ackedTs"`
+	CreatedTs   int64       `json:"createdTs"`
+}
+
+// IsOpen - not yet acknowledged by the field or superseded.
+func (change *ConfigChange) IsOpen() bool {
+	return change.Status == CONFIG_CHANGE_STATUS_PENDING || change.Status == CONFIG_CHANGE_STATUS_SENT
+}
+
+// ConfigChangeRequest - body of MessageTypeCloudConfigChange, ids are the ones of the field. TagName is empty
+// for a controller change, Config holds a SensorConfig or a ControllerConfig.
+type ConfigChangeRequest struct {
+	ChangeID     int64       `json:"change_id"`
+	ControllerID int64       `json:"controller_id"`
+	TagName      string      `json:"tag_name"`
+	UpdatedTs    int64       `json:"updated_ts"`
+	Config       interface{} `json:"config"`
+}
+
+// ConfigChangeAck - body of MessageTypeCloudConfigAck. Status is applied, rejected with Error, or conflict when
+// the field copy is newer, UpdatedTs is the version the field has after it.
+type ConfigChangeAck struct {
+	ChangeID  int64  `json:"change_id"`
+	Status    string `json:"status"`
+	UpdatedTs int64  `json:"updated_ts"`
+	Error     string `json:"error"`
+}
@@ -0,0 +1,137 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ConnectivityEventUnknown - the cloud stopped, the state of the oil field is not known until its next connect or
+// disconnect.
+const (
+	ConnectivityEventConnect    = "connect"
+	ConnectivityEventDisconnect = "disconnect"
+	ConnectivityEventUnknown    = "unknown"
+)
+
+// OilFieldSensorID - alarm subject standing for the oil field itself, used by connectivity alarms.
+func OilFieldSensorID(oilFieldID int64) string {
+	return fmt.Sprintf("%d", oilFieldID)
+}
+
+type ConnectivityEvent struct {
+	EventID    int64  `json:"eventId"`
+	OilFieldID int64  `json:"oilFieldId"`
+	Event      string `json:"event"`
+	Address    string `json:"address"`
+	Time       int64  `json:"time"`
+}
+
+type Outage struct {
+	Start     int64 `json:"start"`
+	End       int64 `json:"end"`
+	Duration  int64 `json:"duration"`
+	IsOngoing bool  `json:"isOngoing"`
+}
+
+// UptimeReport - UptimePercent is the share of the time the state of the field is known, the unknown periods
+// are left out of the uptime and the downtime.
+type UptimeReport struct {
+	OilFieldID      int64     `json:"oilFieldId"`
+	From            int64     `json:"from"`
+	To              int64     `json:"to"`
+	UptimePercent   float64   `json:"uptimePercent"`
+	DowntimeSeconds int64     `json:"downtimeSeconds"`
+	UnknownSeconds  int64     `json:"unknownSeconds"`
+	Outages         []*Outage `json:"outages"`
+	UnknownPeriods  []*Outage `json:"unknownPeriods"`
+}
+
+type UptimeRequest struct {
+	OilFieldID int64
+	From       int64
+	To         int64
+}
+
+func (request *UptimeRequest) Validate() error {
+	if request.OilFieldID == 0 {
+		return errors.New("oilFieldId required")
+	}
+	if request.From <= 0 || request.To <= request.From {
+		return errors.New("from and to required, to must be after from")
+	}
+
+	return nil
+}
+
+// NewUptimeReport - builds the report of [from, to) out of the time ordered events inside the range, state is the
+// last event before from, empty when there is none and the field counts as offline. The range is cut at now, the
+// future is not counted.
+func NewUptimeReport(oilFieldID int64, from int64, to int64, now int64, state string, events []*ConnectivityEvent) *UptimeReport {
+	report := &UptimeReport{
+		OilFieldID:     oilFieldID,
+		From:           from,
+		To:             to,
+		Outages:        make([]*Outage, 0, 10),
+		UnknownPeriods: make([]*Outage, 0),
+	}
+	if to > now {
+		to = now
+	}
+	if to <= from {
+		return report
+	}
+
+	// period - the current outage or unknown period, nil while online
+	var period *Outage
+	periodState := ConnectivityEventConnect
+	closePeriod := func(end int64) {
+		if period == nil {
+			return
+		}
+		period.End = end
+		period.Duration = period.End - period.Start
+		if periodState == ConnectivityEventUnknown {
+			report.UnknownPeriods = append(report.UnknownPeriods, period)
+		} else {
+			report.Outages = append(report.Outages, period)
+		}
+		period = nil
+	}
+	setState := func(event string, eventTime int64) {
+		if event != ConnectivityEventUnknown && event != ConnectivityEventConnect {
+			event = ConnectivityEventDisconnect
+		}
+		if period != nil && periodState == event {
+			return
+		}
+		closePeriod(eventTime)
+		periodState = event
+		if event != ConnectivityEventConnect {
+			period = &Outage{Start: eventTime}
+		}
+	}
+
+	setState(state, from)
+	for _, event := range events {
+		if event.Time >= to {
+			break
+		}
+		setState(event.Event, event.Time)
+	}
+	if period != nil {
+		period.IsOngoing = to == now
+		closePeriod(to)
+	}
+
+	for _, item := range report.Outages {
+		report.DowntimeSeconds += item.Duration
+	}
+	for _, item := range report.UnknownPeriods {
+		report.UnknownSeconds += item.Duration
+	}
+	if known := to - from - report.UnknownSeconds; known > 0 {
+		report.UptimePercent = float64(known-report.DowntimeSeconds) * 100 / float64(known)
+	}
+
+	return report
+}
@@ -1,22 +1,25 @@
 package models
 
 type SensorResult struct {
-	SensorId     string  `json:"sensorId"`
-	TagName      string  `json:"tagName"`
-	ControllerId string  `json:"controllerId"`
-	Transform    string  `json:"transform"`
-	RangeL       float32 `json:"rangeL"`
-	RangeH       float32 `json:"rangeH"`
-	AlarmValue   float32 `json:"alarmValue"`
-	AlarmTime    int64   `json:"time"`
-	AlarmL       float64 `json:"alarmL"`
-	AlarmLL      float64 `json:"alarmLL"`
-	AlarmH       float64 `json:"alarmH"`
-	AlarmHH      float64 `json:"alarmHH"`
-	Unit         string  `json:"unit"`
-	IsEnabled    bool    `json:"isEnabled"`
-	CreatedTs    int64   `json:"createdTs"`
-	UpdatedTs    int64   `json:"updatedTs"`
+	SensorId     string            `json:"sensorId"`
+	TagName      string            `json:"tagName"`
+	ControllerId string            `json:"controllerId"`
+	Transform    string            `json:"transform"`
+	RangeL       float32           `json:"rangeL"`
+	RangeH       float32           `json:"rangeH"`
+	AlarmValue   float32           `json:"alarmValue"`
+	AlarmTime    int64             `json:"time"`
+	AlarmL       float64           `json:"alarmL"`
+	AlarmLL      float64           `json:"alarmLL"`
+	AlarmH       float64           `json:"alarmH"`
+	AlarmHH      float64           `json:"alarmHH"`
+	Unit         string            `json:"unit"`
+	IsEnabled    bool              `json:"isEnabled"`
+	CreatedTs    int64             `json:"createdTs"`
+	UpdatedTs    int64             `json:"updatedTs"`
+	ValueType    string            `json:"valueType"`
+	EnumLabels   map[string]string `json:"enumLabels"`
+	AlarmStates  []string          `json:"alarmStates"`
 }
 
 type ControllerResult struct {
@@ -44,24 +47,29 @@ type ControllerResultCloud struct {
 	IsOnline     bool   `json:"isOnline"`
 }
 
+// SensorResultCloud - a sensor of a sync file. ValueType is one of SENSOR_TYPE_*, EnumLabels the label of each
+// code of an enum sensor and AlarmStates the states raising ALARM_TYPE_STATE.
 type SensorResultCloud struct {
-	TagName      string  `json:"tagName"`
-	ControllerID int64   `json:"controllerId"`
-	Transform    string  `json:"transform"`
-	Address      int     `json:"address"`
-	Quantity     int     `json:"quantity"`
-	ReadTemplate string  `json:"read_template"`
-	ResultFormat string  `json:"result_format"`
-	RangeL       float32 `json:"rangeL"`
-	RangeH       float32 `json:"rangeH"`
-	AlarmL       float32 `json:"alarmL"`
-	AlarmLL      float32 `json:"alarmLL"`
-	AlarmH       float32 `json:"alarmH"`
-	AlarmHH      float32 `json:"alarmHH"`
-	Unit         string  `json:"unit"`
-	IsEnabled    bool    `json:"isEnabled"`
-	SkipSave     bool    `json:"skip_save"`
-	CreatedTs    int64   `json:"createdTs"`
-	UpdatedTs    int64   `json:"updatedTs"`
-	IsOnline     bool    `json:"isOnline"`
+	TagName      string            `json:"tagName"`
+	ControllerID int64             `json:"controllerId"`
+	Transform    string            `json:"transform"`
+	Address      int               `json:"address"`
+	Quantity     int               `json:"quantity"`
+	ReadTemplate string            `json:"read_template"`
+	ResultFormat string            `json:"result_format"`
+	RangeL       float32           `json:"rangeL"`
+	RangeH       float32           `json:"rangeH"`
+	AlarmL       float32           `json:"alarmL"`
+	AlarmLL      float32           `json:"alarmLL"`
+	AlarmH       float32           `json:"alarmH"`
+	AlarmHH      float32           `json:"alarmHH"`
+	Unit         string            `json:"unit"`
+	IsEnabled    bool              `json:"isEnabled"`
+	SkipSave     bool              `json:"skip_save"`
+	CreatedTs    int64             `json:"createdTs"`
+	UpdatedTs    int64             `json:"updatedTs"`
+	IsOnline     bool              `json:"isOnline"`
+	ValueType    string            `json:"valueType"`
+	EnumLabels   map[string]string `json:"enumLabels"`
+	AlarmStates  []string          `json:"alarmStates"`
 }
@@ -0,0 +1,29 @@
+package models
+
+// OilFieldCredentials - link credentials of an oil field. Messages and sync files are signed with HMAC-SHA256
+// of Secret; after a rotation the PreviousSecret is still accepted for the grace period. A gateway may also
+// authenticate with a client certificate whose common name is ClientCertCN. UseTLS switches the dial-out
+// link to wss:// and https://.
+type OilFieldCredentials struct {
+	OilFieldID     int64  `json:"oilFieldId"`
+	Secret         string `json:"secret,omitempty"`
+	PreviousSecret string `json:"-"`
+	HasSecret      bool   `json:"hasSecret"`
+	RotatedTs      int64  `json:"rotatedTs"`
+	ClientCertCN   string `json:"clientCertCn"`
+	UseTLS         bool   `json:"useTls"`
+	AllowUnsigned  bool   `json:"allowUnsigned"`
+}
+
+// Secrets - returns the secrets accepted at the given unix time.
+func (credentials *OilFieldCredentials) Secrets(now int64, grace int64) []string {
+	secrets := make([]string, 0, 2)
+	if credentials.Secret != "" {
+		secrets = append(secrets, credentials.Secret)
+	}
+	if credentials.PreviousSecret != "" && now-credentials.RotatedTs < grace {
+		secrets = append(secrets, credentials.PreviousSecret)
+	}
+
+	return secrets
+}
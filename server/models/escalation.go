@@ -0,0 +1,135 @@
+package models
+
+import (
+	"errors"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+	validation2 "gitlab.citicom.kz/CloudServer/server/utils/validation"
+)
+
+// OnCallSchedule - rotation of users taking shifts of ShiftHours one after another starting at RotationStart.
+type OnCallSchedule struct {
+	ScheduleID    int64   `json:"scheduleId"`
+	CompanyID     int64   `json:"companyId"`
+	Name          string  `json:"name"`
+	UserIDs       []int64 `json:"userIds"`
+	RotationStart int64   `json:"rotationStart"`
+	ShiftHours    int     `json:"shiftHours"`
+	OnCallUserID  int64   `json:"onCallUserId"`
+	CreatedTs     int64   `json:"createdTs"`
+	UpdatedTs     int64   `json:"updatedTs"`
+}
+
+// OnCall - returns the user on shift at the given unix time or 0 when nobody is.
+func (schedule *OnCallSchedule) OnCall(now int64) int64 {
+	if len(schedule.UserIDs) == 0 || schedule.ShiftHours <= 0 || now < schedule.RotationStart {
+		return 0
+	}
+
+	shift := (now - schedule.RotationStart) / int64(schedule.ShiftHours*3600)
+	return schedule.UserIDs[shift%int64(len(schedule.UserIDs))]
+}
+
+// EscalationStep - tier reached when the alarm stays unacknowledged DelayMinutes after it was raised.
+// Recipients are the on-call user of the schedule, or every company user with the role when no schedule is set.
+type EscalationStep struct {
+	DelayMinutes int    `json:"delayMinutes"`
+	Role         string `json:"role"`
+	ScheduleID   int64  `json:"scheduleId"`
+}
+
+// EscalationPolicy - escalation steps of a company, or of a single oil field when OilFieldID is set.
+type EscalationPolicy struct {
+	PolicyID   int64            `json:"policyId"`
+	CompanyID  int64            `json:"companyId"`
+	OilFieldID int64            `json:"oilFieldId"`
+	Name       string           `json:"name"`
+	Steps      []EscalationStep `json:"steps"`
+	IsEnabled  bool             `json:"isEnabled"`
+	CreatedTs  int64            `json:"createdTs"`
+	UpdatedTs  int64            `json:"updatedTs"`
+}
+
+type AlarmEscalationResult struct {
+	EscalationID int64  `json:"escalationId"`
+	AlarmID      int64  `json:"alarmId"`
+	PolicyID     int64  `json:"policyId"`
+	Tier         int    `json:"tier"`
+	UserID       int64  `json:"userId"`
+	FirstName    string `json:"firstName"`
+	LastName     string `json:"lastName"`
+	Time         int64  `json:"time"`
+}
+
+func (schedule *OnCallSchedule) Validate() error {
+	return validation.ValidateStruct(
+		schedule,
+		validation.Field(
+			&schedule.CompanyID,
+			validation.Required,
+		),
+		validation.Field(
+			&schedule.Name,
+			validation.Required,
+		),
+		validation.Field(
+			&schedule.UserIDs,
+			validation.Required,
+		),
+		validation.Field(
+			&schedule.RotationStart,
+			validation.Required,
+		),
+		validation.Field(
+			&schedule.ShiftHours,
+			validation.Required,
+			validation2.GreaterThanOrEqualCreate("shiftHours must be at least 1", 1),
+		),
+	)
+}
+
+func (step EscalationStep) Validate() error {
+	if step.Role == "" && step.ScheduleID == 0 {
+		return errors.New("role or scheduleId required")
+	}
+
+	return validation.ValidateStruct(
+		&step,
+		validation.Field(
+			&step.DelayMinutes,
+			validation2.GreaterThanOrEqualCreate("delayMinutes must be at least 1", 1),
+		),
+		validation.Field(
+			&step.Role,
+			validation.In(RoleOperator, RoleManager, RoleAdmin).Error("allow roles operator, manager, admin"),
+		),
+	)
+}
+
+func (policy *EscalationPolicy) Validate() error {
+	if err := validation.ValidateStruct(
+		policy,
+		validation.Field(
+			&policy.CompanyID,
+			validation.Required,
+		),
+		validation.Field(
+			&policy.Name,
+			validation.Required,
+		),
+		validation.Field(
+			&policy.Steps,
+			validation.Required,
+		),
+	); err != nil {
+		return err
+	}
+
+	for i := 1; i < len(policy.Steps); i++ {
+		if policy.Steps[i].DelayMinutes <= policy.Steps[i-1].DelayMinutes {
+			return errors.New("steps: delayMinutes must increase from tier to tier")
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"errors"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+)
+
+// MaintenanceWindow - period during which alarms of an oil field, a controller or a sensor are stored
+// as suppressed and not notified. Empty ControllerID and SensorID cover the whole oil field.
+type MaintenanceWindow struct {
+	WindowID       int64  `json:"windowId"`
+	CompanyID      int64  `json:"companyId"`
+	OilFieldID     int64  `json:"oilFieldId"`
+	ControllerID   string `json:"controllerId"`
+	SensorID       string `json:"sensorId"`
+	OwnerID        int64  `json:"ownerId"`
+	OwnerFirstName string `json:"ownerFirstName"`
+	OwnerLastName  string `json:"ownerLastName"`
+	Reason         string `json:"reason"`
+	StartTs        int64  `json:"startTs"`
+	EndTs          int64  `json:"endTs"`
+	IsClosed       bool   `json:"isClosed"`
+	CreatedTs      int64  `json:"createdTs"`
+	UpdatedTs      int64  `json:"updatedTs"`
+}
+
+// IsActive - reports whether the window covers the given unix time.
+func (window *MaintenanceWindow) IsActive(now int64) bool {
+	return !window.IsClosed && window.StartTs <= now && now < window.EndTs
+}
+
+func (window *MaintenanceWindow) Validate() error {
+	if window.EndTs <= window.StartTs {
+		return errors.New("endTs must be after startTs")
+	}
+
+	return validation.ValidateStruct(
+		window,
+		validation.Field(
+			&window.OilFieldID,
+			validation.Required,
+		),
+		validation.Field(
+			&window.Reason,
+			validation.Required,
+			validation.Length(1, 1024),
+		),
+		validation.Field(
+			&window.StartTs,
+			validation.Required,
+		),
+		validation.Field(
+			&window.EndTs,
+			validation.Required,
+		),
+	)
+}
@@ -19,6 +19,8 @@ type MnemoSensorDataResult struct {
 	RangeH         string  `json:"rangeH"`
 	RangeL         string  `json:"rangeL"`
 	FormattedValue float64 `json:"formattedValue"`
+	Quality        string  `json:"quality"`
+	State          string  `json:"state,omitempty"`
 	CreatedTs      int64   `json:"createdTs"`
 }
 
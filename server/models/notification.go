@@ -0,0 +1,166 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+	validation2 "gitlab.citicom.kz/CloudServer/server/utils/validation"
+)
+
+const (
+	NotificationChannelSMTP    = "smtp"
+	NotificationChannelWebhook = "webhook"
+	NotificationChannelBot     = "bot"
+	NotificationChannelSMS     = "sms"
+)
+
+const (
+	NotificationStatusPending = "pending"
+	NotificationStatusSent    = "sent"
+	NotificationStatusFailed  = "failed"
+	NotificationStatusSkipped = "skipped"
+)
+
+type NotificationChannel struct {
+	ChannelID int64           `json:"channelId"`
+	CompanyID int64           `json:"companyId"`
+	Name      string          `json:"name"`
+	Type      string          `json:"type"`
+	Config    json.RawMessage `json:"config"`
+	IsEnabled bool            `json:"isEnabled"`
+	CreatedTs int64           `json:"createdTs"`
+	UpdatedTs int64           `json:"updatedTs"`
+}
+
+type NotificationSubscription struct {
+	SubscriptionID int64                `json:"subscriptionId"`
+	UserID         int64                `json:"userId"`
+	ChannelID      int64                `json:"channelId"`
+	Address        string               `json:"address"`
+	OilFieldIDs    []int64              `json:"oilFieldIds"`
+	Severities     []string             `json:"severities"`
+	QuietFrom      int                  `json:"quietFrom"`
+	QuietTo        int                  `json:"quietTo"`
+	TimeZone       string               `json:"timeZone"`
+	IsEnabled      bool                 `json:"isEnabled"`
+	CreatedTs      int64                `json:"createdTs"`
+	UpdatedTs      int64                `json:"updatedTs"`
+	Channel        *NotificationChannel `json:"-"`
+}
+
+type NotificationDelivery struct {
+	DeliveryID     int64  `json:"deliveryId"`
+	AlarmID        int64  `json:"alarmId"`
+	SubscriptionID int64  `json:"subscriptionId"`
+	ChannelID      int64  `json:"channelId"`
+	UserID         int64  `json:"userId"`
+	ChannelType    string `json:"channelType"`
+	Address        string `json:"address"`
+	Status         string `json:"status"`
+	Attempts       int    `json:"attempts"`
+	LastError      string `json:"lastError"`
+	CreatedTs      int64  `json:"createdTs"`
+	UpdatedTs      int64  `json:"updatedTs"`
+	SentTs         int64  `json:"sentTs"`
+}
+
+// Accepts - reports whether the alarm matches the oil field and severity rules of the subscription.
+func (subscription *NotificationSubscription) Accepts(alarm *AlarmResult) bool {
+	if len(subscription.OilFieldIDs) > 0 {
+		found := false
+		for _, oilFieldID := range subscription.OilFieldIDs {
+			if oilFieldID == alarm.OilFieldId {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if len(subscription.Severities) > 0 {
+		severity := AlarmSeverity(alarm.AlarmType)
+		for _, allowed := range subscription.Severities {
+			if allowed == severity {
+				return true
+			}
+		}
+		return false
+	}
+
+	return true
+}
+
+// InQuietHours - reports whether now falls into the quiet hours of the subscription.
+// Quiet hours are minutes after midnight in the subscription time zone and may wrap over midnight.
+func (subscription *NotificationSubscription) InQuietHours(now time.Time) bool {
+	if subscription.QuietFrom == subscription.QuietTo {
+		return false
+	}
+
+	location, err := time.LoadLocation(subscription.TimeZone)
+	if err != nil {
+		location = time.UTC
+	}
+	local := now.In(location)
+	minute := local.Hour()*60 + local.Minute()
+
+	if subscription.QuietFrom < subscription.QuietTo {
+		return minute >= subscription.QuietFrom && minute < subscription.QuietTo
+	}
+	return minute >= subscription.QuietFrom || minute < subscription.QuietTo
+}
+
+func (channel *NotificationChannel) Validate() error {
+	return validation.ValidateStruct(
+		channel,
+		validation.Field(
+			&channel.CompanyID,
+			validation.Required,
+		),
+		validation.Field(
+			&channel.Name,
+			validation.Required,
+		),
+		validation.Field(
+			&channel.Type,
+			validation.Required,
+			validation.In(
+				NotificationChannelSMTP,
+				NotificationChannelWebhook,
+				NotificationChannelBot,
+				NotificationChannelSMS,
+			).Error("allow types smtp, webhook, bot, sms"),
+		),
+		validation.Field(
+			&channel.Config,
+			validation.Required,
+		),
+	)
+}
+
+func (subscription *NotificationSubscription) Validate() error {
+	return validation.ValidateStruct(
+		subscription,
+		validation.Field(
+			&subscription.ChannelID,
+			validation.Required,
+		),
+		validation.Field(
+			&subscription.Severities,
+			validation.Each(validation.In(ALARM_SEVERITY_CRITICAL, ALARM_SEVERITY_WARNING)),
+		),
+		validation.Field(
+			&subscription.QuietFrom,
+			validation2.GreaterThanOrEqualCreate("quietFrom must be between 0 and 1439", 0),
+			validation2.LessOrEqualCreate("quietFrom must be between 0 and 1439", 1439),
+		),
+		validation.Field(
+			&subscription.QuietTo,
+			validation2.GreaterThanOrEqualCreate("quietTo must be between 0 and 1439", 0),
+			validation2.LessOrEqualCreate("quietTo must be between 0 and 1439", 1439),
+		),
+	)
+}
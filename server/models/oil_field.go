@@ -2,31 +2,52 @@ package models
 
 import validation "github.com/go-ozzo/ozzo-validation"
 
+const (
+	// ConnectionModeDial - the cloud dials ws://<HttpAddress>/connectCloud of the oil field.
+	ConnectionModeDial = "dial"
+	// ConnectionModeGateway - the field gateway dials /gateway/connect of the cloud.
+	ConnectionModeGateway = "gateway"
+)
+
 type OilField struct {
-	OilFieldId  int64   `json:"oilFieldId"`
-	HttpAddress string  `json:"httpAddress"`
-	CompanyID   int64   `json:"companyId"`
-	CompanyName string  `json:"companyName"`
-	Name        string  `json:"name"`
-	Lat         float64 `json:"lat"`
-	Lon         float64 `json:"lon"`
-	IsDeleted   bool    `json:"isDeleted"`
-	CreatedTs   int64   `json:"createdTs"`
-	UpdatedTs   int64   `json:"updatedTs"`
+	OilFieldId     int64   `json:"oilFieldId"`
+	HttpAddress    string  `json:"httpAddress"`
+	CompanyID      int64   `json:"companyId"`
+	CompanyName    string  `json:"companyName"`
+	Name           string  `json:"name"`
+	Lat            float64 `json:"lat"`
+	Lon            float64 `json:"lon"`
+	ConnectionMode string  `json:"connectionMode"`
+	IsDeleted      bool    `json:"isDeleted"`
+	CreatedTs      int64   `json:"createdTs"`
+	UpdatedTs      int64   `json:"updatedTs"`
+}
+
+// IsGateway - reports whether the field gateway connects into the cloud instead of being dialed.
+func (oilField *OilField) IsGateway() bool {
+	return oilField.ConnectionMode == ConnectionModeGateway
 }
 
 type OilFieldResult struct {
-	OilFieldId  int64   `json:"oilFieldId"`
-	HttpAddress string  `json:"httpAddress"`
-	CompanyID   int64   `json:"companyId"`
-	CompanyName string  `json:"companyName"`
-	Name        string  `json:"name"`
-	Lat         float64 `json:"lat"`
-	Lon         float64 `json:"lon"`
-	IsDeleted   bool    `json:"isDeleted"`
-	CreatedTs   int64   `json:"createdTs"`
-	UpdatedTs   int64   `json:"updatedTs"`
-	IsOnline    bool    `json:"isOnline"`
+	OilFieldId     int64             `json:"oilFieldId"`
+	HttpAddress    string            `json:"httpAddress"`
+	CompanyID      int64             `json:"companyId"`
+	CompanyName    string            `json:"companyName"`
+	Name           string            `json:"name"`
+	Lat            float64           `json:"lat"`
+	Lon            float64           `json:"lon"`
+	ConnectionMode string            `json:"connectionMode"`
+	IsDeleted      bool              `json:"isDeleted"`
+	CreatedTs      int64             `json:"createdTs"`
+	UpdatedTs      int64             `json:"updatedTs"`
+	IsOnline       bool              `json:"isOnline"`
+	SyncClient     *SyncClientStatus `json:"syncClient,omitempty"`
+}
+
+// GatewayToken - credential of a field gateway, only returned when it is generated.
+type GatewayToken struct {
+	OilFieldID int64  `json:"oilFieldId"`
+	Token      string `json:"token"`
 }
 
 func (ofr *OilFieldResult) Validate() error {
@@ -48,5 +69,9 @@ func (ofr *OilFieldResult) Validate() error {
 			&ofr.Lon,
 			validation.Required,
 		),
+		validation.Field(
+			&ofr.ConnectionMode,
+			validation.In(ConnectionModeDial, ConnectionModeGateway),
+		),
 	)
 }
@@ -0,0 +1,48 @@
+package models
+
+import (
+	validation "github.com/go-ozzo/ozzo-validation"
+	validation2 "gitlab.citicom.kz/CloudServer/server/utils/validation"
+)
+
+// SensorAlarmSettings - cloud side alarm kinds of a sensor on top of the limits synchronized from the field.
+// Zero values switch the corresponding kind off.
+type SensorAlarmSettings struct {
+	SensorID          string  `json:"sensorId"`
+	ControllerID      string  `json:"controllerId"`
+	OilFieldID        int64   `json:"oilFieldId"`
+	RateOfChange      float32 `json:"rateOfChange"`
+	StaleMinutes      int     `json:"staleMinutes"`
+	FrozenMinutes     int     `json:"frozenMinutes"`
+	DeviationSensorID string  `json:"deviationSensorId"`
+	DeviationSetpoint float32 `json:"deviationSetpoint"`
+	DeviationLimit    float32 `json:"deviationLimit"`
+	BadQuality        bool    `json:"badQuality"`
+	UpdatedTs         int64   `json:"updatedTs"`
+}
+
+func (settings *SensorAlarmSettings) Validate() error {
+	return validation.ValidateStruct(
+		settings,
+		validation.Field(
+			&settings.SensorID,
+			validation.Required,
+		),
+		validation.Field(
+			&settings.RateOfChange,
+			validation2.GreaterThanOrEqualCreate("rateOfChange must not be negative", float32(0)),
+		),
+		validation.Field(
+			&settings.StaleMinutes,
+			validation2.GreaterThanOrEqualCreate("staleMinutes must not be negative", 0),
+		),
+		validation.Field(
+			&settings.FrozenMinutes,
+			validation2.GreaterThanOrEqualCreate("frozenMinutes must not be negative", 0),
+		),
+		validation.Field(
+			&settings.DeviationLimit,
+			validation2.GreaterThanOrEqualCreate("deviationLimit must not be negative", float32(0)),
+		),
+	)
+}
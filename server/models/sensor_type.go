@@ -0,0 +1,201 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Value types of a sensor, sensors of the field without a type are float.
+const (
+	SENSOR_TYPE_FLOAT  = "float"
+	SENSOR_TYPE_BOOL   = "bool"
+	SENSOR_TYPE_INT    = "int"
+	SENSOR_TYPE_ENUM   = "enum"
+	SENSOR_TYPE_STRING = "string"
+)
+
+// NormalizeSensorType - the type as one of SENSOR_TYPE_*, unknown types are float.
+func NormalizeSensorType(valueType string) string {
+	switch valueType {
+	case SENSOR_TYPE_BOOL, SENSOR_TYPE_INT, SENSOR_TYPE_ENUM, SENSOR_TYPE_STRING:
+		return valueType
+	default:
+		return SENSOR_TYPE_FLOAT
+	}
+}
+
+// IsNumericSensorType - samples of the type are compared with limits, ranges and other samples.
+func IsNumericSensorType(valueType string) bool {
+	valueType = NormalizeSensorType(valueType)
+	return valueType == SENSOR_TYPE_FLOAT || valueType == SENSOR_TYPE_INT
+}
+
+// IsDiscreteSensorType - samples of the type hold a state until the next one, they are charted as steps.
+func IsDiscreteSensorType(valueType string) bool {
+	return NormalizeSensorType(valueType) != SENSOR_TYPE_FLOAT
+}
+
+// SampleValue - the sample as the type of its sensor: the InfluxDB fields, the number stored as value and the
+// state compared with the alarm states. value stays a float of every type but string, so charts and counts keep
+// working, the typed value goes to valueBool, valueInt or valueString. A sample without a typed value falls back
+// to its formatted value.
+func (sensor *SensorResultCloud) SampleValue(data *SensorData) (map[string]interface{}, float32, string, error) {
+	switch NormalizeSensorType(sensor.ValueType) {
+	case SENSOR_TYPE_BOOL:
+		state, err := data.boolValue()
+		if err != nil {
+			return nil, 0, "", err
+		}
+		var number float32
+		if state {
+			number = 1
+		}
+		return map[string]interface{}{"value": number, "valueBool": state}, number, strconv.FormatBool(state), nil
+	case SENSOR_TYPE_INT:
+		code, err := data.intValue()
+		if err != nil {
+			return nil, 0, "", err
+		}
+		return map[string]interface{}{"value": float32(code), "valueInt": code}, float32(code), strconv.FormatInt(code, 10), nil
+	case SENSOR_TYPE_ENUM:
+		code, label, err := sensor.enumValue(data)
+		if err != nil {
+			return nil, 0, "", err
+		}
+		return map[string]interface{}{"value": float32(code), "valueInt": code, "valueString": label}, float32(code), label, nil
+	case SENSOR_TYPE_STRING:
+		text, err := data.stringValue()
+		if err != nil {
+			return nil, 0, "", err
+		}
+		return map[string]interface{}{"valueString": text}, 0, text, nil
+	default:
+		return map[string]interface{}{"value": data.FormattedValue}, data.FormattedValue, "", nil
+	}
+}
+
+// IsAlarmState - whether the state of a sample is one of the alarm states of the sensor. An alarm state is
+// matched with the state or, for a bool, int or enum sensor, with the number of the sample.
+func (sensor *SensorResultCloud) IsAlarmState(state string, value float32) bool {
+	number := strconv.FormatInt(int64(value), 10)
+	for _, alarmState := range sensor.AlarmStates {
+		if strings.EqualFold(alarmState, state) {
+			return true
+		}
+		if NormalizeSensorType(sensor.ValueType) != SENSOR_TYPE_STRING && alarmState == number {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (sensor *SensorResultCloud) enumValue(data *SensorData) (int64, string, error) {
+	value, err := data.typedValue()
+	if err != nil {
+		return 0, "", err
+	}
+
+	if text, ok := value.(string); ok {
+		for code, label := range sensor.EnumLabels {
+			if label == text {
+				parsed, err := strconv.ParseInt(code, 10, 64)
+				if err != nil {
+					return 0, "", fmt.Errorf("Invalid enum code %s", code)
+				}
+				return parsed, label, nil
+			}
+		}
+	}
+
+	code, err := data.intValue()
+	if err != nil {
+		return 0, "", err
+	}
+	label, ok := sensor.EnumLabels[strconv.FormatInt(code, 10)]
+	if !ok {
+		label = strconv.FormatInt(code, 10)
+	}
+
+	return code, label, nil
+}
+
+// typedValue - the decoded value of the sample, nil when the field sent only the formatted value.
+func (sensorData *SensorData) typedValue() (interface{}, error) {
+	if len(sensorData.Value) == 0 {
+		return nil, nil
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(sensorData.Value, &value); err != nil {
+		return nil, err
+	}
+
+	return value, nil
+}
+
+func (sensorData *SensorData) boolValue() (bool, error) {
+	value, err := sensorData.typedValue()
+	if err != nil {
+		return false, err
+	}
+
+	switch typed := value.(type) {
+	case nil:
+		return sensorData.FormattedValue != 0, nil
+	case bool:
+		return typed, nil
+	case float64:
+		return typed != 0, nil
+	case string:
+		return strconv.ParseBool(typed)
+	default:
+		return false, fmt.Errorf("Invalid bool value %s", string(sensorData.Value))
+	}
+}
+
+func (sensorData *SensorData) intValue() (int64, error) {
+	value, err := sensorData.typedValue()
+	if err != nil {
+		return 0, err
+	}
+
+	switch typed := value.(type) {
+	case nil:
+		return int64(math.Round(float64(sensorData.FormattedValue))), nil
+	case bool:
+		if typed {
+			return 1, nil
+		}
+		return 0, nil
+	case float64:
+		if typed != math.Trunc(typed) {
+			return 0, fmt.Errorf("Invalid int value %s", string(sensorData.Value))
+		}
+		return int64(typed), nil
+	case string:
+		return strconv.ParseInt(typed, 10, 64)
+	default:
+		return 0, fmt.Errorf("Invalid int value %s", string(sensorData.Value))
+	}
+}
+
+func (sensorData *SensorData) stringValue() (string, error) {
+	value, err := sensorData.typedValue()
+	if err != nil {
+		return "", err
+	}
+
+	switch typed := value.(type) {
+	case nil:
+		return "", errors.New("String sample without a value")
+	case string:
+		return typed, nil
+	default:
+		return string(sensorData.Value), nil
+	}
+}
@@ -2,6 +2,7 @@ package models
 
 import (
 	"encoding/json"
+	"fmt"
 	"time"
 )
 
@@ -11,20 +12,65 @@ const (
 	MessageTypeOilFieldOnline  = "MessageTypeOilFieldOnline"
 	MessageTypeOilFieldOffline = "MessageTypeOilFieldOffline"
 	MessageTypeAlarm           = "MessageTypeAlarm"
+	MessageTypeAlarmEscalation = "MessageTypeAlarmEscalation"
+	// MessageTypeConfigChange - a config change was acknowledged by its oil field.
+	MessageTypeConfigChange = "MessageTypeConfigChange"
+	// MessageTypeCommand - a remote command awaits approval or completed.
+	MessageTypeCommand = "MessageTypeCommand"
+	// MessageTypeSyncItem - a controller or sensor was deleted from the full config of its oil field or restored.
+	MessageTypeSyncItem = "MessageTypeSyncItem"
 
 	MessageTypeCloudSyncGzip    = "MessageTypeCloudSyncGZIP"
 	MessageTypeCloudSyncGzipAck = "MessageTypeCloudSyncGzipAck"
+	// MessageTypeCloudSyncGzipNack - the sync file was not ingested, the field keeps it and sends it again.
+	MessageTypeCloudSyncGzipNack = "MessageTypeCloudSyncGzipNack"
+	// MessageTypeCloudSyncData - sync file sent inline over the socket by gateways, acked like MessageTypeCloudSyncGzip.
+	MessageTypeCloudSyncData = "MessageTypeCloudSyncData"
+	// MessageTypeCloudBackfill - asks the field to resend a time range, it answers with sync files carrying
+	// backfill_id and MessageTypeCloudBackfillDone.
+	MessageTypeCloudBackfill     = "MessageTypeCloudBackfill"
+	MessageTypeCloudBackfillDone = "MessageTypeCloudBackfillDone"
+	// MessageTypeCloudConfigChange - a controller or sensor edited in the cloud, the field answers with
+	// MessageTypeCloudConfigAck.
+	MessageTypeCloudConfigChange = "MessageTypeCloudConfigChange"
+	MessageTypeCloudConfigAck    = "MessageTypeCloudConfigAck"
+	// MessageTypeCloudCommand - a write to a tag of a field controller, the field answers with
+	// MessageTypeCloudCommandResult carrying the value read back.
+	MessageTypeCloudCommand       = "MessageTypeCloudCommand"
+	MessageTypeCloudCommandResult = "MessageTypeCloudCommandResult"
 )
 
+// InputMessage - message of an oil field, Signature is set when the oil field has a secret.
 type InputMessage struct {
-	Type string          `json:"type"`
-	Body json.RawMessage `json:"body"`
+	Type      string          `json:"type"`
+	Timestamp int64           `json:"timestamp"`
+	Body      json.RawMessage `json:"body"`
+	Signature string          `json:"signature"`
 }
 
+// SigningPayload - the bytes covered by the message signature.
+func (im *InputMessage) SigningPayload() []byte {
+	return SigningPayload(im.Type, im.Timestamp, im.Body)
+}
+
+// OutputMessage - message to a user or an oil field. Messages to an oil field carry the signature of the
+// current secret and, during a secret rotation, of the previous one.
 type OutputMessage struct {
-	Type      string          `json:"type"`
-	Timestamp time.Time       `json:"timestamp"`
-	Body      json.RawMessage `json:"body"`
+	Type              string          `json:"type"`
+	Timestamp         time.Time       `json:"timestamp"`
+	Body              json.RawMessage `json:"body"`
+	Signature         string          `json:"signature,omitempty"`
+	PreviousSignature string          `json:"previousSignature,omitempty"`
+}
+
+// SigningPayload - the bytes covered by the message signature.
+func (om *OutputMessage) SigningPayload() []byte {
+	return SigningPayload(om.Type, om.Timestamp.Unix(), om.Body)
+}
+
+// SigningPayload - "<type>\n<unix timestamp>\n<body>", signed with HMAC-SHA256 of the oil field secret.
+func SigningPayload(messageType string, timestamp int64, body []byte) []byte {
+	return append([]byte(fmt.Sprintf("%s\n%d\n", messageType, timestamp)), body...)
 }
 
 func (om *OutputMessage) MarshalJSON() ([]byte, error) {
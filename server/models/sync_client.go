@@ -0,0 +1,28 @@
+package models
+
+const (
+	SYNC_CLIENT_STATE_CONNECTING  = "connecting"
+	SYNC_CLIENT_STATE_ONLINE      = "online"
+	SYNC_CLIENT_STATE_DEGRADED    = "degraded"
+	SYNC_CLIENT_STATE_BACKING_OFF = "backing-off"
+	SYNC_CLIENT_STATE_DISABLED    = "disabled"
+)
+
+// SyncClientStatus - state of the sync connection of an oil field. Connecting is a dial in progress, or for a
+// gateway waiting for it to dial in. Degraded is online while the last message exchange failed, backing-off
+// waits for NextRetryTs after failed dials, disabled is a deleted oil field.
+type SyncClientStatus struct {
+	OilFieldID  int64  `json:"oilFieldId"`
+	State       string `json:"state"`
+	Failures    int    `json:"failures"`
+	LastError   string `json:"lastError"`
+	LastErrorTs int64  `json:"lastErrorTs"`
+	NextRetryTs int64  `json:"nextRetryTs"`
+	ConnectedTs int64  `json:"connectedTs"`
+	StateTs     int64  `json:"stateTs"`
+}
+
+// IsConnected - online or degraded.
+func (status *SyncClientStatus) IsConnected() bool {
+	return status.State == SYNC_CLIENT_STATE_ONLINE || status.State == SYNC_CLIENT_STATE_DEGRADED
+}
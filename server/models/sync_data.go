@@ -1,22 +1,51 @@
 package models
 
 import (
+	"encoding/json"
 	validation "github.com/go-ozzo/ozzo-validation"
 	"regexp"
 )
 
+// Quality of a sample as the field read it, OPC style.
+const (
+	SAMPLE_QUALITY_GOOD      = "good"
+	SAMPLE_QUALITY_UNCERTAIN = "uncertain"
+	SAMPLE_QUALITY_BAD       = "bad"
+)
+
+// SensorData - a sample of a sync file. SensorDataId is the id of the sample on the field, RawValue the registers
+// read, Value the typed value of a sensor not float and Quality one of SAMPLE_QUALITY_*.
 type SensorData struct {
-	SensorDataId   int64   `json:"sensorDataId"`
-	SensorTagName  string  `json:"sensorTagName"`
-	RawValue       []byte  `json:"rawValue"`
-	FormattedValue float32 `json:"formattedValue"`
-	CreatedTs      int64   `json:"createdTs"`
+	SensorDataId   int64           `json:"sensorDataId"`
+	SensorTagName  string          `json:"sensorTagName"`
+	RawValue       []byte          `json:"rawValue"`
+	FormattedValue float32         `json:"formattedValue"`
+	Value          json.RawMessage `json:"value"`
+	Quality        string          `json:"quality"`
+	CreatedTs      int64           `json:"createdTs"`
+}
+
+// SampleQuality - the quality of the sample, good when the field sent none and uncertain when it is unknown.
+func (sensorData *SensorData) SampleQuality() string {
+	return NormalizeQuality(sensorData.Quality)
+}
+
+// NormalizeQuality - a stored or sent quality as one of SAMPLE_QUALITY_*, samples stored without a quality are good.
+func NormalizeQuality(quality string) string {
+	switch quality {
+	case "", SAMPLE_QUALITY_GOOD:
+		return SAMPLE_QUALITY_GOOD
+	case SAMPLE_QUALITY_BAD:
+		return SAMPLE_QUALITY_BAD
+	default:
+		return SAMPLE_QUALITY_UNCERTAIN
+	}
 }
 
 type SensorDataResult struct {
 	SensorData
-	ControllerId int64  `json:controllerId`
-	TagName      string `json:sensorTagName`
+	ControllerId int64  `json:"controllerId"`
+	TagName      string `json:"tagName"`
 }
 
 func (sensorData *SensorData) HasAlarm(sensor *SensorResultCloud) (bool, string, float32) {
@@ -35,6 +64,20 @@ func (sensorData *SensorData) HasAlarm(sensor *SensorResultCloud) (bool, string,
 	return false, "", 0
 }
 
+// AlarmLimits - returns the configured limits, or nil when the sensor has no limits set.
+func (sensor *SensorResultCloud) AlarmLimits() []AlarmLimit {
+	if sensor.AlarmLL == 0 && sensor.AlarmL == 0 && sensor.AlarmH == 0 && sensor.AlarmHH == 0 {
+		return nil
+	}
+
+	return []AlarmLimit{
+		{AlarmType: ALARM_TYPE_LOW_LOW, Value: sensor.AlarmLL, Low: true},
+		{AlarmType: ALARM_TYPE_LOW, Value: sensor.AlarmL, Low: true},
+		{AlarmType: ALARM_TYPE_HIGHT, Value: sensor.AlarmH},
+		{AlarmType: ALARM_TYPE_HIGHT_HIGHT, Value: sensor.AlarmHH},
+	}
+}
+
 type CloudSensorResult struct {
 	TagName      string        `json:"tagName"`
 	ControllerID int64         `json:"controllerId"`
@@ -78,6 +121,7 @@ type SyncControllerDataRequest struct {
 	SelectTime   string `json:"selectTime"`
 	DiffTime     string `json:"diffTime"`
 	GroupTime    string `json:"groupTime"`
+	WithQuality  bool   `json:"withQuality"`
 }
 
 type CloudDataAck struct {
@@ -85,9 +129,12 @@ type CloudDataAck struct {
 	MaxID         int64  `json:"maxId"`
 }
 
+// CloudGzipData - content of a sync file. With FullConfig the controllers are every controller of the oil field
+// with every sensor, the ones missing are marked deleted.
 type CloudGzipData struct {
 	Controllers []*CloudControllersResult `json:"controllers"`
 	Data        []*SensorData             `json:"data"`
+	FullConfig  bool                      `json:"full_config"`
 }
 
 func (scdr *SyncControllerDataRequest) Validate() error {
@@ -113,3 +160,10 @@ func (scdr *SyncControllerDataRequest) Validate() error {
 		),
 	)
 }
+
+// ConfigSyncCounts - controller and sensor rows of sync files inserted, updated and left unchanged.
+type ConfigSyncCounts struct {
+	Inserted  int64 `json:"inserted"`
+	Updated   int64 `json:"updated"`
+	Unchanged int64 `json:"unchanged"`
+}
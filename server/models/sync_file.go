@@ -0,0 +1,134 @@
+package models
+
+import (
+	"fmt"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+	validation2 "gitlab.citicom.kz/CloudServer/server/utils/validation"
+)
+
+const (
+	SYNC_FILE_STATUS_RECEIVED = "received"
+	SYNC_FILE_STATUS_INGESTED = "ingested"
+	SYNC_FILE_STATUS_FAILED   = "failed"
+)
+
+const (
+	SyncFileListDefaultLimit = 100
+	SyncFileListMaxLimit     = 1000
+	SyncFileErrorMaxLength   = 1024
+)
+
+// Error codes of MessageTypeCloudSyncGzipNack, the field keeps the file and retries.
+const (
+	SYNC_ERROR_DOWNLOAD  = "SYNC_ERROR_DOWNLOAD"
+	SYNC_ERROR_SIGNATURE = "SYNC_ERROR_SIGNATURE"
+	SYNC_ERROR_DECODE    = "SYNC_ERROR_DECODE"
+	SYNC_ERROR_STORE     = "SYNC_ERROR_STORE"
+	SYNC_ERROR_TOO_LARGE = "SYNC_ERROR_TOO_LARGE"
+)
+
+// SyncDataChunk - body of MessageTypeCloudSyncData, a part of a sync file sent inline by a gateway. Offset is the
+// position of Data in the file, More is set on every part but the last. A file sent whole is a single part at 0.
+type SyncDataChunk struct {
+	FileName   string `json:"file_name"`
+	Data       []byte `json:"data"`
+	Offset     int64  `json:"offset"`
+	More       bool   `json:"more"`
+	BackfillID int64  `json:"backfill_id"`
+}
+
+// SyncFile - ledger record of a sync file of an oil field, a file is identified by its name and checksum.
+// Downloads failing before the payload arrived are recorded with an empty checksum.
+type SyncFile struct {
+	FileID     int64  `json:"fileId"`
+	OilFieldID int64  `json:"oilFieldId"`
+	FileName   string `json:"fileName"`
+	Checksum   string `json:"checksum"`
+	Points     int    `json:"points"`
+	Status     string `json:"status"`
+	ErrorCode  string `json:"errorCode"`
+	Error      string `json:"error"`
+	Attempts   int    `json:"attempts"`
+	CreatedTs  int64  `json:"createdTs"`
+	UpdatedTs  int64  `json:"updatedTs"`
+}
+
+// SyncFileFilter - query parameters of /sync_files/list.
+type SyncFileFilter struct {
+	OilFieldID int64
+	Status     string
+	Limit      int
+}
+
+func (filter *SyncFileFilter) Validate() error {
+	return validation.ValidateStruct(
+		filter,
+		validation.Field(
+			&filter.Status,
+			validation.In(SYNC_FILE_STATUS_RECEIVED, SYNC_FILE_STATUS_INGESTED, SYNC_FILE_STATUS_FAILED),
+		),
+		validation.Field(
+			&filter.Limit,
+			validation2.GreaterThanOrEqualCreate("limit greater than or equal 1", 1),
+			validation2.LessOrEqualCreate(fmt.Sprintf("limit less than or equal %d", SyncFileListMaxLimit), SyncFileListMaxLimit),
+		),
+	)
+}
+
+type SyncFileAck struct {
+	FileName string `json:"file_name"`
+}
+
+type SyncFileNack struct {
+	FileName string `json:"file_name"`
+	Code     string `json:"code"`
+	Error    string `json:"error"`
+}
+
+// SyncProgress - a sync file being stored.
+type SyncProgress struct {
+	OilFieldID int64  `json:"oilFieldId"`
+	FileName   string `json:"fileName"`
+	Bytes      int64  `json:"bytes"`
+	Points     int64  `json:"points"`
+	Batches    int64  `json:"batches"`
+	StartedTs  int64  `json:"startedTs"`
+}
+
+// SyncQueue - incoming messages of an oil field waiting for a worker.
+type SyncQueue struct {
+	OilFieldID int64 `json:"oilFieldId"`
+	Depth      int   `json:"depth"`
+	Capacity   int   `json:"capacity"`
+	Processing bool  `json:"processing"`
+}
+
+// SyncMetrics - counters of the sync path since the start of the server.
+type SyncMetrics struct {
+	FilesIngested  int64            `json:"filesIngested"`
+	FilesSkipped   int64            `json:"filesSkipped"`
+	FilesFailed    int64            `json:"filesFailed"`
+	BytesReceived  int64            `json:"bytesReceived"`
+	BytesDecoded   int64            `json:"bytesDecoded"`
+	PointsWritten  int64            `json:"pointsWritten"`
+	BatchesWritten int64            `json:"batchesWritten"`
+	Config         ConfigSyncCounts `json:"config"`
+	Spool          *SpoolStats      `json:"spool"`
+	Active         []*SyncProgress  `json:"active"`
+	Workers        int              `json:"workers"`
+	Queues         []*SyncQueue     `json:"queues"`
+}
+
+// SpoolStats - batches InfluxDB refused, kept on disk until they are replayed. Age is the seconds since the oldest
+// segment was opened, BatchesSpooled and PointsReplayed count since the start of the server.
+type SpoolStats struct {
+	Dir            string `json:"dir"`
+	Segments       int    `json:"segments"`
+	Bytes          int64  `json:"bytes"`
+	OldestTs       int64  `json:"oldestTs"`
+	Age            int64  `json:"age"`
+	BatchesSpooled int64  `json:"batchesSpooled"`
+	PointsReplayed int64  `json:"pointsReplayed"`
+	LastError      string `json:"lastError"`
+}
@@ -0,0 +1,21 @@
+package models
+
+const (
+	SYNC_ITEM_CONTROLLER = "controller"
+	SYNC_ITEM_SENSOR     = "sensor"
+
+	SYNC_ITEM_EVENT_DELETED  = "deleted"
+	SYNC_ITEM_EVENT_RESTORED = "restored"
+)
+
+// SyncItemEvent - a controller or sensor went missing from the full config of its oil field, or reappeared.
+// ControllerID is the controller of a sensor, the item itself for a controller.
+type SyncItemEvent struct {
+	OilFieldID   int64  `json:"oilFieldId"`
+	ItemType     string `json:"itemType"`
+	ItemID       string `json:"itemId"`
+	ControllerID string `json:"controllerId"`
+	Name         string `json:"name"`
+	Event        string `json:"event"`
+	Ts           int64  `json:"ts"`
+}
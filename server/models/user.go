@@ -226,6 +226,13 @@ var adminRole = Role{
 	Child: &managerRole,
 	Permissions: []string{
 		"/users",
+		"/notifications/channels",
+		"/escalation",
+		"/backfills",
+		"/commands",
+		"/oil_fields/reconnect",
+		"/oil_fields/gatewayToken",
+		"/oil_fields/credentials",
 	},
 }
 var managerRole = Role{
@@ -233,10 +240,22 @@ var managerRole = Role{
 	Child: &operatorRole,
 	Permissions: []string{
 		"/users/list",
-		"/oil_fields",
+		"/oil_fields/save",
+		"/oil_fields/delete",
+		"/oil_fields/uptime",
 		"/sensors/list",
+		"/sensors/alarmSettings",
+		"/sensors/save",
+		"/controllers/save",
+		"/config_changes",
+		"/commands/list",
 		"/mnemoschemes",
 		"/pages",
+		"/notifications/deliveries",
+		"/maintenance",
+		"/analytics",
+		"/alarm_dedup",
+		"/sync_files",
 	},
 }
 var operatorRole = Role{
@@ -253,6 +272,9 @@ var operatorRole = Role{
 		"/files",
 		"/connect",
 		"/companyData",
+		"/notifications/subscriptions",
+		"/escalation/schedules/list",
+		"/maintenance/list",
 	},
 }
 var guestRole = Role{
@@ -0,0 +1,56 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const defaultBotAPIURL = "https://api.telegram.org"
+
+type botConfig struct {
+	APIURL string `json:"apiUrl"`
+	Token  string `json:"token"`
+}
+
+// botSender - chat bot with a Telegram compatible sendMessage method, the address is the chat id.
+type botSender struct {
+	config botConfig
+}
+
+func newBotSender(raw json.RawMessage) (*botSender, error) {
+	config := botConfig{APIURL: defaultBotAPIURL}
+	if err := json.Unmarshal(raw, &config); err != nil {
+		return nil, err
+	}
+	if config.Token == "" {
+		return nil, fmt.Errorf("bot channel requires token")
+	}
+
+	return &botSender{config: config}, nil
+}
+
+func (sender *botSender) Send(ctx context.Context, address string, message *Message) error {
+	url := fmt.Sprintf("%s/bot%s/sendMessage", strings.TrimRight(sender.config.APIURL, "/"), sender.config.Token)
+	respBytes, err := postJSON(ctx, url, map[string]string{
+		"chat_id": address,
+		"text":    message.Text,
+	}, nil)
+	if err != nil {
+		return err
+	}
+
+	var resp struct {
+		Ok          bool   `json:"ok"`
+		Description string `json:"description"`
+	}
+	if err := json.Unmarshal(respBytes, &resp); err != nil {
+		return err
+	}
+	if !resp.Ok {
+		return fmt.Errorf("bot api error: %s", resp.Description)
+	}
+
+	return nil
+}
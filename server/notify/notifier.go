@@ -0,0 +1,275 @@
+package notify
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"gitlab.citicom.kz/CloudServer/server/icontext"
+	"gitlab.citicom.kz/CloudServer/server/models"
+)
+
+const queueSize = 1000
+
+// Store - subscriptions and the delivery log, the alarms and channels of pending deliveries.
+type Store interface {
+	GetCompanySubscriptions(ctx context.Context, companyID int64) ([]*models.NotificationSubscription, error)
+	SaveNotificationDelivery(ctx context.Context, delivery *models.NotificationDelivery) (*models.NotificationDelivery, error)
+	GetPendingNotificationDeliveries(ctx context.Context) ([]*models.NotificationDelivery, error)
+	GetNotificationChannel(ctx context.Context, channelID int64) (*models.NotificationChannel, error)
+	GetAlarm(ctx context.Context, alarmID int64) (*models.AlarmResult, error)
+}
+
+type job struct {
+	delivery *models.NotificationDelivery
+	sender   Sender
+	message  *Message
+}
+
+// Notifier - fans alarms out to the subscribed users and retries failed deliveries with backoff.
+type Notifier struct {
+	store  Store
+	queue  chan *job
+	logger *log.Entry
+}
+
+func NewNotifier(store Store) *Notifier {
+	return &Notifier{
+		store: store,
+		queue: make(chan *job, queueSize),
+		logger: log.WithFields(log.Fields{
+			"ServerThread": "Notifier",
+		}),
+	}
+}
+
+// Run - starts the delivery workers and queues the deliveries left pending by the previous run.
+func (notifier *Notifier) Run() {
+	workers := viper.GetInt("NotifyWorkers")
+	if workers < 1 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		go notifier.work()
+	}
+
+	go notifier.resume(context.WithValue(context.Background(), icontext.LoggerContextKey, notifier.logger))
+}
+
+// resume - queues the pending deliveries again, their retry timers are lost with a restart.
+// A delivery whose alarm or channel is gone fails, one failing to load stays pending for the next start.
+func (notifier *Notifier) resume(ctx context.Context) {
+	deliveries, err := notifier.store.GetPendingNotificationDeliveries(ctx)
+	if err != nil {
+		notifier.logger.Errorf("Can't receive pending deliveries: %s", err.Error())
+		return
+	}
+
+	messages := make(map[int64]*Message)
+	senders := make(map[int64]Sender)
+	queued := 0
+	for _, delivery := range deliveries {
+		message, exists := messages[delivery.AlarmID]
+		if !exists {
+			alarm, err := notifier.store.GetAlarm(ctx, delivery.AlarmID)
+			if err == sql.ErrNoRows {
+				notifier.abandon(ctx, delivery, "alarm not found")
+				continue
+			}
+			if err != nil {
+				notifier.logger.Errorf("Can't resume delivery %d: %s", delivery.DeliveryID, err.Error())
+				continue
+			}
+			message = NewMessage(alarm)
+			messages[delivery.AlarmID] = message
+		}
+
+		sender, exists := senders[delivery.ChannelID]
+		if !exists {
+			channel, err := notifier.store.GetNotificationChannel(ctx, delivery.ChannelID)
+			if err == sql.ErrNoRows {
+				notifier.abandon(ctx, delivery, "channel not found")
+				continue
+			}
+			if err != nil {
+				notifier.logger.Errorf("Can't resume delivery %d: %s", delivery.DeliveryID, err.Error())
+				continue
+			}
+			if !channel.IsEnabled {
+				notifier.abandon(ctx, delivery, "channel is disabled")
+				continue
+			}
+			sender, err = NewSender(channel)
+			if err != nil {
+				notifier.abandon(ctx, delivery, err.Error())
+				continue
+			}
+			senders[delivery.ChannelID] = sender
+		}
+
+		notifier.queue <- &job{delivery: delivery, sender: sender, message: message}
+		queued++
+	}
+
+	if queued > 0 {
+		notifier.logger.Infof("Queued %d pending deliveries", queued)
+	}
+}
+
+// abandon - fails a pending delivery that can not be sent anymore.
+func (notifier *Notifier) abandon(ctx context.Context, delivery *models.NotificationDelivery, reason string) {
+	delivery.Status = models.NotificationStatusFailed
+	delivery.LastError = reason
+	delivery.UpdatedTs = time.Now().Unix()
+	notifier.save(ctx, delivery)
+}
+
+// Notify - queues a delivery for every subscription that accepts the alarm.
+func (notifier *Notifier) Notify(ctx context.Context, alarm *models.AlarmResult) {
+	notifier.notify(ctx, alarm, func(subscription *models.NotificationSubscription) bool {
+		return subscription.Accepts(alarm)
+	}, true)
+}
+
+// NotifyUsers - queues a delivery to every subscription of the given users regardless of
+// their filters and quiet hours, used for escalations to the users on call.
+func (notifier *Notifier) NotifyUsers(ctx context.Context, alarm *models.AlarmResult, userIDs []int64) {
+	notifier.notify(ctx, alarm, func(subscription *models.NotificationSubscription) bool {
+		for _, userID := range userIDs {
+			if subscription.UserID == userID {
+				return true
+			}
+		}
+		return false
+	}, false)
+}
+
+func (notifier *Notifier) notify(
+	ctx context.Context,
+	alarm *models.AlarmResult,
+	accepts func(subscription *models.NotificationSubscription) bool,
+	quietHours bool,
+) {
+	subscriptions, err := notifier.store.GetCompanySubscriptions(ctx, alarm.CompanyID)
+	if err != nil {
+		notifier.logger.Errorf("Can't receive subscriptions: %s", err.Error())
+		return
+	}
+
+	message := NewMessage(alarm)
+	now := time.Now()
+	for _, subscription := range subscriptions {
+		if !subscription.IsEnabled || subscription.Channel == nil || !subscription.Channel.IsEnabled {
+			continue
+		}
+		if !accepts(subscription) {
+			continue
+		}
+
+		delivery := &models.NotificationDelivery{
+			AlarmID:        alarm.AlarmID,
+			SubscriptionID: subscription.SubscriptionID,
+			ChannelID:      subscription.ChannelID,
+			UserID:         subscription.UserID,
+			ChannelType:    subscription.Channel.Type,
+			Address:        subscription.Address,
+			Status:         models.NotificationStatusPending,
+			CreatedTs:      now.Unix(),
+			UpdatedTs:      now.Unix(),
+		}
+
+		if quietHours && subscription.InQuietHours(now) {
+			delivery.Status = models.NotificationStatusSkipped
+			delivery.LastError = "quiet hours"
+			notifier.save(ctx, delivery)
+			continue
+		}
+
+		sender, err := NewSender(subscription.Channel)
+		if err != nil {
+			delivery.Status = models.NotificationStatusFailed
+			delivery.LastError = err.Error()
+			notifier.save(ctx, delivery)
+			continue
+		}
+
+		delivery = notifier.save(ctx, delivery)
+		if delivery == nil {
+			continue
+		}
+
+		select {
+		case notifier.queue <- &job{delivery: delivery, sender: sender, message: message}:
+		default:
+			delivery.Status = models.NotificationStatusFailed
+			delivery.LastError = "delivery queue is full"
+			notifier.save(ctx, delivery)
+		}
+	}
+}
+
+func (notifier *Notifier) work() {
+	for j := range notifier.queue {
+		notifier.deliver(j)
+	}
+}
+
+func (notifier *Notifier) deliver(j *job) {
+	ctx := context.Background()
+	j.delivery.Attempts++
+	j.delivery.UpdatedTs = time.Now().Unix()
+
+	err := j.sender.Send(ctx, j.delivery.Address, j.message)
+	if err == nil {
+		j.delivery.Status = models.NotificationStatusSent
+		j.delivery.LastError = ""
+		j.delivery.SentTs = j.delivery.UpdatedTs
+		notifier.save(ctx, j.delivery)
+		return
+	}
+
+	j.delivery.LastError = err.Error()
+	if j.delivery.Attempts >= viper.GetInt("NotifyMaxAttempts") {
+		j.delivery.Status = models.NotificationStatusFailed
+		notifier.save(ctx, j.delivery)
+		notifier.logger.Errorf("Delivery %d failed after %d attempts: %s", j.delivery.DeliveryID, j.delivery.Attempts, err.Error())
+		return
+	}
+
+	notifier.save(ctx, j.delivery)
+	time.AfterFunc(backoff(j.delivery.Attempts), func() {
+		select {
+		case notifier.queue <- j:
+		default:
+			j.delivery.Status = models.NotificationStatusFailed
+			j.delivery.LastError = "delivery queue is full"
+			notifier.save(ctx, j.delivery)
+		}
+	})
+}
+
+// backoff - exponential delay before the next attempt, capped by NotifyMaxBackoff seconds.
+func backoff(attempts int) time.Duration {
+	delay := time.Duration(viper.GetInt64("NotifyBackoff")) * time.Second
+	maxDelay := time.Duration(viper.GetInt64("NotifyMaxBackoff")) * time.Second
+	for i := 1; i < attempts && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+
+	return delay
+}
+
+func (notifier *Notifier) save(ctx context.Context, delivery *models.NotificationDelivery) *models.NotificationDelivery {
+	saved, err := notifier.store.SaveNotificationDelivery(ctx, delivery)
+	if err != nil {
+		notifier.logger.Errorf("Can't save notification delivery: %s", err.Error())
+		return nil
+	}
+
+	return saved
+}
@@ -0,0 +1,88 @@
+package notify
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"gitlab.citicom.kz/CloudServer/server/models"
+)
+
+// stubStore - delivery log with the pending rows a previous run left behind.
+type stubStore struct {
+	pending  []*models.NotificationDelivery
+	alarms   map[int64]*models.AlarmResult
+	channels map[int64]*models.NotificationChannel
+	failing  map[int64]bool
+	saved    []models.NotificationDelivery
+}
+
+func (store *stubStore) GetCompanySubscriptions(ctx context.Context, companyID int64) ([]*models.NotificationSubscription, error) {
+	return nil, nil
+}
+
+func (store *stubStore) SaveNotificationDelivery(ctx context.Context, delivery *models.NotificationDelivery) (*models.NotificationDelivery, error) {
+	store.saved = append(store.saved, *delivery)
+	return delivery, nil
+}
+
+func (store *stubStore) GetPendingNotificationDeliveries(ctx context.Context) ([]*models.NotificationDelivery, error) {
+	return store.pending, nil
+}
+
+func (store *stubStore) GetNotificationChannel(ctx context.Context, channelID int64) (*models.NotificationChannel, error) {
+	if store.failing[channelID] {
+		return nil, errors.New("connection refused")
+	}
+	if channel, exists := store.channels[channelID]; exists {
+		return channel, nil
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (store *stubStore) GetAlarm(ctx context.Context, alarmID int64) (*models.AlarmResult, error) {
+	if alarm, exists := store.alarms[alarmID]; exists {
+		return alarm, nil
+	}
+	return nil, sql.ErrNoRows
+}
+
+func TestNotifierResumesPendingDeliveries(t *testing.T) {
+	config, _ := json.Marshal(webhookConfig{URL: "http://example.com/hook"})
+	store := &stubStore{
+		pending: []*models.NotificationDelivery{
+			{DeliveryID: 1, AlarmID: 1, ChannelID: 1, Status: models.NotificationStatusPending, Attempts: 2},
+			{DeliveryID: 2, AlarmID: 2, ChannelID: 1, Status: models.NotificationStatusPending},
+			{DeliveryID: 3, AlarmID: 1, ChannelID: 2, Status: models.NotificationStatusPending},
+			{DeliveryID: 4, AlarmID: 1, ChannelID: 3, Status: models.NotificationStatusPending},
+		},
+		alarms: map[int64]*models.AlarmResult{1: {AlarmID: 1}},
+		channels: map[int64]*models.NotificationChannel{
+			1: {ChannelID: 1, Type: models.NotificationChannelWebhook, Config: config, IsEnabled: true},
+			2: {ChannelID: 2, Type: models.NotificationChannelWebhook, Config: config},
+		},
+		failing: map[int64]bool{3: true},
+	}
+	notifier := NewNotifier(store)
+
+	notifier.resume(context.Background())
+
+	if len(notifier.queue) != 1 {
+		t.Fatalf("queued %d deliveries, want 1", len(notifier.queue))
+	}
+	if j := <-notifier.queue; j.delivery.DeliveryID != 1 || j.delivery.Attempts != 2 || j.message.Alarm.AlarmID != 1 {
+		t.Errorf("unexpected job for delivery %d", j.delivery.DeliveryID)
+	}
+
+	// deleted alarm and disabled channel fail, the one failing to load stays pending
+	if len(store.saved) != 2 {
+		t.Fatalf("saved %d deliveries, want 2", len(store.saved))
+	}
+	for _, saved := range store.saved {
+		if (saved.DeliveryID != 2 && saved.DeliveryID != 3) || saved.Status != models.NotificationStatusFailed {
+			t.Errorf("delivery %d saved as %s", saved.DeliveryID, saved.Status)
+		}
+	}
+}
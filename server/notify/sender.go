@@ -0,0 +1,142 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+	"gitlab.citicom.kz/CloudServer/server/models"
+)
+
+// Message - rendered alarm notification.
+type Message struct {
+	Subject string
+	Text    string
+	Alarm   *models.AlarmResult
+}
+
+// Sender - delivers a message to a single recipient address of one channel.
+type Sender interface {
+	Send(ctx context.Context, address string, message *Message) error
+}
+
+// NewSender - builds the sender for the channel type from its JSON config.
+func NewSender(channel *models.NotificationChannel) (Sender, error) {
+	switch channel.Type {
+	case models.NotificationChannelSMTP:
+		return newSMTPSender(channel.Config)
+	case models.NotificationChannelWebhook:
+		return newWebhookSender(channel.Config)
+	case models.NotificationChannelBot:
+		return newBotSender(channel.Config)
+	case models.NotificationChannelSMS:
+		return newSMSSender(channel.Config)
+	}
+
+	return nil, fmt.Errorf("unknown channel type %s", channel.Type)
+}
+
+// ValidateAddress - checks the subscription address for the channel type. A webhook posts to the channel url only,
+// its subscriptions have no address.
+func ValidateAddress(channel *models.NotificationChannel, address string) error {
+	if channel.Type == models.NotificationChannelWebhook {
+		if address != "" {
+			return fmt.Errorf("webhook subscriptions post to the channel url, address must be empty")
+		}
+		return nil
+	}
+
+	if address == "" {
+		return fmt.Errorf("address is required")
+	}
+	if strings.ContainsAny(address, "\r\n") {
+		return fmt.Errorf("address must be a single line")
+	}
+	if channel.Type == models.NotificationChannelSMTP {
+		if _, err := mail.ParseAddress(address); err != nil {
+			return fmt.Errorf("address must be an e-mail")
+		}
+	}
+
+	return nil
+}
+
+func NewMessage(alarm *models.AlarmResult) *Message {
+	subject := fmt.Sprintf("[%s] %s: %s", models.AlarmSeverity(alarm.AlarmType), alarm.OilFieldName, alarm.AlarmType)
+	text := fmt.Sprintf(
+		"%s\nOil field: %s\nController: %s\nSensor: %s\nValue: %v (limit %v)\nTime: %s",
+		subject,
+		alarm.OilFieldName,
+		alarm.ControllerName,
+		alarm.SensorID,
+		alarm.Value,
+		alarm.AlarmValue,
+		time.Unix(alarm.Time, 0).UTC().Format(time.RFC3339),
+	)
+
+	return &Message{
+		Subject: subject,
+		Text:    text,
+		Alarm:   alarm,
+	}
+}
+
+func httpClient() *http.Client {
+	return &http.Client{
+		Timeout: time.Duration(viper.GetInt64("NotifyHTTPTimeout")) * time.Second,
+	}
+}
+
+// postJSON - sends body as JSON and treats every non 2xx answer as a failed delivery. Errors leave out the
+// endpoint, it may carry a token and the errors are stored with the deliveries.
+func postJSON(ctx context.Context, endpoint string, body interface{}, headers map[string]string) ([]byte, error) {
+	bodyBytes, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", endpoint, bytes.NewBuffer(bodyBytes))
+	if err != nil {
+		return nil, withoutURL(err)
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := httpClient().Do(req)
+	if err != nil {
+		return nil, withoutURL(err)
+	}
+	defer resp.Body.Close()
+
+	respBytes, err := ioutil.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return respBytes, fmt.Errorf("answered %d: %s", resp.StatusCode, string(respBytes))
+	}
+
+	return respBytes, nil
+}
+
+// withoutURL - the error of a request without the url the http package puts in it.
+func withoutURL(err error) error {
+	if urlErr, ok := err.(*url.Error); ok {
+		return fmt.Errorf("%s: %v", urlErr.Op, urlErr.Err)
+	}
+
+	return err
+}
@@ -0,0 +1,124 @@
+package notify
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gitlab.citicom.kz/CloudServer/server/models"
+)
+
+func testMessage() *Message {
+	return &Message{
+		Subject: "[critical] Field: ALARM_TYPE_HH",
+		Text:    "Value: 10",
+		Alarm:   &models.AlarmResult{AlarmID: 1},
+	}
+}
+
+func TestWebhookSendsToChannelURL(t *testing.T) {
+	var requests int
+	var body []byte
+	var signature, token string
+	channel := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		body, _ = ioutil.ReadAll(r.Body)
+		signature = r.Header.Get("X-Signature")
+		token = r.Header.Get("X-Token")
+	}))
+	defer channel.Close()
+
+	subscriber := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("request sent to the subscription address")
+	}))
+	defer subscriber.Close()
+
+	config, _ := json.Marshal(webhookConfig{URL: channel.URL, Secret: "secret", Headers: map[string]string{"X-Token": "token"}})
+	sender, err := newWebhookSender(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sender.Send(context.Background(), subscriber.URL, testMessage()); err != nil {
+		t.Fatal(err)
+	}
+	if requests != 1 {
+		t.Fatalf("channel got %d requests, want 1", requests)
+	}
+	if token != "token" {
+		t.Errorf("header X-Token = %q, want token", token)
+	}
+
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write(body)
+	if signature != hex.EncodeToString(mac.Sum(nil)) {
+		t.Errorf("signature %q does not match the body", signature)
+	}
+}
+
+func TestBotErrorsLeaveOutToken(t *testing.T) {
+	const token = "123456:secret-token"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.URL.Path, "/bot"+token+"/sendMessage") {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"ok":false,"description":"Unauthorized"}`))
+	}))
+	apiURL := server.URL
+
+	config, _ := json.Marshal(botConfig{APIURL: apiURL, Token: token})
+	sender, err := newBotSender(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = sender.Send(context.Background(), "42", testMessage())
+	if err == nil {
+		t.Fatal("expected an error for status 401")
+	}
+	if strings.Contains(err.Error(), token) {
+		t.Errorf("error %q contains the token", err.Error())
+	}
+
+	// a refused connection is reported by the http package with the url
+	server.Close()
+	err = sender.Send(context.Background(), "42", testMessage())
+	if err == nil {
+		t.Fatal("expected an error for a closed server")
+	}
+	if strings.Contains(err.Error(), token) {
+		t.Errorf("error %q contains the token", err.Error())
+	}
+}
+
+func TestValidateAddress(t *testing.T) {
+	cases := []struct {
+		channelType string
+		address     string
+		valid       bool
+	}{
+		{models.NotificationChannelWebhook, "", true},
+		{models.NotificationChannelWebhook, "http://169.254.169.254/", false},
+		{models.NotificationChannelSMTP, "user@example.com", true},
+		{models.NotificationChannelSMTP, "user@example.com\r\nBcc: other@example.com", false},
+		{models.NotificationChannelSMTP, "not an e-mail", false},
+		{models.NotificationChannelBot, "42", true},
+		{models.NotificationChannelBot, "", false},
+		{models.NotificationChannelSMS, "+77010000000", true},
+	}
+
+	for _, c := range cases {
+		err := ValidateAddress(&models.NotificationChannel{Type: c.channelType}, c.address)
+		if (err == nil) != c.valid {
+			t.Errorf("%s %q: error %v, want valid %v", c.channelType, c.address, err, c.valid)
+		}
+	}
+}
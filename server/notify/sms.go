@@ -0,0 +1,44 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+type smsConfig struct {
+	URL    string `json:"url"`
+	APIKey string `json:"apiKey"`
+	From   string `json:"from"`
+}
+
+// smsSender - generic HTTP SMS gateway, the address is the phone number.
+type smsSender struct {
+	config smsConfig
+}
+
+func newSMSSender(raw json.RawMessage) (*smsSender, error) {
+	config := smsConfig{}
+	if err := json.Unmarshal(raw, &config); err != nil {
+		return nil, err
+	}
+	if config.URL == "" {
+		return nil, fmt.Errorf("sms channel requires url")
+	}
+
+	return &smsSender{config: config}, nil
+}
+
+func (sender *smsSender) Send(ctx context.Context, address string, message *Message) error {
+	headers := make(map[string]string)
+	if sender.config.APIKey != "" {
+		headers["Authorization"] = "Bearer " + sender.config.APIKey
+	}
+
+	_, err := postJSON(ctx, sender.config.URL, map[string]string{
+		"from": sender.config.From,
+		"to":   address,
+		"text": message.Subject,
+	}, headers)
+	return err
+}
@@ -0,0 +1,74 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newTestSMSSender(t *testing.T, url string, apiKey string) *smsSender {
+	config, _ := json.Marshal(smsConfig{URL: url, APIKey: apiKey, From: "Alarms"})
+	sender, err := newSMSSender(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sender
+}
+
+func TestSMSSend(t *testing.T) {
+	var authorization string
+	var body map[string]string
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		raw, _ := ioutil.ReadAll(r.Body)
+		_ = json.Unmarshal(raw, &body)
+	}))
+	defer gateway.Close()
+
+	sender := newTestSMSSender(t, gateway.URL, "api-key")
+	if err := sender.Send(context.Background(), "+77010000000", testMessage()); err != nil {
+		t.Fatal(err)
+	}
+
+	if authorization != "Bearer api-key" {
+		t.Errorf("authorization = %q, want the bearer key", authorization)
+	}
+	if body["from"] != "Alarms" || body["to"] != "+77010000000" || body["text"] != testMessage().Subject {
+		t.Errorf("unexpected body %v", body)
+	}
+}
+
+func TestSMSErrorsLeaveOutKeyAndURL(t *testing.T) {
+	const apiKey = "secret-api-key"
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+		_, _ = w.Write([]byte(`{"error":"upstream unavailable"}`))
+	}))
+	url := gateway.URL + "/send?key=" + apiKey
+
+	sender := newTestSMSSender(t, url, apiKey)
+	err := sender.Send(context.Background(), "+77010000000", testMessage())
+	if err == nil {
+		t.Fatal("expected an error for status 502")
+	}
+	if !strings.Contains(err.Error(), "502") {
+		t.Errorf("error %q does not report the status", err.Error())
+	}
+	if strings.Contains(err.Error(), apiKey) || strings.Contains(err.Error(), gateway.URL) {
+		t.Errorf("error %q contains the key or the url", err.Error())
+	}
+
+	// a refused connection is reported by the http package with the url
+	gateway.Close()
+	err = sender.Send(context.Background(), "+77010000000", testMessage())
+	if err == nil {
+		t.Fatal("expected an error for a closed gateway")
+	}
+	if strings.Contains(err.Error(), apiKey) || strings.Contains(err.Error(), gateway.URL) {
+		t.Errorf("error %q contains the key or the url", err.Error())
+	}
+}
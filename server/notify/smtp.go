@@ -0,0 +1,129 @@
+package notify
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// defaultSMTPTimeout - bound of an SMTP session when NotifyHTTPTimeout is not set.
+const defaultSMTPTimeout = 30 * time.Second
+
+type smtpConfig struct {
+	Host     string `json:"host"`
+	Port     string `json:"port"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	From     string `json:"from"`
+}
+
+type smtpSender struct {
+	config smtpConfig
+}
+
+func newSMTPSender(raw json.RawMessage) (*smtpSender, error) {
+	config := smtpConfig{Port: "25"}
+	if err := json.Unmarshal(raw, &config); err != nil {
+		return nil, err
+	}
+	if config.Host == "" || config.From == "" {
+		return nil, fmt.Errorf("smtp channel requires host and from")
+	}
+	if strings.ContainsAny(config.From, "\r\n") {
+		return nil, fmt.Errorf("smtp channel from must be a single line")
+	}
+
+	return &smtpSender{config: config}, nil
+}
+
+// Send - mails the message, the whole session is bounded by NotifyHTTPTimeout and ctx. STARTTLS is used when the
+// server offers it, like smtp.SendMail does.
+func (sender *smtpSender) Send(ctx context.Context, address string, message *Message) error {
+	if strings.ContainsAny(address, "\r\n") || strings.ContainsAny(message.Subject, "\r\n") {
+		return fmt.Errorf("address and subject must be a single line")
+	}
+
+	timeout := time.Duration(viper.GetInt64("NotifyHTTPTimeout")) * time.Second
+	if timeout <= 0 {
+		timeout = defaultSMTPTimeout
+	}
+	deadline := time.Now().Add(timeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+
+	dialer := net.Dialer{Deadline: deadline}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(sender.config.Host, sender.config.Port))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(deadline); err != nil {
+		return err
+	}
+
+	// a cancelled ctx ends the session at once instead of at the deadline
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = conn.SetDeadline(time.Now())
+		case <-stop:
+		}
+	}()
+
+	client, err := smtp.NewClient(conn, sender.config.Host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: sender.config.Host}); err != nil {
+			return err
+		}
+	}
+	if sender.config.Username != "" {
+		auth := smtp.PlainAuth("", sender.config.Username, sender.config.Password, sender.config.Host)
+		if err := client.Auth(auth); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(sender.config.From); err != nil {
+		return err
+	}
+	if err := client.Rcpt(address); err != nil {
+		return err
+	}
+
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	body := strings.Join([]string{
+		"From: " + sender.config.From,
+		"To: " + address,
+		"Subject: " + message.Subject,
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+		"",
+		message.Text,
+	}, "\r\n")
+	if _, err := writer.Write([]byte(body)); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
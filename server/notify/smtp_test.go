@@ -0,0 +1,163 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// smtpStandIn - SMTP server on a local port, it accepts every mail and hands its data to the mails channel.
+// A hung stand-in accepts connections and never answers.
+func smtpStandIn(t *testing.T, hung bool) (string, string, chan string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+
+	mails := make(chan string, 1)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			if hung {
+				t.Cleanup(func() { _ = conn.Close() })
+				continue
+			}
+			go serveSMTP(conn, mails)
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	return host, port, mails
+}
+
+func serveSMTP(conn net.Conn, mails chan string) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	reply := func(line string) {
+		_, _ = conn.Write([]byte(line + "\r\n"))
+	}
+
+	reply("220 stand-in ready")
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		command := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+			reply("250 stand-in")
+		case strings.HasPrefix(command, "DATA"):
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				line, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(line)
+			}
+			mails <- data.String()
+			reply("250 queued")
+		case strings.HasPrefix(command, "QUIT"):
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+func newTestSMTPSender(t *testing.T, host string, port string) *smtpSender {
+	config, _ := json.Marshal(smtpConfig{Host: host, Port: port, From: "alarms@example.com"})
+	sender, err := newSMTPSender(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sender
+}
+
+func TestSMTPSend(t *testing.T) {
+	host, port, mails := smtpStandIn(t, false)
+	sender := newTestSMTPSender(t, host, port)
+
+	if err := sender.Send(context.Background(), "user@example.com", testMessage()); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case mail := <-mails:
+		if !strings.Contains(mail, "To: user@example.com\r\n") || !strings.Contains(mail, "Subject: "+testMessage().Subject+"\r\n") {
+			t.Errorf("unexpected mail %q", mail)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("mail not delivered")
+	}
+}
+
+func TestSMTPSendTimesOut(t *testing.T) {
+	viper.Set("NotifyHTTPTimeout", 1)
+	defer viper.Set("NotifyHTTPTimeout", nil)
+
+	host, port, _ := smtpStandIn(t, true)
+	sender := newTestSMTPSender(t, host, port)
+
+	start := time.Now()
+	if err := sender.Send(context.Background(), "user@example.com", testMessage()); err == nil {
+		t.Fatal("expected an error from a hung server")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("send took %v", elapsed)
+	}
+}
+
+func TestSMTPSendHonoursContext(t *testing.T) {
+	viper.Set("NotifyHTTPTimeout", 60)
+	defer viper.Set("NotifyHTTPTimeout", nil)
+
+	host, port, _ := smtpStandIn(t, true)
+	sender := newTestSMTPSender(t, host, port)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := sender.Send(ctx, "user@example.com", testMessage()); err == nil {
+		t.Fatal("expected an error from a hung server")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("send took %v", elapsed)
+	}
+}
+
+func TestSMTPRejectsHeaderInjection(t *testing.T) {
+	host, port, mails := smtpStandIn(t, false)
+	sender := newTestSMTPSender(t, host, port)
+
+	message := testMessage()
+	message.Subject = "alarm\r\nBcc: other@example.com"
+	if err := sender.Send(context.Background(), "user@example.com", message); err == nil {
+		t.Error("expected a subject with CR/LF to be rejected")
+	}
+	if err := sender.Send(context.Background(), "user@example.com\r\nBcc: other@example.com", testMessage()); err == nil {
+		t.Error("expected an address with CR/LF to be rejected")
+	}
+
+	select {
+	case mail := <-mails:
+		t.Errorf("mail %q sent", mail)
+	default:
+	}
+}
@@ -0,0 +1,67 @@
+package notify
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"gitlab.citicom.kz/CloudServer/server/models"
+)
+
+type webhookConfig struct {
+	URL     string            `json:"url"`
+	Secret  string            `json:"secret"`
+	Headers map[string]string `json:"headers"`
+}
+
+type webhookSender struct {
+	config webhookConfig
+}
+
+type webhookBody struct {
+	Subject string              `json:"subject"`
+	Text    string              `json:"text"`
+	Alarm   *models.AlarmResult `json:"alarm"`
+}
+
+func newWebhookSender(raw json.RawMessage) (*webhookSender, error) {
+	config := webhookConfig{}
+	if err := json.Unmarshal(raw, &config); err != nil {
+		return nil, err
+	}
+	if config.URL == "" {
+		return nil, fmt.Errorf("webhook channel requires url")
+	}
+
+	return &webhookSender{config: config}, nil
+}
+
+// Send - posts the alarm as JSON to the channel url. The url, headers and secret are set by an admin, the
+// subscription address is never used, so a subscriber can't have them sent anywhere else.
+func (sender *webhookSender) Send(ctx context.Context, address string, message *Message) error {
+	body := webhookBody{
+		Subject: message.Subject,
+		Text:    message.Text,
+		Alarm:   message.Alarm,
+	}
+
+	headers := make(map[string]string)
+	for key, value := range sender.config.Headers {
+		headers[key] = value
+	}
+	if sender.config.Secret != "" {
+		bodyBytes, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		mac := hmac.New(sha256.New, []byte(sender.config.Secret))
+		mac.Write(bodyBytes)
+		headers["X-Signature"] = hex.EncodeToString(mac.Sum(nil))
+	}
+
+	_, err := postJSON(ctx, sender.config.URL, body, headers)
+	return err
+}
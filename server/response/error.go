@@ -40,7 +40,16 @@ func ErrorResponse(l *log.Entry, w http.ResponseWriter, code int, message string
 }
 
 func Response(l *log.Entry, w http.ResponseWriter, data interface{}) {
-	setupResponse(&w, http.StatusOK)
+	dataResponse(l, w, http.StatusOK, data)
+}
+
+// AcceptedResponse - the request is taken and is completed in the background.
+func AcceptedResponse(l *log.Entry, w http.ResponseWriter, data interface{}) {
+	dataResponse(l, w, http.StatusAccepted, data)
+}
+
+func dataResponse(l *log.Entry, w http.ResponseWriter, httpCode int, data interface{}) {
+	setupResponse(&w, httpCode)
 
 	response := &errorResponse{
 		Code: 0,
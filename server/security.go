@@ -0,0 +1,210 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+	"gitlab.citicom.kz/CloudServer/server/models"
+	"gitlab.citicom.kz/CloudServer/server/utils"
+)
+
+// signatureHeaderName - header carrying the HMAC of a sync file request or response body.
+const signatureHeaderName = "X-Signature"
+
+var InvalidSignature = errors.New("Invalid signature")
+var MessageReplayed = errors.New("Message already received")
+
+// newFieldTLSConfig - TLS settings of the links dialed to oil fields. FieldTLSCAFile replaces the system roots
+// trusted for field certificates, FieldTLSCertFile and FieldTLSKeyFile are the client certificate of the cloud.
+func newFieldTLSConfig() (*tls.Config, error) {
+	config := &tls.Config{}
+
+	if caFile := viper.GetString("FieldTLSCAFile"); caFile != "" {
+		caBytes, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caBytes) {
+			return nil, fmt.Errorf("No certificates in %s", caFile)
+		}
+		config.RootCAs = pool
+	}
+
+	certFile, keyFile := viper.GetString("FieldTLSCertFile"), viper.GetString("FieldTLSKeyFile")
+	if certFile != "" && keyFile != "" {
+		certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	}
+
+	return config, nil
+}
+
+// listen - serves the API over TLS when TLSCertFile and TLSKeyFile are set. Clients presenting a certificate
+// signed by TLSClientCAFile are verified, gateways may use it instead of the token.
+func (server *Server) listen() error {
+	certFile, keyFile := viper.GetString("TLSCertFile"), viper.GetString("TLSKeyFile")
+	if certFile == "" || keyFile == "" {
+		return http.ListenAndServe(server.connectString, nil)
+	}
+
+	config := &tls.Config{}
+	if caFile := viper.GetString("TLSClientCAFile"); caFile != "" {
+		caBytes, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caBytes) {
+			return fmt.Errorf("No certificates in %s", caFile)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	httpServer := &http.Server{
+		Addr:      server.connectString,
+		TLSConfig: config,
+	}
+
+	return httpServer.ListenAndServeTLS(certFile, keyFile)
+}
+
+// clientCertificateName - common name of the verified client certificate of the request, empty without one.
+func clientCertificateName(r *http.Request) string {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return ""
+	}
+
+	return r.TLS.VerifiedChains[0][0].Subject.CommonName
+}
+
+func secretRotationGrace() int64 {
+	return viper.GetInt64("SecretRotationGrace")
+}
+
+// messageNonces - signatures of the field messages accepted within MessageMaxSkew. A signature covers the type,
+// timestamp and body of a message, one seen again is a replay. The signatures of a previous run are lost, so
+// messages stamped before the start of the cloud are not accepted.
+type messageNonces struct {
+	mutex     sync.Mutex
+	fields    map[int64]*fieldNonces
+	startedTs int64
+}
+
+type fieldNonces struct {
+	signatures map[string]int64
+	prunedTs   int64
+}
+
+func newMessageNonces(now int64) *messageNonces {
+	return &messageNonces{
+		fields:    make(map[int64]*fieldNonces),
+		startedTs: now,
+	}
+}
+
+// accept - records the signature of a verified message, false when it was accepted before.
+func (nonces *messageNonces) accept(oilFieldID int64, signature string, timestamp int64, now int64, maxSkew int64) bool {
+	nonces.mutex.Lock()
+	defer nonces.mutex.Unlock()
+
+	if timestamp < nonces.startedTs {
+		return false
+	}
+
+	field, exists := nonces.fields[oilFieldID]
+	if !exists {
+		field = &fieldNonces{signatures: make(map[string]int64)}
+		nonces.fields[oilFieldID] = field
+	}
+
+	// messages older than the skew are refused by their timestamp, their signatures are not needed anymore
+	if field.prunedTs != now {
+		for seen, seenTimestamp := range field.signatures {
+			if now-seenTimestamp > maxSkew {
+				delete(field.signatures, seen)
+			}
+		}
+		field.prunedTs = now
+	}
+
+	if _, seen := field.signatures[signature]; seen {
+		return false
+	}
+	field.signatures[signature] = timestamp
+
+	return true
+}
+
+// verifyFieldMessage - checks a message of an oil field against its stored credentials.
+func (server *Server) verifyFieldMessage(ctx context.Context, message *models.InputMessage, oilFieldID int64) error {
+	credentials, err := server.db.GetOilFieldCredentials(ctx, oilFieldID)
+	if err != nil {
+		return err
+	}
+
+	return server.checkFieldMessage(credentials, message, oilFieldID, time.Now().Unix())
+}
+
+// checkFieldMessage - checks the signature and the age of a message of an oil field with a secret and that it was
+// not received before. Messages of oil fields without a secret are accepted only with AllowUnsigned set.
+func (server *Server) checkFieldMessage(credentials *models.OilFieldCredentials, message *models.InputMessage, oilFieldID int64, now int64) error {
+	if !credentials.HasSecret {
+		if !credentials.AllowUnsigned {
+			return InvalidSignature
+		}
+		return nil
+	}
+
+	maxSkew := viper.GetInt64("MessageMaxSkew")
+	skew := now - message.Timestamp
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > maxSkew {
+		return fmt.Errorf("Message timestamp %d is out of the allowed skew", message.Timestamp)
+	}
+
+	if !utils.HMACVerify(credentials.Secrets(now, secretRotationGrace()), message.SigningPayload(), message.Signature) {
+		return InvalidSignature
+	}
+
+	if !server.messageNonces.accept(oilFieldID, message.Signature, message.Timestamp, now, maxSkew) {
+		return MessageReplayed
+	}
+
+	return nil
+}
+
+// signFieldMessage - signs a message to an oil field with the current and, during a rotation, the previous secret.
+func (server *Server) signFieldMessage(ctx context.Context, message *models.OutputMessage, oilFieldID int64) error {
+	credentials, err := server.db.GetOilFieldCredentials(ctx, oilFieldID)
+	if err != nil {
+		return err
+	}
+	if !credentials.HasSecret {
+		return nil
+	}
+
+	payload := message.SigningPayload()
+	message.Signature = utils.HMACSign(credentials.Secret, payload)
+	if secrets := credentials.Secrets(message.Timestamp.Unix(), secretRotationGrace()); len(secrets) > 1 {
+		message.PreviousSignature = utils.HMACSign(secrets[1], payload)
+	}
+
+	return nil
+}
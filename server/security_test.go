@@ -0,0 +1,58 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/spf13/viper"
+	"gitlab.citicom.kz/CloudServer/server/models"
+	"gitlab.citicom.kz/CloudServer/server/utils"
+)
+
+func testFieldMessage(timestamp int64) *models.InputMessage {
+	return &models.InputMessage{
+		Type:      models.MessageTypeCloudSyncData,
+		Timestamp: timestamp,
+		Body:      json.RawMessage(`{"offset":0}`),
+	}
+}
+
+func TestCheckFieldMessageUnsigned(t *testing.T) {
+	const now = 1000
+	server := &Server{messageNonces: newMessageNonces(now)}
+
+	unsigned := &models.OilFieldCredentials{OilFieldID: 1}
+	if err := server.checkFieldMessage(unsigned, testFieldMessage(now), 1, now); err != InvalidSignature {
+		t.Errorf("unsigned message of a field without a secret: %v, want %v", err, InvalidSignature)
+	}
+
+	// fields without a secret before the migration are backfilled with AllowUnsigned and keep syncing
+	allowed := &models.OilFieldCredentials{OilFieldID: 1, AllowUnsigned: true}
+	for i := 0; i < 2; i++ {
+		if err := server.checkFieldMessage(allowed, testFieldMessage(now), 1, now); err != nil {
+			t.Errorf("unsigned message of a field allowing it: %v", err)
+		}
+	}
+}
+
+func TestCheckFieldMessageSigned(t *testing.T) {
+	viper.Set("MessageMaxSkew", 300)
+	defer viper.Set("MessageMaxSkew", nil)
+
+	const now = 1000
+	server := &Server{messageNonces: newMessageNonces(now)}
+	credentials := &models.OilFieldCredentials{OilFieldID: 1, Secret: "secret", HasSecret: true, AllowUnsigned: true}
+
+	message := testFieldMessage(now)
+	if err := server.checkFieldMessage(credentials, message, 1, now); err != InvalidSignature {
+		t.Errorf("unsigned message of a field with a secret: %v, want %v", err, InvalidSignature)
+	}
+
+	message.Signature = utils.HMACSign("secret", message.SigningPayload())
+	if err := server.checkFieldMessage(credentials, message, 1, now); err != nil {
+		t.Fatalf("signed message: %v", err)
+	}
+	if err := server.checkFieldMessage(credentials, message, 1, now); err != MessageReplayed {
+		t.Errorf("message received again: %v, want %v", err, MessageReplayed)
+	}
+}
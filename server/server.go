@@ -2,6 +2,8 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -12,16 +14,22 @@ import (
 	"github.com/gorilla/websocket"
 	"github.com/rs/xid"
 	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"gitlab.citicom.kz/CloudServer/server/alarm"
 	"gitlab.citicom.kz/CloudServer/server/database"
 	"gitlab.citicom.kz/CloudServer/server/icontext"
 	"gitlab.citicom.kz/CloudServer/server/influx"
 	"gitlab.citicom.kz/CloudServer/server/middleware"
 	"gitlab.citicom.kz/CloudServer/server/models"
+	"gitlab.citicom.kz/CloudServer/server/notify"
 	"gitlab.citicom.kz/CloudServer/server/response"
 	"gitlab.citicom.kz/CloudServer/server/upload"
 	"gitlab.citicom.kz/CloudServer/server/utils"
 )
 
+// gatewayTokenName - header, or query parameter, carrying the field gateway credential.
+const gatewayTokenName = "GatewayToken"
+
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
@@ -35,26 +43,33 @@ type incomingMessageWithContext struct {
 }
 
 type Server struct {
-	closeCh                     chan bool
-	middleware                  []func(next http.Handler) http.Handler
-	connectString               string
-	SocketConnectionsPool       map[int64][]*SocketConnection
-	MasterSocketConnectionsPool map[int64]*SyncClient
-	newIncomingMessage          chan *incomingMessageWithContext
-	logger                      *log.Entry
-	db                          *database.DB
-	influxDB                    *influx.Influx
+	closeCh       chan bool
+	middleware    []func(next http.Handler) http.Handler
+	connectString string
+	hub           *Hub
+	dispatcher    *dispatcher
+	logger        *log.Entry
+	db            *database.DB
+	influxDB      *influx.Influx
+	alarmEngine   *alarm.Engine
+	notifier      *notify.Notifier
+	escalator     *alarm.Escalator
+	connectivity  map[int64]*fieldConnectivity
+	fieldTLS      *tls.Config
+	syncMetrics   *syncMetrics
+	syncStates    *syncClientStates
+	syncUploads   *syncUploads
+	messageNonces *messageNonces
 }
 
 func NewServer(host, port string, db *database.DB, influxDB *influx.Influx) *Server {
 	closeCh := make(chan bool)
-	socketConnectionsPool := make(map[int64][]*SocketConnection)
-	masterSocketConnectionPool := make(map[int64]*SyncClient)
 
 	var _middleware []func(next http.Handler) http.Handler
 	_middleware = append(_middleware, middleware.PermissionsMiddleware())
 	_middleware = append(_middleware, middleware.AuthMiddleware(db, []string{
 		"/auth",
+		"/gateway/connect",
 	}))
 	//_middleware = append(_middleware, middleware.ActionLogMiddleware(db))
 	_middleware = append(_middleware, middleware.LogMiddleware())
@@ -62,22 +77,39 @@ func NewServer(host, port string, db *database.DB, influxDB *influx.Influx) *Ser
 		"/auth",
 	}))
 	connectString := fmt.Sprintf("%s:%s", host, port)
-	newIncomingMessage := make(chan *incomingMessageWithContext)
 	serverLogger := log.WithFields(log.Fields{
 		"ServerThread": "Main",
 	})
 
-	return &Server{
-		closeCh:                     closeCh,
-		middleware:                  _middleware,
-		connectString:               connectString,
-		SocketConnectionsPool:       socketConnectionsPool,
-		MasterSocketConnectionsPool: masterSocketConnectionPool,
-		logger:                      serverLogger,
-		newIncomingMessage:          newIncomingMessage,
-		db:                          db,
-		influxDB:                    influxDB,
+	server := &Server{
+		closeCh:       closeCh,
+		middleware:    _middleware,
+		connectString: connectString,
+		hub:           NewHub(serverLogger),
+		logger:        serverLogger,
+		db:            db,
+		influxDB:      influxDB,
+		alarmEngine:   alarm.NewEngine(db),
+		notifier:      notify.NewNotifier(db),
+		connectivity:  make(map[int64]*fieldConnectivity),
+		syncMetrics:   newSyncMetrics(),
+		syncStates:    newSyncClientStates(),
+		syncUploads:   newSyncUploads(),
+		messageNonces: newMessageNonces(time.Now().Unix()),
+	}
+	server.escalator = alarm.NewEscalator(db, server.escalateAlarm)
+	server.dispatcher = newDispatcher(viper.GetInt("SyncQueueSize"), func(message *incomingMessageWithContext) {
+		server.ProcessNewIncomingMessage(message.Context, message.Message, message.OilFieldId)
+	}, serverLogger)
+
+	fieldTLS, err := newFieldTLSConfig()
+	if err != nil {
+		serverLogger.Errorf("Can't load the oil field TLS settings, using the system roots: %s", err.Error())
+		fieldTLS = &tls.Config{}
 	}
+	server.fieldTLS = fieldTLS
+
+	return server
 }
 
 func (server *Server) wrapMiddleware(handler http.Handler) http.Handler {
@@ -92,6 +124,20 @@ func (server *Server) wrapMiddleware(handler http.Handler) http.Handler {
 func (server *Server) Run() {
 	server.logger.Infof("Server is starting...")
 
+	if err := server.db.CloseConnectivity(context.Background(), time.Now().Unix()); err != nil {
+		server.logger.Errorf("Can't close connectivity of the previous run: %s", err.Error())
+	}
+
+	server.notifier.Run()
+	go server.escalator.Run()
+	go server.runMaintenanceDaemon()
+	go server.runStaleDaemon()
+	go server.runBackfillDaemon()
+	go server.runConfigDaemon()
+	go server.runCommandDaemon()
+	go server.runSpoolDaemon()
+	go server.runHeartbeatDaemon()
+
 	var wg sync.WaitGroup
 
 	wg.Add(2)
@@ -129,13 +175,31 @@ func (server *Server) runMasterDaemon(wg *sync.WaitGroup) {
 		}
 
 		for _, oilField := range oilFields {
-			if !oilField.IsDeleted {
-				server.listenOilField(ctx, oilField)
-			} else {
+			if oilField.IsDeleted {
+				server.disconnectOilField(ctx, oilField.OilFieldId)
+				server.syncStates.Disabled(oilField.OilFieldId)
+				continue
+			}
+
+			// the connection mode changed, drop the connection of the other side
+			if syncClient, exists := server.hub.OilField(oilField.OilFieldId); exists && syncClient.gateway != oilField.IsGateway() {
 				server.disconnectOilField(ctx, oilField.OilFieldId)
 			}
 
+			if oilField.IsGateway() {
+				if !server.isOilFieldOnline(oilField.OilFieldId) {
+					server.syncStates.Waiting(oilField.OilFieldId)
+				}
+				continue
+			}
+
+			// fields are dialed concurrently, a field that doesn't answer doesn't hold up the others
+			if server.syncStates.BeginDial(oilField.OilFieldId, false) {
+				go server.listenOilField(ctx, oilField)
+			}
 		}
+
+		server.checkConnectivity(ctx, oilFields)
 	}
 }
 
@@ -167,10 +231,9 @@ func (server *Server) runWebsocket(wg *sync.WaitGroup) {
 	}()
 
 	server.logger.Infof("Websocket listening...")
+	server.dispatcher.Run(viper.GetInt("SyncWorkers"))
 	for {
 		select {
-		case mes := <-server.newIncomingMessage:
-			go server.ProcessNewIncomingMessage(mes.Context, mes.Message, mes.OilFieldId)
 		case <-server.closeCh:
 			return
 		}
@@ -188,6 +251,7 @@ func (server *Server) runREST(wg *sync.WaitGroup) {
 	}()
 
 	http.Handle("/connect", server.wrapMiddleware(http.HandlerFunc(server.connect)))
+	http.Handle("/gateway/connect", server.wrapMiddleware(http.HandlerFunc(server.gatewayConnect)))
 
 	http.Handle("/auth", server.wrapMiddleware(http.HandlerFunc(server.auth)))
 
@@ -207,9 +271,23 @@ func (server *Server) runREST(wg *sync.WaitGroup) {
 	http.Handle("/oil_fields/list", server.wrapMiddleware(http.HandlerFunc(server.oilFields)))
 	http.Handle("/oil_fields/save", server.wrapMiddleware(http.HandlerFunc(server.oilFieldsSave)))
 	http.Handle("/oil_fields/delete", server.wrapMiddleware(http.HandlerFunc(server.oilFieldsDelete)))
+	http.Handle("/oil_fields/reconnect", server.wrapMiddleware(http.HandlerFunc(server.oilFieldsReconnect)))
+	http.Handle("/oil_fields/uptime", server.wrapMiddleware(http.HandlerFunc(server.oilFieldsUptime)))
+	http.Handle("/oil_fields/gatewayToken", server.wrapMiddleware(http.HandlerFunc(server.oilFieldsGatewayToken)))
+	http.Handle("/oil_fields/credentials", server.wrapMiddleware(http.HandlerFunc(server.oilFieldsCredentials)))
+	http.Handle("/oil_fields/credentials/save", server.wrapMiddleware(http.HandlerFunc(server.oilFieldsCredentialsSave)))
+	http.Handle("/oil_fields/credentials/rotate", server.wrapMiddleware(http.HandlerFunc(server.oilFieldsCredentialsRotate)))
+
+	http.Handle("/sync_files/list", server.wrapMiddleware(http.HandlerFunc(server.syncFilesList)))
+	http.Handle("/sync_metrics", server.wrapMiddleware(http.HandlerFunc(server.syncMetricsHandler)))
+	http.Handle("/backfills/list", server.wrapMiddleware(http.HandlerFunc(server.backfillsList)))
+	http.Handle("/backfills/save", server.wrapMiddleware(http.HandlerFunc(server.backfillsSave)))
+	http.Handle("/backfills/approve", server.wrapMiddleware(http.HandlerFunc(server.backfillsApprove)))
+	http.Handle("/backfills/cancel", server.wrapMiddleware(http.HandlerFunc(server.backfillsCancel)))
 
 	http.Handle("/controllers/list", server.wrapMiddleware(http.HandlerFunc(server.controllersList)))
 	http.Handle("/controllers/data", server.wrapMiddleware(http.HandlerFunc(server.controllerData)))
+	http.Handle("/controllers/save", server.wrapMiddleware(http.HandlerFunc(server.controllersSave)))
 
 	http.Handle("/mnemoschemes/list", server.wrapMiddleware(http.HandlerFunc(server.mnemoschemesList)))
 	http.Handle("/mnemoschemes/save", server.wrapMiddleware(http.HandlerFunc(server.mnemoschemesSave)))
@@ -217,14 +295,53 @@ func (server *Server) runREST(wg *sync.WaitGroup) {
 	http.Handle("/mnemoschemes/mnemoschemesInfoSave", server.wrapMiddleware(http.HandlerFunc(server.mnemoschemesInfoSave)))
 
 	http.Handle("/alarms/list", server.wrapMiddleware(http.HandlerFunc(server.alarmsList)))
-	http.Handle("/alarms/markAsViewed", server.wrapMiddleware(http.HandlerFunc(server.markAlarmViewed)))
+	http.Handle("/alarms/history", server.wrapMiddleware(http.HandlerFunc(server.alarmsHistory)))
+	http.Handle("/alarms/acknowledge", server.wrapMiddleware(http.HandlerFunc(server.alarmsAcknowledge)))
+	http.Handle("/alarms/shelve", server.wrapMiddleware(http.HandlerFunc(server.alarmsShelve)))
+	http.Handle("/alarms/unshelve", server.wrapMiddleware(http.HandlerFunc(server.alarmsUnshelve)))
+	// kept for older clients, acknowledges the alarm without a comment
+	http.Handle("/alarms/markAsViewed", server.wrapMiddleware(http.HandlerFunc(server.alarmsMarkAsViewed)))
+
+	http.Handle("/notifications/channels/list", server.wrapMiddleware(http.HandlerFunc(server.notificationChannelsList)))
+	http.Handle("/notifications/channels/save", server.wrapMiddleware(http.HandlerFunc(server.notificationChannelsSave)))
+	http.Handle("/notifications/subscriptions/list", server.wrapMiddleware(http.HandlerFunc(server.notificationSubscriptionsList)))
+	http.Handle("/notifications/subscriptions/save", server.wrapMiddleware(http.HandlerFunc(server.notificationSubscriptionsSave)))
+	http.Handle("/notifications/subscriptions/delete", server.wrapMiddleware(http.HandlerFunc(server.notificationSubscriptionsDelete)))
+	http.Handle("/notifications/deliveries/list", server.wrapMiddleware(http.HandlerFunc(server.notificationDeliveriesList)))
+
+	http.Handle("/analytics/alarms", server.wrapMiddleware(http.HandlerFunc(server.analyticsAlarms)))
+
+	http.Handle("/alarms/escalations", server.wrapMiddleware(http.HandlerFunc(server.alarmsEscalations)))
+	http.Handle("/escalation/policies/list", server.wrapMiddleware(http.HandlerFunc(server.escalationPoliciesList)))
+	http.Handle("/escalation/policies/save", server.wrapMiddleware(http.HandlerFunc(server.escalationPoliciesSave)))
+	http.Handle("/escalation/policies/delete", server.wrapMiddleware(http.HandlerFunc(server.escalationPoliciesDelete)))
+	http.Handle("/escalation/schedules/list", server.wrapMiddleware(http.HandlerFunc(server.escalationSchedulesList)))
+	http.Handle("/escalation/schedules/save", server.wrapMiddleware(http.HandlerFunc(server.escalationSchedulesSave)))
+	http.Handle("/escalation/schedules/delete", server.wrapMiddleware(http.HandlerFunc(server.escalationSchedulesDelete)))
+
+	http.Handle("/alarm_dedup/list", server.wrapMiddleware(http.HandlerFunc(server.alarmDedupList)))
+	http.Handle("/alarm_dedup/save", server.wrapMiddleware(http.HandlerFunc(server.alarmDedupSave)))
+	http.Handle("/alarm_dedup/delete", server.wrapMiddleware(http.HandlerFunc(server.alarmDedupDelete)))
+
+	http.Handle("/maintenance/list", server.wrapMiddleware(http.HandlerFunc(server.maintenanceList)))
+	http.Handle("/maintenance/save", server.wrapMiddleware(http.HandlerFunc(server.maintenanceSave)))
+	http.Handle("/maintenance/end", server.wrapMiddleware(http.HandlerFunc(server.maintenanceEnd)))
 
 	http.Handle("/sensors/list", server.wrapMiddleware(http.HandlerFunc(server.sensorsList)))
+	http.Handle("/sensors/save", server.wrapMiddleware(http.HandlerFunc(server.sensorsSave)))
+	http.Handle("/config_changes/list", server.wrapMiddleware(http.HandlerFunc(server.configChangesList)))
+	http.Handle("/commands/list", server.wrapMiddleware(http.HandlerFunc(server.commandsList)))
+	http.Handle("/commands/send", server.wrapMiddleware(http.HandlerFunc(server.commandsSend)))
+	http.Handle("/commands/approve", server.wrapMiddleware(http.HandlerFunc(server.commandsApprove)))
+	http.Handle("/commands/reject", server.wrapMiddleware(http.HandlerFunc(server.commandsReject)))
+	http.Handle("/commands/critical", server.wrapMiddleware(http.HandlerFunc(server.commandsCritical)))
+	http.Handle("/sensors/alarmSettings", server.wrapMiddleware(http.HandlerFunc(server.sensorsAlarmSettings)))
+	http.Handle("/sensors/alarmSettings/save", server.wrapMiddleware(http.HandlerFunc(server.sensorsAlarmSettingsSave)))
 	http.Handle("/actions/list", server.wrapMiddleware(http.HandlerFunc(server.actionsList)))
 
 	http.Handle("/files", server.wrapMiddleware(http.HandlerFunc(server.files)))
 
-	server.logger.Fatal(http.ListenAndServe(server.connectString, nil))
+	server.logger.Fatal(server.listen())
 }
 
 func (server *Server) connect(w http.ResponseWriter, r *http.Request) {
@@ -241,7 +358,7 @@ func (server *Server) connect(w http.ResponseWriter, r *http.Request) {
 	server.logger.Infof("Connect (userId: %d)", user.UserID)
 
 	connection := NewSocketConnection(server, conn, user)
-	server.SocketConnectionsPool[user.UserID] = append(server.SocketConnectionsPool[user.UserID], connection)
+	server.hub.AddUserConnection(connection)
 	connection.Run()
 
 	users, err := server.db.GetUsers(ctx, user.CompanyID, user.IsSuperUser())
@@ -270,6 +387,47 @@ func (server *Server) connect(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// gatewayConnect - websocket endpoint field gateways behind NAT dial into, authenticated by the oil field
+// gateway token or client certificate. The connection replaces the previous one of the oil field.
+func (server *Server) gatewayConnect(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l, _ := icontext.GetLogger(ctx)
+
+	oilFieldID, _ := strconv.ParseInt(r.URL.Query().Get("OilFieldID"), 10, 64)
+	token := r.Header.Get(gatewayTokenName)
+	if token == "" {
+		token = r.URL.Query().Get(gatewayTokenName)
+	}
+
+	authorized := false
+	oilField, err := server.db.GetOilField(ctx, oilFieldID)
+	if err == nil && !oilField.IsDeleted && oilField.IsGateway() {
+		authorized = server.db.CheckGatewayToken(ctx, oilFieldID, token)
+		if name := clientCertificateName(r); !authorized && name != "" {
+			credentials, err := server.db.GetOilFieldCredentials(ctx, oilFieldID)
+			authorized = err == nil && credentials.ClientCertCN == name
+		}
+	}
+	if !authorized {
+		l.Errorf("Gateway of oil field %d is not authorized", oilFieldID)
+		response.ErrorResponse(l, w, http.StatusUnauthorized, "Access denied", nil)
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		server.logger.Errorf("Gateway connect error %s", err.Error())
+		return
+	}
+
+	server.logger.Infof("Gateway connect (oilFieldId: %d, address: %s)", oilFieldID, r.RemoteAddr)
+
+	server.disconnectOilField(ctx, oilFieldID)
+	syncClient := NewSyncClient(oilFieldID, r.RemoteAddr, conn, server, server.logger)
+	syncClient.gateway = true
+	server.addSyncClient(ctx, syncClient)
+}
+
 func (server *Server) auth(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	l, _ := icontext.GetLogger(ctx)
@@ -691,17 +849,19 @@ func (server *Server) oilFields(w http.ResponseWriter, r *http.Request) {
 	oilFieldResults := make([]*models.OilFieldResult, 0, 10)
 	for _, oilField := range oilFields {
 		oilFieldResult := &models.OilFieldResult{
-			OilFieldId:  oilField.OilFieldId,
-			HttpAddress: oilField.HttpAddress,
-			CompanyID:   oilField.CompanyID,
-			CompanyName: oilField.CompanyName,
-			Name:        oilField.Name,
-			Lat:         oilField.Lat,
-			Lon:         oilField.Lon,
-			IsDeleted:   oilField.IsDeleted,
-			CreatedTs:   oilField.CreatedTs,
-			UpdatedTs:   oilField.UpdatedTs,
-			IsOnline:    server.isOilFieldOnline(oilField.OilFieldId),
+			OilFieldId:     oilField.OilFieldId,
+			HttpAddress:    oilField.HttpAddress,
+			CompanyID:      oilField.CompanyID,
+			CompanyName:    oilField.CompanyName,
+			Name:           oilField.Name,
+			Lat:            oilField.Lat,
+			Lon:            oilField.Lon,
+			ConnectionMode: oilField.ConnectionMode,
+			IsDeleted:      oilField.IsDeleted,
+			CreatedTs:      oilField.CreatedTs,
+			UpdatedTs:      oilField.UpdatedTs,
+			IsOnline:       server.isOilFieldOnline(oilField.OilFieldId),
+			SyncClient:     server.syncStates.Get(oilField.OilFieldId),
 		}
 		oilFieldResults = append(oilFieldResults, oilFieldResult)
 	}
@@ -731,16 +891,17 @@ func (server *Server) oilFieldsSave(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	oilFieldResult := &models.OilFieldResult{
-		OilFieldId:  oilField.OilFieldId,
-		HttpAddress: oilField.HttpAddress,
-		CompanyID:   oilField.CompanyID,
-		Name:        oilField.Name,
-		Lat:         oilField.Lat,
-		Lon:         oilField.Lon,
-		IsDeleted:   oilField.IsDeleted,
-		CreatedTs:   oilField.CreatedTs,
-		UpdatedTs:   oilField.UpdatedTs,
-		IsOnline:    server.isOilFieldOnline(oilField.OilFieldId),
+		OilFieldId:     oilField.OilFieldId,
+		HttpAddress:    oilField.HttpAddress,
+		CompanyID:      oilField.CompanyID,
+		Name:           oilField.Name,
+		Lat:            oilField.Lat,
+		Lon:            oilField.Lon,
+		ConnectionMode: oilField.ConnectionMode,
+		IsDeleted:      oilField.IsDeleted,
+		CreatedTs:      oilField.CreatedTs,
+		UpdatedTs:      oilField.UpdatedTs,
+		IsOnline:       server.isOilFieldOnline(oilField.OilFieldId),
 	}
 
 	response.Response(l, w, oilFieldResult)
@@ -776,345 +937,2237 @@ func (server *Server) oilFieldsDelete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	oilFieldResult := &models.OilFieldResult{
-		OilFieldId:  oilField.OilFieldId,
-		HttpAddress: oilField.HttpAddress,
-		CompanyID:   oilField.CompanyID,
-		Name:        oilField.Name,
-		Lat:         oilField.Lat,
-		Lon:         oilField.Lon,
-		IsDeleted:   oilField.IsDeleted,
-		CreatedTs:   oilField.CreatedTs,
-		UpdatedTs:   oilField.UpdatedTs,
-		IsOnline:    server.isOilFieldOnline(oilField.OilFieldId),
+		OilFieldId:     oilField.OilFieldId,
+		HttpAddress:    oilField.HttpAddress,
+		CompanyID:      oilField.CompanyID,
+		Name:           oilField.Name,
+		Lat:            oilField.Lat,
+		Lon:            oilField.Lon,
+		ConnectionMode: oilField.ConnectionMode,
+		IsDeleted:      oilField.IsDeleted,
+		CreatedTs:      oilField.CreatedTs,
+		UpdatedTs:      oilField.UpdatedTs,
+		IsOnline:       server.isOilFieldOnline(oilField.OilFieldId),
 	}
 
 	response.Response(l, w, oilFieldResult)
 }
 
-func (server *Server) controllersList(w http.ResponseWriter, r *http.Request) {
+// oilFieldsReconnect - drops the connection of the oil field and dials it right away, skipping the backoff.
+// The dial runs in the background, a gateway is expected to dial in again.
+func (server *Server) oilFieldsReconnect(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	user, _ := icontext.GetUser(ctx)
 	l, _ := icontext.GetLogger(ctx)
-
-	keys := r.URL.Query()
-	oilFieldID, err := strconv.ParseInt(keys.Get("oilFieldId"), 10, 64)
+	input := struct {
+		OilFieldId int64 `json:"oilFieldId"`
+	}{}
+	err := utils.ParseJson(r, &input)
 	if err != nil {
-		l.Errorf("%v", err)
-		response.ErrorResponse(l, w, http.StatusForbidden, "Required oilFieldId", nil)
+		response.ErrorResponse(l, w, http.StatusInternalServerError, "Parse error", nil)
 		return
 	}
 
-	oilField, err := server.db.GetOilField(ctx, oilFieldID)
+	oilField, err := server.db.GetOilField(ctx, input.OilFieldId)
 	if err != nil {
-		l.Errorf("%v", err)
-		response.ErrorResponse(l, w, http.StatusForbidden, "Oil Field Not found", nil)
+		response.ErrorResponse(l, w, http.StatusNotFound, "Oil field not found", nil)
 		return
 	}
 
-	if oilField.CompanyID != user.CompanyID && !user.IsSuperUser() {
+	if !user.IsSuperUser() && oilField.CompanyID != user.CompanyID {
 		response.ErrorResponse(l, w, http.StatusForbidden, "Access denied", nil)
 		return
 	}
 
-	output, err := server.db.GetControllers(ctx, oilFieldID)
-	if err != nil {
-		response.ErrorResponse(l, w, http.StatusInternalServerError, err.Error(), nil)
+	if oilField.IsDeleted {
+		response.ErrorResponse(l, w, http.StatusUnprocessableEntity, "Oil field is deleted", nil)
 		return
 	}
 
-	response.Response(l, w, output)
+	l.Infof("Reconnect of oil field %d forced by user %d", oilField.OilFieldId, user.UserID)
+	server.disconnectOilField(ctx, oilField.OilFieldId)
+	if oilField.IsGateway() {
+		server.syncStates.Waiting(oilField.OilFieldId)
+	} else if server.syncStates.BeginDial(oilField.OilFieldId, true) {
+		// the link outlives the request, it is held with the context of the server
+		go server.listenOilField(context.WithValue(context.Background(), icontext.LoggerContextKey, server.logger), oilField)
+	}
+
+	response.AcceptedResponse(l, w, server.syncStates.Get(oilField.OilFieldId))
 }
 
-func (server *Server) controllerData(w http.ResponseWriter, r *http.Request) {
+// oilFieldsGatewayToken - generates a new gateway credential of the oil field, the previous one stops working.
+// The token is returned only once.
+func (server *Server) oilFieldsGatewayToken(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	user, _ := icontext.GetUser(ctx)
 	l, _ := icontext.GetLogger(ctx)
-
-	input := models.SyncControllerDataRequest{}
+	input := struct {
+		OilFieldId int64 `json:"oilFieldId"`
+	}{}
 	err := utils.ParseJson(r, &input)
 	if err != nil {
 		response.ErrorResponse(l, w, http.StatusInternalServerError, "Parse error", nil)
 		return
 	}
 
-	fmt.Println("DIFF: ", input.DiffTime)
-
-	if err = input.Validate(); err != nil {
-		l.Errorf("%v", err)
-		response.ErrorResponse(l, w, http.StatusForbidden, err.Error(), nil)
-		return
-	}
-
-	controller, err := server.db.GetController(ctx, input.ControllerID)
+	existsOilField, err := server.db.GetOilField(ctx, input.OilFieldId)
 	if err != nil {
-		l.Errorf("%v", err)
-		response.ErrorResponse(l, w, http.StatusForbidden, "Controller Not found", nil)
+		response.ErrorResponse(l, w, http.StatusNotFound, "Oil field not found", nil)
 		return
 	}
 
-	oilField, err := server.db.GetOilField(ctx, controller.OilFieldId)
-	if err != nil {
-		l.Errorf("%v", err)
-		response.ErrorResponse(l, w, http.StatusForbidden, "Controller Not found", nil)
-		return
-	}
-	if !user.IsSuperUser() && oilField.CompanyID != user.CompanyID {
+	if !user.IsSuperUser() && existsOilField.CompanyID != user.CompanyID {
 		response.ErrorResponse(l, w, http.StatusForbidden, "Access denied", nil)
 		return
 	}
-	sensors, err := server.db.GetSensors(ctx, controller.ControllerID)
+
+	token, err := utils.GenerateToken(32)
 	if err != nil {
 		l.Errorf("%v", err)
-		response.ErrorResponse(l, w, http.StatusInternalServerError, "Parse error", nil)
+		response.ErrorResponse(l, w, http.StatusInternalServerError, err.Error(), nil)
 		return
 	}
 
-	tags := make([]string, 0, 10)
-	for _, sensor := range sensors {
-		tags = append(tags, sensor.SensorId)
-	}
-
-	result := server.influxDB.GetMultipleTagsData(tags, input.SelectTime, input.DiffTime, input.GroupTime)
-	result.Objects = sensors
-
-	response.Response(l, w, result)
-}
-
-func (server *Server) mnemoschemesList(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
-	user, _ := icontext.GetUser(ctx)
-	l, _ := icontext.GetLogger(ctx)
-
-	mnemoschemes, err := server.db.GetMnemoschemes(ctx, user.CompanyID, user.IsSuperUser())
-	if err != nil {
+	if err := server.db.SetGatewayToken(ctx, input.OilFieldId, token); err != nil {
+		l.Errorf("%v", err)
 		response.ErrorResponse(l, w, http.StatusInternalServerError, err.Error(), nil)
 		return
 	}
 
-	response.Response(l, w, mnemoschemes)
+	response.Response(l, w, models.GatewayToken{
+		OilFieldID: input.OilFieldId,
+		Token:      token,
+	})
 }
 
-func (server *Server) mnemoschemesSave(w http.ResponseWriter, r *http.Request) {
+func (server *Server) oilFieldsCredentials(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	user, _ := icontext.GetUser(ctx)
 	l, _ := icontext.GetLogger(ctx)
 
-	mnemoID, _ := strconv.ParseInt(r.FormValue("mnemoId"), 10, 64)
-	companyID, _ := strconv.ParseInt(r.FormValue("companyId"), 10, 64)
-	l.Errorf("companyID: %d", companyID)
-	l.Errorf("mnemoID: %d", mnemoID)
-
-	model := models.MnemoResult{
-		MnemoId:   mnemoID,
-		CompanyId: companyID,
-		Info:      r.FormValue("info"),
-		Name:      r.FormValue("name"),
-	}
-
-	l.Errorf("Mnemo: %d", model.MnemoId)
-	l.Errorf("Mnemo: %d", model.CompanyId)
-	l.Errorf("Mnemo: %d", model.Info)
-	l.Errorf("Mnemo: %d", model.Name)
-	if mnemoID > 0 {
-		mnemo, err := server.db.GetMnemoscheme(ctx, mnemoID)
-		l.Errorf("Find mnemo ID: %v", err)
-		if err != nil {
-			response.ErrorResponse(l, w, http.StatusUnprocessableEntity, "Mnemo not found", nil)
-			return
-		}
-		model.FileUrl = mnemo.FileUrl
+	oilFieldID, err := strconv.ParseInt(r.URL.Query().Get("oilFieldId"), 10, 64)
+	if err != nil {
+		response.ErrorResponse(l, w, http.StatusUnprocessableEntity, "Required oilFieldId", nil)
+		return
 	}
 
-	err := model.Validate()
+	existsOilField, err := server.db.GetOilField(ctx, oilFieldID)
 	if err != nil {
-		l.Errorf("validate: %v", err)
-		response.ErrorResponse(l, w, http.StatusUnprocessableEntity, err.Error(), nil)
+		response.ErrorResponse(l, w, http.StatusNotFound, "Oil field not found", nil)
 		return
 	}
 
-	if user.CompanyID != companyID && !user.IsSuperUser() {
+	if !user.IsSuperUser() && existsOilField.CompanyID != user.CompanyID {
 		response.ErrorResponse(l, w, http.StatusForbidden, "Access denied", nil)
 		return
 	}
 
-	if upload.FileExists(r, "file") {
-		if mnemoID > 0 {
-			tempMnemo, err := server.db.GetMnemoscheme(ctx, mnemoID)
-			if err == nil && len(tempMnemo.FileUrl) > 0 {
-				l.Errorf("FileExists(919): %v", err)
-				_ = upload.RemoveFile(tempMnemo.FileUrl[1:], l)
-			}
-		}
-
-		path := "uploads/" + strconv.FormatInt(user.UserID, 10)
-		fileData, err := upload.UploadFile(r, "file", path, l)
-		if err != nil {
-			l.Errorf("fileData(927): %v", err)
-			fmt.Println("err: ", err.Error())
-			response.ErrorResponse(l, w, 500, "Internal server error", nil)
-			return
-		}
-		model.FileUrl = fileData.Url
-	}
-	//else if mnemoID == 0 {
-	// 	l.Errorf("mnemoID equal 0(934): %v")
-	// 	response.ErrorResponse(l, w, http.StatusUnprocessableEntity, "FILE NOT EXISTS", nil)
-	// 	return
-	// }
-
-	mnemo, err := server.db.SaveMnemoschemes(ctx, model)
+	credentials, err := server.db.GetOilFieldCredentials(ctx, oilFieldID)
 	if err != nil {
-		l.Errorf("Save Mnemoschemes(940): %v", err)
-		response.ErrorResponse(l, w, http.StatusUnprocessableEntity, err.Error(), nil)
+		l.Errorf("%v", err)
+		response.ErrorResponse(l, w, http.StatusInternalServerError, err.Error(), nil)
 		return
 	}
+	credentials.Secret = ""
 
-	response.Response(l, w, mnemo)
+	response.Response(l, w, credentials)
 }
 
-func (server *Server) mnemoschemesData(w http.ResponseWriter, r *http.Request) {
+func (server *Server) oilFieldsCredentialsSave(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
+	user, _ := icontext.GetUser(ctx)
 	l, _ := icontext.GetLogger(ctx)
-
-	input := struct {
-		SensorIDs []string `json:"sensorIds"`
-	}{}
+	input := models.OilFieldCredentials{}
 	err := utils.ParseJson(r, &input)
 	if err != nil {
-		fmt.Println(err.Error())
 		response.ErrorResponse(l, w, http.StatusInternalServerError, "Parse error", nil)
 		return
 	}
 
-	if len(input.SensorIDs) == 0 {
-		response.ErrorResponse(l, w, http.StatusUnprocessableEntity, "Empty sensorIds", nil)
+	existsOilField, err := server.db.GetOilField(ctx, input.OilFieldID)
+	if err != nil {
+		response.ErrorResponse(l, w, http.StatusNotFound, "Oil field not found", nil)
 		return
 	}
 
-	latestSensorDatas := server.db.GetLatestSensorValues(ctx, server.influxDB, input.SensorIDs)
-	response.Response(l, w, latestSensorDatas)
+	if !user.IsSuperUser() && existsOilField.CompanyID != user.CompanyID {
+		response.ErrorResponse(l, w, http.StatusForbidden, "Access denied", nil)
+		return
+	}
+
+	credentials, err := server.db.SaveOilFieldCredentials(ctx, input)
+	if err != nil {
+		l.Errorf("%v", err)
+		response.ErrorResponse(l, w, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	credentials.Secret = ""
+
+	response.Response(l, w, credentials)
 }
 
-func (server *Server) mnemoschemesInfoSave(w http.ResponseWriter, r *http.Request) {
+// oilFieldsCredentialsRotate - generates a new secret of the oil field and returns it once. The replaced secret
+// stays valid for SecretRotationGrace seconds so the field can be switched over without dropping messages.
+func (server *Server) oilFieldsCredentialsRotate(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	user, _ := icontext.GetUser(ctx)
 	l, _ := icontext.GetLogger(ctx)
-
 	input := struct {
-		MnemoID   int64  `json:"mnemo_id"`
-		CompanyID int64  `json:"company_id"`
-		Info      string `json:"info"`
+		OilFieldId int64 `json:"oilFieldId"`
 	}{}
 	err := utils.ParseJson(r, &input)
 	if err != nil {
-		response.ErrorResponse(l, w, http.StatusInternalServerError, "Internal server error", nil)
+		response.ErrorResponse(l, w, http.StatusInternalServerError, "Parse error", nil)
 		return
 	}
 
-	if user.CompanyID != input.CompanyID && !user.IsSuperUser() {
+	existsOilField, err := server.db.GetOilField(ctx, input.OilFieldId)
+	if err != nil {
+		response.ErrorResponse(l, w, http.StatusNotFound, "Oil field not found", nil)
+		return
+	}
+
+	if !user.IsSuperUser() && existsOilField.CompanyID != user.CompanyID {
 		response.ErrorResponse(l, w, http.StatusForbidden, "Access denied", nil)
 		return
 	}
 
-	mnemo, err := server.db.SaveMnemoschemeInfo(ctx, input.MnemoID, input.Info)
+	secret, err := utils.GenerateToken(32)
 	if err != nil {
-		response.ErrorResponse(l, w, http.StatusUnprocessableEntity, err.Error(), nil)
+		l.Errorf("%v", err)
+		response.ErrorResponse(l, w, http.StatusInternalServerError, err.Error(), nil)
 		return
 	}
 
-	response.Response(l, w, mnemo)
-}
-
-func (server *Server) alarmsList(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
-	l, _ := icontext.GetLogger(ctx)
-	user, _ := icontext.GetUser(ctx)
-
-	alarms, err := server.db.GetAlarms(ctx, user.CompanyID, user.IsSuperUser())
+	credentials, err := server.db.RotateOilFieldSecret(ctx, input.OilFieldId, secret, time.Now().Unix())
 	if err != nil {
 		l.Errorf("%v", err)
 		response.ErrorResponse(l, w, http.StatusInternalServerError, err.Error(), nil)
 		return
 	}
 
-	response.Response(l, w, alarms)
+	response.Response(l, w, credentials)
 }
 
-func (server *Server) sensorsList(w http.ResponseWriter, r *http.Request) {
+func (server *Server) oilFieldsUptime(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	l, _ := icontext.GetLogger(ctx)
 	user, _ := icontext.GetUser(ctx)
-	input := models.SensorResult{}
 
-	oilFields, err := server.db.GetOilFieldCheckingUser(ctx, user.CompanyID, user.IsSuperUser())
+	keys := r.URL.Query()
+	input := models.UptimeRequest{}
+	input.OilFieldID, _ = strconv.ParseInt(keys.Get("oilFieldId"), 10, 64)
+	input.From, _ = strconv.ParseInt(keys.Get("from"), 10, 64)
+	input.To, _ = strconv.ParseInt(keys.Get("to"), 10, 64)
 
-	if err != nil {
-		response.ErrorResponse(l, w, http.StatusInternalServerError, err.Error(), nil)
+	if err := input.Validate(); err != nil {
+		response.ErrorResponse(l, w, http.StatusUnprocessableEntity, err.Error(), nil)
 		return
 	}
 
-	oilFieldID := make([]int64, 0, 10)
-
-	for _, value := range oilFields {
-		oilFieldID = append(oilFieldID, value.OilFieldId)
+	oilField, err := server.db.GetOilField(ctx, input.OilFieldID)
+	if err != nil {
+		response.ErrorResponse(l, w, http.StatusNotFound, "Oil field not found", nil)
+		return
 	}
 
-	if oilFieldID == nil {
-		response.ErrorResponse(l, w, http.StatusUnprocessableEntity, "oilfieldID Empty", nil)
+	if !user.IsSuperUser() && oilField.CompanyID != user.CompanyID {
+		response.ErrorResponse(l, w, http.StatusForbidden, "Access denied", nil)
 		return
 	}
 
-	controllers, err := server.db.GetControllersArrayInputParam(ctx, oilFieldID, input.SensorId)
-	if err != nil {
+	state := ""
+	last, err := server.db.GetLastConnectivityEvent(ctx, input.OilFieldID, input.From)
+	if err == nil {
+		state = last.Event
+	} else if err != sql.ErrNoRows {
 		l.Errorf("%v", err)
 		response.ErrorResponse(l, w, http.StatusInternalServerError, err.Error(), nil)
 		return
 	}
 
-	sensors := make([]*models.SensorResult, 0, 10)
-
-	for _, value := range controllers {
-		sensors = append(sensors, value.Sensors...)
+	events, err := server.db.GetConnectivityEvents(ctx, input.OilFieldID, input.From, input.To)
+	if err != nil {
+		l.Errorf("%v", err)
+		response.ErrorResponse(l, w, http.StatusInternalServerError, err.Error(), nil)
+		return
 	}
 
-	response.Response(l, w, sensors)
-
+	response.Response(l, w, models.NewUptimeReport(input.OilFieldID, input.From, input.To, time.Now().Unix(), state, events))
 }
 
-func (server *Server) actionsList(w http.ResponseWriter, r *http.Request) {
+func (server *Server) syncFilesList(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	l, _ := icontext.GetLogger(ctx)
 	user, _ := icontext.GetUser(ctx)
 
-	actions, err := server.db.GetActionsLogs(ctx, user.CompanyID, user.IsSuperUser())
+	keys := r.URL.Query()
+	filter := &models.SyncFileFilter{
+		Status: keys.Get("status"),
+		Limit:  models.SyncFileListDefaultLimit,
+	}
+	filter.OilFieldID, _ = strconv.ParseInt(keys.Get("oilFieldId"), 10, 64)
+	if limit := keys.Get("limit"); limit != "" {
+		filter.Limit, _ = strconv.Atoi(limit)
+	}
+
+	if err := filter.Validate(); err != nil {
+		response.ErrorResponse(l, w, http.StatusUnprocessableEntity, err.Error(), nil)
+		return
+	}
+
+	files, err := server.db.GetSyncFiles(ctx, user.CompanyID, user.IsSuperUser(), filter)
+	if err != nil {
+		l.Errorf("%v", err)
+		response.ErrorResponse(l, w, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+
+	response.Response(l, w, files)
+}
+
+func (server *Server) syncMetricsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l, _ := icontext.GetLogger(ctx)
+
+	metrics := server.syncMetrics.snapshot()
+	metrics.Workers = server.dispatcher.workers
+	metrics.Queues = server.dispatcher.Depths()
+	metrics.Spool = server.influxDB.SpoolStats()
+
+	response.Response(l, w, metrics)
+}
+
+func (server *Server) backfillsList(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l, _ := icontext.GetLogger(ctx)
+	user, _ := icontext.GetUser(ctx)
+
+	keys := r.URL.Query()
+	oilFieldID, _ := strconv.ParseInt(keys.Get("oilFieldId"), 10, 64)
+
+	backfills, err := server.db.GetBackfills(ctx, user.CompanyID, user.IsSuperUser(), oilFieldID, keys.Get("status"))
+	if err != nil {
+		l.Errorf("%v", err)
+		response.ErrorResponse(l, w, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+
+	response.Response(l, w, backfills)
+}
+
+func (server *Server) backfillsSave(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user, _ := icontext.GetUser(ctx)
+	l, _ := icontext.GetLogger(ctx)
+	var input models.Backfill
+	err := utils.ParseJson(r, &input)
+	if err != nil {
+		response.ErrorResponse(l, w, http.StatusInternalServerError, "Parse error", nil)
+		return
+	}
+
+	if err := input.Validate(); err != nil {
+		response.ErrorResponse(l, w, http.StatusUnprocessableEntity, err.Error(), nil)
+		return
+	}
+
+	oilField, err := server.db.GetOilField(ctx, input.OilFieldID)
+	if err != nil {
+		response.ErrorResponse(l, w, http.StatusNotFound, "Oil field not found", nil)
+		return
+	}
+
+	if !user.IsSuperUser() && oilField.CompanyID != user.CompanyID {
+		response.ErrorResponse(l, w, http.StatusForbidden, "Access denied", nil)
+		return
+	}
+
+	if oilField.IsDeleted {
+		response.ErrorResponse(l, w, http.StatusUnprocessableEntity, "Oil field is deleted", nil)
+		return
+	}
+
+	input.Status = models.BACKFILL_STATUS_PENDING
+	input.Source = models.BACKFILL_SOURCE_MANUAL
+	input.RequestedBy = user.UserID
+	backfill, err := server.db.CreateBackfill(ctx, input)
+	if err != nil {
+		l.Errorf("%v", err)
+		response.ErrorResponse(l, w, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+
+	response.Response(l, w, backfill)
+}
+
+func (server *Server) backfillsApprove(w http.ResponseWriter, r *http.Request) {
+	server.backfillsSetStatus(w, r, models.BACKFILL_STATUS_PENDING, "Backfill is not proposed", models.BACKFILL_STATUS_PROPOSED)
+}
+
+func (server *Server) backfillsCancel(w http.ResponseWriter, r *http.Request) {
+	server.backfillsSetStatus(w, r, models.BACKFILL_STATUS_CANCELLED, "Backfill is already finished",
+		models.BACKFILL_STATUS_PROPOSED,
+		models.BACKFILL_STATUS_PENDING,
+		models.BACKFILL_STATUS_REQUESTED,
+		models.BACKFILL_STATUS_RECEIVING,
+	)
+}
+
+// backfillsSetStatus - moves the backfill of the body to status, it must be in one of the from statuses.
+func (server *Server) backfillsSetStatus(w http.ResponseWriter, r *http.Request, status string, conflict string, from ...string) {
+	ctx := r.Context()
+	user, _ := icontext.GetUser(ctx)
+	l, _ := icontext.GetLogger(ctx)
+	input := struct {
+		BackfillID int64 `json:"backfillId"`
+	}{}
+	err := utils.ParseJson(r, &input)
+	if err != nil {
+		response.ErrorResponse(l, w, http.StatusInternalServerError, "Parse error", nil)
+		return
+	}
+
+	backfill, err := server.db.GetBackfill(ctx, input.BackfillID)
+	if err != nil {
+		response.ErrorResponse(l, w, http.StatusNotFound, "Backfill not found", nil)
+		return
+	}
+
+	if !user.IsSuperUser() && backfill.CompanyID != user.CompanyID {
+		response.ErrorResponse(l, w, http.StatusForbidden, "Access denied", nil)
+		return
+	}
+
+	moved, err := server.db.SetBackfillStatus(ctx, backfill.BackfillID, status, "", from...)
+	if err != nil {
+		l.Errorf("%v", err)
+		response.ErrorResponse(l, w, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	if !moved {
+		response.ErrorResponse(l, w, http.StatusUnprocessableEntity, conflict, nil)
+		return
+	}
+
+	backfill, err = server.db.GetBackfill(ctx, backfill.BackfillID)
+	if err != nil {
+		l.Errorf("%v", err)
+		response.ErrorResponse(l, w, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+
+	response.Response(l, w, backfill)
+}
+
+func (server *Server) controllersList(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user, _ := icontext.GetUser(ctx)
+	l, _ := icontext.GetLogger(ctx)
+
+	keys := r.URL.Query()
+	oilFieldID, err := strconv.ParseInt(keys.Get("oilFieldId"), 10, 64)
+	if err != nil {
+		l.Errorf("%v", err)
+		response.ErrorResponse(l, w, http.StatusForbidden, "Required oilFieldId", nil)
+		return
+	}
+
+	oilField, err := server.db.GetOilField(ctx, oilFieldID)
+	if err != nil {
+		l.Errorf("%v", err)
+		response.ErrorResponse(l, w, http.StatusForbidden, "Oil Field Not found", nil)
+		return
+	}
+
+	if oilField.CompanyID != user.CompanyID && !user.IsSuperUser() {
+		response.ErrorResponse(l, w, http.StatusForbidden, "Access denied", nil)
+		return
+	}
+
+	output, err := server.db.GetControllers(ctx, oilFieldID)
+	if err != nil {
+		response.ErrorResponse(l, w, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+
+	response.Response(l, w, output)
+}
+
+func (server *Server) controllerData(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user, _ := icontext.GetUser(ctx)
+	l, _ := icontext.GetLogger(ctx)
+
+	input := models.SyncControllerDataRequest{}
+	err := utils.ParseJson(r, &input)
+	if err != nil {
+		response.ErrorResponse(l, w, http.StatusInternalServerError, "Parse error", nil)
+		return
+	}
+
+	fmt.Println("DIFF: ", input.DiffTime)
+
+	if err = input.Validate(); err != nil {
+		l.Errorf("%v", err)
+		response.ErrorResponse(l, w, http.StatusForbidden, err.Error(), nil)
+		return
+	}
+
+	controller, err := server.db.GetController(ctx, input.ControllerID)
+	if err != nil {
+		l.Errorf("%v", err)
+		response.ErrorResponse(l, w, http.StatusForbidden, "Controller Not found", nil)
+		return
+	}
+
+	oilField, err := server.db.GetOilField(ctx, controller.OilFieldId)
+	if err != nil {
+		l.Errorf("%v", err)
+		response.ErrorResponse(l, w, http.StatusForbidden, "Controller Not found", nil)
+		return
+	}
+	if !user.IsSuperUser() && oilField.CompanyID != user.CompanyID {
+		response.ErrorResponse(l, w, http.StatusForbidden, "Access denied", nil)
+		return
+	}
+	sensors, err := server.db.GetSensors(ctx, controller.ControllerID)
+	if err != nil {
+		l.Errorf("%v", err)
+		response.ErrorResponse(l, w, http.StatusInternalServerError, "Parse error", nil)
+		return
+	}
+
+	tags := make([]string, 0, 10)
+	valueTypes := make(map[string]string)
+	for _, sensor := range sensors {
+		tags = append(tags, sensor.SensorId)
+		valueTypes[sensor.SensorId] = sensor.ValueType
+	}
+
+	result := server.influxDB.GetMultipleTagsData(tags, valueTypes, input.SelectTime, input.DiffTime, input.GroupTime, input.WithQuality)
+	result.Objects = sensors
+
+	response.Response(l, w, result)
+}
+
+func (server *Server) mnemoschemesList(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user, _ := icontext.GetUser(ctx)
+	l, _ := icontext.GetLogger(ctx)
+
+	mnemoschemes, err := server.db.GetMnemoschemes(ctx, user.CompanyID, user.IsSuperUser())
+	if err != nil {
+		response.ErrorResponse(l, w, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+
+	response.Response(l, w, mnemoschemes)
+}
+
+func (server *Server) mnemoschemesSave(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user, _ := icontext.GetUser(ctx)
+	l, _ := icontext.GetLogger(ctx)
+
+	mnemoID, _ := strconv.ParseInt(r.FormValue("mnemoId"), 10, 64)
+	companyID, _ := strconv.ParseInt(r.FormValue("companyId"), 10, 64)
+	l.Errorf("companyID: %d", companyID)
+	l.Errorf("mnemoID: %d", mnemoID)
+
+	model := models.MnemoResult{
+		MnemoId:   mnemoID,
+		CompanyId: companyID,
+		Info:      r.FormValue("info"),
+		Name:      r.FormValue("name"),
+	}
+
+	l.Errorf("Mnemo: %d", model.MnemoId)
+	l.Errorf("Mnemo: %d", model.CompanyId)
+	l.Errorf("Mnemo: %s", model.Info)
+	l.Errorf("Mnemo: %s", model.Name)
+	if mnemoID > 0 {
+		mnemo, err := server.db.GetMnemoscheme(ctx, mnemoID)
+		l.Errorf("Find mnemo ID: %v", err)
+		if err != nil {
+			response.ErrorResponse(l, w, http.StatusUnprocessableEntity, "Mnemo not found", nil)
+			return
+		}
+		model.FileUrl = mnemo.FileUrl
+	}
+
+	err := model.Validate()
+	if err != nil {
+		l.Errorf("validate: %v", err)
+		response.ErrorResponse(l, w, http.StatusUnprocessableEntity, err.Error(), nil)
+		return
+	}
+
+	if user.CompanyID != companyID && !user.IsSuperUser() {
+		response.ErrorResponse(l, w, http.StatusForbidden, "Access denied", nil)
+		return
+	}
+
+	if upload.FileExists(r, "file") {
+		if mnemoID > 0 {
+			tempMnemo, err := server.db.GetMnemoscheme(ctx, mnemoID)
+			if err == nil && len(tempMnemo.FileUrl) > 0 {
+				l.Errorf("FileExists(919): %v", err)
+				_ = upload.RemoveFile(tempMnemo.FileUrl[1:], l)
+			}
+		}
+
+		path := "uploads/" + strconv.FormatInt(user.UserID, 10)
+		fileData, err := upload.UploadFile(r, "file", path, l)
+		if err != nil {
+			l.Errorf("fileData(927): %v", err)
+			fmt.Println("err: ", err.Error())
+			response.ErrorResponse(l, w, 500, "Internal server error", nil)
+			return
+		}
+		model.FileUrl = fileData.Url
+	}
+	//else if mnemoID == 0 {
+	// 	l.Errorf("mnemoID equal 0(934): %v")
+	// 	response.ErrorResponse(l, w, http.StatusUnprocessableEntity, "FILE NOT EXISTS", nil)
+	// 	return
+	// }
+
+	mnemo, err := server.db.SaveMnemoschemes(ctx, model)
+	if err != nil {
+		l.Errorf("Save Mnemoschemes(940): %v", err)
+		response.ErrorResponse(l, w, http.StatusUnprocessableEntity, err.Error(), nil)
+		return
+	}
+
+	response.Response(l, w, mnemo)
+}
+
+func (server *Server) mnemoschemesData(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l, _ := icontext.GetLogger(ctx)
+
+	input := struct {
+		SensorIDs []string `json:"sensorIds"`
+	}{}
+	err := utils.ParseJson(r, &input)
+	if err != nil {
+		fmt.Println(err.Error())
+		response.ErrorResponse(l, w, http.StatusInternalServerError, "Parse error", nil)
+		return
+	}
+
+	if len(input.SensorIDs) == 0 {
+		response.ErrorResponse(l, w, http.StatusUnprocessableEntity, "Empty sensorIds", nil)
+		return
+	}
+
+	latestSensorDatas := server.db.GetLatestSensorValues(ctx, server.influxDB, input.SensorIDs)
+	response.Response(l, w, latestSensorDatas)
+}
+
+func (server *Server) mnemoschemesInfoSave(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user, _ := icontext.GetUser(ctx)
+	l, _ := icontext.GetLogger(ctx)
+
+	input := struct {
+		MnemoID   int64  `json:"mnemo_id"`
+		CompanyID int64  `json:"company_id"`
+		Info      string `json:"info"`
+	}{}
+	err := utils.ParseJson(r, &input)
+	if err != nil {
+		response.ErrorResponse(l, w, http.StatusInternalServerError, "Internal server error", nil)
+		return
+	}
+
+	if user.CompanyID != input.CompanyID && !user.IsSuperUser() {
+		response.ErrorResponse(l, w, http.StatusForbidden, "Access denied", nil)
+		return
+	}
+
+	mnemo, err := server.db.SaveMnemoschemeInfo(ctx, input.MnemoID, input.Info)
+	if err != nil {
+		response.ErrorResponse(l, w, http.StatusUnprocessableEntity, err.Error(), nil)
+		return
+	}
+
+	response.Response(l, w, mnemo)
+}
+
+func (server *Server) alarmsList(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l, _ := icontext.GetLogger(ctx)
+	user, _ := icontext.GetUser(ctx)
+
+	filter, err := parseAlarmFilter(r)
+	if err != nil {
+		response.ErrorResponse(l, w, http.StatusUnprocessableEntity, err.Error(), nil)
+		return
+	}
+
+	if err := filter.Validate(); err != nil {
+		response.ErrorResponse(l, w, http.StatusUnprocessableEntity, err.Error(), nil)
+		return
+	}
+
+	alarms, nextCursor, err := server.db.GetAlarms(ctx, user.CompanyID, user.IsSuperUser(), filter)
+	if err != nil {
+		if err == database.InvalidCursor {
+			response.ErrorResponse(l, w, http.StatusUnprocessableEntity, err.Error(), nil)
+			return
+		}
+
+		l.Errorf("%v", err)
+		response.ErrorResponse(l, w, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+
+	counts, err := server.db.CountAlarmsByState(ctx, user.CompanyID, user.IsSuperUser(), filter)
+	if err != nil {
+		l.Errorf("%v", err)
+		response.ErrorResponse(l, w, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+
+	total := int64(0)
+	for state, count := range counts {
+		if filter.State == "" || filter.State == state {
+			total += count
+		}
+	}
+
+	response.Response(l, w, models.AlarmListResult{
+		Alarms:     alarms,
+		Total:      total,
+		Counts:     counts,
+		NextCursor: nextCursor,
+	})
+}
+
+// parseAlarmFilter - reads /alarms/list filters from the query string.
+func parseAlarmFilter(r *http.Request) (*models.AlarmFilter, error) {
+	keys := r.URL.Query()
+	filter := &models.AlarmFilter{
+		ControllerID: keys.Get("controllerId"),
+		SensorID:     keys.Get("sensorId"),
+		AlarmType:    keys.Get("alarmType"),
+		State:        keys.Get("state"),
+		Sort:         keys.Get("sort"),
+		Order:        keys.Get("order"),
+		Limit:        models.AlarmListDefaultLimit,
+		Cursor:       keys.Get("cursor"),
+	}
+
+	var err error
+	if value := keys.Get("oilFieldId"); value != "" {
+		if filter.OilFieldID, err = strconv.ParseInt(value, 10, 64); err != nil {
+			return nil, fmt.Errorf("oilFieldId must be a number")
+		}
+	}
+	if value := keys.Get("from"); value != "" {
+		if filter.From, err = strconv.ParseInt(value, 10, 64); err != nil {
+			return nil, fmt.Errorf("from must be a unix timestamp")
+		}
+	}
+	if value := keys.Get("to"); value != "" {
+		if filter.To, err = strconv.ParseInt(value, 10, 64); err != nil {
+			return nil, fmt.Errorf("to must be a unix timestamp")
+		}
+	}
+	if value := keys.Get("limit"); value != "" {
+		if filter.Limit, err = strconv.Atoi(value); err != nil {
+			return nil, fmt.Errorf("limit must be a number")
+		}
+	}
+	if value := keys.Get("isActive"); value != "" {
+		isActive, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("isActive must be true or false")
+		}
+		filter.IsActive = &isActive
+	}
+	if value := keys.Get("isAcked"); value != "" {
+		isAcked, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("isAcked must be true or false")
+		}
+		filter.IsAcked = &isAcked
+	}
+
+	return filter, nil
+}
+
+func (server *Server) alarmsHistory(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l, _ := icontext.GetLogger(ctx)
+	user, _ := icontext.GetUser(ctx)
+
+	keys := r.URL.Query()
+	alarmID, err := strconv.ParseInt(keys.Get("alarmId"), 10, 64)
+	if err != nil {
+		response.ErrorResponse(l, w, http.StatusUnprocessableEntity, "Required alarmId", nil)
+		return
+	}
+
+	alarm, err := server.db.GetAlarm(ctx, alarmID)
+	if err != nil {
+		response.ErrorResponse(l, w, http.StatusNotFound, "Alarm not found", nil)
+		return
+	}
+
+	if !user.IsSuperUser() && alarm.CompanyID != user.CompanyID {
+		response.ErrorResponse(l, w, http.StatusForbidden, "Access denied", nil)
+		return
+	}
+
+	history, err := server.db.GetAlarmHistory(ctx, alarmID)
+	if err != nil {
+		l.Errorf("%v", err)
+		response.ErrorResponse(l, w, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+
+	response.Response(l, w, history)
+}
+
+func (server *Server) alarmsAcknowledge(w http.ResponseWriter, r *http.Request) {
+	server.acknowledgeAlarm(w, r, false)
+}
+
+// alarmsMarkAsViewed - legacy acknowledge, an alarm already acknowledged is answered as it is.
+func (server *Server) alarmsMarkAsViewed(w http.ResponseWriter, r *http.Request) {
+	server.acknowledgeAlarm(w, r, true)
+}
+
+func (server *Server) acknowledgeAlarm(w http.ResponseWriter, r *http.Request, idempotent bool) {
+	ctx := r.Context()
+	l, _ := icontext.GetLogger(ctx)
+	user, _ := icontext.GetUser(ctx)
+
+	input := models.AlarmAck{}
+	err := utils.ParseJson(r, &input)
+	if err != nil {
+		response.ErrorResponse(l, w, http.StatusInternalServerError, "Parse error", nil)
+		return
+	}
+
+	if err := input.Validate(); err != nil {
+		response.ErrorResponse(l, w, http.StatusUnprocessableEntity, err.Error(), nil)
+		return
+	}
+
+	alarm, err := server.db.GetAlarm(ctx, input.AlarmID)
+	if err != nil {
+		response.ErrorResponse(l, w, http.StatusNotFound, "Alarm not found", nil)
+		return
+	}
+
+	if !user.IsSuperUser() && alarm.CompanyID != user.CompanyID {
+		response.ErrorResponse(l, w, http.StatusForbidden, "Access denied", nil)
+		return
+	}
+
+	acked, err := server.db.AcknowledgeAlarm(ctx, input.AlarmID, user.UserID, input.Comment)
+	if err != nil {
+		if err == database.AlarmAlreadyAcked {
+			if idempotent {
+				response.Response(l, w, alarm)
+				return
+			}
+			response.ErrorResponse(l, w, http.StatusUnprocessableEntity, err.Error(), nil)
+			return
+		}
+
+		response.ErrorResponse(l, w, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+
+	server.SendMessageToCompany(ctx, models.MessageTypeAlarm, acked, acked.CompanyID)
+	response.Response(l, w, acked)
+}
+
+func (server *Server) alarmsShelve(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l, _ := icontext.GetLogger(ctx)
+	user, _ := icontext.GetUser(ctx)
+
+	input := models.AlarmShelve{}
+	err := utils.ParseJson(r, &input)
+	if err != nil {
+		response.ErrorResponse(l, w, http.StatusInternalServerError, "Parse error", nil)
+		return
+	}
+
+	if err := input.Validate(); err != nil {
+		response.ErrorResponse(l, w, http.StatusUnprocessableEntity, err.Error(), nil)
+		return
+	}
+
+	alarm, err := server.db.GetAlarm(ctx, input.AlarmID)
+	if err != nil {
+		response.ErrorResponse(l, w, http.StatusNotFound, "Alarm not found", nil)
+		return
+	}
+
+	if !user.IsSuperUser() && alarm.CompanyID != user.CompanyID {
+		response.ErrorResponse(l, w, http.StatusForbidden, "Access denied", nil)
+		return
+	}
+
+	alarm, err = server.db.ShelveAlarm(ctx, input.AlarmID, user.UserID, input.Until, input.Comment)
+	if err != nil {
+		response.ErrorResponse(l, w, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+
+	server.SendMessageToCompany(ctx, models.MessageTypeAlarm, alarm, alarm.CompanyID)
+	response.Response(l, w, alarm)
+}
+
+func (server *Server) alarmsUnshelve(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l, _ := icontext.GetLogger(ctx)
+	user, _ := icontext.GetUser(ctx)
+
+	input := struct {
+		AlarmID int64 `json:"alarmId"`
+	}{}
+	err := utils.ParseJson(r, &input)
+	if err != nil {
+		response.ErrorResponse(l, w, http.StatusInternalServerError, "Parse error", nil)
+		return
+	}
+
+	alarm, err := server.db.GetAlarm(ctx, input.AlarmID)
+	if err != nil {
+		response.ErrorResponse(l, w, http.StatusNotFound, "Alarm not found", nil)
+		return
+	}
+
+	if !user.IsSuperUser() && alarm.CompanyID != user.CompanyID {
+		response.ErrorResponse(l, w, http.StatusForbidden, "Access denied", nil)
+		return
+	}
+
+	alarm, err = server.db.UnshelveAlarm(ctx, input.AlarmID, user.UserID)
+	if err != nil {
+		if err == database.AlarmNotShelved {
+			response.ErrorResponse(l, w, http.StatusUnprocessableEntity, err.Error(), nil)
+			return
+		}
+
+		response.ErrorResponse(l, w, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+
+	server.SendMessageToCompany(ctx, models.MessageTypeAlarm, alarm, alarm.CompanyID)
+	response.Response(l, w, alarm)
+}
+
+// analyticsAlarms - ISA-18.2 alarm management KPIs of a company or an oil field over a time range.
+func (server *Server) analyticsAlarms(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l, _ := icontext.GetLogger(ctx)
+	user, _ := icontext.GetUser(ctx)
+
+	keys := r.URL.Query()
+	input := &models.AlarmKPIRequest{Top: models.AlarmKPIDefaultTop}
+	input.CompanyID, _ = strconv.ParseInt(keys.Get("companyId"), 10, 64)
+	input.OilFieldID, _ = strconv.ParseInt(keys.Get("oilFieldId"), 10, 64)
+	input.From, _ = strconv.ParseInt(keys.Get("from"), 10, 64)
+	input.To, _ = strconv.ParseInt(keys.Get("to"), 10, 64)
+	if value := keys.Get("top"); value != "" {
+		input.Top, _ = strconv.Atoi(value)
+	}
+	input.Operators, _ = strconv.Atoi(keys.Get("operators"))
+
+	if !user.IsSuperUser() {
+		input.CompanyID = user.CompanyID
+	}
+
+	if err := input.Validate(); err != nil {
+		response.ErrorResponse(l, w, http.StatusUnprocessableEntity, err.Error(), nil)
+		return
+	}
+
+	if input.OilFieldID > 0 {
+		oilField, err := server.db.GetOilField(ctx, input.OilFieldID)
+		if err != nil {
+			response.ErrorResponse(l, w, http.StatusNotFound, "Oil field not found", nil)
+			return
+		}
+
+		if input.CompanyID > 0 && oilField.CompanyID != input.CompanyID {
+			response.ErrorResponse(l, w, http.StatusForbidden, "Access denied", nil)
+			return
+		}
+	}
+
+	all := user.IsSuperUser() && input.CompanyID == 0
+	if input.Operators == 0 {
+		users, err := server.db.GetUsers(ctx, input.CompanyID, all)
+		if err != nil {
+			l.Errorf("%v", err)
+			response.ErrorResponse(l, w, http.StatusInternalServerError, err.Error(), nil)
+			return
+		}
+		for _, item := range users {
+			if item.Role == models.RoleOperator && !item.IsDeleted {
+				input.Operators++
+			}
+		}
+	}
+
+	settings := models.AlarmKPISettings{
+		FloodCount:     viper.GetInt("AlarmFloodCount"),
+		FloodSeconds:   viper.GetInt64("AlarmFloodMinutes") * 60,
+		ChatterCount:   viper.GetInt("AlarmChatterCount"),
+		ChatterSeconds: viper.GetInt64("AlarmChatterSeconds"),
+		StandingHours:  viper.GetInt64("AlarmStandingHours"),
+	}
+	if settings.FloodSeconds < 1 {
+		settings.FloodSeconds = 1
+	}
+	if settings.ChatterSeconds < 1 {
+		settings.ChatterSeconds = 1
+	}
+
+	annunciations, err := server.db.GetAlarmAnnunciations(ctx, input, all)
+	if err != nil {
+		l.Errorf("%v", err)
+		response.ErrorResponse(l, w, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+
+	acks, err := server.db.GetAlarmAckStats(ctx, input, all)
+	if err != nil {
+		l.Errorf("%v", err)
+		response.ErrorResponse(l, w, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+
+	standing, err := server.db.GetStandingAlarms(ctx, input, all, settings.StandingHours)
+	if err != nil {
+		l.Errorf("%v", err)
+		response.ErrorResponse(l, w, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+
+	response.Response(l, w, models.NewAlarmKPIReport(input, settings, annunciations, acks, standing))
+}
+
+func (server *Server) alarmsEscalations(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l, _ := icontext.GetLogger(ctx)
+	user, _ := icontext.GetUser(ctx)
+
+	keys := r.URL.Query()
+	alarmID, err := strconv.ParseInt(keys.Get("alarmId"), 10, 64)
+	if err != nil {
+		response.ErrorResponse(l, w, http.StatusUnprocessableEntity, "Required alarmId", nil)
+		return
+	}
+
+	alarm, err := server.db.GetAlarm(ctx, alarmID)
+	if err != nil {
+		response.ErrorResponse(l, w, http.StatusNotFound, "Alarm not found", nil)
+		return
+	}
+
+	if !user.IsSuperUser() && alarm.CompanyID != user.CompanyID {
+		response.ErrorResponse(l, w, http.StatusForbidden, "Access denied", nil)
+		return
+	}
+
+	escalations, err := server.db.GetAlarmEscalations(ctx, alarmID)
+	if err != nil {
+		l.Errorf("%v", err)
+		response.ErrorResponse(l, w, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+
+	response.Response(l, w, escalations)
+}
+
+func (server *Server) alarmDedupList(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l, _ := icontext.GetLogger(ctx)
+	user, _ := icontext.GetUser(ctx)
+
+	rules, err := server.db.GetAlarmDedupRules(ctx, user.CompanyID, user.IsSuperUser())
+	if err != nil {
+		l.Errorf("%v", err)
+		response.ErrorResponse(l, w, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+
+	response.Response(l, w, rules)
+}
+
+func (server *Server) alarmDedupSave(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l, _ := icontext.GetLogger(ctx)
+	user, _ := icontext.GetUser(ctx)
+
+	input := models.AlarmDedupRule{}
+	err := utils.ParseJson(r, &input)
+	if err != nil {
+		response.ErrorResponse(l, w, http.StatusInternalServerError, "Parse error", nil)
+		return
+	}
+
+	if !user.IsSuperUser() {
+		input.CompanyID = user.CompanyID
+	}
+
+	if err := input.Validate(); err != nil {
+		response.ErrorResponse(l, w, http.StatusUnprocessableEntity, err.Error(), nil)
+		return
+	}
+
+	if input.SensorID != "" {
+		_, _, companyID, err := server.db.GetSensorOwner(ctx, input.SensorID)
+		if err != nil {
+			response.ErrorResponse(l, w, http.StatusNotFound, "Sensor not found", nil)
+			return
+		}
+
+		if companyID != input.CompanyID {
+			response.ErrorResponse(l, w, http.StatusForbidden, "Access denied", nil)
+			return
+		}
+	}
+
+	rule, err := server.db.SaveAlarmDedupRule(ctx, input)
+	if err != nil {
+		l.Errorf("%v", err)
+		response.ErrorResponse(l, w, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+
+	response.Response(l, w, rule)
+}
+
+func (server *Server) alarmDedupDelete(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l, _ := icontext.GetLogger(ctx)
+	user, _ := icontext.GetUser(ctx)
+	input := struct {
+		RuleID int64 `json:"ruleId"`
+	}{}
+	err := utils.ParseJson(r, &input)
+	if err != nil {
+		response.ErrorResponse(l, w, http.StatusInternalServerError, "Parse error", nil)
+		return
+	}
+
+	existsRule, err := server.db.GetAlarmDedupRule(ctx, input.RuleID)
+	if err != nil {
+		response.ErrorResponse(l, w, http.StatusNotFound, "Rule not found", nil)
+		return
+	}
+
+	if !user.IsSuperUser() && existsRule.CompanyID != user.CompanyID {
+		response.ErrorResponse(l, w, http.StatusForbidden, "Access denied", nil)
+		return
+	}
+
+	if err := server.db.DeleteAlarmDedupRule(ctx, input.RuleID); err != nil {
+		l.Errorf("%v", err)
+		response.ErrorResponse(l, w, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+
+	response.Response(l, w, existsRule)
+}
+
+func (server *Server) escalationPoliciesList(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l, _ := icontext.GetLogger(ctx)
+	user, _ := icontext.GetUser(ctx)
+
+	policies, err := server.db.GetEscalationPolicies(ctx, user.CompanyID, user.IsSuperUser())
+	if err != nil {
+		l.Errorf("%v", err)
+		response.ErrorResponse(l, w, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+
+	response.Response(l, w, policies)
+}
+
+func (server *Server) escalationPoliciesSave(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l, _ := icontext.GetLogger(ctx)
+	user, _ := icontext.GetUser(ctx)
+
+	input := models.EscalationPolicy{}
+	err := utils.ParseJson(r, &input)
+	if err != nil {
+		response.ErrorResponse(l, w, http.StatusInternalServerError, "Parse error", nil)
+		return
+	}
+
+	if !user.IsSuperUser() {
+		input.CompanyID = user.CompanyID
+	}
+
+	if err := input.Validate(); err != nil {
+		response.ErrorResponse(l, w, http.StatusUnprocessableEntity, err.Error(), nil)
+		return
+	}
+
+	if input.PolicyID > 0 {
+		existsPolicy, err := server.db.GetEscalationPolicyByID(ctx, input.PolicyID)
+		if err != nil {
+			response.ErrorResponse(l, w, http.StatusNotFound, "Policy not found", nil)
+			return
+		}
+
+		if !user.IsSuperUser() && existsPolicy.CompanyID != user.CompanyID {
+			response.ErrorResponse(l, w, http.StatusForbidden, "Access denied", nil)
+			return
+		}
+	}
+
+	if input.OilFieldID > 0 {
+		oilField, err := server.db.GetOilField(ctx, input.OilFieldID)
+		if err != nil {
+			response.ErrorResponse(l, w, http.StatusNotFound, "Oil field not found", nil)
+			return
+		}
+
+		if oilField.CompanyID != input.CompanyID {
+			response.ErrorResponse(l, w, http.StatusForbidden, "Access denied", nil)
+			return
+		}
+	}
+
+	for _, step := range input.Steps {
+		if step.ScheduleID == 0 {
+			continue
+		}
+
+		schedule, err := server.db.GetOnCallSchedule(ctx, step.ScheduleID)
+		if err != nil {
+			response.ErrorResponse(l, w, http.StatusNotFound, "Schedule not found", nil)
+			return
+		}
+
+		if schedule.CompanyID != input.CompanyID {
+			response.ErrorResponse(l, w, http.StatusForbidden, "Access denied", nil)
+			return
+		}
+	}
+
+	policy, err := server.db.SaveEscalationPolicy(ctx, input)
+	if err != nil {
+		l.Errorf("%v", err)
+		response.ErrorResponse(l, w, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+
+	response.Response(l, w, policy)
+}
+
+func (server *Server) escalationPoliciesDelete(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l, _ := icontext.GetLogger(ctx)
+	user, _ := icontext.GetUser(ctx)
+	input := struct {
+		PolicyID int64 `json:"policyId"`
+	}{}
+	err := utils.ParseJson(r, &input)
+	if err != nil {
+		response.ErrorResponse(l, w, http.StatusInternalServerError, "Parse error", nil)
+		return
+	}
+
+	existsPolicy, err := server.db.GetEscalationPolicyByID(ctx, input.PolicyID)
+	if err != nil {
+		response.ErrorResponse(l, w, http.StatusNotFound, "Policy not found", nil)
+		return
+	}
+
+	if !user.IsSuperUser() && existsPolicy.CompanyID != user.CompanyID {
+		response.ErrorResponse(l, w, http.StatusForbidden, "Access denied", nil)
+		return
+	}
+
+	if err := server.db.DeleteEscalationPolicy(ctx, input.PolicyID); err != nil {
+		l.Errorf("%v", err)
+		response.ErrorResponse(l, w, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+
+	response.Response(l, w, existsPolicy)
+}
+
+func (server *Server) escalationSchedulesList(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l, _ := icontext.GetLogger(ctx)
+	user, _ := icontext.GetUser(ctx)
+
+	schedules, err := server.db.GetOnCallSchedules(ctx, user.CompanyID, user.IsSuperUser())
+	if err != nil {
+		l.Errorf("%v", err)
+		response.ErrorResponse(l, w, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+
+	response.Response(l, w, schedules)
+}
+
+func (server *Server) escalationSchedulesSave(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l, _ := icontext.GetLogger(ctx)
+	user, _ := icontext.GetUser(ctx)
+
+	input := models.OnCallSchedule{}
+	err := utils.ParseJson(r, &input)
+	if err != nil {
+		response.ErrorResponse(l, w, http.StatusInternalServerError, "Parse error", nil)
+		return
+	}
+
+	if !user.IsSuperUser() {
+		input.CompanyID = user.CompanyID
+	}
+
+	if err := input.Validate(); err != nil {
+		response.ErrorResponse(l, w, http.StatusUnprocessableEntity, err.Error(), nil)
+		return
+	}
+
+	if input.ScheduleID > 0 {
+		existsSchedule, err := server.db.GetOnCallSchedule(ctx, input.ScheduleID)
+		if err != nil {
+			response.ErrorResponse(l, w, http.StatusNotFound, "Schedule not found", nil)
+			return
+		}
+
+		if !user.IsSuperUser() && existsSchedule.CompanyID != user.CompanyID {
+			response.ErrorResponse(l, w, http.StatusForbidden, "Access denied", nil)
+			return
+		}
+	}
+
+	for _, userID := range input.UserIDs {
+		scheduleUser, err := server.db.GetUser(ctx, userID)
+		if err != nil {
+			response.ErrorResponse(l, w, http.StatusNotFound, "User not found", nil)
+			return
+		}
+
+		if scheduleUser.CompanyID != input.CompanyID {
+			response.ErrorResponse(l, w, http.StatusForbidden, "Access denied", nil)
+			return
+		}
+	}
+
+	schedule, err := server.db.SaveOnCallSchedule(ctx, input)
+	if err != nil {
+		l.Errorf("%v", err)
+		response.ErrorResponse(l, w, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+
+	response.Response(l, w, schedule)
+}
+
+func (server *Server) escalationSchedulesDelete(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l, _ := icontext.GetLogger(ctx)
+	user, _ := icontext.GetUser(ctx)
+	input := struct {
+		ScheduleID int64 `json:"scheduleId"`
+	}{}
+	err := utils.ParseJson(r, &input)
+	if err != nil {
+		response.ErrorResponse(l, w, http.StatusInternalServerError, "Parse error", nil)
+		return
+	}
+
+	existsSchedule, err := server.db.GetOnCallSchedule(ctx, input.ScheduleID)
+	if err != nil {
+		response.ErrorResponse(l, w, http.StatusNotFound, "Schedule not found", nil)
+		return
+	}
+
+	if !user.IsSuperUser() && existsSchedule.CompanyID != user.CompanyID {
+		response.ErrorResponse(l, w, http.StatusForbidden, "Access denied", nil)
+		return
+	}
+
+	if err := server.db.DeleteOnCallSchedule(ctx, input.ScheduleID); err != nil {
+		l.Errorf("%v", err)
+		response.ErrorResponse(l, w, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+
+	response.Response(l, w, existsSchedule)
+}
+
+func (server *Server) maintenanceList(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l, _ := icontext.GetLogger(ctx)
+	user, _ := icontext.GetUser(ctx)
+
+	keys := r.URL.Query()
+	var oilFieldID int64
+	if keys.Get("oilFieldId") != "" {
+		var err error
+		oilFieldID, err = strconv.ParseInt(keys.Get("oilFieldId"), 10, 64)
+		if err != nil {
+			response.ErrorResponse(l, w, http.StatusUnprocessableEntity, "oilFieldId must be a number", nil)
+			return
+		}
+	}
+	openOnly := keys.Get("open") == "true"
+
+	windows, err := server.db.GetMaintenanceWindows(ctx, user.CompanyID, user.IsSuperUser(), oilFieldID, openOnly)
+	if err != nil {
+		l.Errorf("%v", err)
+		response.ErrorResponse(l, w, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+
+	response.Response(l, w, windows)
+}
+
+func (server *Server) maintenanceSave(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l, _ := icontext.GetLogger(ctx)
+	user, _ := icontext.GetUser(ctx)
+
+	input := models.MaintenanceWindow{}
+	err := utils.ParseJson(r, &input)
+	if err != nil {
+		response.ErrorResponse(l, w, http.StatusInternalServerError, "Parse error", nil)
+		return
+	}
+
+	// ad-hoc window starts right away
+	if input.StartTs == 0 {
+		input.StartTs = time.Now().Unix()
+	}
+
+	if err := input.Validate(); err != nil {
+		response.ErrorResponse(l, w, http.StatusUnprocessableEntity, err.Error(), nil)
+		return
+	}
+
+	oilField, err := server.db.GetOilField(ctx, input.OilFieldID)
+	if err != nil {
+		response.ErrorResponse(l, w, http.StatusNotFound, "Oil field not found", nil)
+		return
+	}
+
+	if !user.IsSuperUser() && oilField.CompanyID != user.CompanyID {
+		response.ErrorResponse(l, w, http.StatusForbidden, "Access denied", nil)
+		return
+	}
+
+	if input.WindowID > 0 {
+		existsWindow, err := server.db.GetMaintenanceWindow(ctx, input.WindowID)
+		if err != nil {
+			response.ErrorResponse(l, w, http.StatusNotFound, "Maintenance window not found", nil)
+			return
+		}
+
+		if !user.IsSuperUser() && existsWindow.CompanyID != user.CompanyID {
+			response.ErrorResponse(l, w, http.StatusForbidden, "Access denied", nil)
+			return
+		}
+
+		if existsWindow.IsClosed {
+			response.ErrorResponse(l, w, http.StatusUnprocessableEntity, "Maintenance window is closed", nil)
+			return
+		}
+	} else {
+		input.OwnerID = user.UserID
+	}
+
+	window, err := server.db.SaveMaintenanceWindow(ctx, input)
+	if err != nil {
+		l.Errorf("%v", err)
+		response.ErrorResponse(l, w, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+
+	response.Response(l, w, window)
+}
+
+func (server *Server) maintenanceEnd(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l, _ := icontext.GetLogger(ctx)
+	user, _ := icontext.GetUser(ctx)
+	input := struct {
+		WindowID int64 `json:"windowId"`
+	}{}
+	err := utils.ParseJson(r, &input)
+	if err != nil {
+		response.ErrorResponse(l, w, http.StatusInternalServerError, "Parse error", nil)
+		return
+	}
+
+	existsWindow, err := server.db.GetMaintenanceWindow(ctx, input.WindowID)
+	if err != nil {
+		response.ErrorResponse(l, w, http.StatusNotFound, "Maintenance window not found", nil)
+		return
+	}
+
+	if !user.IsSuperUser() && existsWindow.CompanyID != user.CompanyID {
+		response.ErrorResponse(l, w, http.StatusForbidden, "Access denied", nil)
+		return
+	}
+
+	if existsWindow.IsClosed {
+		response.ErrorResponse(l, w, http.StatusUnprocessableEntity, "Maintenance window is closed", nil)
+		return
+	}
+
+	if err := server.closeMaintenanceWindow(ctx, input.WindowID); err != nil {
+		l.Errorf("%v", err)
+		response.ErrorResponse(l, w, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+
+	window, err := server.db.GetMaintenanceWindow(ctx, input.WindowID)
+	if err != nil {
+		response.ErrorResponse(l, w, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+
+	response.Response(l, w, window)
+}
+
+func (server *Server) notificationChannelsList(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l, _ := icontext.GetLogger(ctx)
+	user, _ := icontext.GetUser(ctx)
+
+	channels, err := server.db.GetNotificationChannels(ctx, user.CompanyID, user.IsSuperUser())
+	if err != nil {
+		l.Errorf("%v", err)
+		response.ErrorResponse(l, w, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+
+	response.Response(l, w, channels)
+}
+
+func (server *Server) notificationChannelsSave(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l, _ := icontext.GetLogger(ctx)
+	user, _ := icontext.GetUser(ctx)
+
+	input := models.NotificationChannel{}
+	err := utils.ParseJson(r, &input)
+	if err != nil {
+		response.ErrorResponse(l, w, http.StatusInternalServerError, "Parse error", nil)
+		return
+	}
+
+	if !user.IsSuperUser() {
+		input.CompanyID = user.CompanyID
+	}
+
+	if err := input.Validate(); err != nil {
+		response.ErrorResponse(l, w, http.StatusUnprocessableEntity, err.Error(), nil)
+		return
+	}
+
+	if _, err := notify.NewSender(&input); err != nil {
+		response.ErrorResponse(l, w, http.StatusUnprocessableEntity, err.Error(), nil)
+		return
+	}
+
+	if input.ChannelID > 0 {
+		existsChannel, err := server.db.GetNotificationChannel(ctx, input.ChannelID)
+		if err != nil {
+			response.ErrorResponse(l, w, http.StatusNotFound, "Channel not found", nil)
+			return
+		}
+
+		if !user.IsSuperUser() && existsChannel.CompanyID != user.CompanyID {
+			response.ErrorResponse(l, w, http.StatusForbidden, "Access denied", nil)
+			return
+		}
+	}
+
+	channel, err := server.db.SaveNotificationChannel(ctx, input)
+	if err != nil {
+		l.Errorf("%v", err)
+		response.ErrorResponse(l, w, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+
+	response.Response(l, w, channel)
+}
+
+func (server *Server) notificationSubscriptionsList(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l, _ := icontext.GetLogger(ctx)
+	user, _ := icontext.GetUser(ctx)
+
+	subscriptions, err := server.db.GetUserSubscriptions(ctx, user.UserID)
+	if err != nil {
+		l.Errorf("%v", err)
+		response.ErrorResponse(l, w, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+
+	response.Response(l, w, subscriptions)
+}
+
+func (server *Server) notificationSubscriptionsSave(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l, _ := icontext.GetLogger(ctx)
+	user, _ := icontext.GetUser(ctx)
+
+	input := models.NotificationSubscription{}
+	err := utils.ParseJson(r, &input)
+	if err != nil {
+		response.ErrorResponse(l, w, http.StatusInternalServerError, "Parse error", nil)
+		return
+	}
+
+	if err := input.Validate(); err != nil {
+		response.ErrorResponse(l, w, http.StatusUnprocessableEntity, err.Error(), nil)
+		return
+	}
+
+	channel, err := server.db.GetNotificationChannel(ctx, input.ChannelID)
+	if err != nil {
+		response.ErrorResponse(l, w, http.StatusNotFound, "Channel not found", nil)
+		return
+	}
+
+	if channel.CompanyID != user.CompanyID {
+		response.ErrorResponse(l, w, http.StatusForbidden, "Access denied", nil)
+		return
+	}
+
+	if err := notify.ValidateAddress(channel, input.Address); err != nil {
+		response.ErrorResponse(l, w, http.StatusUnprocessableEntity, err.Error(), nil)
+		return
+	}
+
+	if input.SubscriptionID > 0 {
+		existsSubscription, err := server.db.GetSubscription(ctx, input.SubscriptionID)
+		if err != nil {
+			response.ErrorResponse(l, w, http.StatusNotFound, "Subscription not found", nil)
+			return
+		}
+
+		if existsSubscription.UserID != user.UserID {
+			response.ErrorResponse(l, w, http.StatusForbidden, "Access denied", nil)
+			return
+		}
+	}
+	input.UserID = user.UserID
+
+	subscription, err := server.db.SaveSubscription(ctx, input)
+	if err != nil {
+		l.Errorf("%v", err)
+		response.ErrorResponse(l, w, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+
+	response.Response(l, w, subscription)
+}
+
+func (server *Server) notificationSubscriptionsDelete(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l, _ := icontext.GetLogger(ctx)
+	user, _ := icontext.GetUser(ctx)
+	input := struct {
+		SubscriptionID int64 `json:"subscriptionId"`
+	}{}
+	err := utils.ParseJson(r, &input)
+	if err != nil {
+		response.ErrorResponse(l, w, http.StatusInternalServerError, "Parse error", nil)
+		return
+	}
+
+	existsSubscription, err := server.db.GetSubscription(ctx, input.SubscriptionID)
+	if err != nil {
+		response.ErrorResponse(l, w, http.StatusNotFound, "Subscription not found", nil)
+		return
+	}
+
+	if existsSubscription.UserID != user.UserID {
+		response.ErrorResponse(l, w, http.StatusForbidden, "Access denied", nil)
+		return
+	}
+
+	if err := server.db.DeleteSubscription(ctx, input.SubscriptionID); err != nil {
+		l.Errorf("%v", err)
+		response.ErrorResponse(l, w, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+
+	response.Response(l, w, nil)
+}
+
+func (server *Server) notificationDeliveriesList(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l, _ := icontext.GetLogger(ctx)
+	user, _ := icontext.GetUser(ctx)
+
+	keys := r.URL.Query()
+	var alarmID int64
+	if keys.Get("alarmId") != "" {
+		var err error
+		alarmID, err = strconv.ParseInt(keys.Get("alarmId"), 10, 64)
+		if err != nil {
+			response.ErrorResponse(l, w, http.StatusUnprocessableEntity, "alarmId must be a number", nil)
+			return
+		}
+	}
+
+	limit := models.AlarmListDefaultLimit
+	if keys.Get("limit") != "" {
+		var err error
+		limit, err = strconv.Atoi(keys.Get("limit"))
+		if err != nil || limit < 1 || limit > models.AlarmListMaxLimit {
+			response.ErrorResponse(l, w, http.StatusUnprocessableEntity, fmt.Sprintf("limit must be between 1 and %d", models.AlarmListMaxLimit), nil)
+			return
+		}
+	}
+
+	deliveries, err := server.db.GetNotificationDeliveries(ctx, user.CompanyID, user.IsSuperUser(), alarmID, limit)
+	if err != nil {
+		l.Errorf("%v", err)
+		response.ErrorResponse(l, w, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+
+	response.Response(l, w, deliveries)
+}
+
+func (server *Server) sensorsAlarmSettings(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l, _ := icontext.GetLogger(ctx)
+	user, _ := icontext.GetUser(ctx)
+
+	sensorID := r.URL.Query().Get("sensorId")
+	if sensorID == "" {
+		response.ErrorResponse(l, w, http.StatusUnprocessableEntity, "Required sensorId", nil)
+		return
+	}
+
+	controllerID, oilFieldID, companyID, err := server.db.GetSensorOwner(ctx, sensorID)
+	if err != nil {
+		response.ErrorResponse(l, w, http.StatusNotFound, "Sensor not found", nil)
+		return
+	}
+
+	if !user.IsSuperUser() && companyID != user.CompanyID {
+		response.ErrorResponse(l, w, http.StatusForbidden, "Access denied", nil)
+		return
+	}
+
+	settings, err := server.db.GetSensorAlarmSetting(ctx, sensorID)
+	if err == sql.ErrNoRows {
+		settings = &models.SensorAlarmSettings{
+			SensorID:     sensorID,
+			ControllerID: controllerID,
+			OilFieldID:   oilFieldID,
+		}
+	} else if err != nil {
+		l.Errorf("%v", err)
+		response.ErrorResponse(l, w, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+
+	response.Response(l, w, settings)
+}
+
+func (server *Server) sensorsAlarmSettingsSave(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l, _ := icontext.GetLogger(ctx)
+	user, _ := icontext.GetUser(ctx)
+
+	input := models.SensorAlarmSettings{}
+	err := utils.ParseJson(r, &input)
+	if err != nil {
+		response.ErrorResponse(l, w, http.StatusInternalServerError, "Parse error", nil)
+		return
+	}
+
+	if err := input.Validate(); err != nil {
+		response.ErrorResponse(l, w, http.StatusUnprocessableEntity, err.Error(), nil)
+		return
+	}
+
+	controllerID, oilFieldID, companyID, err := server.db.GetSensorOwner(ctx, input.SensorID)
+	if err != nil {
+		response.ErrorResponse(l, w, http.StatusNotFound, "Sensor not found", nil)
+		return
+	}
+
+	if !user.IsSuperUser() && companyID != user.CompanyID {
+		response.ErrorResponse(l, w, http.StatusForbidden, "Access denied", nil)
+		return
+	}
+
+	if input.DeviationSensorID != "" {
+		if input.DeviationSensorID == input.SensorID {
+			response.ErrorResponse(l, w, http.StatusUnprocessableEntity, "deviationSensorId must differ from sensorId", nil)
+			return
+		}
+
+		_, _, deviationCompanyID, err := server.db.GetSensorOwner(ctx, input.DeviationSensorID)
+		if err != nil {
+			response.ErrorResponse(l, w, http.StatusNotFound, "Deviation sensor not found", nil)
+			return
+		}
+
+		if deviationCompanyID != companyID {
+			response.ErrorResponse(l, w, http.StatusForbidden, "Access denied", nil)
+			return
+		}
+	}
+
+	input.ControllerID = controllerID
+	input.OilFieldID = oilFieldID
+
+	settings, err := server.db.SaveSensorAlarmSettings(ctx, input)
+	if err != nil {
+		l.Errorf("%v", err)
+		response.ErrorResponse(l, w, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	server.alarmEngine.ReloadSettings()
+
+	response.Response(l, w, settings)
+}
+
+// sensorsSave - edits the settings of a sensor in the cloud and sends them to its oil field.
+func (server *Server) sensorsSave(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l, _ := icontext.GetLogger(ctx)
+	user, _ := icontext.GetUser(ctx)
+
+	input := models.SensorConfig{}
+	err := utils.ParseJson(r, &input)
+	if err != nil {
+		response.ErrorResponse(l, w, http.StatusInternalServerError, "Parse error", nil)
+		return
+	}
+
+	if err := input.Validate(); err != nil {
+		response.ErrorResponse(l, w, http.StatusUnprocessableEntity, err.Error(), nil)
+		return
+	}
+
+	_, oilFieldID, companyID, err := server.db.GetSensorOwner(ctx, input.SensorID)
+	if err != nil {
+		response.ErrorResponse(l, w, http.StatusNotFound, "Sensor not found", nil)
+		return
+	}
+
+	if !user.IsSuperUser() && companyID != user.CompanyID {
+		response.ErrorResponse(l, w, http.StatusForbidden, "Access denied", nil)
+		return
+	}
+
+	change, err := server.db.SaveSensorConfig(ctx, input, oilFieldID, user.UserID)
+	if err == database.NotFound {
+		response.ErrorResponse(l, w, http.StatusNotFound, "Sensor not found", nil)
+		return
+	}
+	if err == database.ConfigOutdated {
+		response.ErrorResponse(l, w, http.StatusUnprocessableEntity, "Sensor was changed since it was read", nil)
+		return
+	}
+	if err != nil {
+		l.Errorf("%v", err)
+		response.ErrorResponse(l, w, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+
+	server.sendConfigChange(ctx, change)
+	response.Response(l, w, change)
+}
+
+// controllersSave - edits the settings of a controller in the cloud and sends them to its oil field.
+func (server *Server) controllersSave(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l, _ := icontext.GetLogger(ctx)
+	user, _ := icontext.GetUser(ctx)
+
+	input := models.ControllerConfig{}
+	err := utils.ParseJson(r, &input)
+	if err != nil {
+		response.ErrorResponse(l, w, http.StatusInternalServerError, "Parse error", nil)
+		return
+	}
+
+	if err := input.Validate(); err != nil {
+		response.ErrorResponse(l, w, http.StatusUnprocessableEntity, err.Error(), nil)
+		return
+	}
+
+	controller, err := server.db.GetController(ctx, input.ControllerID)
+	if err != nil {
+		response.ErrorResponse(l, w, http.StatusNotFound, "Controller not found", nil)
+		return
+	}
+
+	oilField, err := server.db.GetOilField(ctx, controller.OilFieldId)
+	if err != nil {
+		response.ErrorResponse(l, w, http.StatusNotFound, "Oil field not found", nil)
+		return
+	}
+
+	if !user.IsSuperUser() && oilField.CompanyID != user.CompanyID {
+		response.ErrorResponse(l, w, http.StatusForbidden, "Access denied", nil)
+		return
+	}
+
+	change, err := server.db.SaveControllerConfig(ctx, input, oilField.OilFieldId, user.UserID)
+	if err == database.NotFound {
+		response.ErrorResponse(l, w, http.StatusNotFound, "Controller not found", nil)
+		return
+	}
+	if err == database.ConfigOutdated {
+		response.ErrorResponse(l, w, http.StatusUnprocessableEntity, "Controller was changed since it was read", nil)
+		return
+	}
+	if err != nil {
+		l.Errorf("%v", err)
+		response.ErrorResponse(l, w, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+
+	server.sendConfigChange(ctx, change)
+	response.Response(l, w, change)
+}
+
+func (server *Server) configChangesList(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l, _ := icontext.GetLogger(ctx)
+	user, _ := icontext.GetUser(ctx)
+
+	keys := r.URL.Query()
+	oilFieldID, _ := strconv.ParseInt(keys.Get("oilFieldId"), 10, 64)
+
+	changes, err := server.db.GetConfigChanges(ctx, user.CompanyID, user.IsSuperUser(), oilFieldID, keys.Get("status"))
+	if err != nil {
+		l.Errorf("%v", err)
+		response.ErrorResponse(l, w, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+
+	response.Response(l, w, changes)
+}
+
+func (server *Server) commandsList(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l, _ := icontext.GetLogger(ctx)
+	user, _ := icontext.GetUser(ctx)
+
+	keys := r.URL.Query()
+	oilFieldID, _ := strconv.ParseInt(keys.Get("oilFieldId"), 10, 64)
+
+	commands, err := server.db.GetCommands(ctx, user.CompanyID, user.IsSuperUser(), oilFieldID, keys.Get("status"))
+	if err != nil {
+		l.Errorf("%v", err)
+		response.ErrorResponse(l, w, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+
+	response.Response(l, w, commands)
+}
+
+// commandsSend - issues a write to a sensor of a field controller. A command to a critical sensor waits for the
+// approval of another user, the others are sent right away.
+func (server *Server) commandsSend(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l, _ := icontext.GetLogger(ctx)
+	user, _ := icontext.GetUser(ctx)
+
+	input := struct {
+		SensorID      string   `json:"sensorId"`
+		Action        string   `json:"action"`
+		Value         float32  `json:"value"`
+		ExpectedValue *float32 `json:"expectedValue"`
+		Tolerance     float32  `json:"tolerance"`
+		Timeout       int64    `json:"timeout"`
+		Comment       string   `json:"comment"`
+	}{}
+	err := utils.ParseJson(r, &input)
+	if err != nil {
+		response.ErrorResponse(l, w, http.StatusInternalServerError, "Parse error", nil)
+		return
+	}
+
+	command := models.Command{
+		SensorID:  input.SensorID,
+		Action:    input.Action,
+		Value:     input.Value,
+		Tolerance: input.Tolerance,
+		Timeout:   input.Timeout,
+		Comment:   input.Comment,
+		IssuedBy:  user.UserID,
+	}
+	if err := command.Validate(); err != nil {
+		response.ErrorResponse(l, w, http.StatusUnprocessableEntity, err.Error(), nil)
+		return
+	}
+	command.Normalize(input.ExpectedValue)
+	if command.Timeout == 0 {
+		command.Timeout = viper.GetInt64("CommandTimeout")
+	}
+
+	_, controllerID, oilFieldID, companyID, isCritical, err := server.db.GetCommandTarget(ctx, command.SensorID)
+	if err != nil {
+		response.ErrorResponse(l, w, http.StatusNotFound, "Sensor not found", nil)
+		return
+	}
+
+	if !user.IsSuperUser() && companyID != user.CompanyID {
+		response.ErrorResponse(l, w, http.StatusForbidden, "Access denied", nil)
+		return
+	}
+
+	command.ControllerID = controllerID
+	command.OilFieldID = oilFieldID
+	command.Status = models.COMMAND_STATUS_SENT
+	command.SentTs = time.Now().Unix()
+	if isCritical {
+		command.Status = models.COMMAND_STATUS_AWAITING_APPROVAL
+		command.SentTs = 0
+	}
+
+	created, err := server.db.CreateCommand(ctx, command)
 	if err != nil {
+		l.Errorf("%v", err)
 		response.ErrorResponse(l, w, http.StatusInternalServerError, err.Error(), nil)
 		return
 	}
 
-	response.Response(l, w, actions)
+	l.Infof("Command %d to %s issued by user %d", created.CommandID, created.SensorID, user.UserID)
+	if isCritical {
+		server.SendMessageToCompany(ctx, models.MessageTypeCommand, created, created.CompanyID)
+	} else {
+		server.sendCommand(ctx, created)
+	}
+
+	server.commandResponse(w, r, created.CommandID)
 }
 
-func (server *Server) markAlarmViewed(w http.ResponseWriter, r *http.Request) {
+// commandsApprove - a second user approves the command to a critical sensor, it is sent right away.
+func (server *Server) commandsApprove(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	l, _ := icontext.GetLogger(ctx)
+	user, _ := icontext.GetUser(ctx)
+
 	input := struct {
-		AlarmID int64 `json:"alarmId"`
+		CommandID int64 `json:"commandId"`
 	}{}
 	err := utils.ParseJson(r, &input)
 	if err != nil {
-		fmt.Println(err.Error())
 		response.ErrorResponse(l, w, http.StatusInternalServerError, "Parse error", nil)
 		return
 	}
 
-	alarm, err := server.db.MarkAlarmAsViewed(ctx, input.AlarmID)
+	command, err := server.db.GetCommand(ctx, input.CommandID)
+	if err != nil {
+		response.ErrorResponse(l, w, http.StatusNotFound, "Command not found", nil)
+		return
+	}
+
+	if !user.IsSuperUser() && command.CompanyID != user.CompanyID {
+		response.ErrorResponse(l, w, http.StatusForbidden, "Access denied", nil)
+		return
+	}
+
+	if command.IssuedBy == user.UserID {
+		response.ErrorResponse(l, w, http.StatusUnprocessableEntity, "The command must be approved by another user", nil)
+		return
+	}
+
+	approved, err := server.db.ApproveCommand(ctx, command.CommandID, user.UserID)
 	if err != nil {
+		l.Errorf("%v", err)
 		response.ErrorResponse(l, w, http.StatusInternalServerError, err.Error(), nil)
 		return
 	}
+	if !approved {
+		response.ErrorResponse(l, w, http.StatusUnprocessableEntity, "Command is not awaiting approval", nil)
+		return
+	}
 
-	response.Response(l, w, alarm)
+	command, err = server.db.GetCommand(ctx, command.CommandID)
+	if err != nil {
+		l.Errorf("%v", err)
+		response.ErrorResponse(l, w, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+
+	l.Infof("Command %d approved by user %d", command.CommandID, user.UserID)
+	server.sendCommand(ctx, command)
+	server.commandResponse(w, r, command.CommandID)
+}
+
+// commandsReject - a second user refuses the command to a critical sensor.
+func (server *Server) commandsReject(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l, _ := icontext.GetLogger(ctx)
+	user, _ := icontext.GetUser(ctx)
+
+	input := struct {
+		CommandID int64  `json:"commandId"`
+		Reason    string `json:"reason"`
+	}{}
+	err := utils.ParseJson(r, &input)
+	if err != nil {
+		response.ErrorResponse(l, w, http.StatusInternalServerError, "Parse error", nil)
+		return
+	}
+
+	command, err := server.db.GetCommand(ctx, input.CommandID)
+	if err != nil {
+		response.ErrorResponse(l, w, http.StatusNotFound, "Command not found", nil)
+		return
+	}
+
+	if !user.IsSuperUser() && command.CompanyID != user.CompanyID {
+		response.ErrorResponse(l, w, http.StatusForbidden, "Access denied", nil)
+		return
+	}
+
+	rejected, err := server.db.RejectCommand(ctx, command.CommandID, user.UserID, input.Reason)
+	if err != nil {
+		l.Errorf("%v", err)
+		response.ErrorResponse(l, w, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	if !rejected {
+		response.ErrorResponse(l, w, http.StatusUnprocessableEntity, "Command is not awaiting approval", nil)
+		return
+	}
+
+	command, err = server.db.GetCommand(ctx, command.CommandID)
+	if err != nil {
+		l.Errorf("%v", err)
+		response.ErrorResponse(l, w, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+
+	l.Infof("Command %d rejected by user %d", command.CommandID, user.UserID)
+	server.notifyCommand(ctx, command)
+	response.Response(l, w, command)
+}
+
+// commandResponse - responds with the current state of the command.
+func (server *Server) commandResponse(w http.ResponseWriter, r *http.Request, commandID int64) {
+	ctx := r.Context()
+	l, _ := icontext.GetLogger(ctx)
+
+	command, err := server.db.GetCommand(ctx, commandID)
+	if err != nil {
+		l.Errorf("%v", err)
+		response.ErrorResponse(l, w, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+
+	response.Response(l, w, command)
+}
+
+// commandsCritical - marks a sensor whose commands need the approval of a second user.
+func (server *Server) commandsCritical(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l, _ := icontext.GetLogger(ctx)
+	user, _ := icontext.GetUser(ctx)
+
+	input := models.CriticalTag{}
+	err := utils.ParseJson(r, &input)
+	if err != nil {
+		response.ErrorResponse(l, w, http.StatusInternalServerError, "Parse error", nil)
+		return
+	}
+
+	_, _, _, companyID, _, err := server.db.GetCommandTarget(ctx, input.SensorID)
+	if err != nil {
+		response.ErrorResponse(l, w, http.StatusNotFound, "Sensor not found", nil)
+		return
+	}
+
+	if !user.IsSuperUser() && companyID != user.CompanyID {
+		response.ErrorResponse(l, w, http.StatusForbidden, "Access denied", nil)
+		return
+	}
+
+	if err := server.db.SetSensorCritical(ctx, input.SensorID, input.IsCritical); err != nil {
+		l.Errorf("%v", err)
+		response.ErrorResponse(l, w, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+
+	response.Response(l, w, input)
+}
+
+func (server *Server) sensorsList(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l, _ := icontext.GetLogger(ctx)
+	user, _ := icontext.GetUser(ctx)
+	input := models.SensorResult{}
+
+	oilFields, err := server.db.GetOilFieldCheckingUser(ctx, user.CompanyID, user.IsSuperUser())
+
+	if err != nil {
+		response.ErrorResponse(l, w, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+
+	oilFieldID := make([]int64, 0, 10)
+
+	for _, value := range oilFields {
+		oilFieldID = append(oilFieldID, value.OilFieldId)
+	}
+
+	if oilFieldID == nil {
+		response.ErrorResponse(l, w, http.StatusUnprocessableEntity, "oilfieldID Empty", nil)
+		return
+	}
+
+	controllers, err := server.db.GetControllersArrayInputParam(ctx, oilFieldID, input.SensorId)
+	if err != nil {
+		l.Errorf("%v", err)
+		response.ErrorResponse(l, w, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+
+	sensors := make([]*models.SensorResult, 0, 10)
+
+	for _, value := range controllers {
+		sensors = append(sensors, value.Sensors...)
+	}
+
+	response.Response(l, w, sensors)
+
+}
+
+func (server *Server) actionsList(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l, _ := icontext.GetLogger(ctx)
+	user, _ := icontext.GetUser(ctx)
+
+	actions, err := server.db.GetActionsLogs(ctx, user.CompanyID, user.IsSuperUser())
+	if err != nil {
+		response.ErrorResponse(l, w, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+
+	response.Response(l, w, actions)
 }
 
 func (server *Server) files(w http.ResponseWriter, r *http.Request) {
@@ -1124,21 +3177,22 @@ func (server *Server) files(w http.ResponseWriter, r *http.Request) {
 }
 
 func (server *Server) isOilFieldOnline(oilFieldID int64) bool {
-	if _, exists := server.MasterSocketConnectionsPool[oilFieldID]; exists {
-		return true
-	}
-
-	return false
+	return server.hub.IsOilFieldOnline(oilFieldID)
 }
 
-func (server *Server) masterSocketDisconnect(ctx context.Context, oilFieldID int64) {
+// masterSocketDisconnect - drops the lost connection of the oil field unless it was already replaced.
+func (server *Server) masterSocketDisconnect(ctx context.Context, oilFieldID int64, client *SyncClient) {
 	l, _ := icontext.GetLogger(ctx)
-	l.Infof("Disconnect (oilFieldID: %s)", oilFieldID)
-	fmt.Printf("Disconnect (oilFieldID: %s)\n", oilFieldID)
-	masterConnection, exists := server.MasterSocketConnectionsPool[oilFieldID]
-	if exists {
-		masterConnection.Close()
-		delete(server.MasterSocketConnectionsPool, oilFieldID)
+	l.Infof("Disconnect (oilFieldID: %d)", oilFieldID)
+	fmt.Printf("Disconnect (oilFieldID: %d)\n", oilFieldID)
+	if masterConnection, removed := server.hub.RemoveOilField(oilFieldID, client); removed {
+		server.syncUploads.drop(oilFieldID)
+		server.recordConnectivity(ctx, oilFieldID, models.ConnectivityEventDisconnect, masterConnection.address)
+		if masterConnection.gateway {
+			server.syncStates.Waiting(oilFieldID)
+		} else {
+			server.syncStates.Offline(oilFieldID)
+		}
 
 		oilField, err := server.db.GetOilField(ctx, oilFieldID)
 		if err != nil {
@@ -1146,16 +3200,17 @@ func (server *Server) masterSocketDisconnect(ctx context.Context, oilFieldID int
 		}
 
 		oilFieldResult := &models.OilFieldResult{
-			OilFieldId:  oilField.OilFieldId,
-			HttpAddress: oilField.HttpAddress,
-			CompanyID:   oilField.CompanyID,
-			Name:        oilField.Name,
-			Lat:         oilField.Lat,
-			Lon:         oilField.Lon,
-			IsDeleted:   oilField.IsDeleted,
-			CreatedTs:   oilField.CreatedTs,
-			UpdatedTs:   oilField.UpdatedTs,
-			IsOnline:    server.isOilFieldOnline(oilField.OilFieldId),
+			OilFieldId:     oilField.OilFieldId,
+			HttpAddress:    oilField.HttpAddress,
+			CompanyID:      oilField.CompanyID,
+			Name:           oilField.Name,
+			Lat:            oilField.Lat,
+			Lon:            oilField.Lon,
+			ConnectionMode: oilField.ConnectionMode,
+			IsDeleted:      oilField.IsDeleted,
+			CreatedTs:      oilField.CreatedTs,
+			UpdatedTs:      oilField.UpdatedTs,
+			IsOnline:       server.isOilFieldOnline(oilField.OilFieldId),
 		}
 
 		users, err := server.db.GetUsers(ctx, oilField.CompanyID, true)
@@ -1169,37 +3224,82 @@ func (server *Server) masterSocketDisconnect(ctx context.Context, oilFieldID int
 	}
 }
 
+// listenOilField - dials the oil field, the caller moved it to connecting with syncStates.BeginDial.
+// A failed dial backs the field off.
 func (server *Server) listenOilField(ctx context.Context, oilFieldModel *models.OilField) {
-	if server.isOilFieldOnline(oilFieldModel.OilFieldId) {
+	l, _ := icontext.GetLogger(ctx)
+
+	credentials, err := server.db.GetOilFieldCredentials(ctx, oilFieldModel.OilFieldId)
+	if err != nil {
+		server.syncStates.DialFailed(oilFieldModel.OilFieldId, err)
 		return
 	}
 
-	conn, _, err := websocket.DefaultDialer.Dial(fmt.Sprintf("ws://%s/connectCloud?CloudID=%d", oilFieldModel.HttpAddress, oilFieldModel.OilFieldId), nil)
+	scheme := "ws"
+	if credentials.UseTLS {
+		scheme = "wss"
+	}
+
+	// the field checks the signature of the connect request to know it is the cloud
+	header := http.Header{}
+	if credentials.HasSecret {
+		timestamp := time.Now().Unix()
+		header.Set("Timestamp", strconv.FormatInt(timestamp, 10))
+		header.Set(signatureHeaderName, utils.HMACSign(
+			credentials.Secret,
+			models.SigningPayload("connectCloud", timestamp, []byte(strconv.FormatInt(oilFieldModel.OilFieldId, 10))),
+		))
+	}
+
+	dialer := &websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		HandshakeTimeout: 45 * time.Second,
+		TLSClientConfig:  server.fieldTLS,
+	}
+	conn, _, err := dialer.Dial(fmt.Sprintf("%s://%s/connectCloud?CloudID=%d", scheme, oilFieldModel.HttpAddress, oilFieldModel.OilFieldId), header)
 	if err != nil {
-		//fmt.Printf("Dial failed: %s\n", err.Error())
+		status := server.syncStates.DialFailed(oilFieldModel.OilFieldId, err)
+		l.Warnf(
+			"Dial of oil field %d at %s failed %d times in a row, next retry at %s: %s",
+			oilFieldModel.OilFieldId,
+			oilFieldModel.HttpAddress,
+			status.Failures,
+			time.Unix(status.NextRetryTs, 0).Format(time.RFC3339),
+			err.Error(),
+		)
 		return
 	}
 
 	syncClient := NewSyncClient(oilFieldModel.OilFieldId, oilFieldModel.HttpAddress, conn, server, server.logger)
+	server.addSyncClient(ctx, syncClient)
+}
+
+// addSyncClient - registers the connection of the oil field, runs it and announces the field online. The
+// connection runs only once registered and marked online, a link dropping at once then unregisters it and marks
+// the field offline after that.
+func (server *Server) addSyncClient(ctx context.Context, syncClient *SyncClient) {
+	server.hub.AddOilField(syncClient)
+	server.syncStates.Online(syncClient.OilFieldID)
+	server.recordConnectivity(ctx, syncClient.OilFieldID, models.ConnectivityEventConnect, syncClient.address)
 	syncClient.Run()
-	server.MasterSocketConnectionsPool[oilFieldModel.OilFieldId] = syncClient
 
-	oilField, err := server.db.GetOilField(ctx, oilFieldModel.OilFieldId)
+	oilField, err := server.db.GetOilField(ctx, syncClient.OilFieldID)
 	if err != nil {
 		return
 	}
 
 	oilFieldResult := &models.OilFieldResult{
-		OilFieldId:  oilField.OilFieldId,
-		HttpAddress: oilField.HttpAddress,
-		CompanyID:   oilField.CompanyID,
-		Name:        oilField.Name,
-		Lat:         oilField.Lat,
-		Lon:         oilField.Lon,
-		IsDeleted:   oilField.IsDeleted,
-		CreatedTs:   oilField.CreatedTs,
-		UpdatedTs:   oilField.UpdatedTs,
-		IsOnline:    server.isOilFieldOnline(oilField.OilFieldId),
+		OilFieldId:     oilField.OilFieldId,
+		HttpAddress:    oilField.HttpAddress,
+		CompanyID:      oilField.CompanyID,
+		Name:           oilField.Name,
+		Lat:            oilField.Lat,
+		Lon:            oilField.Lon,
+		ConnectionMode: oilField.ConnectionMode,
+		IsDeleted:      oilField.IsDeleted,
+		CreatedTs:      oilField.CreatedTs,
+		UpdatedTs:      oilField.UpdatedTs,
+		IsOnline:       server.isOilFieldOnline(oilField.OilFieldId),
 	}
 
 	users, err := server.db.GetUsers(ctx, oilField.CompanyID, true)
@@ -1213,43 +3313,113 @@ func (server *Server) listenOilField(ctx context.Context, oilFieldModel *models.
 }
 
 func (server *Server) disconnectOilField(ctx context.Context, oilFieldID int64) {
-	masterConnection, exists := server.MasterSocketConnectionsPool[oilFieldID]
-	if exists {
-		masterConnection.Close()
-		delete(server.MasterSocketConnectionsPool, oilFieldID)
+	if masterConnection, removed := server.hub.RemoveOilField(oilFieldID, nil); removed {
+		server.syncStates.Offline(oilFieldID)
+		server.recordConnectivity(ctx, oilFieldID, models.ConnectivityEventDisconnect, masterConnection.address)
 	}
 }
 
-func (server *Server) CheckAlarms(alarms models.Alarms) {
-	ctx := context.Background()
-	guid := xid.New()
-	requestID := guid.String()
-	requestLogger := log.WithFields(log.Fields{"request_id": requestID})
-	ctx = context.WithValue(ctx, icontext.LoggerContextKey, requestLogger)
+// CheckAlarms - runs synchronized samples through the alarm engine, stores and pushes the transitions.
+func (server *Server) CheckAlarms(ctx context.Context, samples []*models.SensorSample) {
+	server.handleAlarms(ctx, server.alarmEngine.Evaluate(ctx, samples))
+}
 
-	socketAlarms := server.db.SaveAlarms(ctx, alarms)
-	if len(socketAlarms) > 0 {
-		for _, alarm := range socketAlarms {
-			server.SendMessageTo(ctx, models.MessageTypeAlarm, alarm, alarm.UserID)
+// runStaleDaemon - raises stale data alarms for sensors that stopped reporting.
+func (server *Server) runStaleDaemon() {
+	ctx := context.WithValue(context.Background(), icontext.LoggerContextKey, server.logger)
+	for {
+		interval := viper.GetInt64("AlarmStaleInterval")
+		if interval < 1 {
+			interval = 1
+		}
+		<-time.After(time.Duration(interval) * time.Second)
+
+		server.handleAlarms(ctx, server.alarmEngine.CheckStale(ctx, time.Now().Unix()))
+	}
+}
+
+// handleAlarms - stores engine transitions, pushes them to the company and notifies the subscribers.
+func (server *Server) handleAlarms(ctx context.Context, alarms []*models.Alarm) {
+	if len(alarms) == 0 {
+		return
+	}
+
+	socketAlarms := server.db.SaveAlarms(ctx, alarms, models.AlarmDedupRule{
+		WindowSeconds:  viper.GetInt64("AlarmDedupWindow"),
+		Match:          viper.GetString("AlarmDedupMatch"),
+		ValueTolerance: float32(viper.GetFloat64("AlarmDedupValueTolerance")),
+	})
+	for _, alarm := range socketAlarms {
+		server.SendMessageToCompany(ctx, models.MessageTypeAlarm, alarm, alarm.CompanyID)
+		if alarm.Transition != models.ALARM_TRANSITION_RETURN && alarm.State != models.ALARM_STATE_SHELVED && alarm.State != models.ALARM_STATE_SUPPRESSED {
+			server.notifier.Notify(ctx, alarm)
+		}
+	}
+}
+
+// runMaintenanceDaemon - closes maintenance windows once they expire.
+func (server *Server) runMaintenanceDaemon() {
+	ctx := context.WithValue(context.Background(), icontext.LoggerContextKey, server.logger)
+	for {
+		interval := viper.GetInt64("MaintenanceInterval")
+		if interval < 1 {
+			interval = 1
+		}
+		<-time.After(time.Duration(interval) * time.Second)
+
+		windows, err := server.db.GetExpiredMaintenanceWindows(ctx, time.Now().Unix())
+		if err != nil {
+			server.logger.Errorf("Can't receive expired maintenance windows: %s", err.Error())
+			continue
+		}
+
+		for _, window := range windows {
+			if err := server.closeMaintenanceWindow(ctx, window.WindowID); err != nil {
+				server.logger.Errorf("Can't close maintenance window %d: %s", window.WindowID, err.Error())
+			}
+		}
+	}
+}
+
+// closeMaintenanceWindow - ends the window and announces the alarms still standing after it.
+// The engine keeps tracking suppressed limits, so a released alarm reflects the current value.
+func (server *Server) closeMaintenanceWindow(ctx context.Context, windowID int64) error {
+	released, err := server.db.CloseMaintenanceWindow(ctx, windowID, time.Now().Unix())
+	for _, alarm := range released {
+		server.SendMessageToCompany(ctx, models.MessageTypeAlarm, alarm, alarm.CompanyID)
+		if alarm.State != models.ALARM_STATE_SHELVED {
+			server.notifier.Notify(ctx, alarm)
 		}
 	}
+
+	return err
+}
+
+// escalateAlarm - pushes an escalated alarm to the users of the reached tier and notifies them.
+func (server *Server) escalateAlarm(ctx context.Context, alarm *models.AlarmResult, userIDs []int64) {
+	for _, userID := range userIDs {
+		server.SendMessageTo(ctx, models.MessageTypeAlarmEscalation, alarm, userID)
+	}
+	server.notifier.NotifyUsers(ctx, alarm, userIDs)
 }
 
+// NewIncomingMessage - queues a message of the oil field, blocking while the queue of the field is full.
+// Returns false if cancel closed before the message was queued.
 func (server *Server) NewIncomingMessage(
 	ctx context.Context,
 	message *models.InputMessage,
 	oilFieldId int64,
-) {
-	server.newIncomingMessage <- &incomingMessageWithContext{
+	cancel <-chan bool,
+) bool {
+	return server.dispatcher.Dispatch(&incomingMessageWithContext{
 		Context:    ctx,
 		Message:    message,
 		OilFieldId: oilFieldId,
-	}
+	}, cancel)
 }
 
 func (server *Server) SendMessageTo(ctx context.Context, messageType string, body interface{}, userID int64) {
-	connections, exists := server.SocketConnectionsPool[userID]
-	if !exists {
+	if !server.hub.IsUserOnline(userID) {
 		return
 	}
 
@@ -1264,18 +3434,28 @@ func (server *Server) SendMessageTo(ctx context.Context, messageType string, bod
 		Body:      bodyBytes,
 	}
 
-	for _, conn := range connections {
-		conn.SendMessage(message)
-	}
-	return
+	server.hub.SendToUser(userID, message)
 }
 
-func (server *Server) SendMessageOilField(messageType string, body interface{}, oilFieldId int64) {
-	cc, exists := server.MasterSocketConnectionsPool[oilFieldId]
-	if !exists {
+// SendMessageToCompany - sends the message to every connected user of the company.
+func (server *Server) SendMessageToCompany(ctx context.Context, messageType string, body interface{}, companyID int64) {
+	users, err := server.db.GetUsers(ctx, companyID, false)
+	if err != nil {
+		server.logger.Errorf("Can't receive user contact list %s", err.Error())
 		return
 	}
 
+	for _, user := range users {
+		server.SendMessageTo(ctx, messageType, body, user.UserID)
+	}
+}
+
+// SendMessageOilField - signs and queues the message to the oil field, reports whether it was queued.
+func (server *Server) SendMessageOilField(messageType string, body interface{}, oilFieldId int64) bool {
+	if !server.hub.IsOilFieldOnline(oilFieldId) {
+		return false
+	}
+
 	bodyBytes, err := json.Marshal(body)
 	if err != nil {
 		server.logger.Errorf("Can't marshal send message body: %+v", body)
@@ -1288,72 +3468,57 @@ func (server *Server) SendMessageOilField(messageType string, body interface{},
 		Body:      bodyBytes,
 	}
 
-	cc.SendMessage(message)
+	ctx := context.WithValue(context.Background(), icontext.LoggerContextKey, server.logger)
+	if err := server.signFieldMessage(ctx, message, oilFieldId); err != nil {
+		server.logger.Errorf("Can't sign message to oil field %d: %s", oilFieldId, err.Error())
+		return false
+	}
+
+	if !server.hub.SendToOilField(oilFieldId, message) {
+		return false
+	}
 	fmt.Println("MESSAGE SENT!")
-	return
+	return true
 }
 
 func (server *Server) socketDisconnect(ctx context.Context, userID int64, connectionID string) {
 	l, _ := icontext.GetLogger(ctx)
 	l.Infof("Disconnect (userId: %d, connectionID: %s)", userID, connectionID)
-	userConnections, exists := server.SocketConnectionsPool[userID]
-
-	if exists {
-		indexToRemove := -1
-		for k, v := range userConnections {
-			if v.ID == connectionID {
-				indexToRemove = k
-				v.Close()
-			}
-		}
-
-		if indexToRemove != -1 {
-			copy(userConnections[indexToRemove:], userConnections[indexToRemove+1:])
-			userConnections[len(userConnections)-1] = nil
-			userConnections = userConnections[:len(userConnections)-1]
-
-			if len(userConnections) > 0 {
-				server.SocketConnectionsPool[userID] = userConnections
-			} else {
-				delete(server.SocketConnectionsPool, userID)
+	if !server.hub.RemoveUserConnection(userID, connectionID) {
+		return
+	}
 
-				user, err := server.db.GetUser(ctx, userID)
-				if err != nil {
-					l.Errorf("Can't receive user %s", err.Error())
-					return
-				}
-				userResult := models.UserResult{
-					UserID:    user.UserID,
-					CompanyID: user.CompanyID,
-					Email:     user.Email,
-					FirstName: user.FirstName,
-					LastName:  user.LastName,
-					Role:      user.GetResultRole(),
-					IsDeleted: user.IsDeleted,
-					IsOnline:  server.isUserOnline(user.UserID),
-					CreatedTs: user.CreatedTs,
-					UpdatedTs: user.UpdatedTs,
-				}
+	user, err := server.db.GetUser(ctx, userID)
+	if err != nil {
+		l.Errorf("Can't receive user %s", err.Error())
+		return
+	}
+	userResult := models.UserResult{
+		UserID:    user.UserID,
+		CompanyID: user.CompanyID,
+		Email:     user.Email,
+		FirstName: user.FirstName,
+		LastName:  user.LastName,
+		Role:      user.GetResultRole(),
+		IsDeleted: user.IsDeleted,
+		IsOnline:  server.isUserOnline(user.UserID),
+		CreatedTs: user.CreatedTs,
+		UpdatedTs: user.UpdatedTs,
+	}
 
-				users, err := server.db.GetUsers(ctx, user.CompanyID, user.IsSuperUser())
-				if err != nil {
-					l.Errorf("Can't receive user contact list %s", err.Error())
-				} else {
-					for _, currentUser := range users {
-						if currentUser.UserID == user.UserID {
-							continue
-						}
-						server.SendMessageTo(ctx, models.MessageTypeUserOffline, userResult, currentUser.UserID)
-					}
-				}
+	users, err := server.db.GetUsers(ctx, user.CompanyID, user.IsSuperUser())
+	if err != nil {
+		l.Errorf("Can't receive user contact list %s", err.Error())
+	} else {
+		for _, currentUser := range users {
+			if currentUser.UserID == user.UserID {
+				continue
 			}
+			server.SendMessageTo(ctx, models.MessageTypeUserOffline, userResult, currentUser.UserID)
 		}
 	}
 }
 
 func (server *Server) isUserOnline(userID int64) bool {
-	if _, exists := server.SocketConnectionsPool[userID]; exists {
-		return true
-	}
-	return false
+	return server.hub.IsUserOnline(userID)
 }
@@ -4,11 +4,20 @@ import (
 	"bytes"
 	"compress/gzip"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/spf13/viper"
+	"gitlab.citicom.kz/CloudServer/server/icontext"
 	"gitlab.citicom.kz/CloudServer/server/models"
+	"gitlab.citicom.kz/CloudServer/server/utils"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"os"
+	"time"
 )
 
 func (server *Server) ProcessNewIncomingMessage(
@@ -16,10 +25,18 @@ func (server *Server) ProcessNewIncomingMessage(
 	m *models.InputMessage,
 	oilFieldId int64,
 ) {
+	l, _ := icontext.GetLogger(ctx)
+	if err := server.verifyFieldMessage(ctx, m, oilFieldId); err != nil {
+		l.Errorf("Message %s of oil field %d rejected: %s", m.Type, oilFieldId, err.Error())
+		server.syncStates.Degraded(oilFieldId, err)
+		return
+	}
+
 	switch m.Type {
 	case models.MessageTypeCloudSyncGzip:
 		var input struct {
-			FileName string `json:"file_name"`
+			FileName   string `json:"file_name"`
+			BackfillID int64  `json:"backfill_id"`
 		}
 		if err := json.Unmarshal(m.Body, &input); err != nil {
 			return
@@ -30,33 +47,70 @@ func (server *Server) ProcessNewIncomingMessage(
 			return
 		}
 
-		dataForSync, err := syncRequest(oilField.HttpAddress, input.FileName)
+		credentials, err := server.db.GetOilFieldCredentials(ctx, oilFieldId)
 		if err != nil {
-			outputJson := struct {
-				FileName string `json:"file_name"`
-			}{
-				input.FileName,
-			}
-			server.SendMessageOilField(models.MessageTypeCloudSyncGzipAck, outputJson, oilFieldId)
 			return
 		}
 
-		fmt.Println("DATA SIZE: ", len(dataForSync.Data))
-		server.db.SynchronizeData(ctx, server.influxDB, dataForSync.Controllers, dataForSync.Data, oilFieldId)
+		payload, checksum, err := server.syncRequest(oilField, credentials, input.FileName)
+		if err != nil {
+			server.failSyncDownload(ctx, oilFieldId, input.FileName, err)
+			return
+		}
+		defer removeSyncPayload(payload)
 
-		outputJson := struct {
-			FileName string `json:"file_name"`
-		}{
-			input.FileName,
+		server.ingestSyncFile(ctx, oilFieldId, input.FileName, payload, checksum, input.BackfillID)
+	case models.MessageTypeCloudSyncData:
+		var input models.SyncDataChunk
+		if err := json.Unmarshal(m.Body, &input); err != nil {
+			return
+		}
+
+		server.receiveSyncChunk(ctx, oilFieldId, &input)
+	case models.MessageTypeCloudBackfillDone:
+		var input models.BackfillDone
+		if err := json.Unmarshal(m.Body, &input); err != nil {
+			return
+		}
+
+		if input.Error != "" {
+			l.Errorf("Backfill %d of oil field %d failed: %s", input.BackfillID, oilFieldId, input.Error)
+		}
+		if err := server.db.SetBackfillDone(ctx, oilFieldId, input); err != nil {
+			l.Errorf("%v", err)
+		}
+	case models.MessageTypeCloudConfigAck:
+		var input models.ConfigChangeAck
+		if err := json.Unmarshal(m.Body, &input); err != nil {
+			return
+		}
+
+		server.ackConfigChange(ctx, oilFieldId, input)
+	case models.MessageTypeCloudCommandResult:
+		var input models.CommandResult
+		if err := json.Unmarshal(m.Body, &input); err != nil {
+			return
 		}
-		server.SendMessageOilField(models.MessageTypeCloudSyncGzipAck, outputJson, oilFieldId)
+
+		server.commandResult(ctx, oilFieldId, input)
 	default:
 		fmt.Printf("Incorrect type: %s", m.Type)
 	}
 
 }
 
-func syncRequest(address string,fileName string) (*models.CloudGzipData, error) {
+func syncMaxPayloadSize() int64 {
+	return viper.GetInt64("SyncMaxPayloadSize")
+}
+
+func syncChunkSize() int64 {
+	return viper.GetInt64("SyncChunkSize")
+}
+
+// syncRequest - downloads the gzip sync file from the oil field into a temporary file and returns it with the
+// SHA-256 of its content. With a secret the request is signed and the payload must carry a valid signature in
+// the X-Signature header, it is checked while downloading so the payload never has to fit in memory.
+func (server *Server) syncRequest(oilField *models.OilField, credentials *models.OilFieldCredentials, fileName string) (*os.File, string, error) {
 	outputJson := struct {
 		FileName string `json:"file_name"`
 	}{
@@ -64,55 +118,241 @@ func syncRequest(address string,fileName string) (*models.CloudGzipData, error)
 	}
 	jsonBytes, _ := json.Marshal(outputJson)
 
+	scheme := "http"
+	if credentials.UseTLS {
+		scheme = "https"
+	}
+
 	req, err := http.NewRequest(
 		"POST",
-		fmt.Sprintf("http://%s/gzipfile", address),
+		fmt.Sprintf("%s://%s/gzipfile", scheme, oilField.HttpAddress),
 		bytes.NewBuffer(jsonBytes),
 	)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
 	req.Header.Set("Content-Type", "application/json")
+	if credentials.HasSecret {
+		req.Header.Set(signatureHeaderName, utils.HMACSign(credentials.Secret, jsonBytes))
+	}
 
-	client := &http.Client{}
+	client := &http.Client{
+		Transport: &http.Transport{TLSClientConfig: server.fieldTLS},
+	}
 	resp, err := client.Do(req)
 	if err != nil {
 		fmt.Println("ERROR: ", err)
-		return nil, err
+		return nil, "", err
 	}
+	defer resp.Body.Close()
 
-	if resp.StatusCode == 500 {
+	if resp.StatusCode != http.StatusOK {
 		fmt.Println("ERROR FILE NOT FOUND")
-		return nil, err
+		return nil, "", fmt.Errorf("Sync file %s not found, status %d", fileName, resp.StatusCode)
 	}
 
-	bodyBytes, err := ioutil.ReadAll(resp.Body)
+	maxSize := syncMaxPayloadSize()
+	if maxSize > 0 && resp.ContentLength > maxSize {
+		return nil, "", utils.PayloadTooLarge
+	}
+
+	payload, err := ioutil.TempFile(viper.GetString("SyncTempDir"), "sync-*.gz")
 	if err != nil {
-		fmt.Println("ERROR: ", err)
-		return nil, err
+		return nil, "", err
+	}
+
+	checksum := sha256.New()
+	verifier := utils.NewHMACVerifier(credentials.Secrets(time.Now().Unix(), secretRotationGrace()))
+	size, err := io.Copy(io.MultiWriter(payload, checksum, verifier), utils.NewLimitReader(resp.Body, maxSize))
+	server.syncMetrics.received(size)
+	if err != nil {
+		removeSyncPayload(payload)
+		return nil, "", err
 	}
 
-	if len(bodyBytes) == 0 {
-		return nil, fmt.Errorf("Empty bodyBytes")
+	if credentials.HasSecret && !verifier.Verify(resp.Header.Get(signatureHeaderName)) {
+		removeSyncPayload(payload)
+		return nil, "", InvalidSignature
 	}
 
-	b := bytes.NewBuffer(bodyBytes)
-	r, err := gzip.NewReader(b)
-	var resB bytes.Buffer
-	_, err = resB.ReadFrom(r)
+	if _, err := payload.Seek(0, io.SeekStart); err != nil {
+		removeSyncPayload(payload)
+		return nil, "", err
+	}
+
+	return payload, hex.EncodeToString(checksum.Sum(nil)), nil
+}
+
+func removeSyncPayload(payload *os.File) {
+	_ = payload.Close()
+	_ = os.Remove(payload.Name())
+}
+
+// failSyncDownload - records and nacks a sync file that could not be received.
+func (server *Server) failSyncDownload(ctx context.Context, oilFieldId int64, fileName string, err error) {
+	code := models.SYNC_ERROR_DOWNLOAD
+	switch err {
+	case InvalidSignature:
+		code = models.SYNC_ERROR_SIGNATURE
+	case utils.PayloadTooLarge:
+		code = models.SYNC_ERROR_TOO_LARGE
+	}
+
+	if file, fileErr := server.db.StartSyncFile(ctx, oilFieldId, fileName, ""); fileErr == nil {
+		server.db.SetSyncFileFailed(ctx, file.FileID, code, err.Error())
+	}
+	server.syncMetrics.failed()
+	server.nackSyncFile(ctx, oilFieldId, fileName, code, err)
+}
+
+// ingestSyncFile - stores a sync file once. The controllers and sensors are stored first, the samples are written
+// to InfluxDB in batches of SyncBatchSize while the file is decoded. The file is acked only after every batch was
+// written, a file already in the ledger as ingested is acked without storing it again. On failure the field gets
+// a nack with the error code and keeps the file for another attempt, batches already written are overwritten then.
+// Files sent for a backfill count towards its progress.
+func (server *Server) ingestSyncFile(ctx context.Context, oilFieldId int64, fileName string, payload io.Reader, checksum string, backfillID int64) {
+	l, _ := icontext.GetLogger(ctx)
+
+	file, err := server.db.StartSyncFile(ctx, oilFieldId, fileName, checksum)
 	if err != nil {
-		return nil, err
+		l.Errorf("%v", err)
+		server.nackSyncFile(ctx, oilFieldId, fileName, models.SYNC_ERROR_STORE, err)
+		return
 	}
 
-	resData := resB.Bytes()
+	if file.Status == models.SYNC_FILE_STATUS_INGESTED {
+		l.Infof("Sync file %s of oil field %d already ingested", fileName, oilFieldId)
+		server.syncMetrics.skipped()
+		server.addBackfillFile(ctx, oilFieldId, backfillID, int64(file.Points))
+		server.SendMessageOilField(models.MessageTypeCloudSyncGzipAck, models.SyncFileAck{FileName: fileName}, oilFieldId)
+		server.syncStates.Recovered(oilFieldId)
+		return
+	}
 
-	var outputGzip *models.CloudGzipData
-	err = json.Unmarshal(resData, &outputGzip)
+	progress := server.syncMetrics.start(oilFieldId, fileName)
+	err = server.storeSyncFile(ctx, oilFieldId, payload, progress)
+	server.syncMetrics.finish(progress, err)
 	if err != nil {
-		fmt.Println("ERROR: ", err)
-		return nil, err
+		code := models.SYNC_ERROR_DECODE
+		var storeErr *syncStoreError
+		if err == utils.PayloadTooLarge {
+			code = models.SYNC_ERROR_TOO_LARGE
+		} else if errors.As(err, &storeErr) {
+			code = models.SYNC_ERROR_STORE
+		}
+
+		server.db.SetSyncFileFailed(ctx, file.FileID, code, err.Error())
+		server.nackSyncFile(ctx, oilFieldId, fileName, code, err)
+		return
+	}
+
+	l.Infof("Sync file %s of oil field %d ingested: %d points in %d batches", fileName, oilFieldId, progress.Points, progress.Batches)
+	if err := server.db.SetSyncFileIngested(ctx, file.FileID, int(progress.Points)); err != nil {
+		l.Errorf("%v", err)
+		server.nackSyncFile(ctx, oilFieldId, fileName, models.SYNC_ERROR_STORE, err)
+		return
+	}
+	server.addBackfillFile(ctx, oilFieldId, backfillID, progress.Points)
+
+	server.SendMessageOilField(models.MessageTypeCloudSyncGzipAck, models.SyncFileAck{FileName: fileName}, oilFieldId)
+	server.syncStates.Recovered(oilFieldId)
+}
+
+// storeSyncFile - decodes the gzip payload as a stream, at most SyncMaxDecodedSize bytes are unpacked.
+// Alarms are checked after each batch is written, the file is not held in memory until it is committed. The engine
+// skips samples not newer than the last one of each limit, so a nacked file sent again raises nothing twice.
+func (server *Server) storeSyncFile(ctx context.Context, oilFieldId int64, payload io.Reader, progress *models.SyncProgress) error {
+	l, _ := icontext.GetLogger(ctx)
+
+	gzipReader, err := gzip.NewReader(payload)
+	if err != nil {
+		return err
+	}
+	defer gzipReader.Close()
+
+	batchSize := viper.GetInt("SyncBatchSize")
+	if batchSize < 1 {
+		batchSize = 1
 	}
 
-	return outputGzip, nil
+	decoded := utils.NewLimitReader(gzipReader, viper.GetInt64("SyncMaxDecodedSize"))
+	var controllers []*models.CloudControllersResult
+	var sensors []*models.SensorResultCloud
+	return decodeSyncStream(
+		decoded,
+		batchSize,
+		func(fileControllers []*models.CloudControllersResult) error {
+			controllers = fileControllers
+			var restored []*models.SyncItemEvent
+			var counts models.ConfigSyncCounts
+			var err error
+			sensors, restored, counts, err = server.db.SynchronizeCloudControllers(ctx, controllers, oilFieldId)
+			if err != nil {
+				return err
+			}
+
+			server.syncMetrics.config(counts)
+			l.Infof("Sync file %s of oil field %d: %d controllers and sensors inserted, %d updated, %d unchanged", progress.FileName, oilFieldId, counts.Inserted, counts.Updated, counts.Unchanged)
+			if len(restored) > 0 {
+				server.alarmEngine.ReloadSettings()
+			}
+			server.notifySyncItems(ctx, oilFieldId, restored)
+			return nil
+		},
+		func(data []*models.SensorData) error {
+			samples, err := server.db.SynchronizeSamples(ctx, server.influxDB, sensors, data, oilFieldId)
+			if err != nil {
+				return err
+			}
+
+			server.syncMetrics.batch(progress, len(samples), decoded.BytesRead)
+			l.Infof("Sync file %s of oil field %d: %d points stored, %d bytes decoded", progress.FileName, oilFieldId, progress.Points, decoded.BytesRead)
+			server.CheckAlarms(ctx, samples)
+			return nil
+		},
+		func() error {
+			deleted, err := server.db.DeleteMissingControllers(ctx, controllers, oilFieldId)
+			if err != nil {
+				return err
+			}
+
+			if len(deleted) > 0 {
+				server.alarmEngine.ReloadSettings()
+			}
+			server.notifySyncItems(ctx, oilFieldId, deleted)
+			return nil
+		},
+	)
+}
+
+// notifySyncItems - pushes the controllers and sensors deleted or restored by a sync file to the company.
+func (server *Server) notifySyncItems(ctx context.Context, oilFieldId int64, events []*models.SyncItemEvent) {
+	l, _ := icontext.GetLogger(ctx)
+	if len(events) == 0 {
+		return
+	}
+
+	oilField, err := server.db.GetOilField(ctx, oilFieldId)
+	if err != nil {
+		l.Errorf("%v", err)
+		return
+	}
+
+	for _, event := range events {
+		l.Infof("%s %s of oil field %d %s", event.ItemType, event.ItemID, oilFieldId, event.Event)
+		server.SendMessageToCompany(ctx, models.MessageTypeSyncItem, event, oilField.CompanyID)
+	}
+}
+
+func (server *Server) nackSyncFile(ctx context.Context, oilFieldId int64, fileName string, code string, err error) {
+	l, _ := icontext.GetLogger(ctx)
+	l.Errorf("Sync file %s of oil field %d failed with %s: %s", fileName, oilFieldId, code, err.Error())
+	server.syncStates.Degraded(oilFieldId, err)
+
+	server.SendMessageOilField(models.MessageTypeCloudSyncGzipNack, models.SyncFileNack{
+		FileName: fileName,
+		Code:     code,
+		Error:    err.Error(),
+	}, oilFieldId)
 }
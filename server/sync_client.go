@@ -3,6 +3,7 @@ package server
 import (
 	"context"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -15,10 +16,12 @@ import (
 type SyncClient struct {
 	OilFieldID      int64
 	address         string
+	gateway         bool
 	conn            *websocket.Conn
 	server          *Server
 	outgoingMessage chan *models.OutputMessage
 	closeCh         chan bool
+	closeOnce       sync.Once
 	logger          *log.Entry
 }
 
@@ -37,9 +40,12 @@ func NewSyncClient(oilFieldID int64, address string, conn *websocket.Conn, serve
 	}
 }
 
+// Close - stops the connection, safe to call more than once.
 func (cc *SyncClient) Close() {
-	cc.logger.Info("Signal to close ")
-	close(cc.closeCh)
+	cc.closeOnce.Do(func() {
+		cc.logger.Info("Signal to close ")
+		close(cc.closeCh)
+	})
 }
 
 func (cc *SyncClient) Run() {
@@ -77,8 +83,15 @@ func (cc *SyncClient) listenWrite() {
 func (cc *SyncClient) listenRead() {
 	defer func() {
 		_ = cc.conn.Close()
+		ctx := context.WithValue(context.Background(), icontext.LoggerContextKey, cc.logger)
+		cc.server.masterSocketDisconnect(ctx, cc.OilFieldID, cc)
 	}()
 
+	// inline sync files arrive base64 encoded in chunks, larger chunks are nacked after reading, far larger ones
+	// drop the link
+	if chunkSize := syncChunkSize(); chunkSize > 0 {
+		cc.conn.SetReadLimit(chunkSize*2 + syncChunkOverhead)
+	}
 	_ = cc.conn.SetReadDeadline(time.Now().Add(pongWait))
 	cc.conn.SetPongHandler(func(string) error {
 		_ = cc.conn.SetReadDeadline(time.Now().Add(pongWait))
@@ -104,19 +117,28 @@ func (cc *SyncClient) listenRead() {
 						cc.logger.Infof("Close websocket by code: %d, message: %s", c.Code, c.Text)
 					}
 				} else {
-					fmt.Println("Error while reading JSON from websocket %s", err.Error())
+					fmt.Printf("Error while reading JSON from websocket %s\n", err.Error())
 					cc.logger.Errorf("Error while reading JSON from websocket %s", err.Error())
 				}
-				cc.server.masterSocketDisconnect(ctx, cc.OilFieldID)
 				return
 			} else {
-				cc.server.NewIncomingMessage(ctx, &messageObject, cc.OilFieldID)
+				if !cc.server.NewIncomingMessage(ctx, &messageObject, cc.OilFieldID, cc.closeCh) {
+					cc.logger.Info("Closed reading")
+					return
+				}
+				// the queue of the field may have been full for a while, pongs were not read meanwhile
+				_ = cc.conn.SetReadDeadline(time.Now().Add(pongWait))
 			}
 		}
 	}
 }
 
-// SendMessage - add message to output queue
-func (cc *SyncClient) SendMessage(mes *models.OutputMessage) {
-	cc.outgoingMessage <- mes
+// SendMessage - add message to output queue, returns false without blocking when the queue is full
+func (cc *SyncClient) SendMessage(mes *models.OutputMessage) bool {
+	select {
+	case cc.outgoingMessage <- mes:
+		return true
+	default:
+		return false
+	}
 }
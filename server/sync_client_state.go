@@ -0,0 +1,193 @@
+package server
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+	"gitlab.citicom.kz/CloudServer/server/models"
+)
+
+type syncClientState struct {
+	status  models.SyncClientStatus
+	dialing bool
+}
+
+// syncClientStates - states of the sync connections by oil field, they outlive the SyncClient of a connection.
+type syncClientStates struct {
+	mutex  sync.Mutex
+	states map[int64]*syncClientState
+}
+
+func newSyncClientStates() *syncClientStates {
+	return &syncClientStates{
+		states: make(map[int64]*syncClientState),
+	}
+}
+
+func (states *syncClientStates) state(oilFieldID int64) *syncClientState {
+	state, exists := states.states[oilFieldID]
+	if !exists {
+		state = &syncClientState{
+			status: models.SyncClientStatus{
+				OilFieldID: oilFieldID,
+				State:      models.SYNC_CLIENT_STATE_CONNECTING,
+				StateTs:    time.Now().Unix(),
+			},
+		}
+		states.states[oilFieldID] = state
+	}
+
+	return state
+}
+
+func (state *syncClientState) set(name string, now int64) {
+	if state.status.State != name {
+		state.status.State = name
+		state.status.StateTs = now
+	}
+}
+
+func (state *syncClientState) fail(err error, now int64) {
+	state.status.LastError = err.Error()
+	state.status.LastErrorTs = now
+}
+
+// Get - a copy of the status of the oil field.
+func (states *syncClientStates) Get(oilFieldID int64) *models.SyncClientStatus {
+	states.mutex.Lock()
+	defer states.mutex.Unlock()
+
+	status := states.state(oilFieldID).status
+	return &status
+}
+
+// BeginDial - moves the oil field to connecting unless it is connected, already being dialed or, without
+// force, backing off. Reports whether the caller should dial.
+func (states *syncClientStates) BeginDial(oilFieldID int64, force bool) bool {
+	states.mutex.Lock()
+	defer states.mutex.Unlock()
+
+	state := states.state(oilFieldID)
+	now := time.Now().Unix()
+	if state.dialing || state.status.IsConnected() || (!force && now < state.status.NextRetryTs) {
+		return false
+	}
+
+	state.dialing = true
+	state.set(models.SYNC_CLIENT_STATE_CONNECTING, now)
+	return true
+}
+
+// DialFailed - backs the oil field off exponentially, the delay is randomized by ReconnectJitter so fields
+// that went down together don't redial together. Returns the updated status.
+func (states *syncClientStates) DialFailed(oilFieldID int64, err error) *models.SyncClientStatus {
+	states.mutex.Lock()
+	defer states.mutex.Unlock()
+
+	state := states.state(oilFieldID)
+	now := time.Now().Unix()
+	state.dialing = false
+	state.status.Failures++
+	state.fail(err, now)
+	state.status.NextRetryTs = now + reconnectBackoff(state.status.Failures)
+	state.set(models.SYNC_CLIENT_STATE_BACKING_OFF, now)
+
+	status := state.status
+	return &status
+}
+
+// Online - the oil field connected, by a dial or as a gateway. The failures are kept until the link proves stable,
+// see Offline.
+func (states *syncClientStates) Online(oilFieldID int64) {
+	states.mutex.Lock()
+	defer states.mutex.Unlock()
+
+	state := states.state(oilFieldID)
+	now := time.Now().Unix()
+	state.dialing = false
+	state.status.NextRetryTs = 0
+	state.status.ConnectedTs = now
+	state.set(models.SYNC_CLIENT_STATE_ONLINE, now)
+}
+
+// Offline - the connection was lost or dropped. A link that stayed up for ReconnectStableTime starts the backoff
+// over, a shorter one counts as a failed dial, so a field dropping right after every connect backs off like one
+// that can't be dialed.
+func (states *syncClientStates) Offline(oilFieldID int64) {
+	states.mutex.Lock()
+	defer states.mutex.Unlock()
+
+	state := states.state(oilFieldID)
+	now := time.Now().Unix()
+	if now-state.status.ConnectedTs >= viper.GetInt64("ReconnectStableTime") {
+		state.status.Failures = 0
+	}
+	state.status.Failures++
+	state.status.NextRetryTs = now + reconnectBackoff(state.status.Failures)
+	state.set(models.SYNC_CLIENT_STATE_BACKING_OFF, now)
+}
+
+// Degraded - a message exchange of the connected oil field failed.
+func (states *syncClientStates) Degraded(oilFieldID int64, err error) {
+	states.mutex.Lock()
+	defer states.mutex.Unlock()
+
+	state := states.state(oilFieldID)
+	now := time.Now().Unix()
+	state.fail(err, now)
+	if state.status.IsConnected() {
+		state.set(models.SYNC_CLIENT_STATE_DEGRADED, now)
+	}
+}
+
+// Recovered - a message exchange of the degraded oil field succeeded.
+func (states *syncClientStates) Recovered(oilFieldID int64) {
+	states.mutex.Lock()
+	defer states.mutex.Unlock()
+
+	state := states.state(oilFieldID)
+	if state.status.State == models.SYNC_CLIENT_STATE_DEGRADED {
+		state.set(models.SYNC_CLIENT_STATE_ONLINE, time.Now().Unix())
+	}
+}
+
+// Disabled - the oil field is deleted and not dialed anymore.
+func (states *syncClientStates) Disabled(oilFieldID int64) {
+	states.mutex.Lock()
+	defer states.mutex.Unlock()
+
+	state := states.state(oilFieldID)
+	state.status.NextRetryTs = 0
+	state.set(models.SYNC_CLIENT_STATE_DISABLED, time.Now().Unix())
+}
+
+// Waiting - the gateway oil field is not connected and waits for the field to dial in.
+func (states *syncClientStates) Waiting(oilFieldID int64) {
+	states.mutex.Lock()
+	defer states.mutex.Unlock()
+
+	state := states.state(oilFieldID)
+	state.status.NextRetryTs = 0
+	state.set(models.SYNC_CLIENT_STATE_CONNECTING, time.Now().Unix())
+}
+
+// reconnectBackoff - seconds before the next dial after the given number of failed dials in a row.
+func reconnectBackoff(failures int) int64 {
+	base := viper.GetFloat64("ReconnectBackoff")
+	if base < 1 {
+		base = 1
+	}
+	max := viper.GetFloat64("ReconnectMaxBackoff")
+	if max < base {
+		max = base
+	}
+
+	delay := math.Min(max, base*math.Pow(2, float64(failures-1)))
+	jitter := viper.GetFloat64("ReconnectJitter")
+	delay += delay * jitter * (2*rand.Float64() - 1)
+
+	return int64(math.Max(1, math.Round(delay)))
+}
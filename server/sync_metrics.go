@@ -0,0 +1,105 @@
+package server
+
+import (
+	"sync"
+	"time"
+
+	"gitlab.citicom.kz/CloudServer/server/models"
+)
+
+// syncMetrics - progress of the sync files, served by /sync_metrics.
+type syncMetrics struct {
+	mutex  sync.Mutex
+	totals models.SyncMetrics
+	active map[*models.SyncProgress]bool
+}
+
+func newSyncMetrics() *syncMetrics {
+	return &syncMetrics{
+		active: make(map[*models.SyncProgress]bool),
+	}
+}
+
+func (metrics *syncMetrics) received(bytes int64) {
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+
+	metrics.totals.BytesReceived += bytes
+}
+
+func (metrics *syncMetrics) skipped() {
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+
+	metrics.totals.FilesSkipped++
+}
+
+func (metrics *syncMetrics) failed() {
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+
+	metrics.totals.FilesFailed++
+}
+
+func (metrics *syncMetrics) start(oilFieldID int64, fileName string) *models.SyncProgress {
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+
+	progress := &models.SyncProgress{
+		OilFieldID: oilFieldID,
+		FileName:   fileName,
+		StartedTs:  time.Now().Unix(),
+	}
+	metrics.active[progress] = true
+
+	return progress
+}
+
+// batch - records a batch written to InfluxDB, bytes is the decoded size read so far.
+func (metrics *syncMetrics) batch(progress *models.SyncProgress, points int, bytes int64) {
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+
+	metrics.totals.BytesDecoded += bytes - progress.Bytes
+	metrics.totals.PointsWritten += int64(points)
+	metrics.totals.BatchesWritten++
+	progress.Bytes = bytes
+	progress.Points += int64(points)
+	progress.Batches++
+}
+
+// config - records the controller and sensor rows of a sync file.
+func (metrics *syncMetrics) config(counts models.ConfigSyncCounts) {
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+
+	metrics.totals.Config.Inserted += counts.Inserted
+	metrics.totals.Config.Updated += counts.Updated
+	metrics.totals.Config.Unchanged += counts.Unchanged
+}
+
+func (metrics *syncMetrics) finish(progress *models.SyncProgress, err error) {
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+
+	delete(metrics.active, progress)
+	if err != nil {
+		metrics.totals.FilesFailed++
+		return
+	}
+	metrics.totals.FilesIngested++
+}
+
+func (metrics *syncMetrics) snapshot() models.SyncMetrics {
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+
+	snapshot := metrics.totals
+	snapshot.Active = make([]*models.SyncProgress, 0, len(metrics.active))
+	for progress := range metrics.active {
+		item := *progress
+		snapshot.Active = append(snapshot.Active, &item)
+	}
+
+	return snapshot
+}
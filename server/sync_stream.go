@@ -0,0 +1,134 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"gitlab.citicom.kz/CloudServer/server/models"
+)
+
+var ControllersAfterData = errors.New("Sync file controllers must precede its data")
+
+// syncStoreError - failure of a callback of decodeSyncStream, as opposed to a malformed file.
+type syncStoreError struct {
+	err error
+}
+
+func (e *syncStoreError) Error() string {
+	return e.err.Error()
+}
+
+// decodeSyncStream - reads a models.CloudGzipData document token by token. The controllers are decoded at once,
+// the data is handed to onData in batches of batchSize, so memory does not grow with the size of the file.
+// The field writes controllers before data, a file with data first is rejected since its samples can't be
+// matched to sensors. onFullConfig is called once the whole file is stored when it has "full_config": true.
+func decodeSyncStream(
+	reader io.Reader,
+	batchSize int,
+	onControllers func([]*models.CloudControllersResult) error,
+	onData func([]*models.SensorData) error,
+	onFullConfig func() error,
+) error {
+	decoder := json.NewDecoder(reader)
+	if err := expectDelim(decoder, '{'); err != nil {
+		return err
+	}
+
+	controllersRead := false
+	fullConfig := false
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+
+		switch token {
+		case "controllers":
+			var controllers []*models.CloudControllersResult
+			if err := decoder.Decode(&controllers); err != nil {
+				return err
+			}
+			if err := onControllers(controllers); err != nil {
+				return &syncStoreError{err}
+			}
+			controllersRead = true
+		case "full_config":
+			if err := decoder.Decode(&fullConfig); err != nil {
+				return err
+			}
+		case "data":
+			if !controllersRead {
+				return ControllersAfterData
+			}
+			if err := decodeSyncData(decoder, batchSize, onData); err != nil {
+				return err
+			}
+		default:
+			var skip json.RawMessage
+			if err := decoder.Decode(&skip); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := expectDelim(decoder, '}'); err != nil {
+		return err
+	}
+	if fullConfig && controllersRead {
+		if err := onFullConfig(); err != nil {
+			return &syncStoreError{err}
+		}
+	}
+
+	return nil
+}
+
+func decodeSyncData(decoder *json.Decoder, batchSize int, onData func([]*models.SensorData) error) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if token == nil {
+		return nil
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return fmt.Errorf("Sync file data must be an array, got %v", token)
+	}
+
+	batch := make([]*models.SensorData, 0, batchSize)
+	for decoder.More() {
+		sensorData := &models.SensorData{}
+		if err := decoder.Decode(sensorData); err != nil {
+			return err
+		}
+
+		batch = append(batch, sensorData)
+		if len(batch) >= batchSize {
+			if err := onData(batch); err != nil {
+				return &syncStoreError{err}
+			}
+			batch = make([]*models.SensorData, 0, batchSize)
+		}
+	}
+	if len(batch) > 0 {
+		if err := onData(batch); err != nil {
+			return &syncStoreError{err}
+		}
+	}
+
+	return expectDelim(decoder, ']')
+}
+
+func expectDelim(decoder *json.Decoder, expected json.Delim) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != expected {
+		return fmt.Errorf("Sync file expected %v, got %v", expected, token)
+	}
+
+	return nil
+}
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/spf13/viper"
+	"gitlab.citicom.kz/CloudServer/server/models"
+	"gitlab.citicom.kz/CloudServer/server/utils"
+)
+
+// syncChunkOverhead - bytes of a MessageTypeCloudSyncData message besides its data.
+const syncChunkOverhead = 64 << 10
+
+var SyncChunkOutOfOrder = errors.New("Sync file chunk out of order")
+
+// syncUpload - an inline sync file being received, spooled to a temporary file like a downloaded one.
+type syncUpload struct {
+	fileName string
+	file     *os.File
+	checksum hash.Hash
+	size     int64
+}
+
+// syncUploads - the inline sync file being received from each oil field. A gateway sends its files one by one,
+// a file started anew replaces the one in progress and a dropped link discards it.
+type syncUploads struct {
+	mutex   sync.Mutex
+	uploads map[int64]*syncUpload
+}
+
+func newSyncUploads() *syncUploads {
+	return &syncUploads{
+		uploads: make(map[int64]*syncUpload),
+	}
+}
+
+// add - appends the chunk to the file of the oil field and returns the file once its last chunk arrived, rewound
+// to the start. The caller removes the returned file.
+func (uploads *syncUploads) add(oilFieldID int64, chunk *models.SyncDataChunk) (*syncUpload, error) {
+	uploads.mutex.Lock()
+	defer uploads.mutex.Unlock()
+
+	upload := uploads.uploads[oilFieldID]
+	if chunk.Offset == 0 {
+		if upload != nil {
+			removeSyncPayload(upload.file)
+			delete(uploads.uploads, oilFieldID)
+		}
+
+		file, err := ioutil.TempFile(viper.GetString("SyncTempDir"), "sync-*.gz")
+		if err != nil {
+			return nil, err
+		}
+		upload = &syncUpload{fileName: chunk.FileName, file: file, checksum: sha256.New()}
+		uploads.uploads[oilFieldID] = upload
+	}
+
+	if upload == nil || upload.fileName != chunk.FileName || upload.size != chunk.Offset {
+		uploads.dropLocked(oilFieldID)
+		return nil, SyncChunkOutOfOrder
+	}
+	if maxSize := syncMaxPayloadSize(); maxSize > 0 && upload.size+int64(len(chunk.Data)) > maxSize {
+		uploads.dropLocked(oilFieldID)
+		return nil, utils.PayloadTooLarge
+	}
+
+	if _, err := io.MultiWriter(upload.file, upload.checksum).Write(chunk.Data); err != nil {
+		uploads.dropLocked(oilFieldID)
+		return nil, err
+	}
+	upload.size += int64(len(chunk.Data))
+	if chunk.More {
+		return nil, nil
+	}
+
+	delete(uploads.uploads, oilFieldID)
+	if _, err := upload.file.Seek(0, io.SeekStart); err != nil {
+		removeSyncPayload(upload.file)
+		return nil, err
+	}
+
+	return upload, nil
+}
+
+// drop - discards the file being received from the oil field.
+func (uploads *syncUploads) drop(oilFieldID int64) {
+	uploads.mutex.Lock()
+	defer uploads.mutex.Unlock()
+
+	uploads.dropLocked(oilFieldID)
+}
+
+func (uploads *syncUploads) dropLocked(oilFieldID int64) {
+	if upload, exists := uploads.uploads[oilFieldID]; exists {
+		removeSyncPayload(upload.file)
+		delete(uploads.uploads, oilFieldID)
+	}
+}
+
+// receiveSyncChunk - stores a chunk of an inline sync file, the file is ingested once its last chunk arrived.
+// A chunk larger than SyncChunkSize, out of order or past SyncMaxPayloadSize fails the whole file.
+func (server *Server) receiveSyncChunk(ctx context.Context, oilFieldId int64, chunk *models.SyncDataChunk) {
+	if chunkSize := syncChunkSize(); chunkSize > 0 && int64(len(chunk.Data)) > chunkSize {
+		server.syncUploads.drop(oilFieldId)
+		server.failSyncDownload(ctx, oilFieldId, chunk.FileName, utils.PayloadTooLarge)
+		return
+	}
+	server.syncMetrics.received(int64(len(chunk.Data)))
+
+	upload, err := server.syncUploads.add(oilFieldId, chunk)
+	if err != nil {
+		server.failSyncDownload(ctx, oilFieldId, chunk.FileName, err)
+		return
+	}
+	if upload == nil {
+		return
+	}
+	defer removeSyncPayload(upload.file)
+
+	server.ingestSyncFile(ctx, oilFieldId, chunk.FileName, upload.file, hex.EncodeToString(upload.checksum.Sum(nil)), chunk.BackfillID)
+}
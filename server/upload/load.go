@@ -46,7 +46,7 @@ func UploadFile(
 
 	infile, fileHandler, err := r.FormFile(fileKey)
 	if err != nil {
-		l.Errorf("UploadFile(48): %v")
+		l.Errorf("UploadFile(48): %v", err)
 		return nil, err
 	}
 	defer infile.Close()
@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+)
+
+// HMACSign - returns the hex encoded HMAC-SHA256 of the payload.
+func HMACSign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// HMACVerify - reports whether the signature was made by one of the secrets.
+func HMACVerify(secrets []string, payload []byte, signature string) bool {
+	verifier := NewHMACVerifier(secrets)
+	verifier.Write(payload)
+	return verifier.Verify(signature)
+}
+
+// HMACVerifier - checks the signature of a payload written to it in parts, for payloads too large to hold in memory.
+type HMACVerifier struct {
+	macs []hash.Hash
+}
+
+func NewHMACVerifier(secrets []string) *HMACVerifier {
+	verifier := &HMACVerifier{macs: make([]hash.Hash, 0, len(secrets))}
+	for _, secret := range secrets {
+		verifier.macs = append(verifier.macs, hmac.New(sha256.New, []byte(secret)))
+	}
+
+	return verifier
+}
+
+func (verifier *HMACVerifier) Write(p []byte) (int, error) {
+	for _, mac := range verifier.macs {
+		mac.Write(p)
+	}
+
+	return len(p), nil
+}
+
+// Verify - reports whether the signature of the written payload was made by one of the secrets.
+func (verifier *HMACVerifier) Verify(signature string) bool {
+	expected, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+
+	for _, mac := range verifier.macs {
+		if hmac.Equal(mac.Sum(nil), expected) {
+			return true
+		}
+	}
+
+	return false
+}
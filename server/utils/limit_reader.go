@@ -0,0 +1,30 @@
+package utils
+
+import (
+	"errors"
+	"io"
+)
+
+var PayloadTooLarge = errors.New("Payload too large")
+
+// LimitReader - fails with PayloadTooLarge once more than limit bytes were read, unlike io.LimitReader which
+// silently stops. A limit of zero or less reads without a limit.
+type LimitReader struct {
+	reader    io.Reader
+	limit     int64
+	BytesRead int64
+}
+
+func NewLimitReader(reader io.Reader, limit int64) *LimitReader {
+	return &LimitReader{reader: reader, limit: limit}
+}
+
+func (r *LimitReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.BytesRead += int64(n)
+	if r.limit > 0 && r.BytesRead > r.limit {
+		return n, PayloadTooLarge
+	}
+
+	return n, err
+}